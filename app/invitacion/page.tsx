@@ -0,0 +1,183 @@
+'use client'
+
+import React, { useState, useEffect, Suspense } from 'react';
+import { useSearchParams } from 'next/navigation';
+import Link from 'next/link';
+import { UserPlus, ArrowLeft, Eye, EyeOff } from 'lucide-react';
+import { api } from '@/services/api';
+
+const MIN_PASSWORD_LENGTH = 8;
+
+function InvitacionContent() {
+  const searchParams = useSearchParams();
+  const token = searchParams.get('token');
+
+  const [invitation, setInvitation] = useState<{ email: string; role: string; inviter: string } | null>(null);
+  const [invalid, setInvalid] = useState(false);
+  const [name, setName] = useState('');
+  const [password, setPassword] = useState('');
+  const [confirmPassword, setConfirmPassword] = useState('');
+  const [showPassword, setShowPassword] = useState(false);
+  const [error, setError] = useState('');
+  const [isSubmitting, setIsSubmitting] = useState(false);
+
+  useEffect(() => {
+    if (!token) {
+      setInvalid(true);
+      return;
+    }
+    api.getInvitation(token).then(setInvitation).catch(() => setInvalid(true));
+  }, [token]);
+
+  if (invalid || !token) {
+    return (
+      <div className="min-h-screen bg-gradient-to-br from-blue-50 to-indigo-100 flex items-center justify-center p-4">
+        <div className="bg-white rounded-2xl shadow-xl p-8 w-full max-w-md text-center">
+          <h1 className="text-xl text-gray-800 mb-2">Invitación inválida</h1>
+          <p className="text-gray-600 mb-6">
+            La invitación ha expirado, fue revocada o ya se utilizó. Pide a quien te invitó que te envíe una nueva.
+          </p>
+          <Link href="/" className="inline-flex items-center gap-2 text-indigo-600 hover:text-indigo-700 font-medium">
+            <ArrowLeft className="w-4 h-4" />
+            Iniciar sesión
+          </Link>
+        </div>
+      </div>
+    );
+  }
+
+  if (!invitation) {
+    return (
+      <div className="min-h-screen bg-gradient-to-br from-blue-50 to-indigo-100 flex items-center justify-center">
+        <p className="text-gray-600">Cargando...</p>
+      </div>
+    );
+  }
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setError('');
+    if (password.length < MIN_PASSWORD_LENGTH) {
+      setError(`La contraseña debe tener al menos ${MIN_PASSWORD_LENGTH} caracteres.`);
+      return;
+    }
+    if (password !== confirmPassword) {
+      setError('Las contraseñas no coinciden.');
+      return;
+    }
+    setIsSubmitting(true);
+    try {
+      const response = await api.acceptInvitation(token, name, password);
+      api.storeTokens(response.token, response.refresh_token);
+      // Full reload so the app context loads the new user from the stored token
+      window.location.replace('/dashboard');
+    } catch (err: unknown) {
+      const msg = err instanceof Error ? err.message : 'No se pudo aceptar la invitación.';
+      setError(msg);
+      setIsSubmitting(false);
+    }
+  };
+
+  return (
+    <div className="min-h-screen bg-gradient-to-br from-blue-50 to-indigo-100 flex items-center justify-center p-4">
+      <div className="bg-white rounded-2xl shadow-xl p-8 w-full max-w-md">
+        <div className="flex flex-col items-center mb-8">
+          <div className="w-16 h-16 bg-indigo-600 rounded-full flex items-center justify-center mb-4">
+            <UserPlus className="w-8 h-8 text-white" />
+          </div>
+          <h1 className="text-2xl text-gray-800 text-center">Crea tu cuenta</h1>
+          <p className="text-gray-600 mt-2 text-center text-sm">
+            {invitation.inviter} te invitó a Mellon Harmony como <strong>{invitation.email}</strong>.
+          </p>
+        </div>
+
+        <form onSubmit={handleSubmit} className="space-y-6">
+          <div>
+            <label htmlFor="name" className="block text-sm text-gray-700 mb-2">
+              Nombre completo
+            </label>
+            <input
+              id="name"
+              type="text"
+              value={name}
+              onChange={(e) => setName(e.target.value)}
+              className="w-full px-4 py-3 border border-gray-300 rounded-lg focus:outline-none focus:ring-2 focus:ring-indigo-500"
+              required
+              disabled={isSubmitting}
+            />
+          </div>
+
+          <div>
+            <label htmlFor="password" className="block text-sm text-gray-700 mb-2">
+              Contraseña
+            </label>
+            <div className="relative">
+              <input
+                id="password"
+                type={showPassword ? 'text' : 'password'}
+                value={password}
+                onChange={(e) => setPassword(e.target.value)}
+                className="w-full px-4 py-3 border border-gray-300 rounded-lg focus:outline-none focus:ring-2 focus:ring-indigo-500 pr-10"
+                placeholder="••••••••"
+                required
+                minLength={MIN_PASSWORD_LENGTH}
+                disabled={isSubmitting}
+              />
+              <button
+                type="button"
+                onClick={() => setShowPassword(!showPassword)}
+                className="absolute right-3 top-1/2 -translate-y-1/2 text-gray-500 hover:text-gray-700"
+                aria-label={showPassword ? 'Ocultar contraseña' : 'Mostrar contraseña'}
+              >
+                {showPassword ? <EyeOff className="w-5 h-5" /> : <Eye className="w-5 h-5" />}
+              </button>
+            </div>
+          </div>
+
+          <div>
+            <label htmlFor="confirmPassword" className="block text-sm text-gray-700 mb-2">
+              Confirmar contraseña
+            </label>
+            <input
+              id="confirmPassword"
+              type={showPassword ? 'text' : 'password'}
+              value={confirmPassword}
+              onChange={(e) => setConfirmPassword(e.target.value)}
+              className="w-full px-4 py-3 border border-gray-300 rounded-lg focus:outline-none focus:ring-2 focus:ring-indigo-500"
+              placeholder="••••••••"
+              required
+              minLength={MIN_PASSWORD_LENGTH}
+              disabled={isSubmitting}
+            />
+          </div>
+
+          {error && (
+            <div className="bg-red-50 text-red-600 p-3 rounded-lg text-sm">
+              {error}
+            </div>
+          )}
+
+          <button
+            type="submit"
+            disabled={isSubmitting}
+            className="w-full bg-indigo-600 text-white py-3 rounded-lg hover:bg-indigo-700 transition-colors disabled:opacity-50 disabled:cursor-not-allowed"
+          >
+            {isSubmitting ? 'Creando cuenta...' : 'Aceptar invitación'}
+          </button>
+        </form>
+      </div>
+    </div>
+  );
+}
+
+export default function Invitacion() {
+  return (
+    <Suspense fallback={
+      <div className="min-h-screen bg-gradient-to-br from-blue-50 to-indigo-100 flex items-center justify-center">
+        <p className="text-gray-600">Cargando...</p>
+      </div>
+    }>
+      <InvitacionContent />
+    </Suspense>
+  );
+}
@@ -6,7 +6,7 @@ import Link from 'next/link';
 import { useApp } from '@/context/AppContext';
 import { Loading } from '@/components/Loading';
 import { LogIn, Eye, EyeOff } from 'lucide-react';
-import { isApiUrlConfigured } from '@/services/api';
+import { api, isApiUrlConfigured } from '@/services/api';
 
 export default function Login() {
   const [email, setEmail] = useState('');
@@ -14,6 +14,7 @@ export default function Login() {
   const [showPassword, setShowPassword] = useState(false);
   const [error, setError] = useState('');
   const [apiConfigError, setApiConfigError] = useState('');
+  const [ssoEnabled, setSsoEnabled] = useState(false);
   const { login, user, isLoading } = useApp();
   const router = useRouter();
 
@@ -27,6 +28,13 @@ export default function Login() {
     }
   }, []);
 
+  // Show the SSO button when the backend has OIDC configured, and surface callback errors
+  useEffect(() => {
+    const ssoError = new URLSearchParams(window.location.search).get('sso_error');
+    if (ssoError) setError(ssoError);
+    api.getSsoConfig().then((config) => setSsoEnabled(config.enabled)).catch(() => setSsoEnabled(false));
+  }, []);
+
   useEffect(() => {
     if (!isLoading && user) {
       router.push('/dashboard');
@@ -150,6 +158,15 @@ export default function Login() {
           </button>
         </form>
 
+        {ssoEnabled && (
+          <a
+            href={api.ssoLoginUrl()}
+            className="mt-4 block w-full text-center border border-indigo-600 text-indigo-600 py-3 rounded-lg hover:bg-indigo-50 transition-colors"
+          >
+            Iniciar sesión con SSO
+          </a>
+        )}
+
         <div className="mt-10 pt-6 text-center">
           <p className="text-sm text-gray-600">
             ¿No tienes una cuenta?{' '}
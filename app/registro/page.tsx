@@ -104,6 +104,9 @@ export default function Registro() {
       // Guardar token y redirigir
       if (typeof window !== 'undefined') {
         localStorage.setItem('token', data.token);
+        if (data.refresh_token) {
+          localStorage.setItem('refresh_token', data.refresh_token);
+        }
       }
 
       // Redirigir al dashboard
@@ -6,7 +6,7 @@ import Link from 'next/link';
 import { Lock, ArrowLeft, Eye, EyeOff } from 'lucide-react';
 import { api } from '@/services/api';
 
-const MIN_PASSWORD_LENGTH = 6;
+const MIN_PASSWORD_LENGTH = 8;
 
 function RestablecerContrasenaContent() {
   const router = useRouter();
@@ -99,7 +99,7 @@ function RestablecerContrasenaContent() {
           </div>
           <h1 className="text-2xl text-gray-800 text-center">Nueva contraseña</h1>
           <p className="text-gray-600 mt-2 text-center text-sm">
-            Elige una contraseña de al menos 6 caracteres.
+            Elige una contraseña de al menos 8 caracteres que combine mayúsculas, minúsculas, números o símbolos.
           </p>
         </div>
 
@@ -0,0 +1,22 @@
+'use client'
+
+import { useEffect } from 'react';
+import { Loading } from '@/components/Loading';
+import { api } from '@/services/api';
+
+// Landing page for the single sign-on callback: the backend puts the token pair in the URL fragment.
+export default function SsoCallback() {
+  useEffect(() => {
+    const params = new URLSearchParams(window.location.hash.slice(1));
+    const token = params.get('token');
+    if (!token) {
+      window.location.replace('/?sso_error=' + encodeURIComponent('No se pudo completar el inicio de sesión con SSO'));
+      return;
+    }
+    api.storeTokens(token, params.get('refresh_token') || undefined);
+    // Full reload so the app context loads the signed-in user from the stored token
+    window.location.replace('/dashboard');
+  }, []);
+
+  return <Loading fullScreen message="Iniciando sesión..." />;
+}
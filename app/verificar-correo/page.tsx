@@ -0,0 +1,57 @@
+'use client'
+
+import React, { useState, useEffect, Suspense } from 'react';
+import { useSearchParams } from 'next/navigation';
+import Link from 'next/link';
+import { MailCheck, ArrowLeft } from 'lucide-react';
+import { api } from '@/services/api';
+
+function VerificarCorreoContent() {
+  const searchParams = useSearchParams();
+  const token = searchParams.get('token');
+  const [status, setStatus] = useState<'loading' | 'success' | 'error'>(token ? 'loading' : 'error');
+  const [message, setMessage] = useState('El enlace de verificación no es válido.');
+
+  useEffect(() => {
+    if (!token) return;
+    api.verifyEmail(token)
+      .then((res) => {
+        setMessage(`Confirmamos ${res.email}. Ya puedes recibir correos de tu cuenta.`);
+        setStatus('success');
+      })
+      .catch((err: unknown) => {
+        setMessage(err instanceof Error ? err.message : 'El enlace de verificación ha expirado o no es válido.');
+        setStatus('error');
+      });
+  }, [token]);
+
+  return (
+    <div className="min-h-screen bg-gradient-to-br from-blue-50 to-indigo-100 flex items-center justify-center p-4">
+      <div className="bg-white rounded-2xl shadow-xl p-8 w-full max-w-md text-center">
+        <div className={`w-16 h-16 rounded-full flex items-center justify-center mx-auto mb-4 ${status === 'success' ? 'bg-green-100' : 'bg-indigo-100'}`}>
+          <MailCheck className={`w-8 h-8 ${status === 'success' ? 'text-green-600' : 'text-indigo-600'}`} />
+        </div>
+        <h1 className="text-xl text-gray-800 mb-2">
+          {status === 'loading' ? 'Verificando correo...' : status === 'success' ? 'Correo verificado' : 'No se pudo verificar'}
+        </h1>
+        {status !== 'loading' && <p className="text-gray-600 mb-6">{message}</p>}
+        <Link href="/" className="inline-flex items-center gap-2 text-indigo-600 hover:text-indigo-700 font-medium">
+          <ArrowLeft className="w-4 h-4" />
+          Ir a Mellon Harmony
+        </Link>
+      </div>
+    </div>
+  );
+}
+
+export default function VerificarCorreo() {
+  return (
+    <Suspense fallback={
+      <div className="min-h-screen bg-gradient-to-br from-blue-50 to-indigo-100 flex items-center justify-center">
+        <p className="text-gray-600">Cargando...</p>
+      </div>
+    }>
+      <VerificarCorreoContent />
+    </Suspense>
+  );
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"mellon-harmony-api/internal/config"
+	"mellon-harmony-api/internal/service"
+)
+
+// Copies files from the local upload directory into the storage configured with STORAGE_DRIVER
+// (e.g. before switching a deployment to S3). Stored paths ("uploads/...") stay the same, so no
+// database changes are needed. Files already present in the target are skipped unless -overwrite is set.
+func main() {
+	cfg := config.Load()
+
+	from := flag.String("from", cfg.UploadDir, "local upload directory to copy from")
+	dryRun := flag.Bool("dry-run", false, "list files that would be copied without copying them")
+	overwrite := flag.Bool("overwrite", false, "copy files that already exist in the target storage")
+	flag.Parse()
+
+	if cfg.StorageDriver == "" || cfg.StorageDriver == "local" {
+		log.Fatal("❌ STORAGE_DRIVER is local; set STORAGE_DRIVER=s3 and the S3_* variables for the target storage.")
+	}
+
+	source, err := service.NewLocalStorage(*from)
+	if err != nil {
+		log.Fatalf("Failed to open upload directory: %v", err)
+	}
+	target, err := service.NewStorage(service.StorageConfig{
+		Driver: cfg.StorageDriver,
+		S3: service.S3Config{
+			Endpoint:        cfg.S3Endpoint,
+			Region:          cfg.S3Region,
+			Bucket:          cfg.S3Bucket,
+			AccessKeyID:     cfg.S3AccessKeyID,
+			SecretAccessKey: cfg.S3SecretAccessKey,
+			UseSSL:          cfg.S3UseSSL,
+			Prefix:          cfg.S3Prefix,
+		},
+	})
+	if err != nil {
+		log.Fatalf("Failed to initialize target storage: %v", err)
+	}
+
+	log.Printf("Copying uploads from %s to %s storage...", *from, cfg.StorageDriver)
+	ctx := context.Background()
+	var copied, skipped, failed int
+	err = source.Walk(func(key string) error {
+		if !*overwrite {
+			_, err := target.Stat(ctx, key)
+			if err == nil {
+				skipped++
+				return nil
+			}
+			if !errors.Is(err, service.ErrFileNotFound) {
+				log.Printf("  ✗ %s: %v", key, err)
+				failed++
+				return nil
+			}
+		}
+		if *dryRun {
+			log.Printf("  would copy %s", key)
+			copied++
+			return nil
+		}
+
+		file, err := source.Open(ctx, key)
+		if err != nil {
+			log.Printf("  ✗ %s: %v", key, err)
+			failed++
+			return nil
+		}
+		defer file.Close()
+		if err := target.Put(ctx, key, file, file.Size, file.ContentType); err != nil {
+			log.Printf("  ✗ %s: %v", key, err)
+			failed++
+			return nil
+		}
+		log.Printf("  ✓ %s", key)
+		copied++
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Failed to read upload directory: %v", err)
+	}
+
+	if *dryRun {
+		log.Printf("Dry run: %d to copy, %d already present", copied, skipped)
+		return
+	}
+	log.Printf("✅ Migration complete: %d copied, %d already present, %d failed", copied, skipped, failed)
+	if failed > 0 {
+		log.Fatal("❌ Some files could not be copied; run the command again to retry them.")
+	}
+}
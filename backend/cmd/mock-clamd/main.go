@@ -0,0 +1,124 @@
+// Command mock-clamd is a minimal stand-in for ClamAV's daemon for testing virus scanning locally.
+// It speaks the PING and INSTREAM commands of clamd's TCP protocol and reports any stream that
+// contains the EICAR test string (or MOCK_CLAMD_SIGNATURE) as infected. Never use it in production.
+//
+//	go run ./cmd/mock-clamd           # listens on :3310
+//	SCANNER_DRIVER=clamd CLAMD_ADDRESS=localhost:3310 go run .
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+)
+
+// eicar is the standard antivirus test file (https://www.eicar.org/download-anti-malware-testfile/).
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// maxStreamLength mirrors clamd's default StreamMaxLength.
+const maxStreamLength = 25 * 1024 * 1024
+
+func main() {
+	port := os.Getenv("MOCK_CLAMD_PORT")
+	if port == "" {
+		port = "3310"
+	}
+	signature := os.Getenv("MOCK_CLAMD_SIGNATURE")
+	if signature == "" {
+		signature = eicar
+	}
+
+	listener, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		log.Fatalf("Failed to listen: %v", err)
+	}
+	log.Printf("Mock clamd listening on :%s", port)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Printf("Accept failed: %v", err)
+			continue
+		}
+		go handle(conn, []byte(signature))
+	}
+}
+
+func handle(conn net.Conn, signature []byte) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	// Commands are "zCOMMAND\0" or "nCOMMAND\n"
+	prefix, err := r.ReadByte()
+	if err != nil {
+		return
+	}
+	delim := byte('\n')
+	if prefix == 'z' {
+		delim = 0
+	} else if prefix != 'n' {
+		r.UnreadByte()
+	}
+	command, err := r.ReadString(delim)
+	if err != nil {
+		return
+	}
+	command = strings.TrimSuffix(command, string(delim))
+
+	switch command {
+	case "PING":
+		reply(conn, "PONG", delim)
+	case "INSTREAM":
+		data, err := readStream(r)
+		if err == errStreamTooLong {
+			reply(conn, "INSTREAM size limit exceeded. ERROR", delim)
+			return
+		}
+		if err != nil {
+			return
+		}
+		if bytes.Contains(data, signature) {
+			log.Printf("Scanned %d bytes: infected", len(data))
+			reply(conn, "stream: Eicar-Test-Signature FOUND", delim)
+			return
+		}
+		log.Printf("Scanned %d bytes: clean", len(data))
+		reply(conn, "stream: OK", delim)
+	default:
+		reply(conn, "UNKNOWN COMMAND", delim)
+	}
+}
+
+var errStreamTooLong = errors.New("stream too long")
+
+// readStream reads length-prefixed chunks until the zero-length one.
+func readStream(r io.Reader) ([]byte, error) {
+	var data []byte
+	var size [4]byte
+	for {
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			return nil, err
+		}
+		n := binary.BigEndian.Uint32(size[:])
+		if n == 0 {
+			return data, nil
+		}
+		if len(data)+int(n) > maxStreamLength {
+			return nil, errStreamTooLong
+		}
+		chunk := make([]byte, n)
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return nil, err
+		}
+		data = append(data, chunk...)
+	}
+}
+
+func reply(conn net.Conn, message string, delim byte) {
+	conn.Write(append([]byte(message), delim))
+}
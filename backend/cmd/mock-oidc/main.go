@@ -0,0 +1,243 @@
+// Command mock-oidc is a minimal OpenID Connect provider for testing SSO locally.
+// It accepts any email typed into its login form (or passed as login_hint) and
+// signs ID tokens with a key generated at startup. Never expose it publicly.
+//
+//	go run ./cmd/mock-oidc            # listens on :9000
+//	OIDC_ISSUER_URL=http://localhost:9000 OIDC_CLIENT_ID=mellon-harmony \
+//	OIDC_REDIRECT_URL=http://localhost:8080/api/v1/auth/oidc/callback go run .
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"html/template"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const keyID = "mock-oidc-key"
+
+type authCode struct {
+	clientID      string
+	redirectURI   string
+	email         string
+	name          string
+	nonce         string
+	codeChallenge string
+	expiresAt     time.Time
+}
+
+type provider struct {
+	issuer string
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]authCode
+}
+
+var loginForm = template.Must(template.New("login").Parse(`<!doctype html>
+<html><body style="font-family:sans-serif;max-width:360px;margin:80px auto">
+<h2>Mock OIDC login</h2>
+<form method="post" action="/authorize">
+{{range $k, $v := .Params}}<input type="hidden" name="{{$k}}" value="{{index $v 0}}">{{end}}
+<p><label>Email<br><input name="email" type="email" required autofocus style="width:100%"></label></p>
+<p><label>Nombre<br><input name="name" style="width:100%"></label></p>
+<button type="submit">Iniciar sesión</button>
+</form></body></html>`))
+
+func main() {
+	port := os.Getenv("MOCK_OIDC_PORT")
+	if port == "" {
+		port = "9000"
+	}
+	issuer := os.Getenv("MOCK_OIDC_ISSUER")
+	if issuer == "" {
+		issuer = "http://localhost:" + port
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatalf("Failed to generate signing key: %v", err)
+	}
+	p := &provider{issuer: strings.TrimSuffix(issuer, "/"), key: key, codes: map[string]authCode{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc("/token", p.token)
+	mux.HandleFunc("/jwks", p.jwks)
+
+	log.Printf("Mock OIDC provider listening on :%s (issuer %s)", port, p.issuer)
+	log.Fatal(http.ListenAndServe(":"+port, mux))
+}
+
+func (p *provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                p.issuer,
+		"authorization_endpoint":                p.issuer + "/authorize",
+		"token_endpoint":                        p.issuer + "/token",
+		"jwks_uri":                              p.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+// authorize shows the login form on GET (unless login_hint is given) and issues a code on POST.
+func (p *provider) authorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	params := r.Form
+	if params.Get("response_type") != "code" || params.Get("client_id") == "" || params.Get("redirect_uri") == "" {
+		http.Error(w, "response_type=code, client_id and redirect_uri are required", http.StatusBadRequest)
+		return
+	}
+	if params.Get("code_challenge_method") != "S256" || params.Get("code_challenge") == "" {
+		http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+		return
+	}
+
+	email := params.Get("email")
+	if email == "" {
+		email = params.Get("login_hint")
+	}
+	if email == "" {
+		hidden := url.Values{}
+		for k, v := range params {
+			if k != "email" && k != "name" {
+				hidden[k] = v
+			}
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = loginForm.Execute(w, map[string]interface{}{"Params": hidden})
+		return
+	}
+
+	code := randomString()
+	p.mu.Lock()
+	p.codes[code] = authCode{
+		clientID:      params.Get("client_id"),
+		redirectURI:   params.Get("redirect_uri"),
+		email:         strings.TrimSpace(email),
+		name:          strings.TrimSpace(params.Get("name")),
+		nonce:         params.Get("nonce"),
+		codeChallenge: params.Get("code_challenge"),
+		expiresAt:     time.Now().Add(time.Minute),
+	}
+	p.mu.Unlock()
+
+	redirect, err := url.Parse(params.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	query := redirect.Query()
+	query.Set("code", code)
+	query.Set("state", params.Get("state"))
+	redirect.RawQuery = query.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (p *provider) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	clientID := r.PostForm.Get("client_id")
+	if user, _, ok := r.BasicAuth(); ok {
+		clientID, _ = url.QueryUnescape(user)
+	}
+
+	code := r.PostForm.Get("code")
+	p.mu.Lock()
+	grant, ok := p.codes[code]
+	delete(p.codes, code)
+	p.mu.Unlock()
+
+	if r.PostForm.Get("grant_type") != "authorization_code" || !ok || time.Now().After(grant.expiresAt) ||
+		grant.clientID != clientID || grant.redirectURI != r.PostForm.Get("redirect_uri") {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	challenge := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(challenge[:]) != grant.codeChallenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		return
+	}
+
+	now := time.Now()
+	name := grant.name
+	if name == "" {
+		name = strings.Split(grant.email, "@")[0]
+	}
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            p.issuer,
+		"sub":            grant.email,
+		"aud":            grant.clientID,
+		"email":          grant.email,
+		"email_verified": true,
+		"name":           name,
+		"nonce":          grant.nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+	})
+	idToken.Header["kid"] = keyID
+	signed, err := idToken.SignedString(p.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     signed,
+	})
+}
+
+func (p *provider) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := p.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": keyID,
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+func randomString() string {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatalf("Failed to read random bytes: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
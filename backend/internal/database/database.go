@@ -1,10 +1,12 @@
 package database
 
 import (
+	"errors"
 	"mellon-harmony-api/internal/models"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func Connect(databaseURL string) (*gorm.DB, error) {
@@ -17,7 +19,11 @@ func Connect(databaseURL string) (*gorm.DB, error) {
 }
 
 func Migrate(db *gorm.DB) error {
-	return db.AutoMigrate(
+	// Accounts created before email verification existed are treated as verified once,
+	// when the column is first added; new and changed addresses must be verified.
+	backfillEmailVerified := db.Migrator().HasTable(&models.User{}) && !db.Migrator().HasColumn(&models.User{}, "EmailVerifiedAt")
+
+	if err := db.AutoMigrate(
 		&models.User{},
 		&models.Issue{},
 		&models.Comment{},
@@ -26,5 +32,58 @@ func Migrate(db *gorm.DB) error {
 		&models.Project{},
 		&models.ProjectMember{},
 		&models.Notification{},
-	)
+		&models.Session{},
+		&models.OIDCLoginState{},
+		&models.OIDCLoginCode{},
+		&models.Invitation{},
+		&models.InvitationClient{},
+		&models.APIToken{},
+		&models.Role{},
+		&models.AuditEvent{},
+		&models.File{},
+		&models.UploadSession{},
+	); err != nil {
+		return err
+	}
+
+	if err := migrateSearch(db); err != nil {
+		return err
+	}
+
+	// Built-in roles are only inserted when missing, so permission changes made by admins survive restarts
+	for _, role := range models.BuiltInRoles() {
+		if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&role).Error; err != nil {
+			return err
+		}
+	}
+
+	// comment.moderate came after the built-in roles were seeded, so existing team lead roles lack it
+	if err := grantMissingPermission(db, models.RoleTeamLead, models.PermCommentModerate); err != nil {
+		return err
+	}
+
+	if backfillEmailVerified {
+		if err := db.Exec("UPDATE users SET email_verified_at = created_at WHERE email_verified_at IS NULL").Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// grantMissingPermission adds permission to the role unless it already holds it, so it can run on every start.
+func grantMissingPermission(db *gorm.DB, name models.UserRole, permission string) error {
+	var role models.Role
+	if err := db.Where("name = ?", name).First(&role).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	for _, p := range role.GetPermissions() {
+		if p == permission {
+			return nil
+		}
+	}
+	role.SetPermissions(append(role.GetPermissions(), permission))
+	return db.Save(&role).Error
 }
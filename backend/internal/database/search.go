@@ -0,0 +1,83 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"mellon-harmony-api/internal/models"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// searchVectors are the weighted documents of the full-text search by table: names and titles
+// rank above descriptions and comments. column is one of the indexed columns; rewriting it makes
+// PostgreSQL compute the vector again.
+var searchVectors = []struct{ table, column, document string }{
+	{"issues", "title", "setweight(to_tsvector('%[1]s', coalesce(title, '')), 'A') || setweight(to_tsvector('%[1]s', coalesce(description, '')), 'B')"},
+	{"comments", "text", "setweight(to_tsvector('%[1]s', coalesce(text, '')), 'B')"},
+	{"projects", "name", "setweight(to_tsvector('%[1]s', coalesce(name, '')), 'A') || setweight(to_tsvector('%[1]s', coalesce(description, '')), 'B')"},
+	{"clients", "name", "setweight(to_tsvector('%[1]s', coalesce(name, '')), 'A') || setweight(to_tsvector('%[1]s', coalesce(contact_name, '')), 'B')"},
+}
+
+// migrateSearch sets up the full-text search: the unaccent extension, the models.SearchTextConfig
+// configuration and a generated search_vector column with a GIN index on every searched table.
+// The columns are kept by PostgreSQL, so they are not part of the models. Every step is idempotent.
+// Without the extension the configuration is plain spanish, so searches still work but are accent
+// sensitive; once the extension is available, the next start adds it to the configuration.
+func migrateSearch(db *gorm.DB) error {
+	unaccent := true
+	if err := db.Exec("CREATE EXTENSION IF NOT EXISTS unaccent").Error; err != nil {
+		log.Printf("⚠️  The unaccent extension is not available (%v); full-text search will not ignore accents", err)
+		unaccent = false
+	}
+	for _, statement := range searchStatements(unaccent) {
+		if err := db.Exec(statement).Error; err != nil {
+			return fmt.Errorf("failed to set up full-text search: %w", err)
+		}
+	}
+	return nil
+}
+
+// searchStatements are the statements of migrateSearch after the extension, with the unaccent
+// mapping when the extension is installed. The mapping is applied on every start, not only when the
+// configuration is created, so a configuration created before the extension was available gets it
+// too; the vectors already stored were computed without it and are computed again.
+func searchStatements(unaccent bool) []string {
+	statements := []string{
+		fmt.Sprintf(`DO $$ BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_ts_config WHERE cfgname = '%[1]s') THEN
+				CREATE TEXT SEARCH CONFIGURATION %[1]s (COPY = spanish);
+			END IF;
+		END $$`, models.SearchTextConfig),
+	}
+	if unaccent {
+		var refresh strings.Builder
+		for _, v := range searchVectors {
+			fmt.Fprintf(&refresh, `
+				IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = '%[1]s' AND column_name = 'search_vector') THEN
+					UPDATE %[1]s SET %[2]s = %[2]s;
+				END IF;`, v.table, v.column)
+		}
+		statements = append(statements, fmt.Sprintf(`DO $$
+		DECLARE
+			stale boolean;
+		BEGIN
+			stale := NOT EXISTS (
+				SELECT 1 FROM pg_ts_config_map m
+				JOIN pg_ts_config c ON c.oid = m.mapcfg
+				JOIN pg_ts_dict d ON d.oid = m.mapdict
+				WHERE c.cfgname = '%[1]s' AND d.dictname = 'unaccent');
+			ALTER TEXT SEARCH CONFIGURATION %[1]s ALTER MAPPING FOR hword, hword_part, word WITH unaccent, spanish_stem;
+			IF stale THEN%[2]s
+			END IF;
+		END $$`, models.SearchTextConfig, refresh.String()))
+	}
+	for _, v := range searchVectors {
+		statements = append(statements,
+			fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (%s) STORED",
+				v.table, fmt.Sprintf(v.document, models.SearchTextConfig)),
+			fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%[1]s_search ON %[1]s USING GIN (search_vector)", v.table),
+		)
+	}
+	return statements
+}
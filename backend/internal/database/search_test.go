@@ -0,0 +1,120 @@
+package database
+
+import (
+	"errors"
+	"mellon-harmony-api/internal/models"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// recordingDB returns a database that runs nothing and records the statements executed on it.
+// Statements containing one of failing return an error.
+func recordingDB(t *testing.T, failing ...string) (*gorm.DB, *[]string) {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=127.0.0.1 port=1"}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+		Logger:               logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var executed []string
+	err = db.Callback().Raw().After("gorm:raw").Register("test:record", func(tx *gorm.DB) {
+		statement := tx.Statement.SQL.String()
+		executed = append(executed, statement)
+		for _, part := range failing {
+			if strings.Contains(statement, part) {
+				tx.AddError(errors.New("permission denied"))
+			}
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, &executed
+}
+
+const unaccentMapping = "ALTER MAPPING FOR hword, hword_part, word WITH unaccent, spanish_stem"
+
+func TestMigrateSearch(t *testing.T) {
+	tests := []struct {
+		name         string
+		failing      []string
+		wantMapping  bool
+		wantErr      bool
+		wantExecuted int
+	}{
+		// extension, configuration, mapping, then a column and an index per table
+		{"with unaccent", nil, true, false, 3 + 2*len(searchVectors)},
+		{"without unaccent", []string{"CREATE EXTENSION"}, false, false, 2 + 2*len(searchVectors)},
+		{"mapping fails", []string{"ALTER MAPPING"}, true, true, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, executed := recordingDB(t, tt.failing...)
+			err := migrateSearch(db)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("migrateSearch = %v, want error %v", err, tt.wantErr)
+			}
+			if len(*executed) != tt.wantExecuted {
+				t.Fatalf("executed %d statements, want %d:\n%s", len(*executed), tt.wantExecuted, strings.Join(*executed, "\n"))
+			}
+			all := strings.Join(*executed, "\n")
+			if mapped := strings.Contains(all, unaccentMapping); mapped != tt.wantMapping {
+				t.Errorf("unaccent mapping applied = %v, want %v", mapped, tt.wantMapping)
+			}
+		})
+	}
+}
+
+func TestSearchStatements(t *testing.T) {
+	statements := searchStatements(true)
+	create := statements[0]
+	if !strings.Contains(create, "IF NOT EXISTS (SELECT 1 FROM pg_ts_config WHERE cfgname = '"+models.SearchTextConfig+"')") ||
+		strings.Contains(create, "ALTER MAPPING") {
+		t.Errorf("the configuration is not created once, without the mapping:\n%s", create)
+	}
+
+	// The mapping is not inside the creation guard, so it is applied on every start
+	mapping := statements[1]
+	if !strings.Contains(mapping, "ALTER TEXT SEARCH CONFIGURATION "+models.SearchTextConfig+" "+unaccentMapping) {
+		t.Errorf("mapping statement:\n%s", mapping)
+	}
+	stale := strings.Index(mapping, "IF stale THEN")
+	if stale < 0 || strings.Index(mapping, "ALTER TEXT SEARCH") > stale {
+		t.Errorf("the mapping must be applied before, and regardless of, the stale check:\n%s", mapping)
+	}
+	// Vectors stored without unaccent are computed again, on tables that have them
+	for _, v := range searchVectors {
+		refresh := "UPDATE " + v.table + " SET " + v.column + " = " + v.column
+		if i := strings.Index(mapping, refresh); i < stale {
+			t.Errorf("%s: missing %q after the stale check", v.table, refresh)
+		}
+		if !strings.Contains(mapping, "table_name = '"+v.table+"' AND column_name = 'search_vector'") {
+			t.Errorf("%s: refreshed without checking the column exists", v.table)
+		}
+		if !strings.Contains(v.document, v.column) {
+			t.Errorf("%s: %s is not part of the search vector", v.table, v.column)
+		}
+	}
+
+	for i, v := range searchVectors {
+		column, index := statements[2+2*i], statements[3+2*i]
+		if !strings.HasPrefix(column, "ALTER TABLE "+v.table+" ADD COLUMN IF NOT EXISTS search_vector") ||
+			!strings.Contains(column, "to_tsvector('"+models.SearchTextConfig+"'") || strings.Contains(column, "%") {
+			t.Errorf("%s column: %s", v.table, column)
+		}
+		if index != "CREATE INDEX IF NOT EXISTS idx_"+v.table+"_search ON "+v.table+" USING GIN (search_vector)" {
+			t.Errorf("%s index: %s", v.table, index)
+		}
+	}
+
+	if without := searchStatements(false); len(without) != len(statements)-1 || strings.Contains(strings.Join(without, "\n"), "ALTER MAPPING") {
+		t.Errorf("statements without unaccent:\n%s", strings.Join(without, "\n"))
+	}
+}
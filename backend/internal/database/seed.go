@@ -95,12 +95,14 @@ func SeedUsers(db *gorm.DB) error {
 			return err
 		}
 
-		// Create user
+		// Create user (seed accounts use fixture addresses, so they start verified)
+		verifiedAt := time.Now()
 		user := &models.User{
-			Name:     u.name,
-			Email:    u.email,
-			Password: string(hashedPassword),
-			Role:     u.role,
+			Name:            u.name,
+			Email:           u.email,
+			Password:        string(hashedPassword),
+			Role:            u.role,
+			EmailVerifiedAt: &verifiedAt,
 		}
 
 		if err := userRepo.Create(user); err != nil {
@@ -824,7 +826,7 @@ func SeedIssues(db *gorm.DB) error {
 
 	for _, i := range issues {
 		// Check if issue already exists
-		existingIssues, err := issueRepo.GetAll(map[string]interface{}{})
+		existingIssues, err := issueRepo.GetAll(repository.IssueFilter{})
 		if err == nil {
 			exists := false
 			for _, existing := range existingIssues {
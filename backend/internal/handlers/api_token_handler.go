@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"errors"
+	"mellon-harmony-api/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type APITokenHandler struct {
+	apiTokenService service.APITokenService
+}
+
+func NewAPITokenHandler(apiTokenService service.APITokenService) *APITokenHandler {
+	return &APITokenHandler{
+		apiTokenService: apiTokenService,
+	}
+}
+
+type CreateAPITokenRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+func apiTokenErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrAPITokenNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrInvalidAPITokenScope), errors.Is(err, service.ErrInvalidAPITokenExpiry), errors.Is(err, service.ErrTooManyAPITokens):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// CreateToken issues a personal access token. The plain token is only ever returned here.
+func (h *APITokenHandler) CreateToken(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req CreateAPITokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, plain, err := h.apiTokenService.CreateToken(userID, req.Name, req.Scopes, req.ExpiresInDays, auditMeta(c))
+	if err != nil {
+		c.JSON(apiTokenErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"token":     plain,
+		"api_token": token,
+	})
+}
+
+// ListTokens returns the caller's tokens that have not been revoked (expired ones included).
+func (h *APITokenHandler) ListTokens(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	tokens, err := h.apiTokenService.ListTokens(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// RevokeToken stops one of the caller's tokens from working immediately.
+func (h *APITokenHandler) RevokeToken(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	tokenID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token ID"})
+		return
+	}
+
+	if err := h.apiTokenService.RevokeToken(userID, tokenID, auditMeta(c)); err != nil {
+		c.JSON(apiTokenErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Token revoked"})
+}
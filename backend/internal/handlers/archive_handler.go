@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"mellon-harmony-api/internal/models"
+	"mellon-harmony-api/internal/repository"
+	"mellon-harmony-api/internal/service"
+	"mime"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ArchiveHandler streams ZIP archives of attachments. Only tasks the caller may access (see
+// IssueService.CanAccessIssue) are included.
+type ArchiveHandler struct {
+	issueService service.IssueService
+	fileService  *service.FileService
+	userRepo     repository.UserRepository
+	projectRepo  repository.ProjectRepository
+	clientRepo   repository.ClientRepository
+}
+
+func NewArchiveHandler(issueService service.IssueService, fileService *service.FileService, userRepo repository.UserRepository, projectRepo repository.ProjectRepository, clientRepo repository.ClientRepository) *ArchiveHandler {
+	return &ArchiveHandler{
+		issueService: issueService,
+		fileService:  fileService,
+		userRepo:     userRepo,
+		projectRepo:  projectRepo,
+		clientRepo:   clientRepo,
+	}
+}
+
+// DownloadIssueAttachments streams the attachments of an issue and its comments.
+func (h *ArchiveHandler) DownloadIssueAttachments(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid issue ID"})
+		return
+	}
+	currentUser, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	issue, err := h.issueService.GetIssueForUser(id, currentUser)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Issue not found"})
+		return
+	}
+	h.writeArchive(c, issue.Title, service.AttachmentArchiveEntries([]models.Issue{*issue}, false))
+}
+
+// DownloadProjectAttachments streams the attachments of a project's tasks, in a folder per task.
+func (h *ArchiveHandler) DownloadProjectAttachments(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+	currentUser, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	project, err := h.projectRepo.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return
+	}
+	issues, err := h.issueService.GetAttachmentsForUser(repository.IssueFilter{ProjectIDs: []uuid.UUID{project.ID}}, currentUser)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// Projects the user has no access to look the same as unknown ones
+	if len(issues) == 0 && !h.issueService.CanFileIssueUnder(currentUser, &project.ID, nil) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return
+	}
+	h.writeArchive(c, project.Name, service.AttachmentArchiveEntries(issues, false))
+}
+
+// DownloadClientAttachments streams the attachments of a client's projects for a Planner period
+// (month and year query params, as for reports), in a folder per project and task.
+func (h *ArchiveHandler) DownloadClientAttachments(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client ID"})
+		return
+	}
+	month, year, ok := planningPeriod(c)
+	if !ok {
+		return
+	}
+	currentUser, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	client, err := h.clientRepo.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Client not found"})
+		return
+	}
+	projects, err := h.projectRepo.GetByClientIDAndMonthYear(client.ID, month, year)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var issues []models.Issue
+	if len(projects) > 0 {
+		projectIDs := make([]uuid.UUID, len(projects))
+		for i := range projects {
+			projectIDs[i] = projects[i].ID
+		}
+		issues, err = h.issueService.GetAttachmentsForUser(repository.IssueFilter{ProjectIDs: projectIDs}, currentUser)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	// Clients the user has no access to look the same as unknown ones
+	if len(issues) == 0 && !h.issueService.CanFileIssueUnder(currentUser, nil, &client.ID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Client not found"})
+		return
+	}
+	h.writeArchive(c, fmt.Sprintf("%s %d-%02d", client.Name, year, month), service.AttachmentArchiveEntries(issues, true))
+}
+
+func (h *ArchiveHandler) currentUser(c *gin.Context) (*models.User, bool) {
+	currentUser, err := GetCurrentUserFromDB(c, h.userRepo)
+	if err != nil || currentUser == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuario no encontrado"})
+		return nil, false
+	}
+	return currentUser, true
+}
+
+// writeArchive streams the ZIP as a download named after title. Once streaming started errors can
+// only be logged; the client gets a truncated archive.
+func (h *ArchiveHandler) writeArchive(c *gin.Context, title string, entries []service.ArchiveEntry) {
+	if len(entries) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No attachments found"})
+		return
+	}
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": title + ".zip"}))
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+	if err := h.fileService.WriteArchive(c.Request.Context(), c.Writer, entries); err != nil {
+		log.Printf("Failed to stream attachment archive %q: %v", title, err)
+	}
+}
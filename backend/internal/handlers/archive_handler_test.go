@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"mellon-harmony-api/internal/models"
+	"mellon-harmony-api/internal/repository"
+	"mellon-harmony-api/internal/service"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// archiveIssueService returns the visible issues of a project and lets users file issues only
+// under the projects in allowed.
+type archiveIssueService struct {
+	service.IssueService
+	visible map[uuid.UUID][]models.Issue
+	allowed map[uuid.UUID]bool
+}
+
+func (s *archiveIssueService) GetAttachmentsForUser(filter repository.IssueFilter, user *models.User) ([]models.Issue, error) {
+	var issues []models.Issue
+	for _, projectID := range filter.ProjectIDs {
+		issues = append(issues, s.visible[projectID]...)
+	}
+	return issues, nil
+}
+
+func (s *archiveIssueService) CanFileIssueUnder(user *models.User, projectID, clientID *uuid.UUID) bool {
+	return projectID != nil && s.allowed[*projectID]
+}
+
+type memoryProjectRepository struct {
+	repository.ProjectRepository
+	projects map[uuid.UUID]*models.Project
+	members  map[uuid.UUID][]uuid.UUID
+}
+
+func (r *memoryProjectRepository) GetByID(id uuid.UUID) (*models.Project, error) {
+	project, ok := r.projects[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return project, nil
+}
+
+func (r *memoryProjectRepository) IsMember(projectID, userID uuid.UUID) (bool, error) {
+	for _, member := range r.members[projectID] {
+		if member == userID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func TestArchiveHandlerDownloadProjectAttachmentsAccess(t *testing.T) {
+	user := &models.User{Role: models.RoleUser}
+	users := newMemoryUserRepository(user)
+	member, outsider, sharedTask := &models.Project{ID: uuid.New()}, &models.Project{ID: uuid.New()}, &models.Project{ID: uuid.New()}
+	projects := &memoryProjectRepository{projects: map[uuid.UUID]*models.Project{member.ID: member, outsider.ID: outsider, sharedTask.ID: sharedTask}}
+	issues := &archiveIssueService{
+		// On sharedTask the user only sees a task assigned to them, without uploads
+		visible: map[uuid.UUID][]models.Issue{sharedTask.ID: {{Title: "Logo"}}},
+		allowed: map[uuid.UUID]bool{member.ID: true},
+	}
+	h := NewArchiveHandler(issues, nil, users, projects, nil)
+
+	tests := []struct {
+		name      string
+		projectID uuid.UUID
+		wantError string
+	}{
+		{"unknown project", uuid.New(), "Project not found"},
+		{"project without access", outsider.ID, "Project not found"},
+		{"member, no attachments", member.ID, "No attachments found"},
+		{"visible task, no attachments", sharedTask.ID, "No attachments found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := "/projects/" + tt.projectID.String() + "/attachments.zip"
+			w := serve(h.DownloadProjectAttachments, user, http.MethodGet, path, "/projects/:id/attachments.zip", "")
+			if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), tt.wantError) {
+				t.Errorf("DownloadProjectAttachments = %d %s, want 404 %q", w.Code, w.Body, tt.wantError)
+			}
+		})
+	}
+}
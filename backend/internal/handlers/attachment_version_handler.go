@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"errors"
+	"mellon-harmony-api/internal/models"
+	"mellon-harmony-api/internal/repository"
+	"mellon-harmony-api/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// AttachmentVersionHandler manages the versions of a task's uploaded attachments. Anyone who can
+// access the task (see IssueService.CanAccessIssue) can upload and restore versions.
+type AttachmentVersionHandler struct {
+	issueService service.IssueService
+	urlSigner    *service.FileURLSigner
+	userRepo     repository.UserRepository
+}
+
+func NewAttachmentVersionHandler(issueService service.IssueService, urlSigner *service.FileURLSigner, userRepo repository.UserRepository) *AttachmentVersionHandler {
+	return &AttachmentVersionHandler{
+		issueService: issueService,
+		urlSigner:    urlSigner,
+		userRepo:     userRepo,
+	}
+}
+
+func attachmentVersionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrAttachmentNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrFileScanPending):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrFileInfected), errors.Is(err, service.ErrFileNotScanned):
+		return http.StatusForbidden
+	}
+	return fileErrorStatus(err)
+}
+
+// ListVersions returns the versions of an attachment, latest first.
+func (h *AttachmentVersionHandler) ListVersions(c *gin.Context) {
+	issue, fileID, _, ok := h.attachmentRequest(c)
+	if !ok {
+		return
+	}
+	versions, err := h.issueService.AttachmentVersions(issue, fileID)
+	if errors.Is(err, service.ErrAttachmentNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	response := make([]gin.H, len(versions))
+	for i := range versions {
+		response[i] = fileVersionResponse(h.urlSigner, &versions[i])
+		response[i]["current"] = i == 0
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// UploadVersion stores the uploaded file as the new version of an attachment and returns the issue.
+func (h *AttachmentVersionHandler) UploadVersion(c *gin.Context) {
+	issue, fileID, currentUser, ok := h.attachmentRequest(c)
+	if !ok {
+		return
+	}
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file provided: " + err.Error()})
+		return
+	}
+	body, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer body.Close()
+
+	upload := service.Upload{Name: file.Filename, Size: file.Size, Body: body}
+	updated, err := h.issueService.AddAttachmentVersion(issue, fileID, upload, currentUser.ID, auditMeta(c))
+	if err != nil {
+		c.JSON(attachmentVersionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, signAttachmentResponse(h.urlSigner, h.issueService, updated.ToResponse()))
+}
+
+// RestoreVersion makes a copy of a previous version the current one and returns the issue.
+func (h *AttachmentVersionHandler) RestoreVersion(c *gin.Context) {
+	issue, fileID, currentUser, ok := h.attachmentRequest(c)
+	if !ok {
+		return
+	}
+	versionID, err := uuid.Parse(c.Param("versionId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version ID"})
+		return
+	}
+	updated, err := h.issueService.RestoreAttachmentVersion(issue, fileID, versionID, currentUser.ID, auditMeta(c))
+	if err != nil {
+		c.JSON(attachmentVersionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, signAttachmentResponse(h.urlSigner, h.issueService, updated.ToResponse()))
+}
+
+// attachmentRequest parses the issue and file IDs and loads the issue for the current user.
+func (h *AttachmentVersionHandler) attachmentRequest(c *gin.Context) (*models.Issue, uuid.UUID, *models.User, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid issue ID"})
+		return nil, uuid.Nil, nil, false
+	}
+	fileID, err := uuid.Parse(c.Param("fileId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file ID"})
+		return nil, uuid.Nil, nil, false
+	}
+	currentUser, err := GetCurrentUserFromDB(c, h.userRepo)
+	if err != nil || currentUser == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuario no encontrado"})
+		return nil, uuid.Nil, nil, false
+	}
+	issue, err := h.issueService.GetIssueForUser(id, currentUser)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Issue not found"})
+		return nil, uuid.Nil, nil, false
+	}
+	return issue, fileID, currentUser, true
+}
+
+// fileVersionResponse describes a version of an attachment like a saved upload, with who uploaded it and when.
+func fileVersionResponse(urlSigner *service.FileURLSigner, version *models.File) gin.H {
+	response := fileResponse(urlSigner, version)
+	response["version"] = version.Version
+	response["uploaded_by"] = version.UploadedBy
+	response["created_at"] = version.CreatedAt
+	return response
+}
@@ -2,9 +2,11 @@ package handlers
 
 import (
 	"errors"
+	"math"
 	"mellon-harmony-api/internal/models"
 	"mellon-harmony-api/internal/service"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -13,16 +15,18 @@ import (
 type AuthHandler struct {
 	authService service.AuthService
 	userService service.UserService
+	urlSigner   *service.FileURLSigner
 }
 
-func NewAuthHandler(authService service.AuthService) *AuthHandler {
-	return &AuthHandler{authService: authService}
+func NewAuthHandler(authService service.AuthService, urlSigner *service.FileURLSigner) *AuthHandler {
+	return &AuthHandler{authService: authService, urlSigner: urlSigner}
 }
 
-func NewAuthHandlerWithUserService(authService service.AuthService, userService service.UserService) *AuthHandler {
+func NewAuthHandlerWithUserService(authService service.AuthService, userService service.UserService, urlSigner *service.FileURLSigner) *AuthHandler {
 	return &AuthHandler{
 		authService: authService,
 		userService: userService,
+		urlSigner:   urlSigner,
 	}
 }
 
@@ -34,7 +38,7 @@ type LoginRequest struct {
 type RegisterRequest struct {
 	Name     string          `json:"name" binding:"required,max=255"`
 	Email    string          `json:"email" binding:"required,email,max=255"`
-	Password string          `json:"password" binding:"required,min=6,max=500"`
+	Password string          `json:"password" binding:"required,max=500"`
 	Role     models.UserRole `json:"role"`
 }
 
@@ -44,7 +48,61 @@ type ForgotPasswordRequest struct {
 
 type ResetPasswordRequest struct {
 	Token    string `json:"token" binding:"required,max=500"`
-	Password string `json:"password" binding:"required,min=6,max=500"`
+	Password string `json:"password" binding:"required,max=500"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required,max=500"`
+	Password        string `json:"password" binding:"required,max=500"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required,max=500"`
+}
+
+// sessionMeta captures the device information stored on a session.
+func sessionMeta(c *gin.Context) models.SessionMeta {
+	return models.SessionMeta{
+		UserAgent: c.Request.UserAgent(),
+		IPAddress: c.ClientIP(),
+		RequestID: c.GetString("request_id"),
+	}
+}
+
+// tokenResponse builds the JSON body returned whenever a new token pair is issued.
+func tokenResponse(tokens *service.TokenPair, user *models.User) gin.H {
+	return gin.H{
+		"token":                    tokens.AccessToken,
+		"expires_at":               tokens.AccessExpiresAt,
+		"refresh_token":            tokens.RefreshToken,
+		"refresh_token_expires_at": tokens.RefreshExpiresAt,
+		"user":                     user,
+	}
+}
+
+// respondIfLocked answers 429 with Retry-After when err is an account lockout.
+func respondIfLocked(c *gin.Context, err error) bool {
+	var locked *service.AccountLockedError
+	if !errors.As(err, &locked) {
+		return false
+	}
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(locked.RetryAfter().Seconds()))))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": locked.Error(), "locked_until": locked.Until})
+	return true
+}
+
+// respondIfPasswordPolicy answers 400 with the list of violated rules when err is a password policy error.
+func respondIfPasswordPolicy(c *gin.Context, err error) bool {
+	var policyErr *service.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":      policyErr.Error(),
+		"code":       "password_policy",
+		"violations": policyErr.Violations,
+	})
+	return true
 }
 
 func (h *AuthHandler) Login(c *gin.Context) {
@@ -54,16 +112,53 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	token, user, err := h.authService.Login(req.Email, req.Password)
+	result, user, err := h.authService.Login(req.Email, req.Password, sessionMeta(c))
 	if err != nil {
+		if respondIfLocked(c, err) {
+			return
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"token": token,
-		"user":  user,
-	})
+	respondLoginResult(c, h.urlSigner, http.StatusOK, result, user)
+}
+
+// respondLoginResult sends the tokens of a completed login or, when a second step is needed, the
+// challenge token the client must send to /auth/2fa/verify, both with the given status.
+func respondLoginResult(c *gin.Context, urlSigner *service.FileURLSigner, status int, result *service.LoginResult, user *models.User) {
+	if result.Tokens == nil {
+		c.JSON(status, gin.H{
+			"two_factor_required":       true,
+			"two_factor_setup_required": result.TwoFactorSetupRequired,
+			"challenge_token":           result.ChallengeToken,
+		})
+		return
+	}
+	c.JSON(status, signFileURLs(urlSigner, tokenResponse(result.Tokens, user)))
+}
+
+// Refresh exchanges a refresh token for a new access token. The refresh token is rotated:
+// the one sent is no longer valid and the response carries its replacement.
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, user, err := h.authService.RefreshTokens(req.RefreshToken, sessionMeta(c))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRefreshToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		return
+	}
+
+	user.Password = ""
+	c.JSON(http.StatusOK, signFileURLs(h.urlSigner, tokenResponse(tokens, user)))
 }
 
 func (h *AuthHandler) Register(c *gin.Context) {
@@ -79,20 +174,24 @@ func (h *AuthHandler) Register(c *gin.Context) {
 
 	user, err := h.authService.Register(req.Name, req.Email, req.Password, req.Role)
 	if err != nil {
+		if errors.Is(err, service.ErrRegistrationDisabled) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		if respondIfPasswordPolicy(c, err) {
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	token, err := h.authService.GenerateToken(user)
+	tokens, err := h.authService.IssueTokens(user, sessionMeta(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"token": token,
-		"user":  user,
-	})
+	c.JSON(http.StatusCreated, signFileURLs(h.urlSigner, tokenResponse(tokens, user)))
 }
 
 func (h *AuthHandler) GetMe(c *gin.Context) {
@@ -115,7 +214,7 @@ func (h *AuthHandler) GetMe(c *gin.Context) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 			return
 		}
-		c.JSON(http.StatusOK, user)
+		c.JSON(http.StatusOK, signFileURLs(h.urlSigner, user))
 		return
 	}
 
@@ -126,12 +225,89 @@ func (h *AuthHandler) GetMe(c *gin.Context) {
 	})
 }
 
+// Logout revokes the current session: its refresh token and any access token issued for it stop working.
 func (h *AuthHandler) Logout(c *gin.Context) {
-	// In a real implementation, you might want to blacklist the token
-	// For now, we'll just return success
+	sessionID, err := uuid.Parse(c.GetString("session_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session not found in context"})
+		return
+	}
+
+	if err := h.authService.Logout(sessionID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
 }
 
+// ListSessions returns every device currently signed in to the caller's account.
+func (h *AuthHandler) ListSessions(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	sessions, err := h.authService.ListSessions(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	currentSessionID := c.GetString("session_id")
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID.String() == currentSessionID
+	}
+	c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeSession signs out one of the caller's sessions (e.g. a lost phone).
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	sessionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	if err := h.authService.RevokeSession(userID, sessionID); err != nil {
+		if errors.Is(err, service.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// RevokeOtherSessions signs out every session of the caller except the current one.
+func (h *AuthHandler) RevokeOtherSessions(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	sessionID, err := uuid.Parse(c.GetString("session_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session not found in context"})
+		return
+	}
+
+	if err := h.authService.RevokeOtherSessions(userID, sessionID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Other sessions revoked"})
+}
+
 func (h *AuthHandler) ForgotPassword(c *gin.Context) {
 	var req ForgotPasswordRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -158,6 +334,9 @@ func (h *AuthHandler) ResetPassword(c *gin.Context) {
 	}
 	err := h.authService.ResetPassword(req.Token, req.Password)
 	if err != nil {
+		if respondIfPasswordPolicy(c, err) {
+			return
+		}
 		if errors.Is(err, service.ErrInvalidResetToken) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
@@ -167,3 +346,36 @@ func (h *AuthHandler) ResetPassword(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Contraseña actualizada. Ya puedes iniciar sesión."})
 }
+
+// ChangePassword sets a new password for the signed-in user; other sessions are signed out.
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	sessionID, err := uuid.Parse(c.GetString("session_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session not found in context"})
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.userService.UpdatePassword(userID, req.CurrentPassword, req.Password, sessionID); err != nil {
+		if respondIfPasswordPolicy(c, err) {
+			return
+		}
+		if errors.Is(err, service.ErrWrongCurrentPassword) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudo actualizar la contraseña"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Contraseña actualizada"})
+}
@@ -2,8 +2,11 @@ package handlers
 
 import (
 	"errors"
+	"log"
 	"mellon-harmony-api/internal/models"
 	"mellon-harmony-api/internal/repository"
+	"mellon-harmony-api/internal/service"
+	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -31,3 +34,49 @@ func GetCurrentUserFromDB(c *gin.Context, userRepo repository.UserRepository) (*
 	}
 	return user, nil
 }
+
+// auditMeta identifies the caller and the request for the audit log.
+func auditMeta(c *gin.Context) models.AuditMeta {
+	meta := models.AuditMeta{
+		ActorRole: c.GetString("user_role"),
+		IPAddress: c.ClientIP(),
+		RequestID: c.GetString("request_id"),
+	}
+	if userID, err := uuid.Parse(c.GetString("user_id")); err == nil {
+		meta.ActorID = &userID
+	}
+	return meta
+}
+
+// requirePermission loads the current user and responds 401/403 unless their role grants permission.
+// message is the 403 error shown to the user. Returns the user and whether the handler may continue.
+func requirePermission(c *gin.Context, userRepo repository.UserRepository, perms service.PermissionService, permission, message string) (*models.User, bool) {
+	currentUser, err := GetCurrentUserFromDB(c, userRepo)
+	if err != nil || currentUser == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuario no encontrado"})
+		return nil, false
+	}
+	if !perms.HasPermission(currentUser, permission) {
+		c.JSON(http.StatusForbidden, gin.H{"error": message})
+		return nil, false
+	}
+	return currentUser, true
+}
+
+// notifySupervisors notifies every user whose role grants models.PermActivityNotify, except skipID.
+func notifySupervisors(userRepo repository.UserRepository, perms service.PermissionService, notifications service.NotificationService, skipID uuid.UUID, title, message string, relatedID *uuid.UUID) {
+	allUsers, err := userRepo.GetAll()
+	if err != nil {
+		log.Printf("Failed to load users for notifications: %v", err)
+		return
+	}
+	for i := range allUsers {
+		user := &allUsers[i]
+		if user.ID == skipID || !perms.HasPermission(user, models.PermActivityNotify) {
+			continue
+		}
+		if err := notifications.CreateNotification(user.ID, models.NotificationTypeStatus, title, message, relatedID); err != nil {
+			log.Printf("Failed to notify %s: %v", user.ID, err)
+		}
+	}
+}
@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"log"
 	"mellon-harmony-api/internal/models"
 	"mellon-harmony-api/internal/repository"
 	"mellon-harmony-api/internal/service"
@@ -20,33 +19,44 @@ type ClientHandler struct {
 	userRepo            repository.UserRepository
 	notificationService service.NotificationService
 	clientMemberRepo    repository.ClientMemberRepository
+	permissionService   service.PermissionService
+	urlSigner           *service.FileURLSigner
 }
 
-func NewClientHandler(clientService service.ClientService, userRepo repository.UserRepository, notificationService service.NotificationService, clientMemberRepo repository.ClientMemberRepository) *ClientHandler {
+func NewClientHandler(clientService service.ClientService, userRepo repository.UserRepository, notificationService service.NotificationService, clientMemberRepo repository.ClientMemberRepository, permissionService service.PermissionService, urlSigner *service.FileURLSigner) *ClientHandler {
 	return &ClientHandler{
 		clientService:       clientService,
 		userRepo:            userRepo,
 		notificationService: notificationService,
 		clientMemberRepo:    clientMemberRepo,
+		permissionService:   permissionService,
+		urlSigner:           urlSigner,
 	}
 }
 
-func (h *ClientHandler) canManageClient(clientID, userID uuid.UUID, role string) bool {
-	if role == string(models.RoleAdmin) || role == string(models.RoleTeamLead) {
+// canManageClient allows members of the client's team, and anyone whose role grants permission for every client.
+func (h *ClientHandler) canManageClient(clientID uuid.UUID, user *models.User, permission string) bool {
+	if h.permissionService.HasPermission(user, permission) {
 		return true
 	}
-	exists, _ := h.clientMemberRepo.Exists(clientID, userID)
+	exists, _ := h.clientMemberRepo.Exists(clientID, user.ID)
 	return exists
 }
 
 func (h *ClientHandler) GetClients(c *gin.Context) {
-	clients, err := h.clientService.GetAllClients()
+	opts, err := listOptions(c, clientSortColumns, viewFull)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	clients, total, err := h.clientService.GetAllClients(opts)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, clients)
+	setListHeaders(c, opts, total)
+	c.JSON(http.StatusOK, signFileURLs(h.urlSigner, clients))
 }
 
 func (h *ClientHandler) GetClient(c *gin.Context) {
@@ -62,7 +72,7 @@ func (h *ClientHandler) GetClient(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, client)
+	c.JSON(http.StatusOK, signFileURLs(h.urlSigner, client))
 }
 
 type CreateClientRequest struct {
@@ -82,13 +92,7 @@ func (h *ClientHandler) CreateClient(c *gin.Context) {
 	userID, _ := uuid.Parse(userIDStr.(string))
 
 	// Check role from database (so role changes take effect without re-login)
-	currentUser, err := GetCurrentUserFromDB(c, h.userRepo)
-	if err != nil || currentUser == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuario no encontrado"})
-		return
-	}
-	if currentUser.Role != models.RoleAdmin && currentUser.Role != models.RoleTeamLead {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Solo administradores y líderes de equipo pueden crear clientes"})
+	if _, ok := requirePermission(c, h.userRepo, h.permissionService, models.PermClientCreate, "No tienes permiso para crear clientes"); !ok {
 		return
 	}
 
@@ -98,6 +102,10 @@ func (h *ClientHandler) CreateClient(c *gin.Context) {
 		return
 	}
 
+	if req.Logo != nil {
+		logo := models.StripFileURLSignature(*req.Logo)
+		req.Logo = &logo
+	}
 	client := &models.Client{
 		Name:         req.Name,
 		Description:  req.Description,
@@ -111,37 +119,26 @@ func (h *ClientHandler) CreateClient(c *gin.Context) {
 		CreatedBy:    userID,
 	}
 
-	if err := h.clientService.CreateClient(client); err != nil {
+	if err := h.clientService.CreateClient(client, auditMeta(c)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Notify all admins and team leads about new client (except creator)
+	// Notify supervisors about new client (except creator)
 	if h.notificationService != nil {
 		go func() {
-			allUsers, err := h.userRepo.GetAll()
-			if err == nil {
-				creator, _ := h.userRepo.GetByID(userID)
-				creatorName := "Sistema"
-				if creator != nil {
-					creatorName = creator.Name
-				}
-				clientID := &client.ID
-				title := "Nuevo cliente creado: " + client.Name
-				message := creatorName + " ha creado un nuevo cliente: \"" + client.Name + "\""
-				for _, user := range allUsers {
-					// Notify admins and team leads, but not the creator
-					if (user.Role == models.RoleAdmin || user.Role == models.RoleTeamLead) && user.ID != userID {
-						if err := h.notificationService.CreateNotification(user.ID, models.NotificationTypeStatus, title, message, clientID); err != nil {
-							log.Printf("Failed to notify admin/team lead %s about new client: %v", user.ID, err)
-						}
-					}
-				}
+			creator, _ := h.userRepo.GetByID(userID)
+			creatorName := "Sistema"
+			if creator != nil {
+				creatorName = creator.Name
 			}
+			title := "Nuevo cliente creado: " + client.Name
+			message := creatorName + " ha creado un nuevo cliente: \"" + client.Name + "\""
+			notifySupervisors(h.userRepo, h.permissionService, h.notificationService, userID, title, message, &client.ID)
 		}()
 	}
 
-	c.JSON(http.StatusCreated, client)
+	c.JSON(http.StatusCreated, signFileURLs(h.urlSigner, client))
 }
 
 type UpdateClientRequest struct {
@@ -163,15 +160,12 @@ func (h *ClientHandler) UpdateClient(c *gin.Context) {
 		return
 	}
 
-	userIDStr, _ := c.Get("user_id")
-	userID, _ := uuid.Parse(userIDStr.(string))
-
 	currentUser, err := GetCurrentUserFromDB(c, h.userRepo)
 	if err != nil || currentUser == nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuario no encontrado"})
 		return
 	}
-	if !h.canManageClient(id, userID, string(currentUser.Role)) {
+	if !h.canManageClient(id, currentUser, models.PermClientManage) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "No tienes permiso para actualizar este cliente"})
 		return
 	}
@@ -208,16 +202,17 @@ func (h *ClientHandler) UpdateClient(c *gin.Context) {
 		updates["contact_phone"] = req.ContactPhone
 	}
 	if req.Logo != nil {
-		updates["logo"] = req.Logo
+		logo := models.StripFileURLSignature(*req.Logo)
+		updates["logo"] = &logo
 	}
 
-	client, err := h.clientService.UpdateClient(id, updates)
+	client, err := h.clientService.UpdateClient(id, updates, auditMeta(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, client)
+	c.JSON(http.StatusOK, signFileURLs(h.urlSigner, client))
 }
 
 func (h *ClientHandler) DeleteClient(c *gin.Context) {
@@ -227,20 +222,17 @@ func (h *ClientHandler) DeleteClient(c *gin.Context) {
 		return
 	}
 
-	userIDStr, _ := c.Get("user_id")
-	userID, _ := uuid.Parse(userIDStr.(string))
-
 	currentUser, err := GetCurrentUserFromDB(c, h.userRepo)
 	if err != nil || currentUser == nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuario no encontrado"})
 		return
 	}
-	if !h.canManageClient(id, userID, string(currentUser.Role)) {
+	if !h.canManageClient(id, currentUser, models.PermClientDelete) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "No tienes permiso para eliminar este cliente"})
 		return
 	}
 
-	if err := h.clientService.DeleteClient(id); err != nil {
+	if err := h.clientService.DeleteClient(id, auditMeta(c)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -259,7 +251,7 @@ func (h *ClientHandler) GetClientMembers(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, members)
+	c.JSON(http.StatusOK, signFileURLs(h.urlSigner, members))
 }
 
 func (h *ClientHandler) AddClientMember(c *gin.Context) {
@@ -268,15 +260,12 @@ func (h *ClientHandler) AddClientMember(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": invalidClientIDError})
 		return
 	}
-	userIDStr, _ := c.Get("user_id")
-	userID, _ := uuid.Parse(userIDStr.(string))
-
 	currentUser, err := GetCurrentUserFromDB(c, h.userRepo)
 	if err != nil || currentUser == nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuario no encontrado"})
 		return
 	}
-	if !h.canManageClient(clientID, userID, string(currentUser.Role)) {
+	if !h.canManageClient(clientID, currentUser, models.PermClientManage) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "No tienes permiso para gestionar el equipo del cliente"})
 		return
 	}
@@ -292,7 +281,7 @@ func (h *ClientHandler) AddClientMember(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
 		return
 	}
-	if err := h.clientService.AddClientMember(clientID, memberUserID); err != nil {
+	if err := h.clientService.AddClientMember(clientID, memberUserID, auditMeta(c)); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -305,15 +294,12 @@ func (h *ClientHandler) RemoveClientMember(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": invalidClientIDError})
 		return
 	}
-	currentUserIDStr, _ := c.Get("user_id")
-	currentUserID, _ := uuid.Parse(currentUserIDStr.(string))
-
 	currentUser, err := GetCurrentUserFromDB(c, h.userRepo)
 	if err != nil || currentUser == nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuario no encontrado"})
 		return
 	}
-	if !h.canManageClient(clientID, currentUserID, string(currentUser.Role)) {
+	if !h.canManageClient(clientID, currentUser, models.PermClientManage) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "No tienes permiso para gestionar el equipo del cliente"})
 		return
 	}
@@ -322,7 +308,7 @@ func (h *ClientHandler) RemoveClientMember(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
 		return
 	}
-	if err := h.clientService.RemoveClientMember(clientID, memberUserID); err != nil {
+	if err := h.clientService.RemoveClientMember(clientID, memberUserID, auditMeta(c)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"errors"
 	"mellon-harmony-api/internal/models"
+	"mellon-harmony-api/internal/repository"
 	"mellon-harmony-api/internal/service"
 	"net/http"
 
@@ -11,10 +13,56 @@ import (
 
 type CommentHandler struct {
 	commentService service.CommentService
+	issueService   service.IssueService
+	userRepo       repository.UserRepository
+	urlSigner      *service.FileURLSigner
 }
 
-func NewCommentHandler(commentService service.CommentService) *CommentHandler {
-	return &CommentHandler{commentService: commentService}
+func NewCommentHandler(commentService service.CommentService, issueService service.IssueService, userRepo repository.UserRepository, urlSigner *service.FileURLSigner) *CommentHandler {
+	return &CommentHandler{
+		commentService: commentService,
+		issueService:   issueService,
+		userRepo:       userRepo,
+		urlSigner:      urlSigner,
+	}
+}
+
+// canAccessIssue applies the issue access policy to comment routes, responding 404 with notFound
+// for issues the user may not see.
+func (h *CommentHandler) canAccessIssue(c *gin.Context, issueID uuid.UUID, notFound string) (*models.User, bool) {
+	currentUser, err := GetCurrentUserFromDB(c, h.userRepo)
+	if err != nil || currentUser == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuario no encontrado"})
+		return nil, false
+	}
+	if _, err := h.issueService.GetIssueForUser(issueID, currentUser); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+		return nil, false
+	}
+	return currentUser, true
+}
+
+// accessibleComment checks that the comment exists and the user may access its issue, responding 404 otherwise.
+// Returns the current user.
+func (h *CommentHandler) accessibleComment(c *gin.Context, id uuid.UUID) (*models.User, bool) {
+	comment, err := h.commentService.GetComment(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return nil, false
+	}
+	return h.canAccessIssue(c, comment.IssueID, "Comment not found")
+}
+
+func commentErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrCommentForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrCommentModerated):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrModerationReasonRequired):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
 }
 
 func (h *CommentHandler) GetComments(c *gin.Context) {
@@ -24,6 +72,10 @@ func (h *CommentHandler) GetComments(c *gin.Context) {
 		return
 	}
 
+	if _, ok := h.canAccessIssue(c, issueID, "Issue not found"); !ok {
+		return
+	}
+
 	comments, err := h.commentService.GetComments(issueID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -36,7 +88,7 @@ func (h *CommentHandler) GetComments(c *gin.Context) {
 		responses[i] = comment.ToResponse()
 	}
 
-	c.JSON(http.StatusOK, responses)
+	c.JSON(http.StatusOK, signAttachmentResponse(h.urlSigner, h.issueService, responses))
 }
 
 type CreateCommentRequest struct {
@@ -51,6 +103,10 @@ func (h *CommentHandler) CreateComment(c *gin.Context) {
 		return
 	}
 
+	if _, ok := h.canAccessIssue(c, issueID, "Issue not found"); !ok {
+		return
+	}
+
 	userIDStr, _ := c.Get("user_id")
 	userID, _ := uuid.Parse(userIDStr.(string))
 
@@ -62,11 +118,15 @@ func (h *CommentHandler) CreateComment(c *gin.Context) {
 
 	comment, err := h.commentService.CreateComment(issueID, userID, req.Text, req.Attachments)
 	if err != nil {
+		if errors.Is(err, service.ErrStorageQuotaExceeded) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusCreated, comment.ToResponse())
+	c.JSON(http.StatusCreated, signAttachmentResponse(h.urlSigner, h.issueService, comment.ToResponse()))
 }
 
 type UpdateCommentRequest struct {
@@ -80,21 +140,32 @@ func (h *CommentHandler) UpdateComment(c *gin.Context) {
 		return
 	}
 
+	currentUser, ok := h.accessibleComment(c, id)
+	if !ok {
+		return
+	}
+
 	var req UpdateCommentRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	comment, err := h.commentService.UpdateComment(id, req.Text)
+	comment, err := h.commentService.UpdateComment(id, currentUser.ID, req.Text)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(commentErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, comment)
+	c.JSON(http.StatusOK, signAttachmentResponse(h.urlSigner, h.issueService, comment))
 }
 
+type DeleteCommentRequest struct {
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+// DeleteComment deletes the caller's own comment. Moderators deleting someone else's comment must send
+// a reason (JSON body or ?reason=); the comment is then kept as "deleted by moderator" and returned.
 func (h *CommentHandler) DeleteComment(c *gin.Context) {
 	id, err := uuid.Parse(c.Param("id"))
 	if err != nil {
@@ -102,8 +173,33 @@ func (h *CommentHandler) DeleteComment(c *gin.Context) {
 		return
 	}
 
-	if err := h.commentService.DeleteComment(id); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	currentUser, ok := h.accessibleComment(c, id)
+	if !ok {
+		return
+	}
+
+	var req DeleteCommentRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.Reason == "" {
+		req.Reason = c.Query("reason")
+		if len(req.Reason) > 500 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "reason must be at most 500 characters"})
+			return
+		}
+	}
+
+	moderated, err := h.commentService.DeleteComment(id, currentUser, req.Reason, auditMeta(c))
+	if err != nil {
+		c.JSON(commentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if moderated != nil {
+		c.JSON(http.StatusOK, signAttachmentResponse(h.urlSigner, h.issueService, moderated.ToResponse()))
 		return
 	}
 
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"errors"
+	"mellon-harmony-api/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type EmailVerificationHandler struct {
+	emailVerification service.EmailVerificationService
+}
+
+func NewEmailVerificationHandler(emailVerification service.EmailVerificationService) *EmailVerificationHandler {
+	return &EmailVerificationHandler{emailVerification: emailVerification}
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required,max=500"`
+}
+
+// VerifyEmail confirms the address from the emailed link.
+func (h *EmailVerificationHandler) VerifyEmail(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.emailVerification.VerifyEmail(req.Token)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidVerificationToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudo verificar el correo"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Correo verificado correctamente.", "email": user.Email})
+}
+
+// ResendVerification emails a new verification link to the caller's current address.
+func (h *EmailVerificationHandler) ResendVerification(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if err := h.emailVerification.ResendVerification(userID); err != nil {
+		switch {
+		case errors.Is(err, service.ErrEmailAlreadyVerified):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrEmailNotConfigured):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "El servidor no tiene configurado el envío de correos. Contacta al administrador."})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Te enviamos un nuevo enlace de verificación."})
+}
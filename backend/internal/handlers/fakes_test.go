@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"mellon-harmony-api/internal/models"
+	"mellon-harmony-api/internal/repository"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// The fakes below keep rows in memory and implement the repository methods the tests reach; the
+// embedded interface is nil, so any other method panics and shows the test needs more of it.
+
+type memoryUserRepository struct {
+	repository.UserRepository
+	users map[uuid.UUID]*models.User
+}
+
+func newMemoryUserRepository(users ...*models.User) *memoryUserRepository {
+	r := &memoryUserRepository{users: map[uuid.UUID]*models.User{}}
+	for _, user := range users {
+		if user.ID == uuid.Nil {
+			user.ID = uuid.New()
+		}
+		r.users[user.ID] = user
+	}
+	return r
+}
+
+func (r *memoryUserRepository) GetByID(id uuid.UUID) (*models.User, error) {
+	user, ok := r.users[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copy := *user
+	return &copy, nil
+}
+
+type memoryRoleRepository struct {
+	repository.RoleRepository
+	roles []models.Role
+}
+
+// newMemoryRoleRepository returns the built-in roles plus a role for each entry of extra.
+func newMemoryRoleRepository(extra map[models.UserRole][]string) *memoryRoleRepository {
+	roles := models.BuiltInRoles()
+	for name, permissions := range extra {
+		role := models.Role{Name: name}
+		role.SetPermissions(permissions)
+		roles = append(roles, role)
+	}
+	return &memoryRoleRepository{roles: roles}
+}
+
+func (r *memoryRoleRepository) GetAll() ([]models.Role, error) {
+	return r.roles, nil
+}
+
+// memoryClientMemberRepository holds the user IDs of each client's team.
+type memoryClientMemberRepository struct {
+	repository.ClientMemberRepository
+	members map[uuid.UUID][]uuid.UUID
+}
+
+func (r *memoryClientMemberRepository) Exists(clientID, userID uuid.UUID) (bool, error) {
+	for _, member := range r.members[clientID] {
+		if member == userID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// serve registers handler on method path, runs one request as user and returns the recorder.
+func serve(handler gin.HandlerFunc, user *models.User, method, path, route, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Handle(method, route, func(c *gin.Context) {
+		c.Set("user_id", user.ID.String())
+		c.Set("user_role", string(user.Role))
+	}, handler)
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
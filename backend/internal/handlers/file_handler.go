@@ -1,26 +1,40 @@
 package handlers
 
 import (
+	"errors"
+	"mellon-harmony-api/internal/models"
+	"mellon-harmony-api/internal/repository"
 	"mellon-harmony-api/internal/service"
 	"net/http"
-	"os"
-	"path/filepath"
+	"path"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 type FileHandler struct {
 	fileService *service.FileService
+	urlSigner   *service.FileURLSigner
+	access      uploadAccess
 }
 
-func NewFileHandler(fileService *service.FileService) *FileHandler {
+func NewFileHandler(fileService *service.FileService, urlSigner *service.FileURLSigner, userRepo repository.UserRepository, clientMemberRepo repository.ClientMemberRepository, projectRepo repository.ProjectRepository, permissionService service.PermissionService) *FileHandler {
 	return &FileHandler{
 		fileService: fileService,
+		urlSigner:   urlSigner,
+		access:      newUploadAccess(userRepo, clientMemberRepo, projectRepo, permissionService),
 	}
 }
 
-// UploadFile handles file uploads
+func fileErrorStatus(err error) int {
+	if errors.Is(err, service.ErrFileTooLarge) || errors.Is(err, service.ErrStorageQuotaExceeded) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// UploadFile handles file uploads in a single request; large files should use the resumable /uploads API.
 func (h *FileHandler) UploadFile(c *gin.Context) {
 	// Get the file from the form
 	file, err := c.FormFile("file")
@@ -29,69 +43,71 @@ func (h *FileHandler) UploadFile(c *gin.Context) {
 		return
 	}
 
-	// Optional: upload_purpose = "avatar" | "client_logo" | "attachment" (default)
-	uploadPurpose := c.PostForm("upload_purpose")
-	if uploadPurpose == "" {
-		uploadPurpose = "attachment"
-	}
-
-	var filePath string
-	switch uploadPurpose {
-	case "avatar":
-		userID := c.PostForm("user_id")
-		if userID == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "user_id required for avatar upload"})
-			return
-		}
-		filePath, err = h.fileService.SaveAvatarFile(file, userID)
-	case "client_logo":
-		clientID := c.PostForm("client_id")
-		if clientID == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "client_id required for client logo upload"})
-			return
-		}
-		filePath, err = h.fileService.SaveClientLogoFile(file, clientID)
-	default:
-		// Validate file type for attachment uploads
-		ext := strings.ToLower(filepath.Ext(file.Filename))
-		allowedExts := []string{".jpg", ".jpeg", ".png", ".gif", ".pdf", ".doc", ".docx", ".xls", ".xlsx", ".txt", ".zip", ".rar"}
-		isAllowed := false
-		for _, allowedExt := range allowedExts {
-			if ext == allowedExt {
-				isAllowed = true
-				break
-			}
-		}
-		if !isAllowed {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "File type not allowed"})
-			return
-		}
-		clientID := c.PostForm("client_id")
-		projectID := c.PostForm("project_id")
-		filePath, err = h.fileService.SaveFile(file, clientID, projectID)
+	uploadedBy, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		return
 	}
 
+	// Optional: upload_purpose = "avatar" (needs user_id) | "client_logo" (needs client_id) | "attachment" (default)
+	opts := service.UploadOptions{
+		Purpose:   c.PostForm("upload_purpose"),
+		UserID:    c.PostForm("user_id"),
+		ClientID:  c.PostForm("client_id"),
+		ProjectID: c.PostForm("project_id"),
+	}
+	if !h.access.authorize(c, opts) {
+		return
+	}
+	if err := h.fileService.CheckUpload(file.Filename, file.Size, opts); err != nil {
+		c.JSON(fileErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	body, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer body.Close()
+
+	stored, err := h.fileService.Save(service.Upload{Name: file.Filename, Size: file.Size, Body: body}, uploadedBy, opts)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(fileErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	// Determine file type
+	c.JSON(http.StatusOK, fileResponse(h.urlSigner, stored))
+}
+
+// fileResponse describes a saved upload; path is what gets stored, signed_path can be loaded right away.
+func fileResponse(urlSigner *service.FileURLSigner, stored *models.File) gin.H {
+	// Determine file type from the verified content, not the header sent by the client
 	fileType := "file"
-	if strings.HasPrefix(file.Header.Get("Content-Type"), "image/") {
+	if service.IsImageContentType(stored.ContentType) {
 		fileType = "image"
 	}
+	thumbnails := gin.H{}
+	for size, thumbPath := range stored.ThumbnailPaths() {
+		thumbnails[size] = urlSigner.SignURL(thumbPath)
+	}
 
-	// Return file info
-	c.JSON(http.StatusOK, gin.H{
-		"path": filePath,
-		"name": file.Filename,
-		"type": fileType,
-		"size": file.Size,
-	})
+	filePath := stored.Path()
+	return gin.H{
+		"id":          stored.ID,
+		"path":        filePath,
+		"signed_path": urlSigner.SignURL(filePath),
+		"name":        stored.Name,
+		"type":        fileType,
+		"size":        stored.Size,
+		"checksum":    stored.Checksum,
+		"thumbnails":  thumbnails,
+		"scan_status": stored.ScanStatus,
+	}
 }
 
-// ServeFile serves uploaded files
+// ServeFile serves uploaded files. Unless the file is public (avatars and logos, see FILES_PUBLIC_IMAGES)
+// the URL must carry a valid, unexpired signature, as returned in issue and comment attachments.
 func (h *FileHandler) ServeFile(c *gin.Context) {
 	filePath := c.Param("path")
 	
@@ -104,17 +120,45 @@ func (h *FileHandler) ServeFile(c *gin.Context) {
 		return
 	}
 
-	// Get full file path
 	// Remove "uploads/" prefix if present
-	relativePath := strings.TrimPrefix(filePath, "uploads/")
-	fullPath := h.fileService.GetFilePath(relativePath)
-	
-	// Check if file exists
-	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
+	relativePath := service.FileKey(filePath)
+	public := h.urlSigner.IsPublic(relativePath)
+	if !public && !h.urlSigner.Verify(relativePath, c.Query(models.FileURLExpiresParam), c.Query(models.FileURLSignatureParam)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid or expired file link"})
+		return
+	}
+
+	file, err := h.fileService.OpenFile(c.Request.Context(), relativePath)
+	if errors.Is(err, service.ErrFileNotFound) || errors.Is(err, service.ErrInvalidFileKey) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
 		return
 	}
+	// Attachments are only served once the virus scanner found them clean
+	if errors.Is(err, service.ErrFileScanPending) {
+		c.Header("Retry-After", "10")
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "scan_status": models.FileScanPending})
+		return
+	}
+	if errors.Is(err, service.ErrFileInfected) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "scan_status": models.FileScanInfected})
+		return
+	}
+	if errors.Is(err, service.ErrFileNotScanned) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "scan_status": models.FileScanTooLarge})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer file.Close()
 
-	// Serve the file
-	c.File(fullPath)
+	// Serve the file; signed links must not be cached by shared caches
+	if !public {
+		c.Header("Cache-Control", "private, max-age=300")
+	}
+	if file.ContentType != "" && file.ContentType != "application/octet-stream" {
+		c.Header("Content-Type", file.ContentType)
+	}
+	http.ServeContent(c.Writer, c.Request, path.Base(relativePath), file.ModTime, file)
 }
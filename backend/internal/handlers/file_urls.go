@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"mellon-harmony-api/internal/models"
+	"mellon-harmony-api/internal/service"
+	"reflect"
+
+	"github.com/google/uuid"
+)
+
+// signFileURLs prepares a response that carries stored file URLs, which models keep unsigned: the
+// avatar of every user, the logo of every client and the attachments of every issue and comment
+// response found in v get a fresh signature. v is changed in place (pointers are followed), so it
+// must have been loaded for this response; the result is v, ready for c.JSON.
+func signFileURLs(urlSigner *service.FileURLSigner, v interface{}) interface{} {
+	s := &responseSigner{urlSigner: urlSigner, seen: map[uintptr]bool{}}
+	s.walk(reflect.ValueOf(&v).Elem())
+	return v
+}
+
+// signAttachmentResponse is signFileURLs for responses with issue or comment attachments, which
+// also get the scan status of their uploads, looked up at once for the whole response.
+func signAttachmentResponse(urlSigner *service.FileURLSigner, issues service.IssueService, v interface{}) interface{} {
+	s := &responseSigner{urlSigner: urlSigner, seen: map[uintptr]bool{}}
+	s.walk(reflect.ValueOf(&v).Elem())
+
+	var fileIDs []uuid.UUID
+	for _, attachments := range s.attachments {
+		for _, att := range attachments {
+			if att.FileID != nil {
+				fileIDs = append(fileIDs, *att.FileID)
+			}
+		}
+	}
+	if len(fileIDs) == 0 {
+		return v
+	}
+	statuses := issues.AttachmentScanStatuses(fileIDs)
+	for _, attachments := range s.attachments {
+		for i := range attachments {
+			if attachments[i].FileID != nil {
+				attachments[i].ScanStatus = statuses[*attachments[i].FileID]
+			}
+		}
+	}
+	return v
+}
+
+type responseSigner struct {
+	urlSigner   *service.FileURLSigner
+	seen        map[uintptr]bool
+	attachments [][]models.Attachment // signed attachment lists, which share their elements with the response
+}
+
+// walk signs the URLs of v, which must be addressable or an interface or map whose values can be replaced.
+func (s *responseSigner) walk(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || s.seen[v.Pointer()] {
+			return
+		}
+		s.seen[v.Pointer()] = true
+		s.walk(v.Elem())
+	case reflect.Interface:
+		if v.IsNil() || !v.CanSet() {
+			return
+		}
+		// Values held by an interface cannot be changed in place: sign a copy and put it back
+		elem := reflect.New(v.Elem().Type()).Elem()
+		elem.Set(v.Elem())
+		s.walk(elem)
+		v.Set(elem)
+	case reflect.Map:
+		if !mayHoldFileURLs(v.Type().Elem()) {
+			return
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			elem := reflect.New(iter.Value().Type()).Elem()
+			elem.Set(iter.Value())
+			s.walk(elem)
+			v.SetMapIndex(iter.Key(), elem)
+		}
+	case reflect.Slice, reflect.Array:
+		if !mayHoldFileURLs(v.Type().Elem()) || (v.Kind() == reflect.Array && !v.CanAddr()) {
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			s.walk(v.Index(i))
+		}
+	case reflect.Struct:
+		if !v.CanAddr() {
+			return
+		}
+		s.sign(v.Addr().Interface())
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				s.walk(v.Field(i))
+			}
+		}
+	}
+}
+
+// sign signs the file URLs held directly by a model.
+func (s *responseSigner) sign(model interface{}) {
+	switch m := model.(type) {
+	case *models.User:
+		m.Avatar = s.signPtr(m.Avatar)
+	case *models.Client:
+		m.Logo = s.signPtr(m.Logo)
+	case *models.IssueResponse:
+		s.signAttachments(m.Attachments)
+	case *models.CommentResponse:
+		s.signAttachments(m.Attachments)
+	}
+}
+
+// signPtr signs an optional avatar or logo URL without changing the stored string.
+func (s *responseSigner) signPtr(fileURL *string) *string {
+	if fileURL == nil || *fileURL == "" {
+		return fileURL
+	}
+	signed := s.urlSigner.SignURL(*fileURL)
+	return &signed
+}
+
+func (s *responseSigner) signAttachments(attachments []models.Attachment) {
+	for i := range attachments {
+		attachments[i].URL = s.urlSigner.SignURL(attachments[i].URL)
+	}
+	s.attachments = append(s.attachments, attachments)
+}
+
+// mayHoldFileURLs skips walking collections of plain values, such as UUIDs and strings.
+func mayHoldFileURLs(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+		return true
+	}
+	return false
+}
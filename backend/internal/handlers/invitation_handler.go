@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"errors"
+	"mellon-harmony-api/internal/models"
+	"mellon-harmony-api/internal/repository"
+	"mellon-harmony-api/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type InvitationHandler struct {
+	invitationService service.InvitationService
+	authService       service.AuthService
+	userRepo          repository.UserRepository
+	permissionService service.PermissionService
+	urlSigner         *service.FileURLSigner
+}
+
+func NewInvitationHandler(invitationService service.InvitationService, authService service.AuthService, userRepo repository.UserRepository, permissionService service.PermissionService, urlSigner *service.FileURLSigner) *InvitationHandler {
+	return &InvitationHandler{
+		invitationService: invitationService,
+		authService:       authService,
+		userRepo:          userRepo,
+		permissionService: permissionService,
+		urlSigner:         urlSigner,
+	}
+}
+
+type CreateInvitationRequest struct {
+	Email     string          `json:"email" binding:"required,email,max=255"`
+	Role      models.UserRole `json:"role"`
+	ClientIDs []uuid.UUID     `json:"client_ids"`
+}
+
+type AcceptInvitationRequest struct {
+	Name     string `json:"name" binding:"required,max=255"`
+	Password string `json:"password" binding:"required,max=500"`
+}
+
+// currentInviter returns the caller if their role grants user.invite.
+func (h *InvitationHandler) currentInviter(c *gin.Context) (*models.User, bool) {
+	return requirePermission(c, h.userRepo, h.permissionService, models.PermUserInvite, "No tienes permiso para gestionar invitaciones")
+}
+
+func invitationErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvitationNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrInvitationForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrInvitationEmailTaken):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrInvalidInvitation), errors.Is(err, service.ErrInvitationClientNotFound), errors.Is(err, service.ErrRoleNotFound):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func (h *InvitationHandler) CreateInvitation(c *gin.Context) {
+	inviter, ok := h.currentInviter(c)
+	if !ok {
+		return
+	}
+
+	var req CreateInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	invitation, err := h.invitationService.CreateInvitation(inviter, req.Email, req.Role, req.ClientIDs)
+	if err != nil {
+		c.JSON(invitationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, signFileURLs(h.urlSigner, invitation))
+}
+
+func (h *InvitationHandler) GetInvitations(c *gin.Context) {
+	if _, ok := h.currentInviter(c); !ok {
+		return
+	}
+
+	invitations, err := h.invitationService.ListInvitations()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, signFileURLs(h.urlSigner, invitations))
+}
+
+func (h *InvitationHandler) ResendInvitation(c *gin.Context) {
+	inviter, ok := h.currentInviter(c)
+	if !ok {
+		return
+	}
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invitation ID"})
+		return
+	}
+
+	invitation, err := h.invitationService.ResendInvitation(inviter, id)
+	if err != nil {
+		c.JSON(invitationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, signFileURLs(h.urlSigner, invitation))
+}
+
+func (h *InvitationHandler) RevokeInvitation(c *gin.Context) {
+	inviter, ok := h.currentInviter(c)
+	if !ok {
+		return
+	}
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invitation ID"})
+		return
+	}
+
+	if err := h.invitationService.RevokeInvitation(inviter, id); err != nil {
+		c.JSON(invitationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation revoked"})
+}
+
+// GetInvitationByToken lets the signup page show who is being invited before accepting.
+func (h *InvitationHandler) GetInvitationByToken(c *gin.Context) {
+	invitation, err := h.invitationService.GetInvitationByToken(c.Param("token"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"email":      invitation.Email,
+		"role":       invitation.Role,
+		"inviter":    invitation.Inviter.Name,
+		"expires_at": invitation.ExpiresAt,
+	})
+}
+
+// AcceptInvitation creates the invited account and signs it in, with a 2FA setup challenge instead
+// of tokens when the invited role requires a second factor.
+func (h *InvitationHandler) AcceptInvitation(c *gin.Context) {
+	var req AcceptInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.invitationService.AcceptInvitation(c.Param("token"), req.Name, req.Password)
+	if err != nil {
+		if respondIfPasswordPolicy(c, err) {
+			return
+		}
+		c.JSON(invitationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.authService.CompleteLogin(user, sessionMeta(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	respondLoginResult(c, h.urlSigner, http.StatusCreated, result, user)
+}
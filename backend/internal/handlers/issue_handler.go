@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"mellon-harmony-api/internal/models"
 	"mellon-harmony-api/internal/repository"
@@ -18,55 +19,57 @@ type IssueHandler struct {
 	userRepo            repository.UserRepository
 	notificationService service.NotificationService
 	projectRepo         repository.ProjectRepository
+	permissionService   service.PermissionService
+	urlSigner           *service.FileURLSigner
 }
 
-func NewIssueHandler(issueService service.IssueService, userRepo repository.UserRepository, notificationService service.NotificationService, projectRepo repository.ProjectRepository) *IssueHandler {
+func NewIssueHandler(issueService service.IssueService, userRepo repository.UserRepository, notificationService service.NotificationService, projectRepo repository.ProjectRepository, permissionService service.PermissionService, urlSigner *service.FileURLSigner) *IssueHandler {
 	return &IssueHandler{
 		issueService:        issueService,
 		userRepo:            userRepo,
 		notificationService: notificationService,
 		projectRepo:         projectRepo,
+		permissionService:   permissionService,
+		urlSigner:           urlSigner,
 	}
 }
 
-func (h *IssueHandler) GetIssues(c *gin.Context) {
-	filters := make(map[string]interface{})
+// accessibleIssue loads the issue for the current user, responding 404 when it does not exist
+// or the user may not access it (see IssueService.CanAccessIssue).
+func (h *IssueHandler) accessibleIssue(c *gin.Context, id uuid.UUID) (*models.Issue, *models.User, bool) {
+	currentUser, err := GetCurrentUserFromDB(c, h.userRepo)
+	if err != nil || currentUser == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuario no encontrado"})
+		return nil, nil, false
+	}
+	issue, err := h.issueService.GetIssueForUser(id, currentUser)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Issue not found"})
+		return nil, nil, false
+	}
+	return issue, currentUser, true
+}
 
-	// Role-based access: regular users only see tasks assigned to them (use DB role so changes take effect immediately)
+// GetIssues lists issues matching the filters of issueFilter, e.g. ?q=status:review assignee:me due<2026-11-01
+func (h *IssueHandler) GetIssues(c *gin.Context) {
+	// Users without issue.view_all only see the issues they can access (use DB role so changes take effect immediately)
 	currentUser, err := GetCurrentUserFromDB(c, h.userRepo)
 	if err != nil || currentUser == nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuario no encontrado"})
 		return
 	}
-	if currentUser.Role == models.RoleUser {
-		// Restrict to current user's tasks only; ignore any assigned_to from query
-		filters["assigned_to"] = currentUser.ID
-	} else {
-		// Admin and team_lead: allow optional filters from query
-		if status := c.Query("status"); status != "" {
-			filters["status"] = models.IssueStatus(status)
-		}
-		if priority := c.Query("priority"); priority != "" {
-			filters["priority"] = models.IssuePriority(priority)
-		}
-		if assignedTo := c.Query("assigned_to"); assignedTo != "" {
-			if id, err := uuid.Parse(assignedTo); err == nil {
-				filters["assigned_to"] = id
-			}
-		}
-		if projectID := c.Query("project_id"); projectID != "" {
-			if id, err := uuid.Parse(projectID); err == nil {
-				filters["project_id"] = id
-			}
-		}
-		if clientID := c.Query("client_id"); clientID != "" {
-			if id, err := uuid.Parse(clientID); err == nil {
-				filters["client_id"] = id
-			}
-		}
+	filter, err := issueFilter(c, currentUser.ID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	opts, err := listOptions(c, issueSortColumns, viewSummary)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	issues, err := h.issueService.GetIssues(filters)
+	issues, total, err := h.issueService.GetIssues(filter, opts, currentUser)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -76,8 +79,12 @@ func (h *IssueHandler) GetIssues(c *gin.Context) {
 	response := make([]models.IssueResponse, len(issues))
 	for i, issue := range issues {
 		response[i] = issue.ToResponse()
+		if opts.Summary {
+			response[i].CommentCount = &issues[i].CommentCount
+		}
 	}
-	c.JSON(http.StatusOK, response)
+	setListHeaders(c, opts, total)
+	c.JSON(http.StatusOK, signAttachmentResponse(h.urlSigner, h.issueService, response))
 }
 
 func (h *IssueHandler) GetIssue(c *gin.Context) {
@@ -87,13 +94,12 @@ func (h *IssueHandler) GetIssue(c *gin.Context) {
 		return
 	}
 
-	issue, err := h.issueService.GetIssue(id)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Issue not found"})
+	issue, _, ok := h.accessibleIssue(c, id)
+	if !ok {
 		return
 	}
 
-	c.JSON(http.StatusOK, issue.ToResponse())
+	c.JSON(http.StatusOK, signAttachmentResponse(h.urlSigner, h.issueService, issue.ToResponse()))
 }
 
 type CreateIssueRequest struct {
@@ -110,8 +116,12 @@ type CreateIssueRequest struct {
 }
 
 func (h *IssueHandler) CreateIssue(c *gin.Context) {
-	userIDStr, _ := c.Get("user_id")
-	userID, _ := uuid.Parse(userIDStr.(string))
+	currentUser, err := GetCurrentUserFromDB(c, h.userRepo)
+	if err != nil || currentUser == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuario no encontrado"})
+		return
+	}
+	userID := currentUser.ID
 
 	var req CreateIssueRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -154,6 +164,12 @@ func (h *IssueHandler) CreateIssue(c *gin.Context) {
 		}
 	}
 
+	// Filing under a project or client needs the same access as moving an issue there
+	if (issue.ProjectID != nil || issue.ClientID != nil) && !h.issueService.CanFileIssueUnder(currentUser, issue.ProjectID, issue.ClientID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "No tienes acceso al proyecto o cliente de destino"})
+		return
+	}
+
 	if req.TaskType != "" {
 		issue.TaskType = req.TaskType
 	}
@@ -170,7 +186,11 @@ func (h *IssueHandler) CreateIssue(c *gin.Context) {
 		}
 	}
 
-	if err := h.issueService.CreateIssue(issue); err != nil {
+	if err := h.issueService.CreateIssue(issue, auditMeta(c)); err != nil {
+		if errors.Is(err, service.ErrStorageQuotaExceeded) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -199,26 +219,17 @@ func (h *IssueHandler) CreateIssue(c *gin.Context) {
 			}()
 		}
 
-		// Notify admins and team leads only when a regular user creates the issue
-		if creator != nil && creator.Role == models.RoleUser {
+		// Notify supervisors only when someone they supervise creates the issue
+		if creator != nil && !h.permissionService.HasPermission(creator, models.PermActivityNotify) {
 			go func() {
-				allUsers, err := h.userRepo.GetAll()
-				if err == nil {
-					title := "Nueva tarea creada: " + issue.Title
-					message := creator.Name + " ha creado una nueva tarea: \"" + issue.Title + "\""
-					for _, user := range allUsers {
-						if (user.Role == models.RoleAdmin || user.Role == models.RoleTeamLead) && user.ID != userID {
-							if err := h.notificationService.CreateNotification(user.ID, models.NotificationTypeStatus, title, message, issueID); err != nil {
-								log.Printf("Failed to notify admin/team lead %s: %v", user.ID, err)
-							}
-						}
-					}
-				}
+				title := "Nueva tarea creada: " + issue.Title
+				message := creator.Name + " ha creado una nueva tarea: \"" + issue.Title + "\""
+				notifySupervisors(h.userRepo, h.permissionService, h.notificationService, userID, title, message, issueID)
 			}()
 		}
 	}
 
-	c.JSON(http.StatusCreated, issue.ToResponse())
+	c.JSON(http.StatusCreated, signAttachmentResponse(h.urlSigner, h.issueService, issue.ToResponse()))
 }
 
 type UpdateIssueRequest struct {
@@ -241,6 +252,13 @@ func (h *IssueHandler) UpdateIssue(c *gin.Context) {
 		return
 	}
 
+	// Get old issue for comparison and validation
+	oldIssue, currentUser, ok := h.accessibleIssue(c, id)
+	if !ok {
+		return
+	}
+	currentUserID := currentUser.ID
+
 	var req UpdateIssueRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -291,26 +309,29 @@ func (h *IssueHandler) UpdateIssue(c *gin.Context) {
 	}
 	if req.Attachments != nil {
 		// Convert attachments to JSON string
-		if data, err := json.Marshal(*req.Attachments); err == nil {
+		if data, err := json.Marshal(models.StripAttachmentSignatures(*req.Attachments)); err == nil {
 			updates["attachments"] = string(data)
 		}
 	}
 
-	// Get old issue for comparison and validation
-	oldIssue, _ := h.issueService.GetIssue(id)
-	if oldIssue == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Issue not found"})
+	// Moving the issue needs access to where it goes, not only to where it is
+	var targetProject, targetClient *uuid.UUID
+	if projectID, ok := updates["project_id"].(*uuid.UUID); ok && (oldIssue.ProjectID == nil || *oldIssue.ProjectID != *projectID) {
+		targetProject = projectID
+	}
+	if clientID, ok := updates["client_id"].(*uuid.UUID); ok && (oldIssue.ClientID == nil || *oldIssue.ClientID != *clientID) {
+		targetClient = clientID
+	}
+	if (targetProject != nil || targetClient != nil) && !h.issueService.CanFileIssueUnder(currentUser, targetProject, targetClient) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "No tienes acceso al proyecto o cliente de destino"})
 		return
 	}
 
-	// Reassign lock: if current assignee is team_lead or admin, only team_lead or admin can change assignee
-	currentUserIDStr, _ := c.Get("user_id")
-	currentUserID, _ := uuid.Parse(currentUserIDStr.(string))
-	currentUser, _ := h.userRepo.GetByID(currentUserID)
+	// Reassign lock: if the current assignee holds issue.reassign (leads, admins), only someone who also holds it can change assignee
 	if req.AssignedTo != nil && oldIssue.AssignedTo != nil {
 		currentAssignee, _ := h.userRepo.GetByID(*oldIssue.AssignedTo)
-		if currentAssignee != nil && (currentAssignee.Role == models.RoleAdmin || currentAssignee.Role == models.RoleTeamLead) {
-			if currentUser == nil || (currentUser.Role != models.RoleAdmin && currentUser.Role != models.RoleTeamLead) {
+		if currentAssignee != nil && h.permissionService.HasPermission(currentAssignee, models.PermIssueReassign) {
+			if !h.permissionService.HasPermission(currentUser, models.PermIssueReassign) {
 				c.JSON(http.StatusForbidden, gin.H{
 					"error": "Esta tarea está asignada a un líder o administrador. Solo un líder o administrador puede reasignarla a otro miembro.",
 				})
@@ -319,8 +340,12 @@ func (h *IssueHandler) UpdateIssue(c *gin.Context) {
 		}
 	}
 
-	issue, err := h.issueService.UpdateIssue(id, updates)
+	issue, err := h.issueService.UpdateIssue(id, updates, auditMeta(c))
 	if err != nil {
+		if errors.Is(err, service.ErrStorageQuotaExceeded) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -407,26 +432,14 @@ func (h *IssueHandler) UpdateIssue(c *gin.Context) {
 			}
 		}
 
-		// Notify all admins and team leads about issue update ONLY if the updater is a regular user
-		// If admin/team lead makes the change, only notify people involved (not other admins/team leads)
-		if h.notificationService != nil && currentUser != nil && currentUser.Role == models.RoleUser {
-			go func() {
-				allUsers, err := h.userRepo.GetAll()
-				if err == nil {
-					for _, user := range allUsers {
-						// Notify admins and team leads, but not the updater
-						if (user.Role == models.RoleAdmin || user.Role == models.RoleTeamLead) && user.ID != currentUserID {
-							if err := h.notificationService.CreateNotification(user.ID, models.NotificationTypeStatus, title, message, issueID); err != nil {
-								log.Printf("Failed to notify admin/team lead %s: %v", user.ID, err)
-							}
-						}
-					}
-				}
-			}()
+		// Notify supervisors about issue update ONLY if the updater is not a supervisor
+		// If a supervisor makes the change, only notify people involved (not other supervisors)
+		if h.notificationService != nil && currentUser != nil && !h.permissionService.HasPermission(currentUser, models.PermActivityNotify) {
+			go notifySupervisors(h.userRepo, h.permissionService, h.notificationService, currentUserID, title, message, issueID)
 		}
 	}
 
-	c.JSON(http.StatusOK, issue.ToResponse())
+	c.JSON(http.StatusOK, signAttachmentResponse(h.urlSigner, h.issueService, issue.ToResponse()))
 }
 
 type UpdateStatusRequest struct {
@@ -446,38 +459,35 @@ func (h *IssueHandler) UpdateIssueStatus(c *gin.Context) {
 		return
 	}
 
-	// Get current user who made the update
-	currentUserIDStr, _ := c.Get("user_id")
-	currentUserID, _ := uuid.Parse(currentUserIDStr.(string))
-	currentUser, _ := h.userRepo.GetByID(currentUserID)
-
-	// Only team_lead or admin can move a task from Revisión to Completada
-	existingIssue, _ := h.issueService.GetIssue(id)
-	if existingIssue != nil && req.Status == models.StatusDone {
-		if currentUser == nil || (currentUser.Role != models.RoleAdmin && currentUser.Role != models.RoleTeamLead) {
-			c.JSON(http.StatusForbidden, gin.H{
-				"error": "Solo un líder o administrador puede mover la tarea de Revisión a Completada.",
-			})
-			return
-		}
+	// Get the current user who made the update and the old issue to compare status (for notifications)
+	oldIssue, currentUser, ok := h.accessibleIssue(c, id)
+	if !ok {
+		return
 	}
+	currentUserID := currentUser.ID
 
-	// Get old issue to compare status (for notifications)
-	oldIssue, _ := h.issueService.GetIssue(id)
+	// Only users with issue.approve can move a task from Revisión to Completada
+	canApprove := h.permissionService.HasPermission(currentUser, models.PermIssueApprove)
+	if req.Status == models.StatusDone && !canApprove {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Solo un líder o administrador puede mover la tarea de Revisión a Completada.",
+		})
+		return
+	}
 
 	var approvedAt *time.Time
-	if req.Status == models.StatusDone && currentUser != nil && (currentUser.Role == models.RoleAdmin || currentUser.Role == models.RoleTeamLead) {
+	if req.Status == models.StatusDone && canApprove {
 		now := time.Now()
 		approvedAt = &now
 	}
-	issue, err := h.issueService.UpdateIssueStatus(id, req.Status, approvedAt)
+	issue, err := h.issueService.UpdateIssueStatus(id, req.Status, approvedAt, auditMeta(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	// Notify users if status changed
-	if oldIssue != nil && oldIssue.Status != req.Status && h.notificationService != nil {
+	if oldIssue.Status != req.Status && h.notificationService != nil {
 		go func() {
 			issueID := &issue.ID
 			statusText := ""
@@ -533,25 +543,15 @@ func (h *IssueHandler) UpdateIssueStatus(c *gin.Context) {
 				}
 			}
 
-			// Notify all admins and team leads about status change ONLY if the updater is a regular user
-			// If admin/team lead makes the change, only notify people involved (not other admins/team leads)
-			if currentUser != nil && currentUser.Role == models.RoleUser {
-				allUsers, err := h.userRepo.GetAll()
-				if err == nil {
-					for _, user := range allUsers {
-						// Notify admins and team leads, but not the updater
-						if (user.Role == models.RoleAdmin || user.Role == models.RoleTeamLead) && user.ID != currentUserID {
-							if err := h.notificationService.CreateNotification(user.ID, models.NotificationTypeStatus, title, message, issueID); err != nil {
-								log.Printf("Failed to notify admin/team lead %s about status change: %v", user.ID, err)
-							}
-						}
-					}
-				}
+			// Notify supervisors about status change ONLY if the updater is not a supervisor
+			// If a supervisor makes the change, only notify people involved (not other supervisors)
+			if currentUser != nil && !h.permissionService.HasPermission(currentUser, models.PermActivityNotify) {
+				notifySupervisors(h.userRepo, h.permissionService, h.notificationService, currentUserID, title, message, issueID)
 			}
 		}()
 	}
 
-	c.JSON(http.StatusOK, issue.ToResponse())
+	c.JSON(http.StatusOK, signAttachmentResponse(h.urlSigner, h.issueService, issue.ToResponse()))
 }
 
 func (h *IssueHandler) DeleteIssue(c *gin.Context) {
@@ -561,7 +561,16 @@ func (h *IssueHandler) DeleteIssue(c *gin.Context) {
 		return
 	}
 
-	if err := h.issueService.DeleteIssue(id); err != nil {
+	issue, currentUser, ok := h.accessibleIssue(c, id)
+	if !ok {
+		return
+	}
+	if !h.issueService.CanDeleteIssue(currentUser, issue) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Solo el creador de la tarea o un líder puede eliminarla"})
+		return
+	}
+
+	if err := h.issueService.DeleteIssue(id, auditMeta(c)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"mellon-harmony-api/internal/models"
+	"mellon-harmony-api/internal/service"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// filingIssueService lets users file issues only under the projects and clients in allowed, and
+// records the issues created.
+type filingIssueService struct {
+	service.IssueService
+	allowed map[uuid.UUID]bool
+	created []*models.Issue
+}
+
+func (s *filingIssueService) CanFileIssueUnder(user *models.User, projectID, clientID *uuid.UUID) bool {
+	return (projectID == nil || s.allowed[*projectID]) && (clientID == nil || s.allowed[*clientID])
+}
+
+func (s *filingIssueService) CreateIssue(issue *models.Issue, meta models.AuditMeta) error {
+	issue.ID = uuid.New()
+	s.created = append(s.created, issue)
+	return nil
+}
+
+func TestIssueHandlerCreateIssueAccess(t *testing.T) {
+	user := &models.User{Role: models.RoleUser}
+	users := newMemoryUserRepository(user)
+	ownProject, ownClient := uuid.New(), uuid.New()
+	otherProject, otherClient := uuid.New(), uuid.New()
+
+	tests := []struct {
+		name   string
+		fields string // added to the request body
+		want   int
+	}{
+		{"no project or client", ``, http.StatusCreated},
+		{"own project", `,"project_id":"` + ownProject.String() + `"`, http.StatusCreated},
+		{"own project and client", `,"project_id":"` + ownProject.String() + `","client_id":"` + ownClient.String() + `"`, http.StatusCreated},
+		{"other project", `,"project_id":"` + otherProject.String() + `"`, http.StatusForbidden},
+		{"other client", `,"client_id":"` + otherClient.String() + `"`, http.StatusForbidden},
+		{"own project, other client", `,"project_id":"` + ownProject.String() + `","client_id":"` + otherClient.String() + `"`, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issues := &filingIssueService{allowed: map[uuid.UUID]bool{ownProject: true, ownClient: true}}
+			h := NewIssueHandler(issues, users, nil, nil, nil, nil)
+			body := `{"title":"Logo","description":"Nuevo logo"` + tt.fields + `}`
+			w := serve(h.CreateIssue, user, http.MethodPost, "/issues", "/issues", body)
+			if w.Code != tt.want {
+				t.Fatalf("CreateIssue = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if created := len(issues.created) > 0; created != (tt.want == http.StatusCreated) {
+				t.Errorf("issue saved = %v", created)
+			}
+		})
+	}
+
+	t.Run("unknown user", func(t *testing.T) {
+		issues := &filingIssueService{}
+		h := NewIssueHandler(issues, users, nil, nil, nil, nil)
+		w := serve(h.CreateIssue, &models.User{ID: uuid.New()}, http.MethodPost, "/issues", "/issues", `{"title":"Logo","description":"Nuevo logo"}`)
+		if w.Code != http.StatusUnauthorized || len(issues.created) != 0 {
+			t.Errorf("CreateIssue by an unknown user = %d", w.Code)
+		}
+	})
+}
@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"fmt"
+	"mellon-harmony-api/internal/models"
+	"mellon-harmony-api/internal/repository"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// issueQueryParams maps the query parameters of GET /issues to a term of the issue query language.
+var issueQueryParams = []struct{ param, key, op string }{
+	{"status", "status", ":"},
+	{"priority", "priority", ":"},
+	{"task_type", "type", ":"},
+	{"assigned_to", "assignee", ":"},
+	{"created_by", "creator", ":"},
+	{"project_id", "project", ":"},
+	{"client_id", "client", ":"},
+	{"due_from", "due", ">="},
+	{"due_to", "due", "<="},
+	{"start_from", "start", ">="},
+	{"start_to", "start", "<="},
+	{"approved_from", "approved", ">="},
+	{"approved_to", "approved", "<="},
+}
+
+// issueFilter reads the filters of GET /issues: the query parameters above (comma-separated values
+// are alternatives), overdue=true, unassigned=true and q, a compact query such as
+// `status:review,todo assignee:me due<2026-11-01 logo`. Everything given must match.
+func issueFilter(c *gin.Context, me uuid.UUID) (repository.IssueFilter, error) {
+	var filter repository.IssueFilter
+	for _, p := range issueQueryParams {
+		if value := c.Query(p.param); value != "" {
+			if err := applyIssueTerm(&filter, p.key, p.op, value, me); err != nil {
+				return filter, err
+			}
+		}
+	}
+	if c.Query("overdue") == "true" {
+		filter.Overdue = true
+	}
+	if c.Query("unassigned") == "true" {
+		filter.Unassigned = true
+	}
+	if q := c.Query("q"); q != "" {
+		if err := parseIssueQuery(&filter, q, me); err != nil {
+			return filter, err
+		}
+	}
+	return filter, nil
+}
+
+// parseIssueQuery adds the terms of an issue query to filter. Terms are separated by spaces and are
+// either key:value (values separated by commas, "me" and "none" for people), a date comparison
+// (due<2026-11-01, start>=2026-10-01, approved:2026-10-01..2026-10-31), is:overdue, is:unassigned
+// or free text; double quotes keep spaces in text and values. Words with an unknown key are text.
+func parseIssueQuery(filter *repository.IssueFilter, q string, me uuid.UUID) error {
+	var text []string
+	for _, token := range splitIssueQuery(q) {
+		key, op, value := "", "", token
+		if i := strings.IndexAny(token, ":<>"); i > 0 {
+			key, op, value = strings.ToLower(token[:i]), token[i:i+1], token[i+1:]
+			if op != ":" && strings.HasPrefix(value, "=") {
+				op, value = op+"=", value[1:]
+			}
+		}
+		if key == "" || !isIssueQueryKey(key) {
+			text = append(text, strings.ReplaceAll(token, `"`, ""))
+			continue
+		}
+		if err := applyIssueTerm(filter, key, op, strings.ReplaceAll(value, `"`, ""), me); err != nil {
+			return err
+		}
+	}
+	if len(text) > 0 {
+		filter.Text = strings.TrimSpace(filter.Text + " " + strings.Join(text, " "))
+	}
+	return nil
+}
+
+// splitIssueQuery splits a query at spaces outside double quotes.
+func splitIssueQuery(q string) []string {
+	var tokens []string
+	var current strings.Builder
+	quoted := false
+	for _, r := range q {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			current.WriteRune(r)
+		case !quoted && (r == ' ' || r == '\t' || r == '\n'):
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		tokens = append(tokens, current.String())
+	}
+	return tokens
+}
+
+func isIssueQueryKey(key string) bool {
+	switch key {
+	case "status", "priority", "type", "assignee", "creator", "project", "client", "due", "start", "approved", "is":
+		return true
+	}
+	return false
+}
+
+// applyIssueTerm adds one term (key, operator and value) to filter.
+func applyIssueTerm(filter *repository.IssueFilter, key, op, value string, me uuid.UUID) error {
+	switch key {
+	case "due":
+		return applyTimeTerm(&filter.Due, key, op, value)
+	case "start":
+		return applyTimeTerm(&filter.Start, key, op, value)
+	case "approved":
+		return applyTimeTerm(&filter.Approved, key, op, value)
+	}
+	if op != ":" {
+		return fmt.Errorf("%s solo admite %s:valor", key, key)
+	}
+	for _, v := range strings.Split(value, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		switch key {
+		case "status":
+			switch status := models.IssueStatus(strings.ToLower(v)); status {
+			case models.StatusTodo, models.StatusInProgress, models.StatusReview, models.StatusDone:
+				filter.Statuses = append(filter.Statuses, status)
+			default:
+				return fmt.Errorf("status no válido: %q (todo, in-progress, review o done)", v)
+			}
+		case "priority":
+			switch priority := models.IssuePriority(strings.ToLower(v)); priority {
+			case models.PriorityLow, models.PriorityMedium, models.PriorityHigh:
+				filter.Priorities = append(filter.Priorities, priority)
+			default:
+				return fmt.Errorf("priority no válida: %q (low, medium o high)", v)
+			}
+		case "type":
+			filter.TaskTypes = append(filter.TaskTypes, v)
+		case "assignee":
+			if strings.EqualFold(v, "none") {
+				filter.Unassigned = true
+				continue
+			}
+			id, err := issueQueryUserID(v, me)
+			if err != nil {
+				return fmt.Errorf("assignee no válido: %q", v)
+			}
+			filter.AssigneeIDs = append(filter.AssigneeIDs, id)
+		case "creator":
+			id, err := issueQueryUserID(v, me)
+			if err != nil {
+				return fmt.Errorf("creator no válido: %q", v)
+			}
+			filter.CreatorIDs = append(filter.CreatorIDs, id)
+		case "project", "client":
+			id, err := uuid.Parse(v)
+			if err != nil {
+				return fmt.Errorf("%s no válido: %q", key, v)
+			}
+			if key == "project" {
+				filter.ProjectIDs = append(filter.ProjectIDs, id)
+			} else {
+				filter.ClientIDs = append(filter.ClientIDs, id)
+			}
+		case "is":
+			switch strings.ToLower(v) {
+			case "overdue":
+				filter.Overdue = true
+			case "unassigned":
+				filter.Unassigned = true
+			default:
+				return fmt.Errorf("is no válido: %q (overdue o unassigned)", v)
+			}
+		}
+	}
+	return nil
+}
+
+func issueQueryUserID(value string, me uuid.UUID) (uuid.UUID, error) {
+	if strings.EqualFold(value, "me") {
+		return me, nil
+	}
+	return uuid.Parse(value)
+}
+
+// applyTimeTerm narrows a time range. Dates (YYYY-MM-DD) stand for the whole day, so due<=2026-11-01
+// includes that day; key:from..to sets both ends.
+func applyTimeTerm(r *repository.TimeRange, key, op, value string) error {
+	parse := func(value string) (start, end time.Time, err error) {
+		t, dateOnly, err := parseQueryTime(value)
+		if err != nil {
+			return t, t, fmt.Errorf("%s debe ser una fecha (YYYY-MM-DD) o RFC 3339", key)
+		}
+		if dateOnly {
+			return t, t.AddDate(0, 0, 1), nil
+		}
+		// Timestamps are stored with microsecond precision
+		return t, t.Add(time.Microsecond), nil
+	}
+	if op == ":" {
+		from, to, found := strings.Cut(value, "..")
+		if !found {
+			to = from
+		}
+		start, _, err := parse(from)
+		if err != nil {
+			return err
+		}
+		_, end, err := parse(to)
+		if err != nil {
+			return err
+		}
+		r.From, r.To = &start, &end
+		return nil
+	}
+	start, end, err := parse(value)
+	if err != nil {
+		return err
+	}
+	switch op {
+	case "<":
+		r.To = &start
+	case "<=":
+		r.To = &end
+	case ">":
+		r.From = &end
+	case ">=":
+		r.From = &start
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"mellon-harmony-api/internal/models"
+	"mellon-harmony-api/internal/repository"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func at(value string) *time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t, _ = time.Parse("2006-01-02", value)
+	}
+	return &t
+}
+
+func TestParseIssueQuery(t *testing.T) {
+	me := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+	other := uuid.MustParse("22222222-2222-2222-2222-222222222222")
+
+	tests := []struct {
+		name    string
+		q       string
+		want    repository.IssueFilter
+		wantErr bool
+	}{
+		{"empty", "", repository.IssueFilter{}, false},
+		{"text", "broken  logo", repository.IssueFilter{Text: "broken logo"}, false},
+		{"quoted text", `"new logo" header`, repository.IssueFilter{Text: "new logo header"}, false},
+		{"unknown key is text", "http://example.com", repository.IssueFilter{Text: "http://example.com"}, false},
+		{"statuses", "status:review,TODO", repository.IssueFilter{Statuses: []models.IssueStatus{models.StatusReview, models.StatusTodo}}, false},
+		{"key is case-insensitive", "Priority:high", repository.IssueFilter{Priorities: []models.IssuePriority{models.PriorityHigh}}, false},
+		{"quoted value", `type:"diseño web"`, repository.IssueFilter{TaskTypes: []string{"diseño web"}}, false},
+		{"me and ids", "assignee:me," + other.String() + " creator:ME", repository.IssueFilter{AssigneeIDs: []uuid.UUID{me, other}, CreatorIDs: []uuid.UUID{me}}, false},
+		{"assignee none", "assignee:none", repository.IssueFilter{Unassigned: true}, false},
+		{"flags", "is:overdue is:unassigned", repository.IssueFilter{Overdue: true, Unassigned: true}, false},
+		{"project and client", "project:" + other.String() + " client:" + me.String(), repository.IssueFilter{ProjectIDs: []uuid.UUID{other}, ClientIDs: []uuid.UUID{me}}, false},
+		{"before a day", "due<2026-11-01", repository.IssueFilter{Due: repository.TimeRange{To: at("2026-11-01")}}, false},
+		{"up to a day includes it", "due<=2026-11-01", repository.IssueFilter{Due: repository.TimeRange{To: at("2026-11-02")}}, false},
+		{"after a day excludes it", "start>2026-10-01", repository.IssueFilter{Start: repository.TimeRange{From: at("2026-10-02")}}, false},
+		{"from a day", "start>=2026-10-01", repository.IssueFilter{Start: repository.TimeRange{From: at("2026-10-01")}}, false},
+		{"one day", "approved:2026-10-01", repository.IssueFilter{Approved: repository.TimeRange{From: at("2026-10-01"), To: at("2026-10-02")}}, false},
+		{"range of days", "due:2026-11-01..2026-11-30", repository.IssueFilter{Due: repository.TimeRange{From: at("2026-11-01"), To: at("2026-12-01")}}, false},
+		{"timestamp", "due<=2026-11-01T10:00:00Z", repository.IssueFilter{Due: repository.TimeRange{To: func() *time.Time { t := at("2026-11-01T10:00:00Z").Add(time.Microsecond); return &t }()}}, false},
+		{"terms and text", "status:done logo assignee:me", repository.IssueFilter{Statuses: []models.IssueStatus{models.StatusDone}, AssigneeIDs: []uuid.UUID{me}, Text: "logo"}, false},
+		{"invalid status", "status:blocked", repository.IssueFilter{}, true},
+		{"invalid priority", "priority:urgent", repository.IssueFilter{}, true},
+		{"invalid user", "assignee:bob", repository.IssueFilter{}, true},
+		{"invalid project", "project:abc", repository.IssueFilter{}, true},
+		{"invalid flag", "is:blocked", repository.IssueFilter{}, true},
+		{"invalid date", "due<tomorrow", repository.IssueFilter{}, true},
+		{"invalid range end", "due:2026-11-01..soon", repository.IssueFilter{}, true},
+		{"comparison on a value key", "status>done", repository.IssueFilter{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var filter repository.IssueFilter
+			err := parseIssueQuery(&filter, tt.q, me)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseIssueQuery(%q) error = %v, want error %v", tt.q, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(filter, tt.want) {
+				t.Errorf("parseIssueQuery(%q) = %+v, want %+v", tt.q, filter, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitIssueQuery(t *testing.T) {
+	tests := []struct {
+		q    string
+		want []string
+	}{
+		{"", nil},
+		{"  a \t b\n", []string{"a", "b"}},
+		{`"a b" c`, []string{`"a b"`, "c"}},
+		{`type:"x y",z due<1`, []string{`type:"x y",z`, "due<1"}},
+		{`"unclosed quote`, []string{`"unclosed quote`}},
+	}
+	for _, tt := range tests {
+		if got := splitIssueQuery(tt.q); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitIssueQuery(%q) = %q, want %q", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestIssueFilterParams(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	me := uuid.New()
+
+	tests := []struct {
+		name    string
+		query   string
+		want    repository.IssueFilter
+		wantErr bool
+	}{
+		{"none", "", repository.IssueFilter{}, false},
+		{"comma-separated", "status=todo,done&priority=low", repository.IssueFilter{
+			Statuses:   []models.IssueStatus{models.StatusTodo, models.StatusDone},
+			Priorities: []models.IssuePriority{models.PriorityLow},
+		}, false},
+		{"dates", "due_from=2026-11-01&due_to=2026-11-30", repository.IssueFilter{Due: repository.TimeRange{From: at("2026-11-01"), To: at("2026-12-01")}}, false},
+		{"flags", "overdue=true&unassigned=true", repository.IssueFilter{Overdue: true, Unassigned: true}, false},
+		{"parameters and q", "assigned_to=me&q=status:review+logo", repository.IssueFilter{
+			AssigneeIDs: []uuid.UUID{me},
+			Statuses:    []models.IssueStatus{models.StatusReview},
+			Text:        "logo",
+		}, false},
+		{"invalid parameter", "client_id=abc", repository.IssueFilter{}, true},
+		{"invalid q", "q=due<soon", repository.IssueFilter{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", "/issues?"+tt.query, nil)
+			filter, err := issueFilter(c, me)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("issueFilter(%q) error = %v, want error %v", tt.query, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(filter, tt.want) {
+				t.Errorf("issueFilter(%q) = %+v, want %+v", tt.query, filter, tt.want)
+			}
+		})
+	}
+}
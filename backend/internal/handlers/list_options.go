@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"mellon-harmony-api/internal/repository"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 200
+)
+
+// ListResponseHeaders are the headers of paginated lists, exposed to the browser by CORS.
+var ListResponseHeaders = []string{"X-Total-Count", "Link"}
+
+// Sort values accepted by the list endpoints and their ORDER BY expressions.
+var (
+	issueSortColumns = map[string]string{
+		"created_at": "created_at",
+		"updated_at": "updated_at",
+		"start_date": "start_date",
+		"due_date":   "due_date",
+		"title":      "LOWER(title)",
+		"status":     "CASE status WHEN 'todo' THEN 1 WHEN 'in-progress' THEN 2 WHEN 'review' THEN 3 WHEN 'done' THEN 4 END",
+		"priority":   "CASE priority WHEN 'low' THEN 1 WHEN 'medium' THEN 2 WHEN 'high' THEN 3 END",
+	}
+	projectSortColumns = map[string]string{
+		"created_at": "created_at",
+		"updated_at": "updated_at",
+		"name":       "LOWER(name)",
+		"start_date": "start_date",
+		"deadline":   "deadline",
+		"progress":   "progress",
+	}
+	clientSortColumns = map[string]string{
+		"created_at": "created_at",
+		"updated_at": "updated_at",
+		"name":       "LOWER(name)",
+	}
+	notificationSortColumns = map[string]string{
+		"created_at": "created_at",
+		"type":       "type",
+		"read":       "read",
+	}
+)
+
+// List views: summary rows leave out heavy relations, full rows include them.
+const (
+	viewSummary = "summary"
+	viewFull    = "full"
+)
+
+// listOptions reads the paging and sorting query parameters of a list endpoint: limit (1-200,
+// default 50), page (from 1), sort (one of sortable, default created_at), order (asc or desc,
+// default desc) and view (summary or full, default defaultView).
+func listOptions(c *gin.Context, sortable map[string]string, defaultView string) (repository.ListOptions, error) {
+	opts := repository.ListOptions{Limit: defaultListLimit, Desc: true}
+	switch c.DefaultQuery("view", defaultView) {
+	case viewSummary:
+		opts.Summary = true
+	case viewFull:
+	default:
+		return opts, errors.New("view debe ser summary o full")
+	}
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxListLimit {
+			return opts, fmt.Errorf("limit debe ser un número entre 1 y %d", maxListLimit)
+		}
+		opts.Limit = n
+	}
+	if page := c.Query("page"); page != "" {
+		n, err := strconv.Atoi(page)
+		if err != nil || n < 1 {
+			return opts, errors.New("page debe ser un número mayor que 0")
+		}
+		opts.Offset = (n - 1) * opts.Limit
+	}
+	if value := c.Query("sort"); value != "" {
+		column, ok := sortable[value]
+		if !ok {
+			values := make([]string, 0, len(sortable))
+			for v := range sortable {
+				values = append(values, v)
+			}
+			sort.Strings(values)
+			return opts, fmt.Errorf("sort debe ser uno de: %s", strings.Join(values, ", "))
+		}
+		opts.Sort = column
+	}
+	switch c.DefaultQuery("order", "desc") {
+	case "asc":
+		opts.Desc = false
+	case "desc":
+	default:
+		return opts, errors.New("order debe ser asc o desc")
+	}
+	return opts, nil
+}
+
+// setListHeaders sets X-Total-Count and, when more rows follow, a Link header to the next page.
+func setListHeaders(c *gin.Context, opts repository.ListOptions, total int64) {
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	if opts.Limit == 0 || int64(opts.Offset+opts.Limit) >= total {
+		return
+	}
+	next := *c.Request.URL
+	query := next.Query()
+	query.Set("limit", strconv.Itoa(opts.Limit))
+	query.Set("page", strconv.Itoa(opts.Offset/opts.Limit+2))
+	next.RawQuery = query.Encode()
+	c.Header("Link", fmt.Sprintf(`<%s>; rel="next"`, next.RequestURI()))
+}
+
+// parseQueryTime parses a date (YYYY-MM-DD) or RFC 3339 timestamp from a list filter, reporting
+// whether it was a date so callers can stretch it to the whole day.
+func parseQueryTime(value string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, false, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	return t, true, err
+}
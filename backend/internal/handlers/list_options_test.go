@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"mellon-harmony-api/internal/models"
+	"mellon-harmony-api/internal/repository"
+	"mellon-harmony-api/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func listContext(query string) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/issues?"+query, nil)
+	return c, w
+}
+
+func TestListOptions(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		defaultView string
+		want        repository.ListOptions
+		wantErr     string
+	}{
+		{"defaults", "", viewFull, repository.ListOptions{Limit: defaultListLimit, Desc: true}, ""},
+		{"summary by default", "", viewSummary, repository.ListOptions{Limit: defaultListLimit, Desc: true, Summary: true}, ""},
+		{"full instead of the default summary", "view=full", viewSummary, repository.ListOptions{Limit: defaultListLimit, Desc: true}, ""},
+		{"summary instead of the default full", "view=summary", viewFull, repository.ListOptions{Limit: defaultListLimit, Desc: true, Summary: true}, ""},
+		{"page with the default limit", "page=3", viewFull, repository.ListOptions{Limit: defaultListLimit, Offset: 100, Desc: true}, ""},
+		{"limit and page", "limit=20&page=2", viewFull, repository.ListOptions{Limit: 20, Offset: 20, Desc: true}, ""},
+		{"largest limit", "limit=200", viewFull, repository.ListOptions{Limit: maxListLimit, Desc: true}, ""},
+		{"sort ascending", "sort=title&order=asc", viewFull, repository.ListOptions{Limit: defaultListLimit, Sort: "LOWER(title)"}, ""},
+		{"unknown view", "view=compact", viewFull, repository.ListOptions{}, "view"},
+		{"limit too large", "limit=201", viewFull, repository.ListOptions{}, "limit"},
+		{"limit zero", "limit=0", viewFull, repository.ListOptions{}, "limit"},
+		{"page zero", "page=0", viewFull, repository.ListOptions{}, "page"},
+		{"page not a number", "page=two", viewFull, repository.ListOptions{}, "page"},
+		{"unknown sort", "sort=password", viewFull, repository.ListOptions{}, "sort debe ser uno de: created_at, due_date, priority"},
+		{"unknown order", "order=up", viewFull, repository.ListOptions{}, "order"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := listContext(tt.query)
+			got, err := listOptions(c, issueSortColumns, tt.defaultView)
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Errorf("listOptions(%q) error = %v, want %q", tt.query, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("listOptions(%q) = %+v, %v; want %+v", tt.query, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetListHeaders(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		opts     repository.ListOptions
+		total    int64
+		wantLink string
+	}{
+		{"first of several pages", "status=todo", repository.ListOptions{Limit: 50}, 120, `</issues?limit=50&page=2&status=todo>; rel="next"`},
+		{"middle page", "limit=50&page=2", repository.ListOptions{Limit: 50, Offset: 50}, 120, `</issues?limit=50&page=3>; rel="next"`},
+		{"last page", "limit=50&page=3", repository.ListOptions{Limit: 50, Offset: 100}, 120, ""},
+		{"exactly one page", "", repository.ListOptions{Limit: 50}, 50, ""},
+		{"every row", "", repository.ListOptions{}, 120, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, w := listContext(tt.query)
+			setListHeaders(c, tt.opts, tt.total)
+			if got := w.Header().Get("X-Total-Count"); got != strconv.FormatInt(tt.total, 10) {
+				t.Errorf("X-Total-Count = %q, want %d", got, tt.total)
+			}
+			if got := w.Header().Get("Link"); got != tt.wantLink {
+				t.Errorf("Link = %q, want %q", got, tt.wantLink)
+			}
+		})
+	}
+}
+
+// listingIssueService returns its issues and records the list options it was asked for.
+type listingIssueService struct {
+	service.IssueService
+	issues []models.Issue
+	opts   repository.ListOptions
+}
+
+func (s *listingIssueService) GetIssues(filter repository.IssueFilter, opts repository.ListOptions, user *models.User) ([]models.Issue, int64, error) {
+	s.opts = opts
+	issues := make([]models.Issue, len(s.issues))
+	copy(issues, s.issues)
+	for i := range issues {
+		// Summary rows come with a count instead of comments, as from the repository
+		if opts.Summary {
+			issues[i].CommentCount = len(issues[i].Comments)
+			issues[i].Comments = nil
+		}
+	}
+	return issues, int64(len(issues)), nil
+}
+
+func TestIssueHandlerGetIssuesView(t *testing.T) {
+	user := &models.User{Role: models.RoleUser}
+	users := newMemoryUserRepository(user)
+	issue := models.Issue{ID: uuid.New(), Title: "Logo", Comments: []models.Comment{{Text: "¿Azul?"}, {Text: "Mejor verde"}}}
+
+	tests := []struct {
+		query        string
+		wantSummary  bool
+		wantContains string
+		wantMissing  string
+	}{
+		{"", true, `"comment_count":2`, `"comments"`},
+		{"?view=summary", true, `"comment_count":2`, `"comments"`},
+		{"?view=full", false, `"text":"Mejor verde"`, `"comment_count"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			issues := &listingIssueService{issues: []models.Issue{issue}}
+			h := NewIssueHandler(issues, users, nil, nil, nil, nil)
+			w := serve(h.GetIssues, user, http.MethodGet, "/issues"+tt.query, "/issues", "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("GetIssues = %d %s", w.Code, w.Body)
+			}
+			if issues.opts.Summary != tt.wantSummary || issues.opts.Limit != defaultListLimit {
+				t.Errorf("list options = %+v, want summary %v and the default limit", issues.opts, tt.wantSummary)
+			}
+			body := w.Body.String()
+			if !strings.Contains(body, tt.wantContains) || strings.Contains(body, tt.wantMissing) {
+				t.Errorf("body = %s, want %s without %s", body, tt.wantContains, tt.wantMissing)
+			}
+		})
+	}
+	// An unknown view is refused before listing anything
+	issues := &listingIssueService{}
+	h := NewIssueHandler(issues, users, nil, nil, nil, nil)
+	if w := serve(h.GetIssues, user, http.MethodGet, "/issues?view=compact", "/issues", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown view = %d, want 400", w.Code)
+	}
+}
@@ -31,12 +31,18 @@ func (h *NotificationHandler) GetNotifications(c *gin.Context) {
 		return
 	}
 
-	notifications, err := h.notificationService.GetUserNotifications(userID)
+	opts, err := listOptions(c, notificationSortColumns, viewFull)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	notifications, total, err := h.notificationService.GetUserNotifications(userID, opts)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	setListHeaders(c, opts, total)
 	c.JSON(http.StatusOK, notifications)
 }
 
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"mellon-harmony-api/internal/models"
+	"mellon-harmony-api/internal/service"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// oidcStateCookie binds a login to the browser that started it: Callback only accepts the state
+// stored in this cookie by Login, so a login cannot be forced onto someone else's browser.
+const oidcStateCookie = "oidc_state"
+
+// OIDCHandler serves the single sign-on redirect and callback.
+type OIDCHandler struct {
+	authService service.AuthService
+	oidcService service.OIDCService
+	frontendURL string
+	urlSigner   *service.FileURLSigner
+}
+
+// NewOIDCHandler uses the first origin in frontendURL (comma-separated FRONTEND_URL) as the post-login target.
+func NewOIDCHandler(authService service.AuthService, oidcService service.OIDCService, frontendURL string, urlSigner *service.FileURLSigner) *OIDCHandler {
+	frontend := strings.TrimSpace(strings.Split(frontendURL, ",")[0])
+	return &OIDCHandler{
+		authService: authService,
+		oidcService: oidcService,
+		frontendURL: strings.TrimSuffix(frontend, "/"),
+		urlSigner:   urlSigner,
+	}
+}
+
+// ExchangeRequest carries the code the callback handed to the frontend.
+type ExchangeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// Config tells the login page whether to show the SSO button.
+func (h *OIDCHandler) Config(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"enabled": h.oidcService.IsConfigured()})
+}
+
+// Login redirects the browser to the identity provider.
+func (h *OIDCHandler) Login(c *gin.Context) {
+	authURL, state, err := h.oidcService.AuthorizationURL()
+	if err != nil {
+		if errors.Is(err, service.ErrOIDCNotConfigured) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("OIDC login: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "No se pudo contactar al proveedor de identidad"})
+		return
+	}
+	h.setStateCookie(c, state, int(service.OIDCStateTTL.Seconds()))
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback completes the code exchange and sends the browser to the frontend with a single-use
+// code, which the frontend exchanges at POST /auth/oidc/exchange for tokens or a 2FA challenge.
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	expectedState, _ := c.Cookie(oidcStateCookie)
+	h.setStateCookie(c, "", -1)
+
+	if idpErr := c.Query("error"); idpErr != "" {
+		log.Printf("OIDC callback: provider returned %s: %s", idpErr, c.Query("error_description"))
+		h.redirectError(c, service.ErrOIDCLoginFailed.Error())
+		return
+	}
+	state := c.Query("state")
+	if expectedState == "" || subtle.ConstantTimeCompare([]byte(state), []byte(expectedState)) != 1 {
+		log.Printf("OIDC callback: state does not match the browser's login cookie")
+		h.redirectError(c, service.ErrOIDCLoginFailed.Error())
+		return
+	}
+
+	user, err := h.oidcService.HandleCallback(c.Query("code"), state)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrOIDCUserNotAllowed), errors.Is(err, service.ErrOIDCNotConfigured):
+			h.redirectError(c, err.Error())
+		default:
+			log.Printf("OIDC callback: %v", err)
+			h.redirectError(c, service.ErrOIDCLoginFailed.Error())
+		}
+		return
+	}
+
+	// Without a frontend the browser gets the login result directly, as from POST /auth/login
+	if h.frontendURL == "" {
+		h.completeLogin(c, user)
+		return
+	}
+	code, err := h.oidcService.IssueLoginCode(user)
+	if err != nil {
+		log.Printf("OIDC callback: failed to issue login code: %v", err)
+		h.redirectError(c, service.ErrOIDCLoginFailed.Error())
+		return
+	}
+	fragment := url.Values{}
+	fragment.Set("code", code)
+	c.Redirect(http.StatusFound, h.frontendURL+"/sso#"+fragment.Encode())
+}
+
+// Exchange redeems the code from Callback. The response is the same as POST /auth/login: tokens,
+// or a challenge when the user has 2FA or their role requires it.
+func (h *OIDCHandler) Exchange(c *gin.Context) {
+	var req ExchangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, err := h.oidcService.RedeemLoginCode(req.Code)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": service.ErrOIDCLoginFailed.Error()})
+		return
+	}
+	h.completeLogin(c, user)
+}
+
+func (h *OIDCHandler) completeLogin(c *gin.Context, user *models.User) {
+	result, err := h.authService.CompleteLogin(user, sessionMeta(c))
+	if err != nil {
+		log.Printf("OIDC login: failed to complete login: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": service.ErrOIDCLoginFailed.Error()})
+		return
+	}
+	respondLoginResult(c, h.urlSigner, http.StatusOK, result, user)
+}
+
+// setStateCookie stores (maxAge > 0) or clears the state cookie. It is scoped to the OIDC routes,
+// hidden from scripts and sent on the top-level redirect back from the identity provider (Lax).
+func (h *OIDCHandler) setStateCookie(c *gin.Context, state string, maxAge int) {
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     path.Dir(c.Request.URL.Path),
+		MaxAge:   maxAge,
+		Secure:   secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (h *OIDCHandler) redirectError(c *gin.Context, message string) {
+	if h.frontendURL == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": message})
+		return
+	}
+	c.Redirect(http.StatusFound, h.frontendURL+"/?sso_error="+url.QueryEscape(message))
+}
@@ -18,15 +18,18 @@ type ProjectHandler struct {
 	notificationService  service.NotificationService
 	projectRepo          repository.ProjectRepository
 	clientMemberRepo     repository.ClientMemberRepository
+	permissionService    service.PermissionService
+	urlSigner            *service.FileURLSigner
 }
 
-func NewProjectHandler(projectService service.ProjectService, userRepo repository.UserRepository, notificationService service.NotificationService, projectRepo repository.ProjectRepository, clientMemberRepo repository.ClientMemberRepository) *ProjectHandler {
+func NewProjectHandler(projectService service.ProjectService, userRepo repository.UserRepository, notificationService service.NotificationService, projectRepo repository.ProjectRepository, clientMemberRepo repository.ClientMemberRepository, permissionService service.PermissionService, urlSigner *service.FileURLSigner) *ProjectHandler {
 	return &ProjectHandler{
 		projectService:      projectService,
 		userRepo:            userRepo,
 		notificationService: notificationService,
 		projectRepo:         projectRepo,
 		clientMemberRepo:    clientMemberRepo,
+		permissionService:   permissionService,
 	}
 }
 
@@ -39,13 +42,19 @@ func (h *ProjectHandler) GetProjects(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuario no encontrado"})
 		return
 	}
-	projects, err := h.projectService.GetProjectsForUser(userID, string(currentUser.Role))
+	opts, err := listOptions(c, projectSortColumns, viewFull)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	projects, total, err := h.projectService.GetProjectsForUser(userID, h.permissionService.HasPermission(currentUser, models.PermProjectViewAll), opts)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, projects)
+	setListHeaders(c, opts, total)
+	c.JSON(http.StatusOK, signFileURLs(h.urlSigner, projects))
 }
 
 func (h *ProjectHandler) GetProject(c *gin.Context) {
@@ -61,7 +70,7 @@ func (h *ProjectHandler) GetProject(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, project)
+	c.JSON(http.StatusOK, signFileURLs(h.urlSigner, project))
 }
 
 type CreateProjectRequest struct {
@@ -93,8 +102,8 @@ func (h *ProjectHandler) CreateProject(c *gin.Context) {
 		return
 	}
 
-	// Admin/team_lead can create any project; regular users can only create projects for clients they belong to
-	if currentUser.Role != models.RoleAdmin && currentUser.Role != models.RoleTeamLead {
+	// project.manage allows any project; otherwise users can only create projects for clients they belong to
+	if !h.permissionService.HasPermission(currentUser, models.PermProjectManage) {
 		if req.ClientID == nil {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Debes especificar un cliente para crear un proyecto"})
 			return
@@ -151,37 +160,26 @@ func (h *ProjectHandler) CreateProject(c *gin.Context) {
 		project.Type = "Campaña"
 	}
 
-	if err := h.projectService.CreateProject(project); err != nil {
+	if err := h.projectService.CreateProject(project, auditMeta(c)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Notify all admins and team leads about new project (except creator)
+	// Notify supervisors about new project (except creator)
 	if h.notificationService != nil {
 		go func() {
-			allUsers, err := h.userRepo.GetAll()
-			if err == nil {
-				creator, _ := h.userRepo.GetByID(userID)
-				creatorName := "Sistema"
-				if creator != nil {
-					creatorName = creator.Name
-				}
-				projectID := &project.ID
-				title := "Nuevo proyecto creado: " + project.Name
-				message := creatorName + " ha creado un nuevo proyecto: \"" + project.Name + "\""
-				for _, user := range allUsers {
-					// Notify admins and team leads, but not the creator
-					if (user.Role == models.RoleAdmin || user.Role == models.RoleTeamLead) && user.ID != userID {
-						if err := h.notificationService.CreateNotification(user.ID, models.NotificationTypeStatus, title, message, projectID); err != nil {
-							log.Printf("Failed to notify admin/team lead %s about new project: %v", user.ID, err)
-						}
-					}
-				}
+			creator, _ := h.userRepo.GetByID(userID)
+			creatorName := "Sistema"
+			if creator != nil {
+				creatorName = creator.Name
 			}
+			title := "Nuevo proyecto creado: " + project.Name
+			message := creatorName + " ha creado un nuevo proyecto: \"" + project.Name + "\""
+			notifySupervisors(h.userRepo, h.permissionService, h.notificationService, userID, title, message, &project.ID)
 		}()
 	}
 
-	c.JSON(http.StatusCreated, project)
+	c.JSON(http.StatusCreated, signFileURLs(h.urlSigner, project))
 }
 
 type UpdateProjectRequest struct {
@@ -213,8 +211,8 @@ func (h *ProjectHandler) UpdateProject(c *gin.Context) {
 		return
 	}
 
-	// Admin and team_lead can update any project; regular users can only update projects of clients they belong to
-	if currentUser.Role != models.RoleAdmin && currentUser.Role != models.RoleTeamLead {
+	// project.manage allows any project; otherwise users can only update projects of clients they belong to
+	if !h.permissionService.HasPermission(currentUser, models.PermProjectManage) {
 		project, err := h.projectService.GetProject(id)
 		if err != nil || project == nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
@@ -278,7 +276,7 @@ func (h *ProjectHandler) UpdateProject(c *gin.Context) {
 	// Get old project for comparison
 	oldProject, _ := h.projectService.GetProject(id)
 
-	project, err := h.projectService.UpdateProject(id, updates)
+	project, err := h.projectService.UpdateProject(id, updates, auditMeta(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -347,26 +345,16 @@ func (h *ProjectHandler) UpdateProject(c *gin.Context) {
 					}
 				}
 
-				// Notify all admins and team leads about project update ONLY if the updater is a regular user
-				// If admin/team lead makes the change, only notify people involved (not other admins/team leads)
-				if currentUser != nil && currentUser.Role == models.RoleUser {
-					allUsers, err := h.userRepo.GetAll()
-					if err == nil {
-						for _, user := range allUsers {
-							// Notify admins and team leads, but not the updater
-							if (user.Role == models.RoleAdmin || user.Role == models.RoleTeamLead) && user.ID != currentUserID {
-								if err := h.notificationService.CreateNotification(user.ID, models.NotificationTypeStatus, title, message, projectID); err != nil {
-									log.Printf("Failed to notify admin/team lead %s about project update: %v", user.ID, err)
-								}
-							}
-						}
-					}
+				// Notify supervisors about project update ONLY if the updater is not a supervisor
+				// If a supervisor makes the change, only notify people involved (not other supervisors)
+				if !h.permissionService.HasPermission(currentUser, models.PermActivityNotify) {
+					notifySupervisors(h.userRepo, h.permissionService, h.notificationService, currentUserID, title, message, projectID)
 				}
 			}()
 		}
 	}
 
-	c.JSON(http.StatusOK, project)
+	c.JSON(http.StatusOK, signFileURLs(h.urlSigner, project))
 }
 
 func (h *ProjectHandler) DeleteProject(c *gin.Context) {
@@ -385,8 +373,8 @@ func (h *ProjectHandler) DeleteProject(c *gin.Context) {
 		return
 	}
 
-	// Admin/team_lead can delete any project; regular users can only delete projects of clients they belong to
-	if currentUser.Role != models.RoleAdmin && currentUser.Role != models.RoleTeamLead {
+	// project.manage allows any project; otherwise users can only delete projects of clients they belong to
+	if !h.permissionService.HasPermission(currentUser, models.PermProjectManage) {
 		project, err := h.projectService.GetProject(id)
 		if err != nil || project == nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
@@ -403,7 +391,7 @@ func (h *ProjectHandler) DeleteProject(c *gin.Context) {
 		}
 	}
 
-	if err := h.projectService.DeleteProject(id); err != nil {
+	if err := h.projectService.DeleteProject(id, auditMeta(c)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -499,13 +487,7 @@ func (h *ProjectHandler) BulkCreateMonthly(c *gin.Context) {
 	userIDStr, _ := c.Get("user_id")
 	userID, _ := uuid.Parse(userIDStr.(string))
 
-	currentUser, err := GetCurrentUserFromDB(c, h.userRepo)
-	if err != nil || currentUser == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuario no encontrado"})
-		return
-	}
-	if currentUser.Role != models.RoleAdmin && currentUser.Role != models.RoleTeamLead {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Solo administradores y líderes de equipo pueden crear proyectos masivos"})
+	if _, ok := requirePermission(c, h.userRepo, h.permissionService, models.PermProjectBulkCreate, "No tienes permiso para crear proyectos masivos"); !ok {
 		return
 	}
 
@@ -530,5 +512,5 @@ func (h *ProjectHandler) BulkCreateMonthly(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "Proyectos creados", "created": len(created), "projects": created})
+	c.JSON(http.StatusCreated, signFileURLs(h.urlSigner, gin.H{"message": "Proyectos creados", "created": len(created), "projects": created}))
 }
@@ -2,7 +2,6 @@ package handlers
 
 import (
 	"fmt"
-	"mellon-harmony-api/internal/models"
 	"mellon-harmony-api/internal/repository"
 	"net/http"
 	"time"
@@ -12,50 +11,50 @@ import (
 	"github.com/xuri/excelize/v2"
 )
 
+// ReportHandler builds client Excel reports. Its routes are gated by the report.download
+// permission (middleware.RequirePermission), so the handlers do not check roles themselves.
 type ReportHandler struct {
 	clientRepo  repository.ClientRepository
 	projectRepo repository.ProjectRepository
-	userRepo    repository.UserRepository
 }
 
-func NewReportHandler(clientRepo repository.ClientRepository, projectRepo repository.ProjectRepository, userRepo repository.UserRepository) *ReportHandler {
+func NewReportHandler(clientRepo repository.ClientRepository, projectRepo repository.ProjectRepository) *ReportHandler {
 	return &ReportHandler{
 		clientRepo:  clientRepo,
 		projectRepo: projectRepo,
-		userRepo:    userRepo,
 	}
 }
 
-func (h *ReportHandler) DownloadClientReportFiltered(c *gin.Context) {
-	clientID, err := uuid.Parse(c.Param("id"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client ID"})
-		return
-	}
-
+// planningPeriod parses the month (1-12) and year query params of a Planner period, responding
+// with an error if either is missing or invalid.
+func planningPeriod(c *gin.Context) (int, int, bool) {
 	month := c.Query("month")
 	year := c.Query("year")
 	if month == "" || year == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "month and year query params are required"})
-		return
+		return 0, 0, false
 	}
 	var monthInt, yearInt int
 	if _, err := fmt.Sscanf(month, "%d", &monthInt); err != nil || monthInt < 1 || monthInt > 12 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid month (1-12)"})
-		return
+		return 0, 0, false
 	}
 	if _, err := fmt.Sscanf(year, "%d", &yearInt); err != nil || yearInt < 2000 || yearInt > 2100 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid year"})
-		return
+		return 0, 0, false
 	}
+	return monthInt, yearInt, true
+}
 
-	currentUser, err := GetCurrentUserFromDB(c, h.userRepo)
-	if err != nil || currentUser == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuario no encontrado"})
+func (h *ReportHandler) DownloadClientReportFiltered(c *gin.Context) {
+	clientID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client ID"})
 		return
 	}
-	if currentUser.Role != models.RoleAdmin && currentUser.Role != models.RoleTeamLead {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Solo administradores y líderes de equipo pueden descargar reportes"})
+
+	monthInt, yearInt, ok := planningPeriod(c)
+	if !ok {
 		return
 	}
 
@@ -167,16 +166,6 @@ func (h *ReportHandler) DownloadClientReport(c *gin.Context) {
 		return
 	}
 
-	currentUser, err := GetCurrentUserFromDB(c, h.userRepo)
-	if err != nil || currentUser == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuario no encontrado"})
-		return
-	}
-	if currentUser.Role != models.RoleAdmin && currentUser.Role != models.RoleTeamLead {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Solo administradores y líderes de equipo pueden descargar reportes"})
-		return
-	}
-
 	_, err = h.clientRepo.GetByID(clientID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Client not found"})
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"errors"
+	"mellon-harmony-api/internal/models"
+	"mellon-harmony-api/internal/repository"
+	"mellon-harmony-api/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RoleHandler exposes the permission catalogue and role editing. Write routes are gated by
+// the role.manage permission (middleware.RequirePermission); editors can only grant permissions
+// they hold themselves.
+type RoleHandler struct {
+	permissionService service.PermissionService
+	userRepo          repository.UserRepository
+}
+
+func NewRoleHandler(permissionService service.PermissionService, userRepo repository.UserRepository) *RoleHandler {
+	return &RoleHandler{
+		permissionService: permissionService,
+		userRepo:          userRepo,
+	}
+}
+
+type CreateRoleRequest struct {
+	Name        models.UserRole `json:"name" binding:"required,max=20"`
+	Label       string          `json:"label" binding:"max=100"`
+	Description string          `json:"description" binding:"max=1000"`
+	Permissions []string        `json:"permissions"`
+}
+
+type UpdateRoleRequest struct {
+	Label       *string  `json:"label" binding:"omitempty,max=100"`
+	Description *string  `json:"description" binding:"omitempty,max=1000"`
+	Permissions []string `json:"permissions"` // omit to keep the current set
+}
+
+func roleErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrRoleNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrRoleExists), errors.Is(err, service.ErrRoleInUse):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrRoleProtected), errors.Is(err, service.ErrPermissionEscalation):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrInvalidRole):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// GetPermissions lists every permission a role can grant.
+func (h *RoleHandler) GetPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, models.AllPermissions)
+}
+
+func (h *RoleHandler) GetRoles(c *gin.Context) {
+	roles, err := h.permissionService.ListRoles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, roles)
+}
+
+func (h *RoleHandler) CreateRole(c *gin.Context) {
+	currentUser, err := GetCurrentUserFromDB(c, h.userRepo)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuario no encontrado"})
+		return
+	}
+
+	var req CreateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role, err := h.permissionService.CreateRole(currentUser, req.Name, req.Label, req.Description, req.Permissions, auditMeta(c))
+	if err != nil {
+		c.JSON(roleErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, role)
+}
+
+// UpdateRole edits a role's label, description or permissions. The admin role cannot be changed.
+func (h *RoleHandler) UpdateRole(c *gin.Context) {
+	currentUser, err := GetCurrentUserFromDB(c, h.userRepo)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuario no encontrado"})
+		return
+	}
+
+	var req UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role, err := h.permissionService.UpdateRole(currentUser, models.UserRole(c.Param("name")), req.Label, req.Description, req.Permissions, auditMeta(c))
+	if err != nil {
+		c.JSON(roleErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, role)
+}
+
+// DeleteRole removes a custom role that no user has.
+func (h *RoleHandler) DeleteRole(c *gin.Context) {
+	if err := h.permissionService.DeleteRole(models.UserRole(c.Param("name")), auditMeta(c)); err != nil {
+		c.JSON(roleErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role deleted successfully"})
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"errors"
+	"mellon-harmony-api/internal/models"
+	"mellon-harmony-api/internal/repository"
+	"mellon-harmony-api/internal/service"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 50
+)
+
+// SearchHandler serves the full-text search. Results only include what the user can open: issues
+// and their comments as in GET /issues/:id, projects and clients of the user's client teams (every
+// one with project.view_all).
+type SearchHandler struct {
+	searchService service.SearchService
+	userRepo      repository.UserRepository
+}
+
+func NewSearchHandler(searchService service.SearchService, userRepo repository.UserRepository) *SearchHandler {
+	return &SearchHandler{
+		searchService: searchService,
+		userRepo:      userRepo,
+	}
+}
+
+// Search handles GET /search?q=&type=issue,comment&limit=, returning the best matches first.
+func (h *SearchHandler) Search(c *gin.Context) {
+	user, err := GetCurrentUserFromDB(c, h.userRepo)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuario no encontrado"})
+		return
+	}
+
+	text := strings.TrimSpace(c.Query("q"))
+	if text == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q es obligatorio"})
+		return
+	}
+	var types []string
+	for _, t := range strings.Split(c.Query("type"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, t)
+		}
+	}
+	limit := defaultSearchLimit
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxSearchLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit debe ser un número entre 1 y " + strconv.Itoa(maxSearchLimit)})
+			return
+		}
+		limit = n
+	}
+
+	results, err := h.searchService.Search(user, text, types, limit)
+	if errors.Is(err, service.ErrInvalidSearchType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type debe ser uno o varios de: " + strings.Join([]string{
+			models.SearchTypeIssue, models.SearchTypeComment, models.SearchTypeProject, models.SearchTypeClient,
+		}, ", ")})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if results == nil {
+		results = []models.SearchResult{}
+	}
+	c.JSON(http.StatusOK, results)
+}
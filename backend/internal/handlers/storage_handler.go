@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"errors"
+	"mellon-harmony-api/internal/models"
+	"mellon-harmony-api/internal/repository"
+	"mellon-harmony-api/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// StorageHandler reports the storage used by clients' uploads and manages their quotas. The
+// overview and quota changes are gated by the storage.manage permission (middleware.RequirePermission).
+type StorageHandler struct {
+	fileService       *service.FileService
+	clientService     service.ClientService
+	userRepo          repository.UserRepository
+	clientMemberRepo  repository.ClientMemberRepository
+	permissionService service.PermissionService
+}
+
+func NewStorageHandler(fileService *service.FileService, clientService service.ClientService, userRepo repository.UserRepository, clientMemberRepo repository.ClientMemberRepository, permissionService service.PermissionService) *StorageHandler {
+	return &StorageHandler{
+		fileService:       fileService,
+		clientService:     clientService,
+		userRepo:          userRepo,
+		clientMemberRepo:  clientMemberRepo,
+		permissionService: permissionService,
+	}
+}
+
+// GetStorageOverview returns the storage used by every client, largest first.
+func (h *StorageHandler) GetStorageOverview(c *gin.Context) {
+	overview, err := h.fileService.GetStorageOverview()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, overview)
+}
+
+// GetClientStorage returns the storage used by a client, by project. Members of the client's team
+// and holders of storage.manage can see it.
+func (h *StorageHandler) GetClientStorage(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": invalidClientIDError})
+		return
+	}
+	currentUser, err := GetCurrentUserFromDB(c, h.userRepo)
+	if err != nil || currentUser == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuario no encontrado"})
+		return
+	}
+	if !h.permissionService.HasPermission(currentUser, models.PermStorageManage) {
+		if member, _ := h.clientMemberRepo.Exists(id, currentUser.ID); !member {
+			c.JSON(http.StatusForbidden, gin.H{"error": "No tienes permiso para ver el almacenamiento de este cliente"})
+			return
+		}
+	}
+	h.respondClientStorage(c, id)
+}
+
+type UpdateStorageQuotaRequest struct {
+	// Quota in bytes; 0 means unlimited and null reverts to the default quota
+	Quota *int64 `json:"quota" binding:"omitempty,min=0"`
+}
+
+// UpdateClientStorageQuota sets a client's storage quota. Files already stored are kept even if
+// they exceed it; only new uploads are refused.
+func (h *StorageHandler) UpdateClientStorageQuota(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": invalidClientIDError})
+		return
+	}
+	var req UpdateStorageQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := h.clientService.UpdateClient(id, map[string]interface{}{"storage_quota": req.Quota}, auditMeta(c)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Client not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.respondClientStorage(c, id)
+}
+
+func (h *StorageHandler) respondClientStorage(c *gin.Context, clientID uuid.UUID) {
+	storage, err := h.fileService.GetClientStorage(clientID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Client not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, storage)
+}
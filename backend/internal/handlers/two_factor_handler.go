@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"errors"
+	"mellon-harmony-api/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required,max=20"`
+}
+
+type TwoFactorChallengeRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required,max=2000"`
+	Code           string `json:"code" binding:"max=20"`
+}
+
+// twoFactorErrorStatus maps 2FA service errors to HTTP status codes.
+func twoFactorErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidTwoFactorCode), errors.Is(err, service.ErrInvalidChallengeToken):
+		return http.StatusUnauthorized
+	case errors.Is(err, service.ErrTwoFactorAlreadyEnabled), errors.Is(err, service.ErrTwoFactorNotEnabled),
+		errors.Is(err, service.ErrTwoFactorSetupNotStarted):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrTwoFactorRequired):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// SetupTwoFactor starts TOTP enrollment for the current user and returns the secret and otpauth:// URI.
+func (h *AuthHandler) SetupTwoFactor(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	setup, err := h.authService.BeginTwoFactorSetup(userID)
+	if err != nil {
+		c.JSON(twoFactorErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":           setup.Secret,
+		"provisioning_uri": setup.ProvisioningURI,
+	})
+}
+
+// EnableTwoFactor confirms enrollment with a code from the authenticator app and returns recovery codes.
+func (h *AuthHandler) EnableTwoFactor(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := h.authService.ConfirmTwoFactorSetup(userID, req.Code)
+	if err != nil {
+		c.JSON(twoFactorErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Verificación en dos pasos activada",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTwoFactor turns 2FA off; requires a current TOTP or recovery code.
+func (h *AuthHandler) DisableTwoFactor(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.authService.DisableTwoFactor(userID, req.Code); err != nil {
+		c.JSON(twoFactorErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Verificación en dos pasos desactivada"})
+}
+
+// RegenerateRecoveryCodes invalidates the old recovery codes and returns a new set.
+func (h *AuthHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := h.authService.RegenerateRecoveryCodes(userID, req.Code)
+	if err != nil {
+		c.JSON(twoFactorErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// SetupTwoFactorChallenge starts enrollment during login for roles that must use 2FA.
+func (h *AuthHandler) SetupTwoFactorChallenge(c *gin.Context) {
+	var req TwoFactorChallengeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	setup, err := h.authService.BeginTwoFactorSetupWithChallenge(req.ChallengeToken)
+	if err != nil {
+		c.JSON(twoFactorErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":           setup.Secret,
+		"provisioning_uri": setup.ProvisioningURI,
+	})
+}
+
+// VerifyTwoFactor completes the second login step and returns the normal token pair.
+func (h *AuthHandler) VerifyTwoFactor(c *gin.Context) {
+	var req TwoFactorChallengeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code is required"})
+		return
+	}
+
+	result, err := h.authService.VerifyTwoFactorChallenge(req.ChallengeToken, req.Code, sessionMeta(c))
+	if err != nil {
+		if respondIfLocked(c, err) {
+			return
+		}
+		c.JSON(twoFactorErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	result.User.Password = ""
+	response := tokenResponse(result.Tokens, result.User)
+	if len(result.RecoveryCodes) > 0 {
+		response["recovery_codes"] = result.RecoveryCodes
+	}
+	c.JSON(http.StatusOK, signFileURLs(h.urlSigner, response))
+}
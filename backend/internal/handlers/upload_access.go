@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"mellon-harmony-api/internal/models"
+	"mellon-harmony-api/internal/repository"
+	"mellon-harmony-api/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// uploadAccess checks that the uploader may store files for the user, client and project named in an
+// upload, which decide where the file is kept, whose storage quota it counts against and, for
+// avatars and logos, whose picture it becomes.
+type uploadAccess struct {
+	userRepo          repository.UserRepository
+	clientMemberRepo  repository.ClientMemberRepository
+	projectRepo       repository.ProjectRepository
+	permissionService service.PermissionService
+}
+
+func newUploadAccess(userRepo repository.UserRepository, clientMemberRepo repository.ClientMemberRepository, projectRepo repository.ProjectRepository, permissionService service.PermissionService) uploadAccess {
+	return uploadAccess{
+		userRepo:          userRepo,
+		clientMemberRepo:  clientMemberRepo,
+		projectRepo:       projectRepo,
+		permissionService: permissionService,
+	}
+}
+
+// authorize responds 401 or 403 and returns false when the current user may not upload with opts.
+// Empty or invalid IDs are stored as "general" and need no access; avatars and logos, which
+// require them, are rejected later.
+func (a uploadAccess) authorize(c *gin.Context, opts service.UploadOptions) bool {
+	user, err := GetCurrentUserFromDB(c, a.userRepo)
+	if err != nil || user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuario no encontrado"})
+		return false
+	}
+	switch opts.Purpose {
+	case models.FilePurposeAvatar:
+		// Same rule as updating a profile: your own, or anyone's with user management
+		if userID, err := uuid.Parse(opts.UserID); err == nil && userID != user.ID && !a.permissionService.HasPermission(user, models.PermUserManage) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "No tienes permiso para cambiar el avatar de este usuario"})
+			return false
+		}
+	case models.FilePurposeClientLogo:
+		// Same rule as updating a client: its team, or anyone with client management
+		if clientID, err := uuid.Parse(opts.ClientID); err == nil && !a.canManageClient(user, clientID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "No tienes permiso para cambiar el logo de este cliente"})
+			return false
+		}
+	}
+	if clientID, err := uuid.Parse(opts.ClientID); err == nil && !a.canUseClient(user, clientID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "No tienes permiso para subir archivos a este cliente"})
+		return false
+	}
+	if projectID, err := uuid.Parse(opts.ProjectID); err == nil && !a.canUseProject(user, projectID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "No tienes permiso para subir archivos a este proyecto"})
+		return false
+	}
+	return true
+}
+
+// canUseClient allows members of the client's team and anyone who can manage or see the work of every client.
+func (a uploadAccess) canUseClient(user *models.User, clientID uuid.UUID) bool {
+	if a.permissionService.HasPermission(user, models.PermClientManage) || a.permissionService.HasPermission(user, models.PermIssueViewAll) {
+		return true
+	}
+	member, _ := a.clientMemberRepo.Exists(clientID, user.ID)
+	return member
+}
+
+func (a uploadAccess) canManageClient(user *models.User, clientID uuid.UUID) bool {
+	if a.permissionService.HasPermission(user, models.PermClientManage) {
+		return true
+	}
+	member, _ := a.clientMemberRepo.Exists(clientID, user.ID)
+	return member
+}
+
+// canUseProject allows project members, members of the project's client, and anyone who can see every project or issue.
+func (a uploadAccess) canUseProject(user *models.User, projectID uuid.UUID) bool {
+	if a.permissionService.HasPermission(user, models.PermProjectViewAll) || a.permissionService.HasPermission(user, models.PermIssueViewAll) {
+		return true
+	}
+	if member, _ := a.projectRepo.IsMember(projectID, user.ID); member {
+		return true
+	}
+	project, err := a.projectRepo.GetByID(projectID)
+	if err != nil || project.ClientID == nil {
+		return false
+	}
+	member, _ := a.clientMemberRepo.Exists(*project.ClientID, user.ID)
+	return member
+}
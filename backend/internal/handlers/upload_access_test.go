@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"mellon-harmony-api/internal/models"
+	"mellon-harmony-api/internal/service"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func TestUploadAccessAuthorize(t *testing.T) {
+	admin := &models.User{Role: models.RoleAdmin}
+	teamLead := &models.User{Role: models.RoleTeamLead}
+	member := &models.User{Role: models.RoleUser}
+	projectMember := &models.User{Role: models.RoleUser}
+	outsider := &models.User{Role: models.RoleUser}
+	users := newMemoryUserRepository(admin, teamLead, member, projectMember, outsider)
+	perms := service.NewPermissionService(newMemoryRoleRepository(nil), users, nil)
+
+	client, otherClient := uuid.New(), uuid.New()
+	clientProject := &models.Project{ID: uuid.New(), ClientID: &client}
+	internalProject := &models.Project{ID: uuid.New()}
+	clientMembers := &memoryClientMemberRepository{members: map[uuid.UUID][]uuid.UUID{client: {member.ID}}}
+	projects := &memoryProjectRepository{
+		projects: map[uuid.UUID]*models.Project{clientProject.ID: clientProject, internalProject.ID: internalProject},
+		members:  map[uuid.UUID][]uuid.UUID{internalProject.ID: {projectMember.ID}},
+	}
+	access := newUploadAccess(users, clientMembers, projects, perms)
+
+	tests := []struct {
+		name  string
+		actor *models.User
+		opts  service.UploadOptions
+		want  int
+	}{
+		{"general upload", outsider, service.UploadOptions{Purpose: models.FilePurposeAttachment}, http.StatusNoContent},
+		{"invalid IDs are general", outsider, service.UploadOptions{ClientID: "acme", ProjectID: "web"}, http.StatusNoContent},
+		{"own avatar", outsider, service.UploadOptions{Purpose: models.FilePurposeAvatar, UserID: outsider.ID.String()}, http.StatusNoContent},
+		{"another user's avatar", teamLead, service.UploadOptions{Purpose: models.FilePurposeAvatar, UserID: member.ID.String()}, http.StatusForbidden},
+		{"another user's avatar with user.manage", admin, service.UploadOptions{Purpose: models.FilePurposeAvatar, UserID: member.ID.String()}, http.StatusNoContent},
+		{"logo of the member's client", member, service.UploadOptions{Purpose: models.FilePurposeClientLogo, ClientID: client.String()}, http.StatusNoContent},
+		{"logo of another client", member, service.UploadOptions{Purpose: models.FilePurposeClientLogo, ClientID: otherClient.String()}, http.StatusForbidden},
+		{"logo with client.manage", teamLead, service.UploadOptions{Purpose: models.FilePurposeClientLogo, ClientID: otherClient.String()}, http.StatusNoContent},
+		{"client of the member", member, service.UploadOptions{ClientID: client.String()}, http.StatusNoContent},
+		{"client of others", outsider, service.UploadOptions{ClientID: client.String()}, http.StatusForbidden},
+		{"any client with issue.view_all", teamLead, service.UploadOptions{ClientID: otherClient.String()}, http.StatusNoContent},
+		{"project of the member's client", member, service.UploadOptions{ProjectID: clientProject.ID.String()}, http.StatusNoContent},
+		{"project the user is a member of", projectMember, service.UploadOptions{ProjectID: internalProject.ID.String()}, http.StatusNoContent},
+		{"project of others", outsider, service.UploadOptions{ProjectID: clientProject.ID.String()}, http.StatusForbidden},
+		{"project without client", member, service.UploadOptions{ProjectID: internalProject.ID.String()}, http.StatusForbidden},
+		{"unknown project", member, service.UploadOptions{ProjectID: uuid.New().String()}, http.StatusForbidden},
+		{"own client, project of others", projectMember, service.UploadOptions{ClientID: client.String(), ProjectID: internalProject.ID.String()}, http.StatusForbidden},
+		{"any project with issue.view_all", teamLead, service.UploadOptions{ProjectID: internalProject.ID.String()}, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := func(c *gin.Context) {
+				if access.authorize(c, tt.opts) {
+					c.Status(http.StatusNoContent)
+				}
+			}
+			if w := serve(handler, tt.actor, http.MethodPost, "/files/upload", "/files/upload", ""); w.Code != tt.want {
+				t.Errorf("authorize = %d %s, want %d", w.Code, w.Body, tt.want)
+			}
+		})
+	}
+
+	if w := serve(func(c *gin.Context) { access.authorize(c, service.UploadOptions{}) }, &models.User{ID: uuid.New()}, http.MethodPost, "/files/upload", "/files/upload", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("unknown user = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestStorageHandlerGetClientStorageAccess(t *testing.T) {
+	teamLead := &models.User{Role: models.RoleTeamLead}
+	outsider := &models.User{Role: models.RoleUser}
+	users := newMemoryUserRepository(teamLead, outsider)
+	perms := service.NewPermissionService(newMemoryRoleRepository(nil), users, nil)
+	client := uuid.New()
+	h := NewStorageHandler(nil, nil, users, &memoryClientMemberRepository{}, perms)
+
+	// client.manage alone does not show a client's storage
+	for _, actor := range []*models.User{teamLead, outsider} {
+		w := serve(h.GetClientStorage, actor, http.MethodGet, "/clients/"+client.String()+"/storage", "/clients/:id/storage", "")
+		if w.Code != http.StatusForbidden {
+			t.Errorf("GetClientStorage as %s = %d %s, want 403", actor.Role, w.Code, w.Body)
+		}
+	}
+	if w := serve(h.GetClientStorage, outsider, http.MethodGet, "/clients/acme/storage", "/clients/:id/storage", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid client ID = %d, want 400", w.Code)
+	}
+}
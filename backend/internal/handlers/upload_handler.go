@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"mellon-harmony-api/internal/models"
+	"mellon-harmony-api/internal/repository"
+	"mellon-harmony-api/internal/service"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Headers of the tus resumable upload protocol (https://tus.io/protocols/resumable-upload), core
+// protocol with the creation, expiration and termination extensions.
+const (
+	TusResumableHeader   = "Tus-Resumable"
+	TusVersion           = "1.0.0"
+	UploadLengthHeader   = "Upload-Length"
+	UploadOffsetHeader   = "Upload-Offset"
+	UploadMetadataHeader = "Upload-Metadata"
+	UploadExpiresHeader  = "Upload-Expires"
+	tusChunkContentType  = "application/offset+octet-stream"
+)
+
+// TusRequestHeaders and TusResponseHeaders must be allowed and exposed by CORS for browser clients.
+var (
+	TusRequestHeaders  = []string{TusResumableHeader, UploadLengthHeader, UploadOffsetHeader, UploadMetadataHeader}
+	TusResponseHeaders = []string{TusResumableHeader, UploadOffsetHeader, UploadLengthHeader, UploadExpiresHeader, "Location"}
+)
+
+// UploadHandler serves resumable uploads for files too large for a single request (videos, PSDs).
+// Uploads are tus-compatible, so client libraries such as tus-js-client work against /uploads.
+type UploadHandler struct {
+	uploadService service.UploadService
+	urlSigner     *service.FileURLSigner
+	access        uploadAccess
+}
+
+func NewUploadHandler(uploadService service.UploadService, urlSigner *service.FileURLSigner, userRepo repository.UserRepository, clientMemberRepo repository.ClientMemberRepository, projectRepo repository.ProjectRepository, permissionService service.PermissionService) *UploadHandler {
+	return &UploadHandler{
+		uploadService: uploadService,
+		urlSigner:     urlSigner,
+		access:        newUploadAccess(userRepo, clientMemberRepo, projectRepo, permissionService),
+	}
+}
+
+func uploadErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrUploadNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrUploadOffsetMismatch):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrUploadTooLong), errors.Is(err, service.ErrFileTooLarge), errors.Is(err, service.ErrStorageQuotaExceeded):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, service.ErrInvalidUpload), errors.Is(err, service.ErrFileTypeMismatch), errors.Is(err, service.ErrFileTypeNotAllowed),
+		errors.Is(err, service.ErrNotAnImage), errors.Is(err, service.ErrInvalidImage), errors.Is(err, service.ErrImageTooLarge):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// parseUploadMetadata decodes Upload-Metadata: comma-separated "key base64value" pairs.
+func parseUploadMetadata(header string) map[string]string {
+	metadata := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		parts := strings.Fields(pair)
+		if len(parts) == 0 {
+			continue
+		}
+		value := ""
+		if len(parts) > 1 {
+			decoded, err := base64.StdEncoding.DecodeString(parts[1])
+			if err != nil {
+				continue
+			}
+			value = string(decoded)
+		}
+		metadata[parts[0]] = value
+	}
+	return metadata
+}
+
+func (h *UploadHandler) setUploadHeaders(c *gin.Context, session *models.UploadSession) {
+	c.Header(TusResumableHeader, TusVersion)
+	c.Header(UploadOffsetHeader, strconv.FormatInt(session.Offset, 10))
+	c.Header(UploadLengthHeader, strconv.FormatInt(session.Length, 10))
+	c.Header(UploadExpiresHeader, session.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Header("Cache-Control", "no-store")
+}
+
+// CreateUpload starts an upload (tus creation). Upload-Length is the total size; Upload-Metadata
+// carries filename and, as for POST /files/upload, upload_purpose, user_id, client_id and project_id.
+// Responds 201 with the upload URL in Location.
+func (h *UploadHandler) CreateUpload(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	c.Header(TusResumableHeader, TusVersion)
+
+	length, err := strconv.ParseInt(c.GetHeader(UploadLengthHeader), 10, 64)
+	if err != nil || length <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Length header required"})
+		return
+	}
+	metadata := parseUploadMetadata(c.GetHeader(UploadMetadataHeader))
+	filename := metadata["filename"]
+	if filename == "" {
+		filename = metadata["name"]
+	}
+
+	opts := service.UploadOptions{
+		Purpose:   metadata["upload_purpose"],
+		UserID:    metadata["user_id"],
+		ClientID:  metadata["client_id"],
+		ProjectID: metadata["project_id"],
+	}
+	if !h.access.authorize(c, opts) {
+		return
+	}
+
+	session, err := h.uploadService.CreateUpload(userID, filename, length, opts)
+	if err != nil {
+		c.JSON(uploadErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	h.setUploadHeaders(c, session)
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+session.ID.String())
+	c.Status(http.StatusCreated)
+}
+
+// UploadOffset reports how many bytes were received (tus HEAD), so an interrupted upload can resume.
+func (h *UploadHandler) UploadOffset(c *gin.Context) {
+	session, ok := h.getUpload(c)
+	if !ok {
+		return
+	}
+	h.setUploadHeaders(c, session)
+	c.Status(http.StatusOK)
+}
+
+// AppendChunk receives bytes starting at Upload-Offset (tus PATCH). Responds 204 with the new
+// offset; after the last chunk the file is saved and GET /uploads/:id returns it.
+func (h *UploadHandler) AppendChunk(c *gin.Context) {
+	userID, id, ok := uploadIDs(c)
+	if !ok {
+		return
+	}
+	c.Header(TusResumableHeader, TusVersion)
+	if !strings.HasPrefix(c.ContentType(), tusChunkContentType) {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be " + tusChunkContentType})
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader(UploadOffsetHeader), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Offset header required"})
+		return
+	}
+
+	session, err := h.uploadService.AppendChunk(id, userID, offset, c.Request.Body)
+	if session != nil {
+		h.setUploadHeaders(c, session)
+	}
+	if err != nil {
+		c.JSON(uploadErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetUpload returns the progress of an upload and, once complete, the saved file as returned by
+// POST /files/upload.
+func (h *UploadHandler) GetUpload(c *gin.Context) {
+	session, ok := h.getUpload(c)
+	if !ok {
+		return
+	}
+	response := gin.H{
+		"id":         session.ID,
+		"filename":   session.Filename,
+		"purpose":    session.Purpose,
+		"offset":     session.Offset,
+		"length":     session.Length,
+		"complete":   session.IsComplete(),
+		"expires_at": session.ExpiresAt,
+	}
+	if session.File != nil {
+		response["file"] = fileResponse(h.urlSigner, session.File)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// DeleteUpload cancels an upload and discards the bytes received (tus termination).
+func (h *UploadHandler) DeleteUpload(c *gin.Context) {
+	userID, id, ok := uploadIDs(c)
+	if !ok {
+		return
+	}
+	c.Header(TusResumableHeader, TusVersion)
+	if err := h.uploadService.DeleteUpload(id, userID); err != nil {
+		c.JSON(uploadErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *UploadHandler) getUpload(c *gin.Context) (*models.UploadSession, bool) {
+	userID, id, ok := uploadIDs(c)
+	if !ok {
+		return nil, false
+	}
+	session, err := h.uploadService.GetUpload(id, userID)
+	if err != nil {
+		c.Header(TusResumableHeader, TusVersion)
+		c.JSON(uploadErrorStatus(err), gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return session, true
+}
+
+// uploadIDs parses the caller and the upload ID, responding with an error if either is invalid.
+func uploadIDs(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		return uuid.Nil, uuid.Nil, false
+	}
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": service.ErrUploadNotFound.Error()})
+		return uuid.Nil, uuid.Nil, false
+	}
+	return userID, id, true
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"mellon-harmony-api/internal/service"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestParseUploadMetadata(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   map[string]string
+	}{
+		{"empty", "", map[string]string{}},
+		{"pairs", "filename dmlkZW8ubXA0,upload_purpose YXR0YWNobWVudA==", map[string]string{"filename": "video.mp4", "upload_purpose": "attachment"}},
+		{"spaces around pairs", " filename dmlkZW8ubXA0 , client_id  YWJj ", map[string]string{"filename": "video.mp4", "client_id": "abc"}},
+		{"key without value", "is_confidential,filename YQ==", map[string]string{"is_confidential": "", "filename": "a"}},
+		{"utf-8 value", "filename ZGlzZcOxby5wc2Q=", map[string]string{"filename": "diseño.psd"}},
+		{"invalid base64 is skipped", "filename !!!,project_id eHl6", map[string]string{"project_id": "xyz"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseUploadMetadata(tt.header); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseUploadMetadata(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUploadErrorStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{service.ErrUploadNotFound, http.StatusNotFound},
+		{service.ErrUploadOffsetMismatch, http.StatusConflict},
+		{service.ErrUploadTooLong, http.StatusRequestEntityTooLarge},
+		{fmt.Errorf("%w of 10 bytes", service.ErrFileTooLarge), http.StatusRequestEntityTooLarge},
+		{service.ErrStorageQuotaExceeded, http.StatusRequestEntityTooLarge},
+		{fmt.Errorf("%w: filename required", service.ErrInvalidUpload), http.StatusBadRequest},
+		{service.ErrFileTypeNotAllowed, http.StatusBadRequest},
+		{errors.New("disk full"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if got := uploadErrorStatus(tt.err); got != tt.want {
+			t.Errorf("uploadErrorStatus(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
@@ -11,14 +11,18 @@ import (
 )
 
 type UserHandler struct {
-	userService service.UserService
-	userRepo    repository.UserRepository
+	userService       service.UserService
+	userRepo          repository.UserRepository
+	permissionService service.PermissionService
+	urlSigner         *service.FileURLSigner
 }
 
-func NewUserHandler(userService service.UserService, userRepo repository.UserRepository) *UserHandler {
+func NewUserHandler(userService service.UserService, userRepo repository.UserRepository, permissionService service.PermissionService, urlSigner *service.FileURLSigner) *UserHandler {
 	return &UserHandler{
-		userService: userService,
-		userRepo:    userRepo,
+		userService:       userService,
+		userRepo:          userRepo,
+		permissionService: permissionService,
+		urlSigner:         urlSigner,
 	}
 }
 
@@ -29,7 +33,7 @@ func (h *UserHandler) GetUsers(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, users)
+	c.JSON(http.StatusOK, signFileURLs(h.urlSigner, users))
 }
 
 func (h *UserHandler) GetUser(c *gin.Context) {
@@ -45,7 +49,7 @@ func (h *UserHandler) GetUser(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, user)
+	c.JSON(http.StatusOK, signFileURLs(h.urlSigner, user))
 }
 
 type UpdateUserRequest struct {
@@ -64,7 +68,7 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuario no encontrado"})
 		return
 	}
-	isAdmin := currentUser.Role == models.RoleAdmin
+	isAdmin := h.permissionService.HasPermission(currentUser, models.PermUserManage)
 
 	id, err := uuid.Parse(c.Param("id"))
 	if err != nil {
@@ -92,27 +96,145 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 	if isSelfUpdate && !isAdmin {
 		req.Role = nil
 	}
+	if req.Role != nil && !h.permissionService.RoleExists(*req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "El rol no existe"})
+		return
+	}
+	// user.manage only reaches users and roles whose permissions the actor holds: it can neither
+	// promote anyone (themselves included) above the actor nor take over an admin's account.
+	if !isSelfUpdate || req.Role != nil {
+		target, err := h.userService.GetUser(id)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if !isSelfUpdate && !h.permissionService.CanGrantRole(currentUser, target.Role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "No puedes modificar a un usuario con un rol superior al tuyo"})
+			return
+		}
+		if req.Role != nil && *req.Role != target.Role && !h.permissionService.CanGrantRole(currentUser, *req.Role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": service.ErrPermissionEscalation.Error()})
+			return
+		}
+	}
+
+	if req.Avatar != nil {
+		avatar := models.StripFileURLSignature(*req.Avatar)
+		req.Avatar = &avatar
+	}
 
-	user, err := h.userService.UpdateUser(id, req.Name, req.Email, req.Role, req.Avatar)
+	user, err := h.userService.UpdateUser(id, req.Name, req.Email, req.Role, req.Avatar, auditMeta(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, user)
+	c.JSON(http.StatusOK, signFileURLs(h.urlSigner, user))
 }
 
 func (h *UserHandler) DeleteUser(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.userRepo, h.permissionService, models.PermUserManage, "Solo los administradores pueden eliminar usuarios")
+	if !ok {
+		return
+	}
+
 	id, err := uuid.Parse(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
 		return
 	}
+	target, err := h.userService.GetUser(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if !h.permissionService.CanGrantRole(currentUser, target.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "No puedes eliminar a un usuario con un rol superior al tuyo"})
+		return
+	}
 
-	if err := h.userService.DeleteUser(id); err != nil {
+	if err := h.userService.DeleteUser(id, auditMeta(c)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
 }
+
+// manageableUser returns the user in the :id parameter if currentUser may manage users with their
+// role, like UpdateUser and DeleteUser; otherwise it answers with forbidden and returns false.
+func (h *UserHandler) manageableUser(c *gin.Context, currentUser *models.User, forbidden string) (*models.User, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return nil, false
+	}
+	target, err := h.userService.GetUser(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	if !h.permissionService.CanGrantRole(currentUser, target.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": forbidden})
+		return nil, false
+	}
+	return target, true
+}
+
+// GetUserSessions lists the active sessions of any user (admin only).
+func (h *UserHandler) GetUserSessions(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.userRepo, h.permissionService, models.PermUserManage, "Solo los administradores pueden ver las sesiones de otros usuarios")
+	if !ok {
+		return
+	}
+	target, ok := h.manageableUser(c, currentUser, "No puedes ver las sesiones de un usuario con un rol superior al tuyo")
+	if !ok {
+		return
+	}
+
+	sessions, err := h.userService.GetUserSessions(target.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeUserSessions signs a user out of every device (admin only), e.g. when a token has leaked.
+func (h *UserHandler) RevokeUserSessions(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.userRepo, h.permissionService, models.PermUserManage, "Solo los administradores pueden cerrar las sesiones de otros usuarios")
+	if !ok {
+		return
+	}
+	target, ok := h.manageableUser(c, currentUser, "No puedes cerrar las sesiones de un usuario con un rol superior al tuyo")
+	if !ok {
+		return
+	}
+
+	if err := h.userService.RevokeAllSessions(target.ID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "All sessions revoked"})
+}
+
+// UnlockUser clears a lockout caused by failed logins (admin only).
+func (h *UserHandler) UnlockUser(c *gin.Context) {
+	currentUser, ok := requirePermission(c, h.userRepo, h.permissionService, models.PermUserManage, "Solo los administradores pueden desbloquear cuentas")
+	if !ok {
+		return
+	}
+	target, ok := h.manageableUser(c, currentUser, "No puedes desbloquear a un usuario con un rol superior al tuyo")
+	if !ok {
+		return
+	}
+
+	if err := h.userService.UnlockUser(target.ID, auditMeta(c)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account unlocked"})
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"mellon-harmony-api/internal/models"
+	"mellon-harmony-api/internal/service"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// recordingUserService serves users from a memoryUserRepository and records which were acted on.
+type recordingUserService struct {
+	service.UserService
+	users *memoryUserRepository
+	acted []uuid.UUID
+}
+
+func (s *recordingUserService) GetUser(id uuid.UUID) (*models.User, error) {
+	return s.users.GetByID(id)
+}
+
+func (s *recordingUserService) GetUserSessions(id uuid.UUID) ([]models.Session, error) {
+	s.acted = append(s.acted, id)
+	return []models.Session{}, nil
+}
+
+func (s *recordingUserService) RevokeAllSessions(id uuid.UUID) error {
+	s.acted = append(s.acted, id)
+	return nil
+}
+
+func (s *recordingUserService) UnlockUser(id uuid.UUID, meta models.AuditMeta) error {
+	s.acted = append(s.acted, id)
+	return nil
+}
+
+func TestUserHandlerManageOtherUsers(t *testing.T) {
+	// A supervisor manages users but holds none of the team lead permissions
+	admin := &models.User{Role: models.RoleAdmin}
+	supervisor := &models.User{Role: "supervisor"}
+	teamLead := &models.User{Role: models.RoleTeamLead}
+	plain := &models.User{Role: models.RoleUser}
+	users := newMemoryUserRepository(admin, supervisor, teamLead, plain)
+	perms := service.NewPermissionService(newMemoryRoleRepository(map[models.UserRole][]string{"supervisor": {models.PermUserManage}}), users, nil)
+
+	endpoints := []struct {
+		name   string
+		method string
+		route  string
+		suffix string
+		handle func(h *UserHandler) gin.HandlerFunc
+	}{
+		{"sessions", http.MethodGet, "/users/:id/sessions", "/sessions", func(h *UserHandler) gin.HandlerFunc { return h.GetUserSessions }},
+		{"revoke sessions", http.MethodDelete, "/users/:id/sessions", "/sessions", func(h *UserHandler) gin.HandlerFunc { return h.RevokeUserSessions }},
+		{"unlock", http.MethodPost, "/users/:id/unlock", "/unlock", func(h *UserHandler) gin.HandlerFunc { return h.UnlockUser }},
+	}
+	tests := []struct {
+		name   string
+		actor  *models.User
+		target *models.User
+		want   int
+	}{
+		{"admin, any user", admin, teamLead, http.StatusOK},
+		{"admin, another admin", admin, admin, http.StatusOK},
+		{"supervisor, plain user", supervisor, plain, http.StatusOK},
+		{"supervisor, higher role", supervisor, teamLead, http.StatusForbidden},
+		{"supervisor, admin", supervisor, admin, http.StatusForbidden},
+		{"without user.manage", teamLead, plain, http.StatusForbidden},
+	}
+	for _, endpoint := range endpoints {
+		for _, tt := range tests {
+			t.Run(endpoint.name+"/"+tt.name, func(t *testing.T) {
+				userService := &recordingUserService{users: users}
+				h := NewUserHandler(userService, users, perms, nil)
+				path := "/users/" + tt.target.ID.String() + endpoint.suffix
+				w := serve(endpoint.handle(h), tt.actor, endpoint.method, path, endpoint.route, "")
+				if w.Code != tt.want {
+					t.Fatalf("%s %s = %d, want %d: %s", endpoint.method, path, w.Code, tt.want, w.Body)
+				}
+				if acted := len(userService.acted) > 0; acted != (tt.want == http.StatusOK) {
+					t.Errorf("user service called = %v", acted)
+				}
+			})
+		}
+	}
+
+	t.Run("unknown user", func(t *testing.T) {
+		h := NewUserHandler(&recordingUserService{users: users}, users, perms, nil)
+		if w := serve(h.UnlockUser, admin, http.MethodPost, "/users/"+uuid.New().String()+"/unlock", "/users/:id/unlock", ""); w.Code != http.StatusNotFound {
+			t.Errorf("unknown user = %d, want %d", w.Code, http.StatusNotFound)
+		}
+	})
+}
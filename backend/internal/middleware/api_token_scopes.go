@@ -0,0 +1,35 @@
+package middleware
+
+import "mellon-harmony-api/internal/models"
+
+// scopeAnyToken marks routes any valid personal access token may call.
+const scopeAnyToken = "*"
+
+// apiTokenRouteScopes maps "METHOD route" to the scope a personal access token needs to call it.
+// Routes not listed here (account, session, token and user management, admin endpoints, ...)
+// are closed to tokens regardless of scope, so new routes stay session-only until added.
+var apiTokenRouteScopes = map[string]string{
+	"GET /api/v1/auth/me": scopeAnyToken,
+
+	"GET /api/v1/issues":              models.ScopeIssuesRead,
+	"GET /api/v1/issues/:id":          models.ScopeIssuesRead,
+	"GET /api/v1/issues/:id/comments": models.ScopeIssuesRead,
+
+	"POST /api/v1/issues":              models.ScopeIssuesWrite,
+	"PUT /api/v1/issues/:id":           models.ScopeIssuesWrite,
+	"PATCH /api/v1/issues/:id/status":  models.ScopeIssuesWrite,
+	"DELETE /api/v1/issues/:id":        models.ScopeIssuesWrite,
+	"POST /api/v1/issues/:id/comments": models.ScopeIssuesWrite,
+
+	"GET /api/v1/clients/:id/reports":       models.ScopeReportsRead,
+	"GET /api/v1/clients/:id/reports/:type": models.ScopeReportsRead,
+}
+
+// apiTokenAllows reports whether the token's scopes cover the matched route.
+func apiTokenAllows(token *models.APIToken, method, route string) bool {
+	scope, ok := apiTokenRouteScopes[method+" "+route]
+	if !ok {
+		return false
+	}
+	return scope == scopeAnyToken || token.HasScope(scope)
+}
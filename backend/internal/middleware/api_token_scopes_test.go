@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"errors"
+	"mellon-harmony-api/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// staticAPITokens authenticates one token string as token, owned by user.
+type staticAPITokens struct {
+	plain string
+	token *models.APIToken
+	user  *models.User
+}
+
+func (a staticAPITokens) AuthenticateAPIToken(plain, ipAddress string) (*models.APIToken, *models.User, error) {
+	if plain != a.plain {
+		return nil, nil, errors.New("invalid or expired API token")
+	}
+	return a.token, a.user, nil
+}
+
+func TestAPITokenScopes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const plain = models.APITokenPrefix + "secret"
+	tests := []struct {
+		name   string
+		scopes string
+		user   models.User
+		method string
+		path   string
+		want   int
+	}{
+		{"read scope lists issues", models.ScopeIssuesRead, models.User{}, http.MethodGet, "/api/v1/issues", http.StatusOK},
+		{"read scope reads an issue", models.ScopeIssuesRead, models.User{}, http.MethodGet, "/api/v1/issues/42", http.StatusOK},
+		{"read scope cannot write", models.ScopeIssuesRead, models.User{}, http.MethodPost, "/api/v1/issues", http.StatusForbidden},
+		{"write scope cannot read", models.ScopeIssuesWrite, models.User{}, http.MethodGet, "/api/v1/issues", http.StatusForbidden},
+		{"write scope writes", models.ScopeIssuesWrite, models.User{}, http.MethodPatch, "/api/v1/issues/42/status", http.StatusOK},
+		{"reports scope", models.ScopeReportsRead, models.User{}, http.MethodGet, "/api/v1/clients/7/reports/summary", http.StatusOK},
+		{"any scope reads the owner", models.ScopeReportsRead, models.User{}, http.MethodGet, "/api/v1/auth/me", http.StatusOK},
+		{"unlisted route", "issues:read,issues:write,reports:read", models.User{}, http.MethodPost, "/api/v1/auth/tokens", http.StatusForbidden},
+		{"locked owner", models.ScopeIssuesRead, models.User{LockedUntil: timePtr(time.Now().Add(time.Hour))}, http.MethodGet, "/api/v1/issues", http.StatusUnauthorized},
+		{"deleted owner", models.ScopeIssuesRead, models.User{DeletedAt: gorm.DeletedAt{Time: time.Now(), Valid: true}}, http.MethodGet, "/api/v1/issues", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := tt.user
+			user.ID = uuid.New()
+			auth := AuthMiddleware("secret", nil, staticAPITokens{plain, &models.APIToken{ID: uuid.New(), Scopes: tt.scopes}, &user})
+
+			router := gin.New()
+			api := router.Group("/api/v1", auth)
+			ok := func(c *gin.Context) {
+				if c.GetString("user_id") != user.ID.String() || c.GetString("session_id") != "" {
+					c.Status(http.StatusInternalServerError)
+					return
+				}
+				c.Status(http.StatusOK)
+			}
+			for route := range apiTokenRouteScopes {
+				method, path, _ := strings.Cut(route, " ")
+				api.Handle(method, path[len("/api/v1"):], ok)
+			}
+			api.POST("/auth/tokens", ok)
+
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+plain)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("%s %s = %d, want %d", tt.method, tt.path, w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPITokenUnknown(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/v1/issues", AuthMiddleware("secret", nil, staticAPITokens{plain: models.APITokenPrefix + "secret"}), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/issues", nil)
+	req.Header.Set("Authorization", "Bearer "+models.APITokenPrefix+"guess")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("unknown token = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
@@ -1,37 +1,69 @@
 package middleware
 
 import (
-	"log"
+	"mellon-harmony-api/internal/models"
+	"regexp"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
-// AuditLog logs sensitive actions: method, path, user_id, role, IP, timestamp
-func AuditLog() gin.HandlerFunc {
+// RequestIDHeader carries the request ID. A valid incoming value (e.g. from a proxy) is kept.
+const RequestIDHeader = "X-Request-ID"
+
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// AuditRecorder stores audit events (see service.AuditService).
+type AuditRecorder interface {
+	Record(meta models.AuditMeta, action, entityType, entityID string, before, after map[string]interface{})
+}
+
+// RequestID tags every request with an ID, stored in the context as "request_id" and echoed in
+// the response header, so audit events and logs of the same request can be matched.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = uuid.New().String()
+		}
+		c.Set("request_id", requestID)
+		c.Header(RequestIDHeader, requestID)
+		c.Next()
+	}
+}
+
+// tusChunkContentType marks the chunks of a resumable upload (PATCH /uploads/:id).
+const tusChunkContentType = "application/offset+octet-stream"
+
+// AuditLog records every mutating request (method, path, status, latency) in the audit log,
+// including the ones that were rejected. What actually changed is recorded by the services.
+// Chunks of resumable uploads are not recorded: a large upload sends thousands of them, while its
+// creation (POST /uploads) and cancellation are.
+func AuditLog(recorder AuditRecorder) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		start := time.Now()
 		path := c.Request.URL.Path
 		method := c.Request.Method
-		clientIP := c.ClientIP()
 
 		c.Next()
 
 		// Only log for sensitive methods
-		if method != "GET" && method != "OPTIONS" {
-			userID, _ := c.Get("user_id")
-			userRole, _ := c.Get("user_role")
-			userIDStr := ""
-			roleStr := ""
-			if userID != nil {
-				userIDStr = userID.(string)
+		if method != "GET" && method != "OPTIONS" && method != "HEAD" && c.ContentType() != tusChunkContentType {
+			meta := models.AuditMeta{
+				ActorRole: c.GetString("user_role"),
+				IPAddress: c.ClientIP(),
+				RequestID: c.GetString("request_id"),
 			}
-			if userRole != nil {
-				roleStr = userRole.(string)
+			if userID, err := uuid.Parse(c.GetString("user_id")); err == nil {
+				meta.ActorID = &userID
 			}
-			latency := time.Since(start)
-			log.Printf("[AUDIT] %s %s | user=%s role=%s ip=%s latency=%v",
-				method, path, userIDStr, roleStr, clientIP, latency)
+			recorder.Record(meta, models.AuditRequest, "", "", nil, map[string]interface{}{
+				"method":     method,
+				"path":       path,
+				"status":     c.Writer.Status(),
+				"latency_ms": time.Since(start).Milliseconds(),
+			})
 		}
 	}
 }
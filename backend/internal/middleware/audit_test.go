@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"mellon-harmony-api/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type recordingAudit struct {
+	metas  []models.AuditMeta
+	afters []map[string]interface{}
+}
+
+func (r *recordingAudit) Record(meta models.AuditMeta, action, entityType, entityID string, before, after map[string]interface{}) {
+	r.metas = append(r.metas, meta)
+	r.afters = append(r.afters, after)
+}
+
+func TestRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{"none", "", false},
+		{"valid", "req-123.abc_XYZ", true},
+		{"with spaces", "req 123", false},
+		{"too long", strings.Repeat("a", 65), false},
+		{"header injection", "abc\r\nSet-Cookie: x=1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(RequestID())
+			var seen string
+			router.GET("/", func(c *gin.Context) { seen = c.GetString("request_id") })
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.incoming != "" {
+				req.Header.Set(RequestIDHeader, tt.incoming)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			got := w.Header().Get(RequestIDHeader)
+			if got != seen {
+				t.Errorf("header %q differs from the context %q", got, seen)
+			}
+			if tt.keep && got != tt.incoming {
+				t.Errorf("request ID = %q, want the incoming %q", got, tt.incoming)
+			}
+			if !tt.keep {
+				if _, err := uuid.Parse(got); err != nil {
+					t.Errorf("request ID = %q, want a new UUID", got)
+				}
+			}
+		})
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	userID := uuid.New()
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		wantRecord  bool
+	}{
+		{"create", http.MethodPost, "application/json", true},
+		{"update", http.MethodPut, "application/json", true},
+		{"delete", http.MethodDelete, "", true},
+		{"upload metadata change", http.MethodPatch, "application/json", true},
+		{"read", http.MethodGet, "", false},
+		{"head", http.MethodHead, "", false},
+		{"options", http.MethodOptions, "", false},
+		{"upload chunk", http.MethodPatch, tusChunkContentType, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &recordingAudit{}
+			router := gin.New()
+			router.Use(RequestID(), func(c *gin.Context) {
+				c.Set("user_id", userID.String())
+				c.Set("user_role", "team_lead")
+			}, AuditLog(recorder))
+			router.Handle(tt.method, "/items/:id", func(c *gin.Context) { c.Status(http.StatusForbidden) })
+
+			req := httptest.NewRequest(tt.method, "/items/1", nil)
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			req.Header.Set(RequestIDHeader, "req-1")
+			router.ServeHTTP(httptest.NewRecorder(), req)
+
+			if recorded := len(recorder.metas) == 1; recorded != tt.wantRecord {
+				t.Fatalf("recorded %d events, want recorded %v", len(recorder.metas), tt.wantRecord)
+			}
+			if !tt.wantRecord {
+				return
+			}
+			meta, after := recorder.metas[0], recorder.afters[0]
+			if meta.ActorID == nil || *meta.ActorID != userID || meta.ActorRole != "team_lead" || meta.RequestID != "req-1" {
+				t.Errorf("meta = %+v", meta)
+			}
+			// Rejected requests are recorded too
+			if after["method"] != tt.method || after["path"] != "/items/1" || after["status"] != http.StatusForbidden {
+				t.Errorf("recorded %v", after)
+			}
+		})
+	}
+}
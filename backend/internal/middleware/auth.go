@@ -1,14 +1,27 @@
 package middleware
 
 import (
+	"mellon-harmony-api/internal/models"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
-func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
+// SessionValidator checks that the session behind an access token is still active
+// and that the token version matches the user's current one.
+type SessionValidator interface {
+	ValidateAccessToken(userID, sessionID uuid.UUID, tokenVersion int) error
+}
+
+// APITokenAuthenticator resolves a personal access token to its token record and owner.
+type APITokenAuthenticator interface {
+	AuthenticateAPIToken(token, ipAddress string) (*models.APIToken, *models.User, error)
+}
+
+func AuthMiddleware(jwtSecret string, sessions SessionValidator, apiTokens APITokenAuthenticator) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -27,6 +40,12 @@ func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 
 		tokenString := parts[1]
 
+		// Personal access tokens are opaque secrets, not JWTs
+		if strings.HasPrefix(tokenString, models.APITokenPrefix) {
+			authenticateAPIToken(c, apiTokens, tokenString)
+			return
+		}
+
 		// Parse and validate token
 		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -57,9 +76,62 @@ func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 			return
 		}
 
+		// Only access tokens open protected routes (2FA challenge tokens are signed with the same key)
+		if tokenType, _ := claims["typ"].(string); tokenType != "access" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			c.Abort()
+			return
+		}
+
+		// Revocation check: tokens issued before sessions existed (no sid) are rejected too
+		parsedUserID, userErr := uuid.Parse(userID)
+		sessionIDStr, _ := claims["sid"].(string)
+		sessionID, sessionErr := uuid.Parse(sessionIDStr)
+		version, _ := claims["ver"].(float64)
+		if userErr != nil || sessionErr != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			c.Abort()
+			return
+		}
+		if err := sessions.ValidateAccessToken(parsedUserID, sessionID, int(version)); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+			c.Abort()
+			return
+		}
+
 		c.Set("user_id", userID)
 		c.Set("user_role", claims["role"])
+		c.Set("session_id", sessionID.String())
 
 		c.Next()
 	}
 }
+
+// authenticateAPIToken handles requests made with a personal access token. The token acts with its
+// owner's current role, but only on the routes its scopes allow (see apiTokenRouteScopes).
+func authenticateAPIToken(c *gin.Context, apiTokens APITokenAuthenticator, tokenString string) {
+	token, user, err := apiTokens.AuthenticateAPIToken(tokenString, c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		c.Abort()
+		return
+	}
+	// The owner must still be able to sign in: tokens of deleted or locked accounts stop working
+	if user == nil || user.DeletedAt.Valid || user.IsLocked() {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		c.Abort()
+		return
+	}
+	if !apiTokenAllows(token, c.Request.Method, c.FullPath()) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This API token is not allowed to access this endpoint"})
+		c.Abort()
+		return
+	}
+
+	c.Set("user_id", user.ID.String())
+	c.Set("user_role", string(user.Role))
+	c.Set("api_token_id", token.ID.String())
+	c.Set("token_scopes", token.GetScopes())
+
+	c.Next()
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// PermissionChecker reports whether a user currently holds a named permission.
+type PermissionChecker interface {
+	UserHasPermission(userID uuid.UUID, permission string) bool
+}
+
+// RequirePermission rejects the request with 403 unless the authenticated user's role grants permission.
+// It must run after AuthMiddleware. The role is read from the database, so changes apply immediately.
+func RequirePermission(perms PermissionChecker, permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(c.GetString("user_id"))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+			c.Abort()
+			return
+		}
+		if !perms.UserHasPermission(userID, permission) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "No tienes permiso para realizar esta acción", "permission": permission})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Personal access token scopes.
+const (
+	ScopeIssuesRead  = "issues:read"
+	ScopeIssuesWrite = "issues:write"
+	ScopeReportsRead = "reports:read"
+)
+
+// APITokenScopes lists every scope a personal access token can be granted.
+var APITokenScopes = []string{ScopeIssuesRead, ScopeIssuesWrite, ScopeReportsRead}
+
+// APITokenPrefix starts every personal access token so it can be told apart from a JWT (and found by secret scanners).
+const APITokenPrefix = "mh_pat_"
+
+// APIToken is a named personal access token for scripts and integrations. Only the SHA-256 hash
+// of the secret is stored; the plain token is shown once, when it is created.
+type APIToken struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID     uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	Name       string     `gorm:"type:varchar(100);not null" json:"name"`
+	TokenHash  string     `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	Hint       string     `gorm:"type:varchar(20)" json:"hint"` // first characters of the token, to recognise it in the list
+	Scopes     string     `gorm:"type:varchar(255);not null" json:"-"`
+	ExpiresAt  time.Time  `gorm:"not null" json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `gorm:"type:varchar(64)" json:"last_used_ip,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ScopeList  []string   `gorm:"-" json:"scopes"`
+
+	// Relations
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+func (t *APIToken) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return nil
+}
+
+// AfterFind fills ScopeList from the stored comma-separated scopes.
+func (t *APIToken) AfterFind(tx *gorm.DB) error {
+	t.ScopeList = t.GetScopes()
+	return nil
+}
+
+func (t *APIToken) GetScopes() []string {
+	if t.Scopes == "" {
+		return []string{}
+	}
+	return strings.Split(t.Scopes, ",")
+}
+
+func (t *APIToken) HasScope(scope string) bool {
+	for _, s := range t.GetScopes() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsActive reports whether the token is neither revoked nor expired.
+func (t *APIToken) IsActive() bool {
+	return t.RevokedAt == nil && time.Now().Before(t.ExpiresAt)
+}
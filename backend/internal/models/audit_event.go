@@ -0,0 +1,76 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Audit actions recorded by the services. Entity types are the lower-case model names ("issue", "client", ...).
+const (
+	AuditRequest         = "request" // every mutating API request, whatever its outcome
+	AuditCreate          = "create"
+	AuditUpdate          = "update"
+	AuditDelete          = "delete"
+	AuditStatusChange    = "status_change"
+	AuditMemberAdded     = "member_added"
+	AuditMemberRemoved   = "member_removed"
+	AuditRoleChange      = "role_change"
+	AuditLoginFailed     = "login_failed"
+	AuditAccountLocked   = "account_locked"
+	AuditAccountUnlocked = "account_unlocked"
+	AuditTokenCreated    = "token_created"
+	AuditTokenRevoked    = "token_revoked"
+	AuditModerated       = "moderated"
+)
+
+// AuditMeta identifies who made a change and the request it came from. Handlers build it
+// from the request context and pass it to the service that records the change.
+type AuditMeta struct {
+	ActorID   *uuid.UUID
+	ActorRole string
+	IPAddress string
+	RequestID string
+}
+
+// AuditEvent is one entry of the audit log. Before and After hold only the fields that changed
+// (the whole entity when it was created or deleted), as JSON objects.
+type AuditEvent struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ActorID    *uuid.UUID `gorm:"type:uuid;index" json:"actor_id,omitempty"`
+	ActorRole  string     `gorm:"type:varchar(20)" json:"actor_role,omitempty"`
+	Action     string     `gorm:"type:varchar(50);not null;index" json:"action"`
+	EntityType string     `gorm:"type:varchar(50);index:idx_audit_entity" json:"entity_type,omitempty"`
+	EntityID   string     `gorm:"type:varchar(64);index:idx_audit_entity" json:"entity_id,omitempty"`
+	Before     string     `gorm:"type:text" json:"-"`
+	After      string     `gorm:"type:text" json:"-"`
+	IPAddress  string     `gorm:"type:varchar(64)" json:"ip_address,omitempty"`
+	RequestID  string     `gorm:"type:varchar(64);index" json:"request_id,omitempty"`
+	CreatedAt  time.Time  `gorm:"index" json:"created_at"`
+
+	BeforeData json.RawMessage `gorm:"-" json:"before,omitempty"`
+	AfterData  json.RawMessage `gorm:"-" json:"after,omitempty"`
+
+	// Relations
+	Actor *User `gorm:"foreignKey:ActorID" json:"actor,omitempty"`
+}
+
+func (e *AuditEvent) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
+
+// AfterFind exposes the stored Before/After JSON as raw JSON in API responses.
+func (e *AuditEvent) AfterFind(tx *gorm.DB) error {
+	if e.Before != "" {
+		e.BeforeData = json.RawMessage(e.Before)
+	}
+	if e.After != "" {
+		e.AfterData = json.RawMessage(e.After)
+	}
+	return nil
+}
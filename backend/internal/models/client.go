@@ -18,6 +18,8 @@ type Client struct {
 	ContactEmail    *string   `gorm:"type:varchar(255)" json:"contact_email,omitempty"`
 	ContactPhone    *string   `gorm:"type:varchar(50)" json:"contact_phone,omitempty"`
 	Logo            *string   `gorm:"type:text" json:"logo,omitempty"`
+	// StorageQuota limits the bytes of files uploaded for the client; nil uses CLIENT_STORAGE_QUOTA, 0 means unlimited
+	StorageQuota    *int64    `json:"storage_quota,omitempty"`
 	CreatedBy       uuid.UUID `gorm:"type:uuid;not null" json:"created_by"`
 	CreatedAt       time.Time `json:"created_at"`
 	UpdatedAt       time.Time `json:"updated_at"`
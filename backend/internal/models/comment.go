@@ -17,12 +17,22 @@ type Comment struct {
 	CreatedAt  time.Time `json:"created_at"`
 	UpdatedAt  time.Time `json:"updated_at"`
 	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
+	// Set when a moderator removes the comment. It stays in the thread with ModeratedCommentText;
+	// the original text and attachments are kept (not exposed) for review.
+	ModeratedBy         *uuid.UUID `gorm:"type:uuid" json:"moderated_by,omitempty"`
+	ModeratedAt         *time.Time `json:"moderated_at,omitempty"`
+	ModerationReason    string     `gorm:"type:text" json:"moderation_reason,omitempty"`
+	OriginalText        string     `gorm:"type:text" json:"-"`
+	OriginalAttachments string     `gorm:"type:text" json:"-"`
 
 	// Relations
 	Issue Issue `gorm:"foreignKey:IssueID" json:"-"`
 	User  User  `gorm:"foreignKey:UserID" json:"user"`
 }
 
+// ModeratedCommentText replaces the text of a comment removed by a moderator.
+const ModeratedCommentText = "Comentario eliminado por un moderador"
+
 func (c *Comment) BeforeCreate(tx *gorm.DB) error {
 	if c.ID == uuid.Nil {
 		c.ID = uuid.New()
@@ -30,6 +40,11 @@ func (c *Comment) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// IsModerated reports whether a moderator removed the comment.
+func (c *Comment) IsModerated() bool {
+	return c.ModeratedAt != nil
+}
+
 // GetAttachments returns parsed attachments from JSON string
 func (c *Comment) GetAttachments() []Attachment {
 	if c.Attachments == "" {
@@ -42,13 +57,13 @@ func (c *Comment) GetAttachments() []Attachment {
 	return attachments
 }
 
-// SetAttachments stores attachments as JSON string
+// SetAttachments stores attachments as JSON string, without URL signatures
 func (c *Comment) SetAttachments(attachments []Attachment) error {
 	if len(attachments) == 0 {
 		c.Attachments = ""
 		return nil
 	}
-	data, err := json.Marshal(attachments)
+	data, err := json.Marshal(StripAttachmentSignatures(attachments))
 	if err != nil {
 		return err
 	}
@@ -66,6 +81,9 @@ type CommentResponse struct {
 	CreatedAt  time.Time   `json:"created_at"`
 	UpdatedAt  time.Time   `json:"updated_at"`
 	User       *User       `json:"user,omitempty"`
+	DeletedByModerator bool       `json:"deleted_by_moderator,omitempty"`
+	ModerationReason   string     `json:"moderation_reason,omitempty"`
+	ModeratedAt        *time.Time `json:"moderated_at,omitempty"`
 }
 
 // ToResponse converts Comment to CommentResponse with parsed attachments
@@ -79,5 +97,8 @@ func (c *Comment) ToResponse() CommentResponse {
 		CreatedAt:   c.CreatedAt,
 		UpdatedAt:   c.UpdatedAt,
 		User:        &c.User,
+		DeletedByModerator: c.IsModerated(),
+		ModerationReason:   c.ModerationReason,
+		ModeratedAt:        c.ModeratedAt,
 	}
 }
@@ -0,0 +1,125 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Entities that can own an uploaded file.
+const (
+	FileOwnerIssue   = "issue"
+	FileOwnerComment = "comment"
+	FileOwnerUser    = "user"   // avatar
+	FileOwnerClient  = "client" // logo
+)
+
+// Upload purposes (upload_purpose of POST /files/upload).
+const (
+	FilePurposeAttachment = "attachment"
+	FilePurposeAvatar     = "avatar"
+	FilePurposeClientLogo = "client_logo"
+)
+
+// Virus scan status of a file. Only clean files are served; infected ones are moved to quarantine.
+// Files over the scanner's size limit are too_large: they are never served nor scanned again.
+const (
+	FileScanPending  = "pending"
+	FileScanClean    = "clean"
+	FileScanInfected = "infected"
+	FileScanTooLarge = "too_large"
+)
+
+// File is an uploaded file. Rows are created on upload without an owner; saving an issue, comment,
+// avatar or logo that references the file makes that entity its owner. Files without an owner are
+// deleted by the file sweeper after a grace period.
+type File struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Key         string     `gorm:"type:text;not null;uniqueIndex" json:"-"` // storage key, served as "uploads/{key}"
+	Name        string     `gorm:"type:text" json:"name"`
+	ContentType string     `gorm:"type:varchar(255)" json:"content_type"`
+	Size        int64      `json:"size"`
+	Checksum    string     `gorm:"type:varchar(64)" json:"checksum"` // SHA-256, hex
+	Purpose     string     `gorm:"type:varchar(20)" json:"purpose"`  // attachment, avatar, client_logo
+	Thumbnails  string     `gorm:"type:text" json:"-"`               // JSON object of preview storage keys by size ("200", "800")
+	UploadedBy  uuid.UUID  `gorm:"type:uuid;not null;index" json:"uploaded_by"`
+	ClientID    *uuid.UUID `gorm:"type:uuid" json:"client_id,omitempty"`
+	ProjectID   *uuid.UUID `gorm:"type:uuid" json:"project_id,omitempty"`
+	OwnerType   string     `gorm:"type:varchar(20);index:idx_files_owner" json:"owner_type,omitempty"`
+	OwnerID     *uuid.UUID `gorm:"type:uuid;index:idx_files_owner" json:"owner_id,omitempty"`
+	// DetachedAt is when the file lost its owner; the grace period of unowned files starts here
+	// (or at CreatedAt for files that never had one).
+	DetachedAt *time.Time `gorm:"index" json:"detached_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	// Virus scan: uploads are pending until scanned when a scanner is configured (see Scanner)
+	ScanStatus    string     `gorm:"type:varchar(20);not null;default:clean;index" json:"scan_status"`
+	ScanSignature string     `gorm:"type:varchar(255)" json:"scan_signature,omitempty"` // malware found in infected files
+	ScannedAt     *time.Time `json:"scanned_at,omitempty"`
+	// Versions of an attachment point to its first version; only the latest is referenced by the issue
+	VersionOf *uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_files_version" json:"version_of,omitempty"`
+	Version   int        `gorm:"not null;default:1;uniqueIndex:idx_files_version" json:"version"`
+	// ThumbnailSize is the total size of the previews, counted with Size against the client's quota
+	ThumbnailSize int64 `gorm:"not null;default:0" json:"-"`
+}
+
+func (f *File) BeforeCreate(tx *gorm.DB) error {
+	if f.ID == uuid.Nil {
+		f.ID = uuid.New()
+	}
+	return nil
+}
+
+// FirstVersionID identifies the attachment a file is a version of: the ID of its first version.
+func (f *File) FirstVersionID() uuid.UUID {
+	if f.VersionOf != nil {
+		return *f.VersionOf
+	}
+	return f.ID
+}
+
+// Path is the public path of the file, as stored in attachments ("uploads/{key}").
+func (f *File) Path() string {
+	return "uploads/" + f.Key
+}
+
+// GetThumbnails returns the storage keys of the generated previews by size.
+func (f *File) GetThumbnails() map[string]string {
+	thumbnails := map[string]string{}
+	if f.Thumbnails != "" {
+		json.Unmarshal([]byte(f.Thumbnails), &thumbnails)
+	}
+	return thumbnails
+}
+
+// SetThumbnails stores the storage keys of the generated previews by size.
+func (f *File) SetThumbnails(thumbnails map[string]string) {
+	if len(thumbnails) == 0 {
+		f.Thumbnails = ""
+		return
+	}
+	data, _ := json.Marshal(thumbnails)
+	f.Thumbnails = string(data)
+}
+
+// ThumbnailPaths returns the public paths of the generated previews by size.
+func (f *File) ThumbnailPaths() map[string]string {
+	paths := map[string]string{}
+	for size, key := range f.GetThumbnails() {
+		paths[size] = "uploads/" + key
+	}
+	return paths
+}
+
+// FileUsage is the number and total size (previews included) of uploaded files of a client, or of one of its projects.
+type FileUsage struct {
+	ClientID     *uuid.UUID `json:"client_id,omitempty"`
+	ClientName   string     `json:"client_name,omitempty"`
+	StorageQuota *int64     `json:"-"` // the client's own quota, see Client.StorageQuota
+	ProjectID    *uuid.UUID `json:"project_id,omitempty"`
+	ProjectName  string     `json:"project_name,omitempty"`
+	Files        int64      `json:"files"`
+	Bytes        int64      `json:"bytes"`
+}
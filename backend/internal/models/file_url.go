@@ -0,0 +1,42 @@
+package models
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Query parameters of a signed file URL (see service.FileURLSigner).
+const (
+	FileURLExpiresParam   = "expires"
+	FileURLSignatureParam = "signature"
+)
+
+// StripFileURLSignature removes a signature the client sent back (e.g. when saving an issue it
+// loaded), so only the permanent URL is stored.
+func StripFileURLSignature(fileURL string) string {
+	if !strings.Contains(fileURL, FileURLSignatureParam+"=") {
+		return fileURL
+	}
+	u, err := url.Parse(fileURL)
+	if err != nil {
+		return fileURL
+	}
+	query := u.Query()
+	if query.Get(FileURLExpiresParam) == "" || query.Get(FileURLSignatureParam) == "" {
+		return fileURL
+	}
+	query.Del(FileURLExpiresParam)
+	query.Del(FileURLSignatureParam)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// StripAttachmentSignatures applies StripFileURLSignature to every attachment and drops the scan
+// status, which is looked up again for every response.
+func StripAttachmentSignatures(attachments []Attachment) []Attachment {
+	for i := range attachments {
+		attachments[i].URL = StripFileURLSignature(attachments[i].URL)
+		attachments[i].ScanStatus = ""
+	}
+	return attachments
+}
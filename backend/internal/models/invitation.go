@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Invitation lets an admin or team lead pre-create an account for an email with a chosen role
+// and client memberships. The emailed link carries a random token; only its SHA-256 hash is stored.
+type Invitation struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Email      string     `gorm:"type:varchar(255);not null;index" json:"email"`
+	Role       UserRole   `gorm:"type:varchar(20);not null;default:'user'" json:"role"`
+	TokenHash  string     `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	InvitedBy  uuid.UUID  `gorm:"type:uuid;not null" json:"invited_by"`
+	ExpiresAt  time.Time  `gorm:"not null" json:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+	AcceptedBy *uuid.UUID `gorm:"type:uuid" json:"accepted_by,omitempty"` // user created from the invitation
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	InviteLink string     `gorm:"-" json:"invite_link,omitempty"` // only returned to the inviter when email is not configured
+
+	// Relations
+	Inviter User               `gorm:"foreignKey:InvitedBy" json:"inviter"`
+	Clients []InvitationClient `gorm:"foreignKey:InvitationID" json:"clients"`
+}
+
+func (i *Invitation) BeforeCreate(tx *gorm.DB) error {
+	if i.ID == uuid.Nil {
+		i.ID = uuid.New()
+	}
+	return nil
+}
+
+// IsPending reports whether the invitation can still be accepted.
+func (i *Invitation) IsPending() bool {
+	return i.AcceptedAt == nil && i.RevokedAt == nil && time.Now().Before(i.ExpiresAt)
+}
+
+// InvitationClient is a client the invited user becomes a member of (ClientMember) on acceptance.
+type InvitationClient struct {
+	ID           uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"-"`
+	InvitationID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_invitation_client" json:"-"`
+	ClientID     uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_invitation_client" json:"client_id"`
+
+	// Relations
+	Client Client `gorm:"foreignKey:ClientID" json:"client"`
+}
+
+func (ic *InvitationClient) BeforeCreate(tx *gorm.DB) error {
+	if ic.ID == uuid.Nil {
+		ic.ID = uuid.New()
+	}
+	return nil
+}
@@ -50,6 +50,12 @@ type Attachment struct {
 	Type string `json:"type"` // "link", "image", "file"
 	URL  string `json:"url"`
 	Name string `json:"name,omitempty"`
+	// FileID links uploaded files ("image", "file") to their row in the files table
+	FileID *uuid.UUID `json:"file_id,omitempty"`
+	// ScanStatus of uploaded files (pending, clean, infected), filled in responses and never stored
+	ScanStatus string `json:"scan_status,omitempty"`
+	// Versions is the number of versions of an uploaded file; the attachment is the latest one
+	Versions int `json:"versions,omitempty"`
 }
 
 type Issue struct {
@@ -70,6 +76,8 @@ type Issue struct {
 	CreatedAt   time.Time    `json:"created_at"`
 	UpdatedAt   time.Time    `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	// CommentCount is only loaded by summary lists, which leave Comments empty
+	CommentCount int `gorm:"->;-:migration" json:"-"`
 
 	// Relations
 	Assignee   *User     `gorm:"foreignKey:AssignedTo" json:"assignee,omitempty"`
@@ -91,13 +99,13 @@ func (i *Issue) GetAttachments() []Attachment {
 	return atts
 }
 
-// SetAttachments stores attachments as JSON string
+// SetAttachments stores attachments as JSON string, without URL signatures
 func (i *Issue) SetAttachments(atts []Attachment) {
 	if len(atts) == 0 {
 		i.Attachments = ""
 		return
 	}
-	data, err := json.Marshal(atts)
+	data, err := json.Marshal(StripAttachmentSignatures(atts))
 	if err != nil {
 		i.Attachments = ""
 		return
@@ -135,6 +143,8 @@ type IssueResponse struct {
 	Project     *Project     `json:"project,omitempty"`
 	Client      *Client      `json:"client,omitempty"`
 	Comments    []Comment    `json:"comments,omitempty"`
+	// CommentCount is set in summary lists instead of Comments
+	CommentCount *int `json:"comment_count,omitempty"`
 }
 
 // ToResponse converts Issue to IssueResponse with parsed attachments
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// OIDCLoginState keeps the per-attempt secrets of an OpenID Connect login between the redirect
+// to the identity provider and its callback. Rows are single-use and expire after a few minutes.
+type OIDCLoginState struct {
+	ID           uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	StateHash    string    `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"` // SHA-256 of the state parameter
+	Nonce        string    `gorm:"type:varchar(64);not null" json:"-"`
+	CodeVerifier string    `gorm:"type:varchar(128);not null" json:"-"` // PKCE verifier, never leaves the server
+	ExpiresAt    time.Time `gorm:"not null;index" json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func (s *OIDCLoginState) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
+
+// OIDCLoginCode is the single-use code the SSO callback hands to the frontend, which exchanges it
+// with a POST for the same result as a password login, so tokens never travel in a URL.
+type OIDCLoginCode struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	CodeHash  string    `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"` // SHA-256 of the code
+	UserID    uuid.UUID `gorm:"type:uuid;not null" json:"user_id"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (c *OIDCLoginCode) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return nil
+}
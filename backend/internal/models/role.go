@@ -0,0 +1,122 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Permissions checked by the permission service. A role grants a set of them;
+// the admin role always holds every permission.
+const (
+	PermIssueViewAll      = "issue.view_all"      // see every issue, not only the ones assigned to you
+	PermIssueApprove      = "issue.approve"       // move issues to done (approval after review)
+	PermIssueReassign     = "issue.reassign"      // reassign issues held by someone with this permission
+	PermProjectViewAll    = "project.view_all"    // see projects of every client
+	PermProjectManage     = "project.manage"      // create, edit and delete projects of any client
+	PermProjectBulkCreate = "project.bulk_create" // create the monthly projects of several clients at once
+	PermClientCreate      = "client.create"
+	PermClientManage      = "client.manage" // edit any client and its team
+	PermClientDelete      = "client.delete" // delete any client
+	PermReportDownload    = "report.download"
+	PermCommentModerate   = "comment.moderate" // delete other people's comments, giving a reason
+	PermActivityNotify    = "activity.notify"  // be notified when members without it create or change work
+	PermUserInvite        = "user.invite"
+	PermUserManage        = "user.manage" // edit, delete and unlock other users and their sessions
+	PermRoleManage        = "role.manage"
+	PermAuditView         = "audit.view"     // read and export the audit log
+	PermStorageManage     = "storage.manage" // see the storage used by every client and set their quotas
+)
+
+// PermissionInfo describes a permission for the role editor.
+type PermissionInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// AllPermissions lists every permission a role can be granted.
+var AllPermissions = []PermissionInfo{
+	{PermIssueViewAll, "Ver todas las tareas, no solo las asignadas"},
+	{PermIssueApprove, "Aprobar tareas (mover de Revisión a Completada)"},
+	{PermIssueReassign, "Reasignar tareas asignadas a líderes o administradores"},
+	{PermProjectViewAll, "Ver los proyectos de todos los clientes"},
+	{PermProjectManage, "Crear, editar y eliminar proyectos de cualquier cliente"},
+	{PermProjectBulkCreate, "Crear proyectos mensuales masivos"},
+	{PermClientCreate, "Crear clientes"},
+	{PermClientManage, "Editar cualquier cliente y su equipo"},
+	{PermClientDelete, "Eliminar clientes"},
+	{PermReportDownload, "Descargar reportes de clientes"},
+	{PermCommentModerate, "Eliminar comentarios de otros indicando el motivo"},
+	{PermActivityNotify, "Recibir notificaciones de la actividad del equipo"},
+	{PermUserInvite, "Invitar usuarios"},
+	{PermUserManage, "Administrar usuarios, sus sesiones y bloqueos"},
+	{PermRoleManage, "Administrar roles y permisos"},
+	{PermAuditView, "Consultar y exportar el registro de auditoría"},
+	{PermStorageManage, "Consultar el almacenamiento de todos los clientes y fijar sus cuotas"},
+}
+
+// IsPermission reports whether name is a known permission.
+func IsPermission(name string) bool {
+	for _, p := range AllPermissions {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Role maps a role name (the value stored in User.Role) to a set of permissions.
+// The built-in roles are created by the migration; admins can add custom ones.
+type Role struct {
+	Name        UserRole  `gorm:"type:varchar(20);primaryKey" json:"name"`
+	Label       string    `gorm:"type:varchar(100);not null" json:"label"`
+	Description string    `gorm:"type:text" json:"description"`
+	Permissions string    `gorm:"type:text;not null;default:''" json:"-"` // comma-separated
+	BuiltIn     bool      `gorm:"not null;default:false" json:"built_in"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	PermissionList []string `gorm:"-" json:"permissions"`
+}
+
+// AfterFind fills PermissionList from the stored comma-separated permissions.
+func (r *Role) AfterFind(tx *gorm.DB) error {
+	r.PermissionList = r.GetPermissions()
+	return nil
+}
+
+func (r *Role) GetPermissions() []string {
+	if r.Permissions == "" {
+		return []string{}
+	}
+	return strings.Split(r.Permissions, ",")
+}
+
+func (r *Role) SetPermissions(permissions []string) {
+	r.Permissions = strings.Join(permissions, ",")
+	r.PermissionList = permissions
+}
+
+// BuiltInRoles returns the default roles with the permissions they had before roles were configurable.
+func BuiltInRoles() []Role {
+	teamLead := []string{}
+	for _, p := range AllPermissions {
+		if p.Name != PermUserManage && p.Name != PermRoleManage && p.Name != PermAuditView && p.Name != PermStorageManage {
+			teamLead = append(teamLead, p.Name)
+		}
+	}
+	roles := []Role{
+		{Name: RoleAdmin, Label: "Administrador", Description: "Acceso completo", BuiltIn: true},
+		{Name: RoleTeamLead, Label: "Líder de equipo", Description: "Gestiona clientes, proyectos y tareas", BuiltIn: true},
+		{Name: RoleUser, Label: "Usuario", Description: "Trabaja en las tareas asignadas y en los clientes de su equipo", BuiltIn: true},
+	}
+	all := make([]string, len(AllPermissions))
+	for i, p := range AllPermissions {
+		all[i] = p.Name
+	}
+	roles[0].SetPermissions(all)
+	roles[1].SetPermissions(teamLead)
+	roles[2].SetPermissions([]string{})
+	return roles
+}
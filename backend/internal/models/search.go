@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SearchTextConfig is the PostgreSQL text search configuration of the search_vector columns:
+// Spanish stemming of words stripped of accents, so "diseno" finds "Diseño".
+const SearchTextConfig = "es_unaccent"
+
+// Types of search results.
+const (
+	SearchTypeIssue   = "issue"
+	SearchTypeComment = "comment"
+	SearchTypeProject = "project"
+	SearchTypeClient  = "client"
+)
+
+// SearchResult is a match of the full-text search. Title and Snippet are HTML-escaped, with the
+// matched words wrapped in <mark>.
+type SearchResult struct {
+	Type      string     `json:"type"`
+	ID        uuid.UUID  `json:"id"`
+	Title     string     `json:"title"`
+	Snippet   string     `json:"snippet,omitempty"`
+	Rank      float64    `json:"rank"`
+	IssueID   *uuid.UUID `json:"issue_id,omitempty"`   // comments: the issue they belong to
+	ProjectID *uuid.UUID `json:"project_id,omitempty"` // issues and comments
+	ClientID  *uuid.UUID `json:"client_id,omitempty"`  // issues and projects
+	UpdatedAt time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Session is one login (device) of a user. It stores the SHA-256 hash of the current
+// refresh token, which is rotated on every refresh. Access tokens carry the session ID
+// in the "sid" claim so revoking the session invalidates them immediately.
+type Session struct {
+	ID                uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID            uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	RefreshTokenHash  string     `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	PreviousTokenHash *string    `gorm:"type:varchar(64);index" json:"-"` // last rotated-out token, used to detect reuse
+	UserAgent         string     `gorm:"type:varchar(512)" json:"user_agent"`
+	IPAddress         string     `gorm:"type:varchar(64)" json:"ip_address"`
+	ExpiresAt         time.Time  `gorm:"not null" json:"expires_at"`
+	LastUsedAt        time.Time  `json:"last_used_at"`
+	RevokedAt         *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+	Current           bool       `gorm:"-" json:"current"` // set when listing: the session of the requesting token
+
+	// Relations
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+func (s *Session) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
+
+// SessionMeta describes the device that opened or refreshed a session.
+type SessionMeta struct {
+	UserAgent string
+	IPAddress string
+	RequestID string // only used for the audit log
+}
+
+// IsActive reports whether the session has not been revoked and has not expired.
+func (s *Session) IsActive() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// UploadSession is a resumable upload in progress (see /uploads). Received bytes are kept in a
+// temporary file until Offset reaches Length; the upload is then saved like a regular one and
+// FileID points to the result.
+type UploadSession struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UploadedBy uuid.UUID  `gorm:"type:uuid;not null;index" json:"uploaded_by"`
+	Filename   string     `gorm:"type:text;not null" json:"filename"`
+	Purpose    string     `gorm:"type:varchar(20);not null" json:"purpose"`
+	UserID     string     `gorm:"type:varchar(36)" json:"user_id,omitempty"`
+	ClientID   string     `gorm:"type:varchar(36)" json:"client_id,omitempty"`
+	ProjectID  string     `gorm:"type:varchar(36)" json:"project_id,omitempty"`
+	Length     int64      `gorm:"not null" json:"length"`
+	Offset     int64      `gorm:"not null;default:0" json:"offset"`
+	FileID     *uuid.UUID `gorm:"type:uuid" json:"file_id,omitempty"`
+	ExpiresAt  time.Time  `gorm:"not null;index" json:"expires_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+
+	// Relations
+	File *File `gorm:"foreignKey:FileID" json:"-"`
+}
+
+func (u *UploadSession) BeforeCreate(tx *gorm.DB) error {
+	if u.ID == uuid.Nil {
+		u.ID = uuid.New()
+	}
+	return nil
+}
+
+// IsComplete reports whether every byte was received and the file saved.
+func (u *UploadSession) IsComplete() bool {
+	return u.FileID != nil
+}
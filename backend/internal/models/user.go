@@ -16,17 +16,31 @@ const (
 )
 
 type User struct {
-	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	Name      string    `gorm:"not null" json:"name"`
-	Email     string    `gorm:"uniqueIndex;not null" json:"email"`
-	Password  string    `gorm:"not null" json:"-"`
-	Role      UserRole  `gorm:"type:varchar(20);default:'user'" json:"role"`
-	Avatar                 *string         `json:"avatar,omitempty"`
-	PasswordResetToken     *string         `gorm:"type:varchar(255);index" json:"-"`
-	PasswordResetExpiresAt  *time.Time      `json:"-"`
-	CreatedAt               time.Time      `json:"created_at"`
-	UpdatedAt                time.Time      `json:"updated_at"`
-	DeletedAt               gorm.DeletedAt `gorm:"index" json:"-"`
+	ID                     uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Name                   string     `gorm:"not null" json:"name"`
+	Email                  string     `gorm:"uniqueIndex;not null" json:"email"`
+	Password               string     `gorm:"not null" json:"-"`
+	Role                   UserRole   `gorm:"type:varchar(20);default:'user'" json:"role"`
+	Avatar                 *string    `json:"avatar,omitempty"`
+	PasswordResetToken     *string    `gorm:"type:varchar(255);index" json:"-"`
+	PasswordResetExpiresAt *time.Time `json:"-"`
+	TokenVersion           int        `gorm:"not null;default:0" json:"-"` // bumped to invalidate every access token of the user
+	// Email verification: EmailVerifiedAt is cleared whenever Email changes. The token column stores a SHA-256 hash.
+	EmailVerifiedAt            *time.Time `json:"email_verified_at"`
+	EmailVerificationToken     *string    `gorm:"type:varchar(64);index" json:"-"`
+	EmailVerificationExpiresAt *time.Time `json:"-"`
+	// Per-account lockout after repeated failed logins (see service/account_lockout.go)
+	FailedLoginAttempts int        `gorm:"not null;default:0" json:"-"`
+	LastFailedLoginAt   *time.Time `json:"-"`
+	LockedUntil         *time.Time `json:"locked_until,omitempty"`
+	// Two-factor authentication (RFC 6238 TOTP). TOTPSecret is set on setup and only used once TOTPEnabled is true.
+	TOTPSecret        *string        `gorm:"type:varchar(64)" json:"-"`
+	TOTPEnabled       bool           `gorm:"default:false" json:"two_factor_enabled"`
+	TOTPLastUsedStep  int64          `gorm:"default:0" json:"-"` // last accepted time step, prevents replaying a code
+	TOTPRecoveryCodes string         `gorm:"type:text" json:"-"` // JSON array of SHA-256 hashes of unused recovery codes
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	DeletedAt         gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
 func (u *User) BeforeCreate(tx *gorm.DB) error {
@@ -35,3 +49,14 @@ func (u *User) BeforeCreate(tx *gorm.DB) error {
 	}
 	return nil
 }
+
+// IsEmailVerified reports whether the user proved they own their current email address.
+// Account emails (password reset, security notifications) are only sent to verified addresses.
+func (u *User) IsEmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+// IsLocked reports whether the account is temporarily locked after too many failed logins.
+func (u *User) IsLocked() bool {
+	return u.LockedUntil != nil && time.Now().Before(*u.LockedUntil)
+}
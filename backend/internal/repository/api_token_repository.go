@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"mellon-harmony-api/internal/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type APITokenRepository interface {
+	Create(token *models.APIToken) error
+	GetByHash(hash string) (*models.APIToken, error)
+	GetByUserID(userID uuid.UUID) ([]models.APIToken, error)
+	Revoke(userID, id uuid.UUID) (bool, error)
+	RevokeAllForUser(userID uuid.UUID) error
+	TouchLastUsed(id uuid.UUID, ip string) error
+}
+
+type apiTokenRepository struct {
+	db *gorm.DB
+}
+
+func NewAPITokenRepository(db *gorm.DB) APITokenRepository {
+	return &apiTokenRepository{db: db}
+}
+
+func (r *apiTokenRepository) Create(token *models.APIToken) error {
+	return r.db.Omit("User").Create(token).Error
+}
+
+func (r *apiTokenRepository) GetByHash(hash string) (*models.APIToken, error) {
+	var token models.APIToken
+	err := r.db.Where("token_hash = ?", hash).First(&token).Error
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// GetByUserID returns the user's tokens that are not revoked, newest first (expired ones are kept so they can be cleaned up).
+func (r *apiTokenRepository) GetByUserID(userID uuid.UUID) ([]models.APIToken, error) {
+	var tokens []models.APIToken
+	err := r.db.Where("user_id = ? AND revoked_at IS NULL", userID).Order("created_at DESC").Find(&tokens).Error
+	return tokens, err
+}
+
+// Revoke revokes one of the user's tokens and reports whether it existed.
+func (r *apiTokenRepository) Revoke(userID, id uuid.UUID) (bool, error) {
+	result := r.db.Model(&models.APIToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+// RevokeAllForUser revokes every token of the user, e.g. after a password reset or account deletion.
+func (r *apiTokenRepository) RevokeAllForUser(userID uuid.UUID) error {
+	return r.db.Model(&models.APIToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (r *apiTokenRepository) TouchLastUsed(id uuid.UUID, ip string) error {
+	return r.db.Model(&models.APIToken{}).Where("id = ?", id).
+		UpdateColumns(map[string]interface{}{"last_used_at": time.Now(), "last_used_ip": ip}).Error
+}
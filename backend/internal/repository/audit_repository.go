@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"mellon-harmony-api/internal/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AuditFilter narrows the audit log; zero values match everything.
+type AuditFilter struct {
+	ActorID    *uuid.UUID
+	Action     string
+	EntityType string
+	EntityID   string
+	RequestID  string
+	From       *time.Time
+	To         *time.Time // exclusive
+}
+
+type AuditRepository interface {
+	Create(event *models.AuditEvent) error
+	// List returns one page of matching events, newest first, and the total number of matches.
+	List(filter AuditFilter, limit, offset int) ([]models.AuditEvent, int64, error)
+	// Each calls fn with every matching event, newest first, loading them in batches.
+	Each(filter AuditFilter, fn func(event *models.AuditEvent) error) error
+}
+
+type auditRepository struct {
+	db *gorm.DB
+}
+
+func NewAuditRepository(db *gorm.DB) AuditRepository {
+	return &auditRepository{db: db}
+}
+
+func (r *auditRepository) Create(event *models.AuditEvent) error {
+	return r.db.Omit("Actor").Create(event).Error
+}
+
+func (r *auditRepository) List(filter AuditFilter, limit, offset int) ([]models.AuditEvent, int64, error) {
+	var total int64
+	if err := r.filtered(filter).Model(&models.AuditEvent{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var events []models.AuditEvent
+	err := r.filtered(filter).
+		Preload("Actor").
+		Order("created_at DESC, id DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&events).Error
+	return events, total, err
+}
+
+func (r *auditRepository) Each(filter AuditFilter, fn func(event *models.AuditEvent) error) error {
+	const batchSize = 500
+	var last *models.AuditEvent
+	for {
+		query := r.filtered(filter)
+		// Keyset pagination, so events recorded during the export do not shift the batches
+		if last != nil {
+			query = query.Where("(created_at, id) < (?, ?)", last.CreatedAt, last.ID)
+		}
+		var events []models.AuditEvent
+		err := query.
+			Preload("Actor").
+			Order("created_at DESC, id DESC").
+			Limit(batchSize).
+			Find(&events).Error
+		if err != nil {
+			return err
+		}
+		for i := range events {
+			if err := fn(&events[i]); err != nil {
+				return err
+			}
+		}
+		if len(events) < batchSize {
+			return nil
+		}
+		last = &events[len(events)-1]
+	}
+}
+
+func (r *auditRepository) filtered(filter AuditFilter) *gorm.DB {
+	query := r.db
+	if filter.ActorID != nil {
+		query = query.Where("actor_id = ?", *filter.ActorID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.EntityType != "" {
+		query = query.Where("entity_type = ?", filter.EntityType)
+	}
+	if filter.EntityID != "" {
+		query = query.Where("entity_id = ?", filter.EntityID)
+	}
+	if filter.RequestID != "" {
+		query = query.Where("request_id = ?", filter.RequestID)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+	return query
+}
@@ -11,6 +11,8 @@ type ClientRepository interface {
 	Create(client *models.Client) error
 	GetByID(id uuid.UUID) (*models.Client, error)
 	GetAll() ([]models.Client, error)
+	// List returns one page of clients and the total number of clients. Summary rows have no projects.
+	List(opts ListOptions) ([]models.Client, int64, error)
 	Update(client *models.Client) error
 	Delete(id uuid.UUID) error
 }
@@ -44,6 +46,20 @@ func (r *clientRepository) GetAll() ([]models.Client, error) {
 	return clients, err
 }
 
+func (r *clientRepository) List(opts ListOptions) ([]models.Client, int64, error) {
+	var total int64
+	if err := r.db.Model(&models.Client{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	query := r.db.Preload("Creator")
+	if !opts.Summary {
+		query = query.Preload("Projects")
+	}
+	var clients []models.Client
+	err := opts.page(query, "created_at").Find(&clients).Error
+	return clients, total, err
+}
+
 func (r *clientRepository) Update(client *models.Client) error {
 	return r.db.Save(client).Error
 }
@@ -0,0 +1,302 @@
+package repository
+
+import (
+	"errors"
+	"mellon-harmony-api/internal/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// QuotaCheck approves storing extra more bytes for the client of usage, or returns why not.
+type QuotaCheck func(usage *models.FileUsage, extra int64) error
+
+// fileBytes is the storage taken by the files of a query, previews included.
+const fileBytes = "COALESCE(SUM(files.size + files.thumbnail_size), 0)"
+
+type FileRepository interface {
+	// Create records a file. For a file of a client, check approves the new bytes first while the
+	// client's storage is locked, so concurrent uploads cannot all take the last free space.
+	Create(file *models.File, check QuotaCheck) error
+	GetByID(id uuid.UUID) (*models.File, error)
+	GetByKeys(keys []string) ([]models.File, error)
+	// GetServed returns the file stored under key, or the file whose preview is stored under key.
+	GetServed(key string) ([]models.File, error)
+	// Link makes ownerType/ownerID the owner of the given files, skipping files another entity owns.
+	// With a clientID, files linked for the first time are charged to that client, as approved by
+	// check under the client's storage lock, whatever client they were uploaded for.
+	Link(ownerType string, ownerID uuid.UUID, ids []uuid.UUID, clientID *uuid.UUID, check QuotaCheck) error
+	// ListVersions returns the versions of an attachment given the ID of its first version, latest first.
+	ListVersions(firstVersionID uuid.UUID) ([]models.File, error)
+	// Release removes ownerType/ownerID as owner of its files except keep and the other versions of
+	// keep, starting their grace period.
+	Release(ownerType string, ownerID uuid.UUID, keep []uuid.UUID, now time.Time) error
+	// Detach restarts the grace period of an unowned file.
+	Detach(id uuid.UUID, now time.Time) error
+	// ReleaseDeletedOwners releases files whose owner was deleted (or, for comments, whose issue was).
+	ReleaseDeletedOwners(now time.Time) (int64, error)
+	// ListUnowned returns up to limit files that have had no owner since before the given time.
+	ListUnowned(before time.Time, limit int) ([]models.File, error)
+	// IsReferenced reports whether a live issue, comment, avatar or logo still mentions the storage key.
+	IsReferenced(key string) (bool, error)
+	// SetScanStatus records the result of a virus scan.
+	SetScanStatus(id uuid.UUID, status, signature string, scannedAt time.Time) error
+	// ListPendingScan returns up to limit files uploaded before the given time that were never scanned.
+	ListPendingScan(before time.Time, limit int) ([]models.File, error)
+	// GetScanStatuses returns the scan status of the given files by ID.
+	GetScanStatuses(ids []uuid.UUID) (map[uuid.UUID]string, error)
+	// GetClientUsage returns the files stored for a client and its quota; gorm.ErrRecordNotFound if the client does not exist.
+	GetClientUsage(clientID uuid.UUID) (*models.FileUsage, error)
+	// GetProjectUsage returns the files stored for a client by project, largest first.
+	GetProjectUsage(clientID uuid.UUID) ([]models.FileUsage, error)
+	// GetUsageByClient returns the files stored for every client, largest first.
+	GetUsageByClient() ([]models.FileUsage, error)
+	// GetUnassignedUsage returns the files stored without a client (avatars, general attachments).
+	GetUnassignedUsage() (*models.FileUsage, error)
+	Delete(id uuid.UUID) error
+}
+
+type fileRepository struct {
+	db *gorm.DB
+}
+
+func NewFileRepository(db *gorm.DB) FileRepository {
+	return &fileRepository{db: db}
+}
+
+func (r *fileRepository) Create(file *models.File, check QuotaCheck) error {
+	if file.ClientID == nil || check == nil {
+		return r.db.Create(file).Error
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkClientQuota(tx, *file.ClientID, file.Size+file.ThumbnailSize, check); err != nil {
+			return err
+		}
+		return tx.Create(file).Error
+	})
+}
+
+// checkClientQuota locks the client's storage until the end of the transaction and runs check
+// on its usage. Unknown clients have no quota.
+func checkClientQuota(tx *gorm.DB, clientID uuid.UUID, extra int64, check QuotaCheck) error {
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtextextended(?, 0))", "client_storage:"+clientID.String()).Error; err != nil {
+		return err
+	}
+	usage, err := clientUsage(tx, clientID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return check(usage, extra)
+}
+
+func (r *fileRepository) GetByID(id uuid.UUID) (*models.File, error) {
+	var file models.File
+	if err := r.db.Where("id = ?", id).First(&file).Error; err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+func (r *fileRepository) GetByKeys(keys []string) ([]models.File, error) {
+	var files []models.File
+	if len(keys) == 0 {
+		return files, nil
+	}
+	err := r.db.Where("key IN ?", keys).Find(&files).Error
+	return files, err
+}
+
+func (r *fileRepository) GetServed(key string) ([]models.File, error) {
+	var files []models.File
+	// Thumbnails is a JSON object whose values are the preview keys
+	pattern := `%"` + likeEscaper.Replace(key) + `"%`
+	err := r.db.Where("key = ? OR thumbnails LIKE ?", key, pattern).Find(&files).Error
+	return files, err
+}
+
+func (r *fileRepository) Link(ownerType string, ownerID uuid.UUID, ids []uuid.UUID, clientID *uuid.UUID, check QuotaCheck) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if clientID != nil {
+			// Unowned files are new to the entity; others are already charged to it or stay with their owner
+			charged := tx.Model(&models.File{}).
+				Where("id IN ? AND owner_id IS NULL AND client_id IS DISTINCT FROM ?", ids, *clientID)
+			var extra int64
+			if err := charged.Session(&gorm.Session{}).Select(fileBytes).Scan(&extra).Error; err != nil {
+				return err
+			}
+			if extra > 0 && check != nil {
+				if err := checkClientQuota(tx, *clientID, extra, check); err != nil {
+					return err
+				}
+			}
+			if err := charged.Update("client_id", *clientID).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&models.File{}).
+			Where("id IN ?", ids).
+			Where("(owner_id IS NULL OR (owner_type = ? AND owner_id = ?))", ownerType, ownerID).
+			Updates(map[string]interface{}{
+				"owner_type":  ownerType,
+				"owner_id":    ownerID,
+				"detached_at": nil,
+			}).Error
+	})
+}
+
+func (r *fileRepository) ListVersions(firstVersionID uuid.UUID) ([]models.File, error) {
+	var files []models.File
+	err := r.db.Where("id = ? OR version_of = ?", firstVersionID, firstVersionID).
+		Order("version DESC").
+		Find(&files).Error
+	return files, err
+}
+
+func (r *fileRepository) Release(ownerType string, ownerID uuid.UUID, keep []uuid.UUID, now time.Time) error {
+	query := r.db.Model(&models.File{}).Where("owner_type = ? AND owner_id = ?", ownerType, ownerID)
+	if len(keep) > 0 {
+		query = query.Where("COALESCE(version_of, id) NOT IN (SELECT COALESCE(version_of, id) FROM files WHERE id IN ?)", keep)
+	}
+	return query.Updates(map[string]interface{}{
+		"owner_type":  "",
+		"owner_id":    nil,
+		"detached_at": now,
+	}).Error
+}
+
+func (r *fileRepository) Detach(id uuid.UUID, now time.Time) error {
+	return r.db.Model(&models.File{}).Where("id = ?", id).Update("detached_at", now).Error
+}
+
+func (r *fileRepository) ReleaseDeletedOwners(now time.Time) (int64, error) {
+	result := r.db.Model(&models.File{}).
+		Where("owner_id IS NOT NULL").
+		Where(`((owner_type = ? AND NOT EXISTS (SELECT 1 FROM issues WHERE issues.id = files.owner_id AND issues.deleted_at IS NULL))
+			OR (owner_type = ? AND NOT EXISTS (SELECT 1 FROM comments JOIN issues ON issues.id = comments.issue_id
+				WHERE comments.id = files.owner_id AND comments.deleted_at IS NULL AND issues.deleted_at IS NULL))
+			OR (owner_type = ? AND NOT EXISTS (SELECT 1 FROM users WHERE users.id = files.owner_id AND users.deleted_at IS NULL))
+			OR (owner_type = ? AND NOT EXISTS (SELECT 1 FROM clients WHERE clients.id = files.owner_id AND clients.deleted_at IS NULL)))`,
+			models.FileOwnerIssue, models.FileOwnerComment, models.FileOwnerUser, models.FileOwnerClient).
+		Updates(map[string]interface{}{
+			"owner_type":  "",
+			"owner_id":    nil,
+			"detached_at": now,
+		})
+	return result.RowsAffected, result.Error
+}
+
+func (r *fileRepository) ListUnowned(before time.Time, limit int) ([]models.File, error) {
+	var files []models.File
+	err := r.db.Where("owner_id IS NULL AND COALESCE(detached_at, created_at) < ?", before).
+		Order("created_at ASC").
+		Limit(limit).
+		Find(&files).Error
+	return files, err
+}
+
+func (r *fileRepository) IsReferenced(key string) (bool, error) {
+	pattern := "%" + key + "%"
+	var referenced bool
+	err := r.db.Raw(`SELECT EXISTS (SELECT 1 FROM issues WHERE issues.deleted_at IS NULL AND issues.attachments LIKE ?)
+		OR EXISTS (SELECT 1 FROM comments JOIN issues ON issues.id = comments.issue_id
+			WHERE comments.deleted_at IS NULL AND issues.deleted_at IS NULL
+			AND (comments.attachments LIKE ? OR comments.original_attachments LIKE ?))
+		OR EXISTS (SELECT 1 FROM users WHERE deleted_at IS NULL AND avatar LIKE ?)
+		OR EXISTS (SELECT 1 FROM clients WHERE deleted_at IS NULL AND logo LIKE ?)`,
+		pattern, pattern, pattern, pattern, pattern).Scan(&referenced).Error
+	return referenced, err
+}
+
+func (r *fileRepository) SetScanStatus(id uuid.UUID, status, signature string, scannedAt time.Time) error {
+	return r.db.Model(&models.File{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"scan_status":    status,
+		"scan_signature": signature,
+		"scanned_at":     scannedAt,
+	}).Error
+}
+
+func (r *fileRepository) ListPendingScan(before time.Time, limit int) ([]models.File, error) {
+	var files []models.File
+	err := r.db.Where("scan_status = ? AND created_at < ?", models.FileScanPending, before).
+		Order("created_at ASC").
+		Limit(limit).
+		Find(&files).Error
+	return files, err
+}
+
+func (r *fileRepository) GetScanStatuses(ids []uuid.UUID) (map[uuid.UUID]string, error) {
+	statuses := make(map[uuid.UUID]string, len(ids))
+	if len(ids) == 0 {
+		return statuses, nil
+	}
+	var files []models.File
+	if err := r.db.Select("id", "scan_status").Where("id IN ?", ids).Find(&files).Error; err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		statuses[file.ID] = file.ScanStatus
+	}
+	return statuses, nil
+}
+
+func (r *fileRepository) GetClientUsage(clientID uuid.UUID) (*models.FileUsage, error) {
+	return clientUsage(r.db, clientID)
+}
+
+func clientUsage(db *gorm.DB, clientID uuid.UUID) (*models.FileUsage, error) {
+	var usage models.FileUsage
+	err := db.Table("clients").
+		Select("clients.id AS client_id, clients.name AS client_name, clients.storage_quota, COUNT(files.id) AS files, "+fileBytes+" AS bytes").
+		Joins("LEFT JOIN files ON files.client_id = clients.id").
+		Where("clients.id = ? AND clients.deleted_at IS NULL", clientID).
+		Group("clients.id").
+		Take(&usage).Error
+	if err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+func (r *fileRepository) GetProjectUsage(clientID uuid.UUID) ([]models.FileUsage, error) {
+	var usage []models.FileUsage
+	err := r.db.Table("files").
+		Select("files.client_id, files.project_id, projects.name AS project_name, COUNT(files.id) AS files, "+fileBytes+" AS bytes").
+		Joins("LEFT JOIN projects ON projects.id = files.project_id").
+		Where("files.client_id = ?", clientID).
+		Group("files.client_id, files.project_id, projects.name").
+		Order("bytes DESC").
+		Scan(&usage).Error
+	return usage, err
+}
+
+func (r *fileRepository) GetUsageByClient() ([]models.FileUsage, error) {
+	var usage []models.FileUsage
+	err := r.db.Table("clients").
+		Select("clients.id AS client_id, clients.name AS client_name, clients.storage_quota, COUNT(files.id) AS files, " + fileBytes + " AS bytes").
+		Joins("LEFT JOIN files ON files.client_id = clients.id").
+		Where("clients.deleted_at IS NULL").
+		Group("clients.id").
+		Order("bytes DESC, clients.name ASC").
+		Scan(&usage).Error
+	return usage, err
+}
+
+func (r *fileRepository) GetUnassignedUsage() (*models.FileUsage, error) {
+	var usage models.FileUsage
+	err := r.db.Table("files").
+		Select("COUNT(files.id) AS files, " + fileBytes + " AS bytes").
+		Where("files.client_id IS NULL").
+		Scan(&usage).Error
+	return &usage, err
+}
+
+func (r *fileRepository) Delete(id uuid.UUID) error {
+	return r.db.Delete(&models.File{}, id).Error
+}
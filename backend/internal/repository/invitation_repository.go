@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"errors"
+	"mellon-harmony-api/internal/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrInvitationUsed is returned by Accept when the invitation was accepted or revoked concurrently.
+var ErrInvitationUsed = errors.New("invitation already used")
+
+type InvitationRepository interface {
+	Create(invitation *models.Invitation) error
+	GetByID(id uuid.UUID) (*models.Invitation, error)
+	GetByTokenHash(hash string) (*models.Invitation, error)
+	GetAll() ([]models.Invitation, error)
+	Update(invitation *models.Invitation) error
+	RevokePendingForEmail(email string) error
+	Accept(invitation *models.Invitation, user *models.User) error
+}
+
+type invitationRepository struct {
+	db *gorm.DB
+}
+
+func NewInvitationRepository(db *gorm.DB) InvitationRepository {
+	return &invitationRepository{db: db}
+}
+
+// Create inserts the invitation together with its client rows.
+func (r *invitationRepository) Create(invitation *models.Invitation) error {
+	return r.db.Omit("Inviter", "Clients.Client").Create(invitation).Error
+}
+
+func (r *invitationRepository) GetByID(id uuid.UUID) (*models.Invitation, error) {
+	var invitation models.Invitation
+	err := r.db.Preload("Inviter").Preload("Clients.Client").Where("id = ?", id).First(&invitation).Error
+	if err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+func (r *invitationRepository) GetByTokenHash(hash string) (*models.Invitation, error) {
+	var invitation models.Invitation
+	err := r.db.Preload("Inviter").Preload("Clients.Client").Where("token_hash = ?", hash).First(&invitation).Error
+	if err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+func (r *invitationRepository) GetAll() ([]models.Invitation, error) {
+	var invitations []models.Invitation
+	err := r.db.Preload("Inviter").Preload("Clients.Client").Order("created_at DESC").Find(&invitations).Error
+	return invitations, err
+}
+
+func (r *invitationRepository) Update(invitation *models.Invitation) error {
+	return r.db.Omit("Inviter", "Clients").Save(invitation).Error
+}
+
+// RevokePendingForEmail revokes older open invitations so only the newest link works.
+func (r *invitationRepository) RevokePendingForEmail(email string) error {
+	return r.db.Model(&models.Invitation{}).
+		Where("LOWER(email) = LOWER(?) AND accepted_at IS NULL AND revoked_at IS NULL", email).
+		Update("revoked_at", time.Now()).Error
+}
+
+// Accept marks the invitation as used, creates the user and adds the client memberships
+// in one transaction, so a link can never create two accounts.
+func (r *invitationRepository) Accept(invitation *models.Invitation, user *models.User) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		result := tx.Model(&models.Invitation{}).
+			Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", invitation.ID).
+			Updates(map[string]interface{}{"accepted_at": now, "accepted_by": user.ID})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvitationUsed
+		}
+		for _, ic := range invitation.Clients {
+			if err := tx.Create(&models.ClientMember{ClientID: ic.ClientID, UserID: user.ID}).Error; err != nil {
+				return err
+			}
+		}
+		invitation.AcceptedAt = &now
+		invitation.AcceptedBy = &user.ID
+		return nil
+	})
+}
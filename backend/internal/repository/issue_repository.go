@@ -2,16 +2,63 @@ package repository
 
 import (
 	"mellon-harmony-api/internal/models"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
+// IssueFilter narrows issue lists; zero values match everything and the values of a field are
+// alternatives (status IN ...).
+type IssueFilter struct {
+	Statuses    []models.IssueStatus
+	Priorities  []models.IssuePriority
+	TaskTypes   []string
+	AssigneeIDs []uuid.UUID
+	Unassigned  bool // issues without assignee, or with one of AssigneeIDs when set
+	CreatorIDs  []uuid.UUID
+	ProjectIDs  []uuid.UUID
+	ClientIDs   []uuid.UUID
+	Due         TimeRange
+	Start       TimeRange
+	Approved    TimeRange
+	Overdue     bool   // due date passed and not done
+	Text        string // contained in the title or description, case-insensitively
+	// VisibleTo limits the issues to those this user may access (see IssueService.CanAccessIssue)
+	VisibleTo *uuid.UUID
+}
+
+// TimeRange matches times from From (inclusive) to To (exclusive); either may be nil.
+type TimeRange struct {
+	From *time.Time
+	To   *time.Time
+}
+
+func (t TimeRange) where(query *gorm.DB, column string) *gorm.DB {
+	if t.From != nil {
+		query = query.Where(column+" >= ?", *t.From)
+	}
+	if t.To != nil {
+		query = query.Where(column+" < ?", *t.To)
+	}
+	return query
+}
+
+// likeEscaper escapes the wildcards of LIKE patterns (backslash is Postgres' default escape character).
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
 type IssueRepository interface {
 	Create(issue *models.Issue) error
 	GetByID(id uuid.UUID) (*models.Issue, error)
-	GetAll(filters map[string]interface{}) ([]models.Issue, error)
+	GetAll(filter IssueFilter) ([]models.Issue, error)
+	// GetAttachments returns the issues matching filter with only what attachment archives need:
+	// the title, the project name and the attachments of the issue and of its comments.
+	GetAttachments(filter IssueFilter) ([]models.Issue, error)
+	// List returns one page of the issues matching filter and the total number of matches. Summary
+	// rows have no comments but their CommentCount.
+	List(filter IssueFilter, opts ListOptions) ([]models.Issue, int64, error)
 	GetByAssignedTo(userID uuid.UUID) ([]models.Issue, error)
 	GetByProjectID(projectID uuid.UUID) ([]models.Issue, error)
 	Update(issue *models.Issue) error
@@ -40,28 +87,95 @@ func (r *issueRepository) GetByID(id uuid.UUID) (*models.Issue, error) {
 	return &issue, nil
 }
 
-func (r *issueRepository) GetAll(filters map[string]interface{}) ([]models.Issue, error) {
+func (r *issueRepository) GetAll(filter IssueFilter) ([]models.Issue, error) {
+	var issues []models.Issue
+	err := r.filtered(filter).
+		Preload("Assignee").Preload("Creator").Preload("Project").Preload("Client").Preload("Comments.User").
+		Order("created_at DESC").Find(&issues).Error
+	return issues, err
+}
+
+func (r *issueRepository) GetAttachments(filter IssueFilter) ([]models.Issue, error) {
+	var issues []models.Issue
+	err := r.filtered(filter).Select("id", "title", "project_id", "attachments").
+		Preload("Project", func(db *gorm.DB) *gorm.DB { return db.Select("id", "name") }).
+		Preload("Comments", func(db *gorm.DB) *gorm.DB {
+			return db.Select("id", "issue_id", "attachments").Where("attachments IS NOT NULL AND attachments <> ''")
+		}).
+		Order("created_at DESC").Find(&issues).Error
+	return issues, err
+}
+
+func (r *issueRepository) List(filter IssueFilter, opts ListOptions) ([]models.Issue, int64, error) {
+	var total int64
+	if err := r.filtered(filter).Model(&models.Issue{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	query := r.filtered(filter).Preload("Assignee").Preload("Creator").Preload("Project").Preload("Client")
+	if opts.Summary {
+		query = query.Select("issues.*, (SELECT COUNT(*) FROM comments WHERE comments.issue_id = issues.id AND comments.deleted_at IS NULL) AS comment_count")
+	} else {
+		query = query.Preload("Comments.User")
+	}
 	var issues []models.Issue
-	query := r.db.Preload("Assignee").Preload("Creator").Preload("Project").Preload("Client").Preload("Comments.User")
+	err := opts.page(query, "created_at").Find(&issues).Error
+	return issues, total, err
+}
 
-	if status, ok := filters["status"]; ok {
-		query = query.Where("status = ?", status)
+func (r *issueRepository) filtered(filter IssueFilter) *gorm.DB {
+	query := r.db
+	if len(filter.Statuses) > 0 {
+		query = query.Where("status IN ?", filter.Statuses)
+	}
+	if len(filter.Priorities) > 0 {
+		query = query.Where("priority IN ?", filter.Priorities)
 	}
-	if priority, ok := filters["priority"]; ok {
-		query = query.Where("priority = ?", priority)
+	if len(filter.TaskTypes) > 0 {
+		query = query.Where("task_type IN ?", filter.TaskTypes)
 	}
-	if assignedTo, ok := filters["assigned_to"]; ok {
-		query = query.Where("assigned_to = ?", assignedTo)
+	switch {
+	case len(filter.AssigneeIDs) > 0 && filter.Unassigned:
+		query = query.Where("(assigned_to IN ? OR assigned_to IS NULL)", filter.AssigneeIDs)
+	case len(filter.AssigneeIDs) > 0:
+		query = query.Where("assigned_to IN ?", filter.AssigneeIDs)
+	case filter.Unassigned:
+		query = query.Where("assigned_to IS NULL")
 	}
-	if projectID, ok := filters["project_id"]; ok {
-		query = query.Where("project_id = ?", projectID)
+	if len(filter.CreatorIDs) > 0 {
+		query = query.Where("created_by IN ?", filter.CreatorIDs)
 	}
-	if clientID, ok := filters["client_id"]; ok {
-		query = query.Where("client_id = ?", clientID)
+	if len(filter.ProjectIDs) > 0 {
+		query = query.Where("project_id IN ?", filter.ProjectIDs)
 	}
+	if len(filter.ClientIDs) > 0 {
+		query = query.Where("client_id IN ?", filter.ClientIDs)
+	}
+	query = filter.Due.where(query, "due_date")
+	query = filter.Start.where(query, "start_date")
+	query = filter.Approved.where(query, "approved_at")
+	if filter.Overdue {
+		query = query.Where("due_date < ? AND status <> ?", time.Now(), models.StatusDone)
+	}
+	if filter.Text != "" {
+		pattern := "%" + likeEscaper.Replace(filter.Text) + "%"
+		query = query.Where("(title ILIKE ? OR description ILIKE ?)", pattern, pattern)
+	}
+	if filter.VisibleTo != nil {
+		query = query.Where(visibleIssues("issues"), map[string]interface{}{"user": *filter.VisibleTo})
+	}
+	return query
+}
 
-	err := query.Order("created_at DESC").Find(&issues).Error
-	return issues, err
+// memberClients are the clients whose team the user given as the named argument @user is on.
+const memberClients = "SELECT client_id FROM client_members WHERE user_id = @user"
+
+// visibleIssues mirrors IssueService.CanAccessIssue for the issues of table (a name or alias),
+// for the user given as the named argument @user. Search uses it too.
+func visibleIssues(table string) string {
+	return "(" + table + ".created_by = @user OR " + table + ".assigned_to = @user" +
+		" OR " + table + ".client_id IN (" + memberClients + ")" +
+		" OR " + table + ".project_id IN (SELECT project_id FROM project_members WHERE user_id = @user)" +
+		" OR " + table + ".project_id IN (SELECT id FROM projects WHERE client_id IN (" + memberClients + ")))"
 }
 
 func (r *issueRepository) GetByAssignedTo(userID uuid.UUID) ([]models.Issue, error) {
@@ -0,0 +1,32 @@
+package repository
+
+import "gorm.io/gorm"
+
+// ListOptions pages and sorts a list. Sort is an ORDER BY expression the caller picked from a fixed
+// set (see handlers.listOptions), never raw input; rows with equal sort values are ordered by ID so
+// pages do not overlap.
+type ListOptions struct {
+	Limit  int // 0 returns every row
+	Offset int
+	Sort   string
+	Desc   bool
+	// Summary skips the heavy relations of list rows: issue comments, project members, client projects
+	Summary bool
+}
+
+// page orders query by the options, or by defaultSort, and applies the limit and offset.
+func (o ListOptions) page(query *gorm.DB, defaultSort string) *gorm.DB {
+	sort := o.Sort
+	if sort == "" {
+		sort = defaultSort
+	}
+	direction := " ASC"
+	if o.Desc {
+		direction = " DESC"
+	}
+	query = query.Order(sort + direction + " NULLS LAST").Order("id" + direction)
+	if o.Limit > 0 {
+		query = query.Limit(o.Limit).Offset(o.Offset)
+	}
+	return query
+}
@@ -9,7 +9,8 @@ import (
 
 type NotificationRepository interface {
 	Create(notification *models.Notification) error
-	GetByUserID(userID uuid.UUID) ([]models.Notification, error)
+	// GetByUserID returns one page of the user's notifications and the total number of them.
+	GetByUserID(userID uuid.UUID, opts ListOptions) ([]models.Notification, int64, error)
 	GetUnreadByUserID(userID uuid.UUID) ([]models.Notification, error)
 	GetByID(id uuid.UUID) (*models.Notification, error)
 	MarkAsRead(id uuid.UUID) error
@@ -29,12 +30,15 @@ func (r *notificationRepository) Create(notification *models.Notification) error
 	return r.db.Create(notification).Error
 }
 
-func (r *notificationRepository) GetByUserID(userID uuid.UUID) ([]models.Notification, error) {
+func (r *notificationRepository) GetByUserID(userID uuid.UUID, opts ListOptions) ([]models.Notification, int64, error) {
+	var total int64
+	if err := r.db.Model(&models.Notification{}).Where("user_id = ?", userID).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
 	var notifications []models.Notification
-	err := r.db.Where("user_id = ?", userID).
-		Order("created_at DESC").
+	err := opts.page(r.db.Where("user_id = ?", userID), "created_at").
 		Find(&notifications).Error
-	return notifications, err
+	return notifications, total, err
 }
 
 func (r *notificationRepository) GetUnreadByUserID(userID uuid.UUID) ([]models.Notification, error) {
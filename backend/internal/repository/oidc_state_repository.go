@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"mellon-harmony-api/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type OIDCStateRepository interface {
+	Create(state *models.OIDCLoginState) error
+	Consume(stateHash string) (*models.OIDCLoginState, error)
+	DeleteExpired() error
+	CreateCode(code *models.OIDCLoginCode) error
+	ConsumeCode(codeHash string) (*models.OIDCLoginCode, error)
+}
+
+type oidcStateRepository struct {
+	db *gorm.DB
+}
+
+func NewOIDCStateRepository(db *gorm.DB) OIDCStateRepository {
+	return &oidcStateRepository{db: db}
+}
+
+func (r *oidcStateRepository) Create(state *models.OIDCLoginState) error {
+	return r.db.Create(state).Error
+}
+
+// Consume returns the unexpired state with the given hash and deletes it. The delete is the check,
+// so a callback replayed at the same time only succeeds once.
+func (r *oidcStateRepository) Consume(stateHash string) (*models.OIDCLoginState, error) {
+	var state models.OIDCLoginState
+	result := r.db.Clauses(clause.Returning{}).
+		Where("state_hash = ? AND expires_at > ?", stateHash, time.Now()).
+		Delete(&state)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &state, nil
+}
+
+// DeleteExpired removes expired states and login codes.
+func (r *oidcStateRepository) DeleteExpired() error {
+	if err := r.db.Where("expires_at <= ?", time.Now()).Delete(&models.OIDCLoginState{}).Error; err != nil {
+		return err
+	}
+	return r.db.Where("expires_at <= ?", time.Now()).Delete(&models.OIDCLoginCode{}).Error
+}
+
+func (r *oidcStateRepository) CreateCode(code *models.OIDCLoginCode) error {
+	return r.db.Create(code).Error
+}
+
+// ConsumeCode returns the unexpired login code with the given hash and deletes it. The delete is
+// the check, so a code exchanged twice at the same time only succeeds once.
+func (r *oidcStateRepository) ConsumeCode(codeHash string) (*models.OIDCLoginCode, error) {
+	var code models.OIDCLoginCode
+	result := r.db.Clauses(clause.Returning{}).
+		Where("code_hash = ? AND expires_at > ?", codeHash, time.Now()).
+		Delete(&code)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &code, nil
+}
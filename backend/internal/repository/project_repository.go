@@ -11,6 +11,9 @@ type ProjectRepository interface {
 	Create(project *models.Project) error
 	GetByID(id uuid.UUID) (*models.Project, error)
 	GetAll() ([]models.Project, error)
+	// List returns one page of projects and the total number of projects; with clientIDs set, only
+	// projects of those clients. Summary rows have no members.
+	List(clientIDs []uuid.UUID, opts ListOptions) ([]models.Project, int64, error)
 	GetByClientIDAndType(clientID uuid.UUID, projectType string) ([]models.Project, error)
 	GetByClientIDAndMonthYear(clientID uuid.UUID, month, year int) ([]models.Project, error)
 	Update(project *models.Project) error
@@ -18,6 +21,7 @@ type ProjectRepository interface {
 	AddMember(projectID, userID uuid.UUID, role string) error
 	RemoveMember(projectID, userID uuid.UUID) error
 	GetMembers(projectID uuid.UUID) ([]models.ProjectMember, error)
+	IsMember(projectID, userID uuid.UUID) (bool, error)
 }
 
 type projectRepository struct {
@@ -49,6 +53,26 @@ func (r *projectRepository) GetAll() ([]models.Project, error) {
 	return projects, err
 }
 
+func (r *projectRepository) List(clientIDs []uuid.UUID, opts ListOptions) ([]models.Project, int64, error) {
+	filtered := func() *gorm.DB {
+		if clientIDs == nil {
+			return r.db
+		}
+		return r.db.Where("client_id IN ?", clientIDs)
+	}
+	var total int64
+	if err := filtered().Model(&models.Project{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	query := filtered().Preload("Creator")
+	if !opts.Summary {
+		query = query.Preload("Members.User")
+	}
+	var projects []models.Project
+	err := opts.page(query, "created_at").Find(&projects).Error
+	return projects, total, err
+}
+
 func (r *projectRepository) GetByClientIDAndType(clientID uuid.UUID, projectType string) ([]models.Project, error) {
 	var projects []models.Project
 	err := r.db.Preload("Issues").Preload("Issues.Assignee").
@@ -111,3 +135,9 @@ func (r *projectRepository) GetMembers(projectID uuid.UUID) ([]models.ProjectMem
 	err := r.db.Preload("User").Where("project_id = ?", projectID).Find(&members).Error
 	return members, err
 }
+
+func (r *projectRepository) IsMember(projectID, userID uuid.UUID) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.ProjectMember{}).Where("project_id = ? AND user_id = ?", projectID, userID).Count(&count).Error
+	return count > 0, err
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"mellon-harmony-api/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type RoleRepository interface {
+	Create(role *models.Role) error
+	GetByName(name models.UserRole) (*models.Role, error)
+	GetAll() ([]models.Role, error)
+	Update(role *models.Role) error
+	Delete(name models.UserRole) error
+	// CountUsers returns how many users currently have the role.
+	CountUsers(name models.UserRole) (int64, error)
+}
+
+type roleRepository struct {
+	db *gorm.DB
+}
+
+func NewRoleRepository(db *gorm.DB) RoleRepository {
+	return &roleRepository{db: db}
+}
+
+func (r *roleRepository) Create(role *models.Role) error {
+	return r.db.Create(role).Error
+}
+
+func (r *roleRepository) GetByName(name models.UserRole) (*models.Role, error) {
+	var role models.Role
+	err := r.db.Where("name = ?", name).First(&role).Error
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (r *roleRepository) GetAll() ([]models.Role, error) {
+	var roles []models.Role
+	err := r.db.Order("built_in DESC, name ASC").Find(&roles).Error
+	return roles, err
+}
+
+func (r *roleRepository) Update(role *models.Role) error {
+	return r.db.Save(role).Error
+}
+
+func (r *roleRepository) Delete(name models.UserRole) error {
+	return r.db.Where("name = ?", name).Delete(&models.Role{}).Error
+}
+
+func (r *roleRepository) CountUsers(name models.UserRole) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.User{}).Where("role = ?", name).Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"fmt"
+	"mellon-harmony-api/internal/models"
+	"sort"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Search highlights are marked with private-use characters, which cannot clash with the searched
+// text, so the service can escape the text before turning them into <mark> tags.
+const (
+	SearchHighlightStart = "\uE000"
+	SearchHighlightStop  = "\uE001"
+)
+
+// SearchQuery is a full-text search. Text is in web search syntax ("quoted phrases", OR, -word).
+// Results are limited to what UserID can see unless AllIssues (issue.view_all) or AllProjects
+// (project.view_all) is set.
+type SearchQuery struct {
+	Text        string
+	Types       []string // models.SearchType*; empty searches every type
+	UserID      uuid.UUID
+	AllIssues   bool
+	AllProjects bool
+	Limit       int
+}
+
+type SearchRepository interface {
+	// Search returns the best matches of every type, ordered by rank.
+	Search(q SearchQuery) ([]models.SearchResult, error)
+}
+
+type searchRepository struct {
+	db *gorm.DB
+}
+
+func NewSearchRepository(db *gorm.DB) SearchRepository {
+	return &searchRepository{db: db}
+}
+
+// searchVisibleIssues are the issues aliased i that the user may access.
+var searchVisibleIssues = visibleIssues("i")
+
+func (r *searchRepository) Search(q SearchQuery) ([]models.SearchResult, error) {
+	types := q.Types
+	if len(types) == 0 {
+		types = []string{models.SearchTypeIssue, models.SearchTypeComment, models.SearchTypeProject, models.SearchTypeClient}
+	}
+	var results []models.SearchResult
+	for _, t := range types {
+		var rows []models.SearchResult
+		if err := r.searchType(t, q).Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+		results = append(results, rows...)
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank > results[j].Rank
+		}
+		return results[i].UpdatedAt.After(results[j].UpdatedAt)
+	})
+	if q.Limit > 0 && len(results) > q.Limit {
+		results = results[:q.Limit]
+	}
+	return results, nil
+}
+
+// searchType builds the query of one result type: rows whose search_vector matches, with the rank,
+// a highlighted title and a snippet of the longer text around the matches.
+func (r *searchRepository) searchType(t string, q SearchQuery) *gorm.DB {
+	args := map[string]interface{}{
+		"text":    q.Text,
+		"user":    q.UserID,
+		"title":   fmt.Sprintf("StartSel=%s, StopSel=%s, HighlightAll=true", SearchHighlightStart, SearchHighlightStop),
+		"snippet": fmt.Sprintf("StartSel=%s, StopSel=%s, MaxWords=30, MinWords=10, MaxFragments=2", SearchHighlightStart, SearchHighlightStop),
+	}
+	headline := func(column string) string {
+		return fmt.Sprintf("ts_headline('%s', coalesce(%s, ''), query, ", models.SearchTextConfig, column)
+	}
+	var (
+		table, alias, columns, where string
+	)
+	switch t {
+	case models.SearchTypeIssue:
+		table, alias = "issues", "i"
+		columns = headline("i.title") + "@title) AS title, " + headline("i.description") + "@snippet) AS snippet, " +
+			"NULL::uuid AS issue_id, i.project_id, i.client_id"
+		where = "i.deleted_at IS NULL"
+		if !q.AllIssues {
+			where += " AND " + searchVisibleIssues
+		}
+	case models.SearchTypeComment:
+		table, alias = "comments", "c"
+		columns = headline("i.title") + "@title) AS title, " + headline("c.text") + "@snippet) AS snippet, " +
+			"c.issue_id, i.project_id, i.client_id"
+		where = "c.deleted_at IS NULL AND c.moderated_at IS NULL AND i.deleted_at IS NULL"
+		if !q.AllIssues {
+			where += " AND " + searchVisibleIssues
+		}
+	case models.SearchTypeProject:
+		table, alias = "projects", "p"
+		columns = headline("p.name") + "@title) AS title, " + headline("p.description") + "@snippet) AS snippet, " +
+			"NULL::uuid AS issue_id, NULL::uuid AS project_id, p.client_id"
+		where = "p.deleted_at IS NULL"
+		if !q.AllProjects {
+			where += " AND p.client_id IN (" + memberClients + ")"
+		}
+	case models.SearchTypeClient:
+		table, alias = "clients", "cl"
+		columns = headline("cl.name") + "@title) AS title, " + headline("cl.contact_name") + "@snippet) AS snippet, " +
+			"NULL::uuid AS issue_id, NULL::uuid AS project_id, NULL::uuid AS client_id"
+		where = "cl.deleted_at IS NULL"
+		if !q.AllProjects {
+			where += " AND cl.id IN (" + memberClients + ")"
+		}
+	}
+	query := r.db.Table(fmt.Sprintf("%s AS %s", table, alias))
+	if t == models.SearchTypeComment {
+		query = query.Joins("JOIN issues AS i ON i.id = c.issue_id")
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+	return query.
+		Joins(fmt.Sprintf("CROSS JOIN websearch_to_tsquery('%s', @text) AS query", models.SearchTextConfig), args).
+		Select(fmt.Sprintf("'%[1]s' AS type, %[2]s.id, ts_rank(%[2]s.search_vector, query) AS rank, %[2]s.updated_at, ", t, alias)+columns, args).
+		Where(alias+".search_vector @@ query").
+		Where(where, args).
+		Order("rank DESC").Order(alias + ".updated_at DESC").
+		Limit(limit)
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"mellon-harmony-api/internal/models"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// searchStatement builds, without running it, the search of one result type.
+func searchStatement(t *testing.T, searchType string, q SearchQuery) *gorm.Statement {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=127.0.0.1 port=1"}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+		Logger:               logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []models.SearchResult
+	return (&searchRepository{db: db}).searchType(searchType, q).Scan(&rows).Statement
+}
+
+// searchSQL returns the SQL of the search of one result type, with its arguments inlined.
+func searchSQL(t *testing.T, searchType string, q SearchQuery) string {
+	stmt := searchStatement(t, searchType, q)
+	return stmt.Dialector.Explain(stmt.SQL.String(), stmt.Vars...)
+}
+
+func TestSearchVisibility(t *testing.T) {
+	user := uuid.New()
+	memberOf := "IN (SELECT client_id FROM client_members WHERE user_id = '" + user.String() + "')"
+	issueAccess := []string{
+		"i.created_by = '" + user.String() + "'",
+		"i.assigned_to = '" + user.String() + "'",
+		"i.client_id " + memberOf,
+		"i.project_id IN (SELECT project_id FROM project_members WHERE user_id = '" + user.String() + "')",
+		"i.project_id IN (SELECT id FROM projects WHERE client_id " + memberOf + ")",
+	}
+	tests := []struct {
+		name        string
+		searchType  string
+		allIssues   bool
+		allProjects bool
+		// wantLimited are the access conditions the query must have, or must not when empty
+		wantLimited []string
+		wantAlways  []string
+	}{
+		{"issues of the user", models.SearchTypeIssue, false, true, issueAccess, []string{"i.deleted_at IS NULL"}},
+		{"every issue", models.SearchTypeIssue, true, false, nil, []string{"i.deleted_at IS NULL"}},
+		{"comments on the user's issues", models.SearchTypeComment, false, true, issueAccess,
+			[]string{"JOIN issues AS i ON i.id = c.issue_id", "c.deleted_at IS NULL", "c.moderated_at IS NULL", "i.deleted_at IS NULL"}},
+		{"comments on every issue", models.SearchTypeComment, true, false, nil,
+			[]string{"c.deleted_at IS NULL", "c.moderated_at IS NULL", "i.deleted_at IS NULL"}},
+		{"projects of the user's clients", models.SearchTypeProject, true, false, []string{"p.client_id " + memberOf}, []string{"p.deleted_at IS NULL"}},
+		{"every project", models.SearchTypeProject, false, true, nil, []string{"p.deleted_at IS NULL"}},
+		{"the user's clients", models.SearchTypeClient, true, false, []string{"cl.id " + memberOf}, []string{"cl.deleted_at IS NULL"}},
+		{"every client", models.SearchTypeClient, false, true, nil, []string{"cl.deleted_at IS NULL"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql := searchSQL(t, tt.searchType, SearchQuery{Text: "logo", UserID: user, AllIssues: tt.allIssues, AllProjects: tt.allProjects})
+			for _, condition := range append(tt.wantLimited, tt.wantAlways...) {
+				if !strings.Contains(sql, condition) {
+					t.Errorf("missing %q in\n%s", condition, sql)
+				}
+			}
+			if len(tt.wantLimited) == 0 && strings.Contains(sql, user.String()) {
+				t.Errorf("query limited to the user:\n%s", sql)
+			}
+		})
+	}
+}
+
+func TestSearchQueryText(t *testing.T) {
+	text := `"logo nuevo" -borrador'; DROP TABLE issues; --`
+	stmt := searchStatement(t, models.SearchTypeIssue, SearchQuery{Text: text, AllIssues: true})
+	sql := stmt.SQL.String()
+	if strings.Contains(sql, "borrador") || !strings.Contains(sql, "websearch_to_tsquery('"+models.SearchTextConfig+"', $") {
+		t.Errorf("search text is not passed as an argument:\n%s", sql)
+	}
+	found := false
+	for _, v := range stmt.Vars {
+		found = found || v == text
+	}
+	if !found {
+		t.Errorf("arguments %v do not include the search text", stmt.Vars)
+	}
+	if !strings.HasSuffix(sql, "LIMIT 20") {
+		t.Errorf("default limit missing:\n%s", sql)
+	}
+	if sql := searchSQL(t, models.SearchTypeIssue, SearchQuery{Text: "logo", AllIssues: true, Limit: 5}); !strings.HasSuffix(sql, "LIMIT 5") {
+		t.Errorf("limit missing:\n%s", sql)
+	}
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"mellon-harmony-api/internal/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type SessionRepository interface {
+	Create(session *models.Session) error
+	GetByID(id uuid.UUID) (*models.Session, error)
+	GetByRefreshTokenHash(hash string) (*models.Session, error)
+	GetByPreviousTokenHash(hash string) (*models.Session, error)
+	GetActiveByUserID(userID uuid.UUID) ([]models.Session, error)
+	Update(session *models.Session) error
+	// Rotate saves a session whose refresh token was replaced, only if its previous token is still
+	// the current one and the session was not revoked meanwhile; it reports whether it did.
+	Rotate(session *models.Session) (bool, error)
+	Revoke(id uuid.UUID) error
+	RevokeAllForUser(userID uuid.UUID) error
+	RevokeAllForUserExcept(userID, keepID uuid.UUID) error
+}
+
+type sessionRepository struct {
+	db *gorm.DB
+}
+
+func NewSessionRepository(db *gorm.DB) SessionRepository {
+	return &sessionRepository{db: db}
+}
+
+func (r *sessionRepository) Create(session *models.Session) error {
+	return r.db.Create(session).Error
+}
+
+func (r *sessionRepository) GetByID(id uuid.UUID) (*models.Session, error) {
+	var session models.Session
+	err := r.db.Where("id = ?", id).First(&session).Error
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *sessionRepository) GetByRefreshTokenHash(hash string) (*models.Session, error) {
+	var session models.Session
+	err := r.db.Where("refresh_token_hash = ?", hash).First(&session).Error
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *sessionRepository) GetByPreviousTokenHash(hash string) (*models.Session, error) {
+	var session models.Session
+	err := r.db.Where("previous_token_hash = ?", hash).First(&session).Error
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *sessionRepository) GetActiveByUserID(userID uuid.UUID) ([]models.Session, error) {
+	var sessions []models.Session
+	err := r.db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at DESC").Find(&sessions).Error
+	return sessions, err
+}
+
+func (r *sessionRepository) Update(session *models.Session) error {
+	return r.db.Omit("User").Save(session).Error
+}
+
+func (r *sessionRepository) Rotate(session *models.Session) (bool, error) {
+	result := r.db.Model(&models.Session{}).
+		Where("id = ? AND refresh_token_hash = ? AND revoked_at IS NULL", session.ID, session.PreviousTokenHash).
+		Updates(map[string]interface{}{
+			"refresh_token_hash":  session.RefreshTokenHash,
+			"previous_token_hash": session.PreviousTokenHash,
+			"expires_at":          session.ExpiresAt,
+			"last_used_at":        session.LastUsedAt,
+			"ip_address":          session.IPAddress,
+			"user_agent":          session.UserAgent,
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r *sessionRepository) Revoke(id uuid.UUID) error {
+	return r.db.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (r *sessionRepository) RevokeAllForUser(userID uuid.UUID) error {
+	return r.db.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (r *sessionRepository) RevokeAllForUserExcept(userID, keepID uuid.UUID) error {
+	return r.db.Model(&models.Session{}).
+		Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, keepID).
+		Update("revoked_at", time.Now()).Error
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"mellon-harmony-api/internal/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type UploadSessionRepository interface {
+	Create(session *models.UploadSession) error
+	GetByID(id uuid.UUID) (*models.UploadSession, error)
+	Update(session *models.UploadSession) error
+	Delete(id uuid.UUID) error
+	// GetExpired returns sessions that expired before the given time, completed or not.
+	GetExpired(before time.Time) ([]models.UploadSession, error)
+	// Lock waits until no other request, on any instance of the API, holds the upload and returns
+	// the function that releases it.
+	Lock(id uuid.UUID) (func(), error)
+}
+
+type uploadSessionRepository struct {
+	db *gorm.DB
+}
+
+func NewUploadSessionRepository(db *gorm.DB) UploadSessionRepository {
+	return &uploadSessionRepository{db: db}
+}
+
+func (r *uploadSessionRepository) Create(session *models.UploadSession) error {
+	return r.db.Omit("File").Create(session).Error
+}
+
+func (r *uploadSessionRepository) GetByID(id uuid.UUID) (*models.UploadSession, error) {
+	var session models.UploadSession
+	if err := r.db.Preload("File").Where("id = ?", id).First(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *uploadSessionRepository) Update(session *models.UploadSession) error {
+	return r.db.Omit("File").Save(session).Error
+}
+
+func (r *uploadSessionRepository) Delete(id uuid.UUID) error {
+	return r.db.Delete(&models.UploadSession{}, id).Error
+}
+
+func (r *uploadSessionRepository) GetExpired(before time.Time) ([]models.UploadSession, error) {
+	var sessions []models.UploadSession
+	err := r.db.Where("expires_at < ?", before).Find(&sessions).Error
+	return sessions, err
+}
+
+// Lock takes a session-level advisory lock on a connection of its own, which is released with it.
+func (r *uploadSessionRepository) Lock(id uuid.UUID) (func(), error) {
+	sqlDB, err := r.db.DB()
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	key := "upload:" + id.String()
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock(hashtextextended($1, 0))", key); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return func() {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock(hashtextextended($1, 0))", key); err != nil {
+			// Drop the connection rather than return it to the pool still holding the lock
+			conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		}
+		conn.Close()
+	}, nil
+}
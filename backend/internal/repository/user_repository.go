@@ -13,9 +13,19 @@ type UserRepository interface {
 	GetByID(id uuid.UUID) (*models.User, error)
 	GetByEmail(email string) (*models.User, error)
 	GetByPasswordResetToken(token string) (*models.User, error)
+	GetByEmailVerificationToken(tokenHash string) (*models.User, error)
 	GetAll() ([]models.User, error)
 	Update(user *models.User) error
 	Delete(id uuid.UUID) error
+	IncrementFailedLogins(id uuid.UUID, resetBefore time.Time) (int, error)
+	SetLockedUntil(id uuid.UUID, until *time.Time) error
+	ResetFailedLogins(id uuid.UUID) error
+	// UseTOTPStep records step as the last accepted TOTP time step, unless it is not newer than the
+	// stored one; it reports whether it did, so a code is only accepted once.
+	UseTOTPStep(id uuid.UUID, step int64) (bool, error)
+	// ReplaceRecoveryCodes stores the remaining recovery codes, only if they still are previous; it
+	// reports whether it did, so a recovery code is only accepted once.
+	ReplaceRecoveryCodes(id uuid.UUID, previous, remaining string) (bool, error)
 }
 
 type userRepository struct {
@@ -57,6 +67,15 @@ func (r *userRepository) GetByPasswordResetToken(token string) (*models.User, er
 	return &user, nil
 }
 
+func (r *userRepository) GetByEmailVerificationToken(tokenHash string) (*models.User, error) {
+	var user models.User
+	err := r.db.Where("email_verification_token = ? AND email_verification_expires_at > ?", tokenHash, time.Now()).First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
 func (r *userRepository) GetAll() ([]models.User, error) {
 	var users []models.User
 	err := r.db.Find(&users).Error
@@ -70,3 +89,51 @@ func (r *userRepository) Update(user *models.User) error {
 func (r *userRepository) Delete(id uuid.UUID) error {
 	return r.db.Delete(&models.User{}, id).Error
 }
+
+// IncrementFailedLogins atomically counts a failed login and returns the new total.
+// Failures older than resetBefore are forgotten first, so the counter decays over time.
+func (r *userRepository) IncrementFailedLogins(id uuid.UUID, resetBefore time.Time) (int, error) {
+	var attempts int
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).
+			Where("id = ? AND last_failed_login_at < ?", id, resetBefore).
+			UpdateColumn("failed_login_attempts", 0).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.User{}).Where("id = ?", id).UpdateColumns(map[string]interface{}{
+			"failed_login_attempts": gorm.Expr("failed_login_attempts + 1"),
+			"last_failed_login_at":  time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Select("failed_login_attempts").Where("id = ?", id).Row().Scan(&attempts)
+	})
+	return attempts, err
+}
+
+func (r *userRepository) SetLockedUntil(id uuid.UUID, until *time.Time) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).UpdateColumn("locked_until", until).Error
+}
+
+// ResetFailedLogins clears the counter and any lock (successful login or admin unlock).
+func (r *userRepository) ResetFailedLogins(id uuid.UUID) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).UpdateColumns(map[string]interface{}{
+		"failed_login_attempts": 0,
+		"last_failed_login_at":  nil,
+		"locked_until":          nil,
+	}).Error
+}
+
+func (r *userRepository) UseTOTPStep(id uuid.UUID, step int64) (bool, error) {
+	result := r.db.Model(&models.User{}).
+		Where("id = ? AND totp_last_used_step < ?", id, step).
+		UpdateColumn("totp_last_used_step", step)
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r *userRepository) ReplaceRecoveryCodes(id uuid.UUID, previous, remaining string) (bool, error) {
+	result := r.db.Model(&models.User{}).
+		Where("id = ? AND totp_recovery_codes = ?", id, previous).
+		UpdateColumn("totp_recovery_codes", remaining)
+	return result.RowsAffected == 1, result.Error
+}
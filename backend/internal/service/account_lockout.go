@@ -0,0 +1,140 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"mellon-harmony-api/internal/models"
+	"time"
+)
+
+const (
+	defaultLockoutThreshold    = 5
+	defaultLockoutBaseDuration = time.Minute
+	defaultLockoutMaxDuration  = 24 * time.Hour
+)
+
+// ErrAccountLocked matches (errors.Is) every AccountLockedError.
+var ErrAccountLocked = errors.New("account locked")
+
+// AccountLockedError is returned by Login while an account is locked after repeated failures.
+type AccountLockedError struct {
+	Until time.Time
+}
+
+func (e *AccountLockedError) Error() string {
+	return fmt.Sprintf("cuenta bloqueada temporalmente por demasiados intentos fallidos; intenta de nuevo en %s", formatLockDuration(e.RetryAfter()))
+}
+
+func (e *AccountLockedError) Is(target error) bool {
+	return target == ErrAccountLocked
+}
+
+// RetryAfter is the time left until the lock expires.
+func (e *AccountLockedError) RetryAfter() time.Duration {
+	if d := time.Until(e.Until); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// LockoutPolicy configures per-account lockout. After Threshold consecutive failures the account
+// is locked for BaseDuration, doubling with every further failure up to MaxDuration.
+// Failures older than MaxDuration are forgotten.
+type LockoutPolicy struct {
+	Threshold    int
+	BaseDuration time.Duration
+	MaxDuration  time.Duration
+}
+
+func (p LockoutPolicy) withDefaults() LockoutPolicy {
+	if p.Threshold <= 0 {
+		p.Threshold = defaultLockoutThreshold
+	}
+	if p.BaseDuration <= 0 {
+		p.BaseDuration = defaultLockoutBaseDuration
+	}
+	if p.MaxDuration < p.BaseDuration {
+		p.MaxDuration = defaultLockoutMaxDuration
+	}
+	return p
+}
+
+// lockDuration returns how long to lock after the given number of consecutive failures (0 = no lock).
+func (p LockoutPolicy) lockDuration(attempts int) time.Duration {
+	if attempts < p.Threshold {
+		return 0
+	}
+	d := p.BaseDuration
+	for i := p.Threshold; i < attempts && d < p.MaxDuration; i++ {
+		d *= 2
+	}
+	if d > p.MaxDuration {
+		d = p.MaxDuration
+	}
+	return d
+}
+
+// checkLocked returns an AccountLockedError if the user may not attempt to sign in right now.
+func (s *authService) checkLocked(user *models.User) error {
+	if user.IsLocked() {
+		return &AccountLockedError{Until: *user.LockedUntil}
+	}
+	return nil
+}
+
+// recordFailedLogin counts a wrong password or second-factor code. When the count reaches the
+// policy threshold the account is locked and the owner is notified; the returned error is then
+// an AccountLockedError, otherwise nil.
+func (s *authService) recordFailedLogin(user *models.User, meta models.SessionMeta) error {
+	attempts, err := s.userRepo.IncrementFailedLogins(user.ID, time.Now().Add(-s.lockout.MaxDuration))
+	if err != nil {
+		log.Printf("Failed to record failed login for %s: %v", user.Email, err)
+		return nil
+	}
+	s.recordLoginEvent(user, models.AuditLoginFailed, meta, map[string]interface{}{"failed_login_attempts": attempts})
+
+	lockFor := s.lockout.lockDuration(attempts)
+	if lockFor == 0 {
+		return nil
+	}
+	until := time.Now().Add(lockFor)
+	if err := s.userRepo.SetLockedUntil(user.ID, &until); err != nil {
+		log.Printf("Failed to lock account %s: %v", user.Email, err)
+		return nil
+	}
+	user.LockedUntil = &until
+	s.recordLoginEvent(user, models.AuditAccountLocked, meta, map[string]interface{}{"failed_login_attempts": attempts, "locked_until": until})
+
+	s.sendLockoutNotification(user, lockFor, meta)
+	return &AccountLockedError{Until: until}
+}
+
+// recordLoginEvent audits a sign-in attempt against user. Nobody is signed in yet, so the event has no actor.
+func (s *authService) recordLoginEvent(user *models.User, action string, meta models.SessionMeta, details map[string]interface{}) {
+	if s.audit == nil {
+		log.Printf("[AUDIT] %s user=%s details=%v ip=%s", action, user.ID, details, meta.IPAddress)
+		return
+	}
+	s.audit.Record(models.AuditMeta{IPAddress: meta.IPAddress, RequestID: meta.RequestID}, action, "user", user.ID.String(), nil, details)
+}
+
+// clearFailedLogins resets the counter after a successful sign-in.
+func (s *authService) clearFailedLogins(user *models.User) {
+	if user.FailedLoginAttempts == 0 && user.LockedUntil == nil {
+		return
+	}
+	if err := s.userRepo.ResetFailedLogins(user.ID); err != nil {
+		log.Printf("Failed to reset failed logins for %s: %v", user.Email, err)
+	}
+}
+
+func (s *authService) sendLockoutNotification(user *models.User, lockFor time.Duration, meta models.SessionMeta) {
+	if !user.IsEmailVerified() || s.emailService == nil || !s.emailService.IsConfigured() {
+		return
+	}
+	resetLink := s.frontendURL + "/recuperar-contrasena"
+	if err := s.emailService.SendAccountLockedEmail(user.Email, user.Name, lockFor, meta.IPAddress, resetLink); err != nil {
+		log.Printf("Failed to send lockout notification to %s: %v", user.Email, err)
+	}
+}
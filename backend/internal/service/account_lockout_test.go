@@ -0,0 +1,132 @@
+package service
+
+import (
+	"errors"
+	"mellon-harmony-api/internal/models"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestLockoutPolicyLockDuration(t *testing.T) {
+	p := LockoutPolicy{Threshold: 3, BaseDuration: time.Minute, MaxDuration: 10 * time.Minute}
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, time.Minute},
+		{4, 2 * time.Minute},
+		{6, 8 * time.Minute},
+		{7, 10 * time.Minute},
+		{50, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := p.lockDuration(tt.attempts); got != tt.want {
+			t.Errorf("lockDuration(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestLockoutPolicyWithDefaults(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy LockoutPolicy
+		want   LockoutPolicy
+	}{
+		{"zero value", LockoutPolicy{}, LockoutPolicy{defaultLockoutThreshold, defaultLockoutBaseDuration, defaultLockoutMaxDuration}},
+		{"configured", LockoutPolicy{3, time.Minute, time.Hour}, LockoutPolicy{3, time.Minute, time.Hour}},
+		{"max below base", LockoutPolicy{3, time.Hour, time.Minute}, LockoutPolicy{3, time.Hour, defaultLockoutMaxDuration}},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.withDefaults(); got != tt.want {
+			t.Errorf("%s: withDefaults() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func newLockoutTestService(t *testing.T) (*authService, *memoryUserRepository, *models.User, *recordingEmailService) {
+	t.Helper()
+	hashed, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifiedAt := time.Now()
+	user := &models.User{Email: "ana@example.com", Password: string(hashed), Role: models.RoleUser, EmailVerifiedAt: &verifiedAt}
+	users := newMemoryUserRepository(user)
+	emails := &recordingEmailService{}
+	s := NewAuthService(users, newMemoryLoginSessionRepository(), nil, emails, nil, AuthConfig{
+		JWTSecret:   "secret",
+		FrontendURL: "https://app.example.com",
+		Lockout:     LockoutPolicy{Threshold: 3, BaseDuration: time.Minute, MaxDuration: time.Hour},
+	}).(*authService)
+	return s, users, user, emails
+}
+
+func TestAuthServiceLoginLockout(t *testing.T) {
+	s, users, user, emails := newLockoutTestService(t)
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		_, _, err := s.Login(user.Email, "wrong", models.SessionMeta{IPAddress: "10.0.0.1"})
+		if attempt < 3 && (err == nil || errors.Is(err, ErrAccountLocked)) {
+			t.Fatalf("attempt %d: %v, want invalid credentials", attempt, err)
+		}
+		if attempt == 3 {
+			var locked *AccountLockedError
+			if !errors.As(err, &locked) || locked.RetryAfter() <= 0 || locked.RetryAfter() > time.Minute {
+				t.Fatalf("attempt %d: %v, want a lock of up to a minute", attempt, err)
+			}
+		}
+	}
+	if len(emails.sent) != 1 || emails.sent[0].kind != "locked" || emails.sent[0].link != "https://app.example.com/recuperar-contrasena" {
+		t.Errorf("sent %+v, want one lockout notification", emails.sent)
+	}
+
+	// While locked even the right password is refused, without counting another failure
+	if _, _, err := s.Login(user.Email, "correct horse", models.SessionMeta{}); !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("right password while locked: %v, want %v", err, ErrAccountLocked)
+	}
+	if got := users.users[user.ID].FailedLoginAttempts; got != 3 {
+		t.Errorf("failed attempts = %d, want 3", got)
+	}
+
+	// Once the lock expires the right password signs in and clears the counter
+	expired := time.Now().Add(-time.Second)
+	users.users[user.ID].LockedUntil = &expired
+	result, _, err := s.Login(user.Email, "correct horse", models.SessionMeta{})
+	if err != nil || result.Tokens == nil {
+		t.Fatalf("Login after the lock = %+v, %v", result, err)
+	}
+	if stored := users.users[user.ID]; stored.FailedLoginAttempts != 0 || stored.LockedUntil != nil {
+		t.Errorf("counter not reset: %d attempts, locked until %v", stored.FailedLoginAttempts, stored.LockedUntil)
+	}
+}
+
+func TestAuthServiceLoginLockoutDoubles(t *testing.T) {
+	s, users, user, _ := newLockoutTestService(t)
+	users.users[user.ID].FailedLoginAttempts = 4
+	now := time.Now()
+	users.users[user.ID].LastFailedLoginAt = &now
+
+	_, _, err := s.Login(user.Email, "wrong", models.SessionMeta{})
+	var locked *AccountLockedError
+	if !errors.As(err, &locked) || locked.RetryAfter() <= 3*time.Minute || locked.RetryAfter() > 4*time.Minute {
+		t.Fatalf("fifth failure: %v, want a four minute lock", err)
+	}
+}
+
+func TestAuthServiceLoginForgetsOldFailures(t *testing.T) {
+	s, users, user, _ := newLockoutTestService(t)
+	users.users[user.ID].FailedLoginAttempts = 2
+	old := time.Now().Add(-2 * time.Hour)
+	users.users[user.ID].LastFailedLoginAt = &old
+
+	if _, _, err := s.Login(user.Email, "wrong", models.SessionMeta{}); err == nil || errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("failure after the window: %v, want invalid credentials", err)
+	}
+	if got := users.users[user.ID].FailedLoginAttempts; got != 1 {
+		t.Errorf("failed attempts = %d, want the count to restart at 1", got)
+	}
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"mellon-harmony-api/internal/models"
+	"mellon-harmony-api/internal/repository"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultAPITokenLifetime = 90 * 24 * time.Hour
+	maxAPITokenLifetime     = 366 * 24 * time.Hour
+	maxAPITokensPerUser     = 20
+	// lastUsedResolution limits how often using a token writes its last-used timestamp.
+	lastUsedResolution = time.Minute
+)
+
+// ErrInvalidAPIToken is returned for unknown, revoked or expired personal access tokens.
+var ErrInvalidAPIToken = errors.New("invalid or expired API token")
+
+// ErrAPITokenNotFound is returned when revoking a token that does not exist or belongs to another user.
+var ErrAPITokenNotFound = errors.New("token no encontrado")
+
+// ErrInvalidAPITokenScope is returned when creating a token without scopes or with an unknown scope.
+var ErrInvalidAPITokenScope = errors.New("alcance no válido; usa issues:read, issues:write o reports:read")
+
+// ErrInvalidAPITokenExpiry is returned when the requested lifetime is out of range.
+var ErrInvalidAPITokenExpiry = errors.New("la vigencia del token debe ser de 1 a 366 días")
+
+// ErrTooManyAPITokens is returned when a user already has the maximum number of active tokens.
+var ErrTooManyAPITokens = errors.New("alcanzaste el máximo de tokens activos; revoca alguno antes de crear otro")
+
+// APITokenService manages personal access tokens ("mh_pat_...") used by scripts instead of a password login.
+type APITokenService interface {
+	// CreateToken returns the stored token and the plain secret, which is never retrievable again.
+	CreateToken(userID uuid.UUID, name string, scopes []string, expiresInDays int, meta models.AuditMeta) (*models.APIToken, string, error)
+	ListTokens(userID uuid.UUID) ([]models.APIToken, error)
+	RevokeToken(userID, tokenID uuid.UUID, meta models.AuditMeta) error
+	AuthenticateAPIToken(token, ipAddress string) (*models.APIToken, *models.User, error)
+}
+
+type apiTokenService struct {
+	tokenRepo    repository.APITokenRepository
+	userRepo     repository.UserRepository
+	auditService AuditService
+}
+
+func NewAPITokenService(tokenRepo repository.APITokenRepository, userRepo repository.UserRepository, auditService AuditService) APITokenService {
+	return &apiTokenService{
+		tokenRepo:    tokenRepo,
+		userRepo:     userRepo,
+		auditService: auditService,
+	}
+}
+
+func (s *apiTokenService) CreateToken(userID uuid.UUID, name string, scopes []string, expiresInDays int, meta models.AuditMeta) (*models.APIToken, string, error) {
+	scopeList, err := normalizeScopes(scopes)
+	if err != nil {
+		return nil, "", err
+	}
+	lifetime := defaultAPITokenLifetime
+	if expiresInDays != 0 {
+		lifetime = time.Duration(expiresInDays) * 24 * time.Hour
+		if expiresInDays < 0 || lifetime > maxAPITokenLifetime {
+			return nil, "", ErrInvalidAPITokenExpiry
+		}
+	}
+
+	existing, err := s.tokenRepo.GetByUserID(userID)
+	if err != nil {
+		return nil, "", err
+	}
+	active := 0
+	for _, t := range existing {
+		if t.IsActive() {
+			active++
+		}
+	}
+	if active >= maxAPITokensPerUser {
+		return nil, "", ErrTooManyAPITokens
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", errors.New("no se pudo generar el token")
+	}
+	plain := models.APITokenPrefix + hex.EncodeToString(secret)
+
+	token := &models.APIToken{
+		UserID:    userID,
+		Name:      strings.TrimSpace(name),
+		TokenHash: hashToken(plain),
+		Hint:      plain[:len(models.APITokenPrefix)+6],
+		Scopes:    strings.Join(scopeList, ","),
+		ExpiresAt: time.Now().Add(lifetime),
+		ScopeList: scopeList,
+	}
+	if err := s.tokenRepo.Create(token); err != nil {
+		return nil, "", err
+	}
+	s.auditService.Record(meta, models.AuditTokenCreated, "api_token", token.ID.String(), nil, auditSnapshot(token))
+	return token, plain, nil
+}
+
+func (s *apiTokenService) ListTokens(userID uuid.UUID) ([]models.APIToken, error) {
+	return s.tokenRepo.GetByUserID(userID)
+}
+
+func (s *apiTokenService) RevokeToken(userID, tokenID uuid.UUID, meta models.AuditMeta) error {
+	revoked, err := s.tokenRepo.Revoke(userID, tokenID)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return ErrAPITokenNotFound
+	}
+	s.auditService.Record(meta, models.AuditTokenRevoked, "api_token", tokenID.String(), nil, map[string]interface{}{"user_id": userID})
+	return nil
+}
+
+// AuthenticateAPIToken resolves a bearer token to its owner. The owner's current role applies,
+// so demoting or deleting a user immediately limits or disables their tokens.
+func (s *apiTokenService) AuthenticateAPIToken(plain, ipAddress string) (*models.APIToken, *models.User, error) {
+	if !strings.HasPrefix(plain, models.APITokenPrefix) {
+		return nil, nil, ErrInvalidAPIToken
+	}
+	token, err := s.tokenRepo.GetByHash(hashToken(plain))
+	if err != nil || !token.IsActive() {
+		return nil, nil, ErrInvalidAPIToken
+	}
+	user, err := s.userRepo.GetByID(token.UserID)
+	if err != nil {
+		return nil, nil, ErrInvalidAPIToken
+	}
+
+	if token.LastUsedAt == nil || time.Since(*token.LastUsedAt) > lastUsedResolution {
+		if err := s.tokenRepo.TouchLastUsed(token.ID, truncate(ipAddress, 64)); err != nil {
+			log.Printf("Failed to update last use of API token %s: %v", token.ID, err)
+		}
+	}
+	return token, user, nil
+}
+
+// normalizeScopes validates and de-duplicates scopes, keeping the canonical order.
+func normalizeScopes(scopes []string) ([]string, error) {
+	requested := map[string]bool{}
+	for _, scope := range scopes {
+		requested[strings.TrimSpace(scope)] = true
+	}
+	var result []string
+	for _, scope := range models.APITokenScopes {
+		if requested[scope] {
+			result = append(result, scope)
+			delete(requested, scope)
+		}
+	}
+	if len(result) == 0 || len(requested) > 0 {
+		return nil, ErrInvalidAPITokenScope
+	}
+	return result, nil
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"errors"
+	"mellon-harmony-api/internal/models"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNormalizeScopes(t *testing.T) {
+	tests := []struct {
+		name    string
+		scopes  []string
+		want    []string
+		wantErr bool
+	}{
+		{"one", []string{"issues:read"}, []string{models.ScopeIssuesRead}, false},
+		{"canonical order without repeats", []string{" reports:read", "issues:write", "issues:read", "issues:write"}, []string{models.ScopeIssuesRead, models.ScopeIssuesWrite, models.ScopeReportsRead}, false},
+		{"none", nil, nil, true},
+		{"unknown", []string{"issues:read", "users:write"}, nil, true},
+		{"wrong case", []string{"Issues:Read"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeScopes(tt.scopes)
+			if (err != nil) != tt.wantErr || (err != nil && !errors.Is(err, ErrInvalidAPITokenScope)) {
+				t.Fatalf("normalizeScopes(%v) error = %v, want error %v", tt.scopes, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizeScopes(%v) = %v, want %v", tt.scopes, got, tt.want)
+			}
+		})
+	}
+}
+
+func newTestAPITokenService(users ...*models.User) (APITokenService, *memoryAPITokenRepository, *recordingAuditService) {
+	tokens := newMemoryAPITokenRepository()
+	audit := &recordingAuditService{}
+	return NewAPITokenService(tokens, newMemoryUserRepository(users...), audit), tokens, audit
+}
+
+func TestAPITokenServiceCreateToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		scopes  []string
+		days    int
+		wantErr error
+		wantTTL time.Duration
+	}{
+		{"default lifetime", []string{"issues:read"}, 0, nil, defaultAPITokenLifetime},
+		{"one day", []string{"issues:read"}, 1, nil, 24 * time.Hour},
+		{"longest lifetime", []string{"issues:read"}, 366, nil, maxAPITokenLifetime},
+		{"too long", []string{"issues:read"}, 367, ErrInvalidAPITokenExpiry, 0},
+		{"negative", []string{"issues:read"}, -1, ErrInvalidAPITokenExpiry, 0},
+		{"no scope", nil, 0, ErrInvalidAPITokenScope, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &models.User{Email: "ana@example.com"}
+			s, tokens, audit := newTestAPITokenService(user)
+			token, plain, err := s.CreateToken(user.ID, " deploy ", tt.scopes, tt.days, models.AuditMeta{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CreateToken error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if len(tokens.tokens) != 0 || len(audit.events) != 0 {
+					t.Error("a rejected token was stored or audited")
+				}
+				return
+			}
+			if !strings.HasPrefix(plain, models.APITokenPrefix) || !strings.HasPrefix(plain, token.Hint) || token.Name != "deploy" {
+				t.Errorf("CreateToken = %+v, %q", token, plain)
+			}
+			if stored := tokens.tokens[token.ID]; stored.TokenHash != hashToken(plain) || strings.Contains(stored.TokenHash, plain) {
+				t.Error("only the hash of the token must be stored")
+			}
+			if ttl := time.Until(token.ExpiresAt); ttl > tt.wantTTL || ttl < tt.wantTTL-time.Minute {
+				t.Errorf("token expires in %s, want %s", ttl, tt.wantTTL)
+			}
+			if len(audit.events) != 1 || audit.events[0].action != models.AuditTokenCreated {
+				t.Errorf("audited %+v, want one %s event", audit.events, models.AuditTokenCreated)
+			}
+		})
+	}
+}
+
+func TestAPITokenServiceCreateTokenLimit(t *testing.T) {
+	user := &models.User{Email: "ana@example.com"}
+	s, tokens, _ := newTestAPITokenService(user)
+	for i := 0; i < maxAPITokensPerUser; i++ {
+		if _, _, err := s.CreateToken(user.ID, "script", []string{"issues:read"}, 0, models.AuditMeta{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, err := s.CreateToken(user.ID, "one more", []string{"issues:read"}, 0, models.AuditMeta{}); !errors.Is(err, ErrTooManyAPITokens) {
+		t.Fatalf("token over the limit: %v, want %v", err, ErrTooManyAPITokens)
+	}
+	// Expired tokens do not count
+	for _, token := range tokens.tokens {
+		token.ExpiresAt = time.Now().Add(-time.Minute)
+		break
+	}
+	if _, _, err := s.CreateToken(user.ID, "one more", []string{"issues:read"}, 0, models.AuditMeta{}); err != nil {
+		t.Errorf("token after one expired: %v", err)
+	}
+}
+
+func TestAPITokenServiceAuthenticateAPIToken(t *testing.T) {
+	user := &models.User{Email: "ana@example.com"}
+	s, tokens, _ := newTestAPITokenService(user)
+	create := func() (*models.APIToken, string) {
+		token, plain, err := s.CreateToken(user.ID, "script", []string{"issues:read"}, 0, models.AuditMeta{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token, plain
+	}
+
+	active, activePlain := create()
+	got, owner, err := s.AuthenticateAPIToken(activePlain, "10.0.0.1")
+	if err != nil || got.ID != active.ID || owner.ID != user.ID {
+		t.Fatalf("AuthenticateAPIToken = %v, %v, %v", got, owner, err)
+	}
+	if stored := tokens.tokens[active.ID]; stored.LastUsedAt == nil || stored.LastUsedIP != "10.0.0.1" {
+		t.Errorf("last use not recorded: %+v", stored)
+	}
+
+	revoked, revokedPlain := create()
+	if err := s.RevokeToken(user.ID, revoked.ID, models.AuditMeta{}); err != nil {
+		t.Fatal(err)
+	}
+	expired, expiredPlain := create()
+	tokens.tokens[expired.ID].ExpiresAt = time.Now().Add(-time.Minute)
+
+	for name, plain := range map[string]string{
+		"revoked":      revokedPlain,
+		"expired":      expiredPlain,
+		"unknown":      models.APITokenPrefix + "0123",
+		"not a token":  "eyJhbGciOi",
+		"empty string": "",
+	} {
+		if _, _, err := s.AuthenticateAPIToken(plain, ""); !errors.Is(err, ErrInvalidAPIToken) {
+			t.Errorf("%s token: %v, want %v", name, err, ErrInvalidAPIToken)
+		}
+	}
+}
+
+func TestAPITokenServiceRevokeToken(t *testing.T) {
+	user := &models.User{Email: "ana@example.com"}
+	other := &models.User{Email: "luis@example.com"}
+	s, _, audit := newTestAPITokenService(user, other)
+	token, _, _ := s.CreateToken(user.ID, "script", []string{"issues:read"}, 0, models.AuditMeta{})
+
+	if err := s.RevokeToken(other.ID, token.ID, models.AuditMeta{}); !errors.Is(err, ErrAPITokenNotFound) {
+		t.Fatalf("revoking another user's token: %v, want %v", err, ErrAPITokenNotFound)
+	}
+	if err := s.RevokeToken(user.ID, token.ID, models.AuditMeta{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RevokeToken(user.ID, token.ID, models.AuditMeta{}); !errors.Is(err, ErrAPITokenNotFound) {
+		t.Errorf("revoking twice: %v, want %v", err, ErrAPITokenNotFound)
+	}
+	if listed, _ := s.ListTokens(user.ID); len(listed) != 0 {
+		t.Errorf("revoked token still listed: %+v", listed)
+	}
+	if last := audit.events[len(audit.events)-1]; last.action != models.AuditTokenRevoked || last.entityID != token.ID.String() {
+		t.Errorf("last audit event = %+v, want %s of %s", last, models.AuditTokenRevoked, token.ID)
+	}
+}
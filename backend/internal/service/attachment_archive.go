@@ -0,0 +1,162 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"mellon-harmony-api/internal/models"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// maxArchiveNameLength limits folder and file names in attachment archives, in characters.
+const maxArchiveNameLength = 100
+
+// ArchiveEntry is a file of an attachment archive: its path in the archive and its storage key.
+type ArchiveEntry struct {
+	Name string
+	Key  string
+}
+
+// AttachmentArchiveEntries lists the uploaded attachments of the issues and of their comments,
+// in a folder per task named by its title and, when byProject is set, under a folder per project.
+// Links and files attached more than once to the same task are listed once.
+func AttachmentArchiveEntries(issues []models.Issue, byProject bool) []ArchiveEntry {
+	var entries []ArchiveEntry
+	used := map[string]bool{}
+	for i := range issues {
+		issue := &issues[i]
+		dir := ""
+		if byProject {
+			dir = "No project"
+			if issue.Project != nil {
+				dir = archiveName(issue.Project.Name, dir)
+			}
+		}
+		folder := uniqueArchiveName(used, dir, archiveName(issue.Title, "Untitled task"), true)
+
+		attachments := issue.GetAttachments()
+		for _, comment := range issue.Comments {
+			attachments = append(attachments, comment.GetAttachments()...)
+		}
+		seen := map[string]bool{}
+		for _, att := range attachments {
+			u, err := url.Parse(att.URL)
+			if err != nil {
+				continue
+			}
+			key, ok := storedFilePath(u.Path)
+			if !ok || seen[key] {
+				continue
+			}
+			seen[key] = true
+			name := att.Name
+			if name == "" {
+				name = path.Base(key)
+			}
+			entries = append(entries, ArchiveEntry{
+				Name: uniqueArchiveName(used, folder, archiveName(name, path.Base(key)), false),
+				Key:  key,
+			})
+		}
+	}
+	return entries
+}
+
+// archiveName makes a title or file name safe as a single path segment on every OS.
+func archiveName(name, fallback string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if runes := []rune(name); len(runes) > maxArchiveNameLength {
+		ext := path.Ext(name)
+		if len([]rune(ext)) > 10 {
+			ext = ""
+		}
+		name = string(runes[:maxArchiveNameLength-len([]rune(ext))]) + ext
+	}
+	name = strings.Trim(name, " .")
+	if name == "" {
+		return fallback
+	}
+	return name
+}
+
+// uniqueArchiveName joins dir and name, adding " (2)", " (3)"... (before the extension of files)
+// when the path is already used, e.g. by another task with the same title.
+func uniqueArchiveName(used map[string]bool, dir, name string, folder bool) string {
+	candidate := path.Join(dir, name)
+	ext := ""
+	if !folder {
+		ext = path.Ext(name)
+	}
+	for n := 2; used[strings.ToLower(candidate)]; n++ {
+		candidate = path.Join(dir, fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), n, ext))
+	}
+	used[strings.ToLower(candidate)] = true
+	return candidate
+}
+
+// WriteArchive streams a ZIP of the entries to w. Files that cannot be served (missing, not yet
+// scanned or infected) are left out and listed in omitted.txt. Media that is already compressed is
+// stored as is.
+func (s *FileService) WriteArchive(ctx context.Context, w io.Writer, entries []ArchiveEntry) error {
+	zw := zip.NewWriter(w)
+	var omitted []string
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		file, err := s.OpenFile(ctx, entry.Key)
+		if err != nil {
+			omitted = append(omitted, fmt.Sprintf("%s: %v", entry.Name, err))
+			continue
+		}
+		header := &zip.FileHeader{Name: entry.Name, Method: zip.Deflate, Modified: file.ModTime}
+		if isCompressedContentType(file.ContentType) {
+			header.Method = zip.Store
+		}
+		dst, err := zw.CreateHeader(header)
+		if err == nil {
+			_, err = io.Copy(dst, file)
+		}
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", entry.Name, err)
+		}
+	}
+	if len(omitted) > 0 {
+		dst, err := zw.CreateHeader(&zip.FileHeader{Name: "omitted.txt", Method: zip.Deflate, Modified: time.Now()})
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(dst, "These attachments could not be included:\n\n"+strings.Join(omitted, "\n")+"\n"); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// isCompressedContentType reports whether deflating files of this type would gain nothing.
+func isCompressedContentType(contentType string) bool {
+	switch {
+	case strings.HasPrefix(contentType, "image/") && contentType != "image/vnd.adobe.photoshop",
+		strings.HasPrefix(contentType, "video/"), strings.HasPrefix(contentType, "audio/"):
+		return true
+	}
+	switch contentType {
+	case "application/zip", "application/pdf", "application/gzip",
+		"application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+		"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		"application/vnd.openxmlformats-officedocument.presentationml.presentation":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,177 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"mellon-harmony-api/internal/models"
+	"mellon-harmony-api/internal/repository"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func issueWithAttachments(title string, project *models.Project, urls ...string) models.Issue {
+	issue := models.Issue{Title: title, Project: project}
+	var attachments []models.Attachment
+	for _, u := range urls {
+		name, u, _ := strings.Cut(u, "=")
+		attachments = append(attachments, models.Attachment{Type: "file", URL: u, Name: name})
+	}
+	issue.SetAttachments(attachments)
+	return issue
+}
+
+func TestAttachmentArchiveEntries(t *testing.T) {
+	design := &models.Project{Name: "Diseño: web/app"}
+	withComment := issueWithAttachments("Logo", design, "brief.pdf=uploads/c1/p1/files/a.pdf")
+	comment := models.Comment{}
+	comment.SetAttachments([]models.Attachment{
+		{URL: "http://api.test/api/v1/files/uploads/c1/p1/files/a.pdf?expires=1&signature=x", Name: "again.pdf"},
+		{URL: "uploads/c1/p1/images/b.png", Name: "brief.pdf"},
+	})
+	withComment.Comments = []models.Comment{comment}
+	issues := []models.Issue{
+		withComment,
+		issueWithAttachments("Logo", design, "=uploads/c1/p1/files/c.pdf"),
+		issueWithAttachments("  ..  ", nil, "site=https://example.com/site", "notes.txt=uploads/general/general/files/d.txt"),
+	}
+
+	tests := []struct {
+		name      string
+		byProject bool
+		want      []ArchiveEntry
+	}{
+		{"by task", false, []ArchiveEntry{
+			{"Logo/brief.pdf", "c1/p1/files/a.pdf"},
+			{"Logo/brief (2).pdf", "c1/p1/images/b.png"},
+			{"Logo (2)/c.pdf", "c1/p1/files/c.pdf"},
+			{"Untitled task/notes.txt", "general/general/files/d.txt"},
+		}},
+		{"by project", true, []ArchiveEntry{
+			{"Diseño_ web_app/Logo/brief.pdf", "c1/p1/files/a.pdf"},
+			{"Diseño_ web_app/Logo/brief (2).pdf", "c1/p1/images/b.png"},
+			{"Diseño_ web_app/Logo (2)/c.pdf", "c1/p1/files/c.pdf"},
+			{"No project/Untitled task/notes.txt", "general/general/files/d.txt"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AttachmentArchiveEntries(issues, tt.byProject); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("AttachmentArchiveEntries =\n%v\nwant\n%v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestArchiveName(t *testing.T) {
+	long := strings.Repeat("a", 150)
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Informe final.pdf", "Informe final.pdf"},
+		{`a/b\c:d*e?f"g<h>i|j`, "a_b_c_d_e_f_g_h_i_j"},
+		{"tab\there", "tab_here"},
+		{"  .hidden. ", "hidden"},
+		{"...", "fallback"},
+		{"", "fallback"},
+		{long + ".pdf", strings.Repeat("a", maxArchiveNameLength-4) + ".pdf"},
+		{strings.Repeat("ñ", 150), strings.Repeat("ñ", maxArchiveNameLength)},
+	}
+	for _, tt := range tests {
+		if got := archiveName(tt.name, "fallback"); got != tt.want {
+			t.Errorf("archiveName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFileServiceWriteArchive(t *testing.T) {
+	s, storage, files := newTestFileService(t, nil)
+	ctx := context.Background()
+	notes, _ := s.SaveFile(textUpload("notes.txt", "meeting notes"), uuid.New(), "", "")
+	pending, _ := s.SaveFile(textUpload("pending.txt", "not scanned yet"), uuid.New(), "", "")
+	files.files[pending.ID].ScanStatus = models.FileScanPending
+	storage.Put(ctx, "c1/p1/images/photo.png", strings.NewReader("png data"), 8, "image/png")
+
+	var buf bytes.Buffer
+	err := s.WriteArchive(ctx, &buf, []ArchiveEntry{
+		{"Logo/notes.txt", notes.Key},
+		{"Logo/photo.png", "c1/p1/images/photo.png"},
+		{"Logo/pending.txt", pending.Key},
+		{"Logo/gone.pdf", "c1/p1/files/gone.pdf"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	methods := map[string]uint16{}
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		got[f.Name] = string(data)
+		methods[f.Name] = f.Method
+	}
+	if got["Logo/notes.txt"] != "meeting notes" || got["Logo/photo.png"] != "png data" || len(got) != 3 {
+		t.Errorf("archive = %v", got)
+	}
+	// Images are already compressed
+	if methods["Logo/photo.png"] != zip.Store || methods["Logo/notes.txt"] != zip.Deflate {
+		t.Errorf("methods = %v", methods)
+	}
+	omitted := got["omitted.txt"]
+	if !strings.Contains(omitted, "Logo/pending.txt: "+ErrFileScanPending.Error()) || !strings.Contains(omitted, "Logo/gone.pdf") {
+		t.Errorf("omitted.txt = %q", omitted)
+	}
+}
+
+func TestFileServiceWriteArchiveCanceled(t *testing.T) {
+	s, _, _ := newTestFileService(t, nil)
+	notes, _ := s.SaveFile(textUpload("notes.txt", "meeting notes"), uuid.New(), "", "")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.WriteArchive(ctx, io.Discard, []ArchiveEntry{{"notes.txt", notes.Key}}); err != context.Canceled {
+		t.Errorf("WriteArchive after the client left = %v, want %v", err, context.Canceled)
+	}
+}
+
+// filterRecordingIssues records the filter of GetAttachments.
+type filterRecordingIssues struct {
+	repository.IssueRepository
+	filter repository.IssueFilter
+}
+
+func (r *filterRecordingIssues) GetAttachments(filter repository.IssueFilter) ([]models.Issue, error) {
+	r.filter = filter
+	return nil, nil
+}
+
+func TestIssueServiceGetAttachmentsForUser(t *testing.T) {
+	lead := &models.User{ID: uuid.New(), Role: models.RoleTeamLead}
+	user := &models.User{ID: uuid.New(), Role: models.RoleUser}
+	permissions := NewPermissionService(newMemoryRoleRepository(), newMemoryUserRepository(lead, user), nil)
+	projectID := uuid.New()
+
+	for _, u := range []*models.User{lead, user} {
+		issues := &filterRecordingIssues{}
+		s := NewIssueService(issues, nil, nil, nil, permissions, nil, nil)
+		if _, err := s.GetAttachmentsForUser(repository.IssueFilter{ProjectIDs: []uuid.UUID{projectID}}, u); err != nil {
+			t.Fatal(err)
+		}
+		if len(issues.filter.ProjectIDs) != 1 || issues.filter.ProjectIDs[0] != projectID {
+			t.Errorf("%s: filter lost the project: %+v", u.Role, issues.filter)
+		}
+		// Issues are limited to the visible ones in the query, unless the role sees every issue
+		if limited := issues.filter.VisibleTo != nil && *issues.filter.VisibleTo == u.ID; limited != (u == user) {
+			t.Errorf("%s: VisibleTo = %v", u.Role, issues.filter.VisibleTo)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"encoding/json"
+	"log"
+	"mellon-harmony-api/internal/models"
+	"mellon-harmony-api/internal/repository"
+	"reflect"
+	"strings"
+)
+
+// AuditService writes the audit log. Services record what changed through it. Recording never
+// fails the change itself: an event that cannot be stored is written to the server log instead.
+type AuditService interface {
+	// Record stores an event. before and after are snapshots (see auditSnapshot); only the fields
+	// that differ between them are kept, and an update that changed nothing is not recorded.
+	// Pass nil before for creations and nil after for deletions.
+	Record(meta models.AuditMeta, action, entityType, entityID string, before, after map[string]interface{})
+	List(filter repository.AuditFilter, limit, offset int) ([]models.AuditEvent, int64, error)
+	Each(filter repository.AuditFilter, fn func(event *models.AuditEvent) error) error
+}
+
+type auditService struct {
+	auditRepo repository.AuditRepository
+}
+
+func NewAuditService(auditRepo repository.AuditRepository) AuditService {
+	return &auditService{auditRepo: auditRepo}
+}
+
+// auditIgnoredFields change on every write and say nothing about what the actor did.
+var auditIgnoredFields = map[string]bool{"created_at": true, "updated_at": true}
+
+func (s *auditService) Record(meta models.AuditMeta, action, entityType, entityID string, before, after map[string]interface{}) {
+	if before != nil && after != nil {
+		before, after = auditDiff(before, after)
+		if len(after) == 0 {
+			return
+		}
+	}
+	event := &models.AuditEvent{
+		ActorID:    meta.ActorID,
+		ActorRole:  truncate(meta.ActorRole, 20),
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   truncate(entityID, 64),
+		Before:     auditJSON(before),
+		After:      auditJSON(after),
+		IPAddress:  truncate(meta.IPAddress, 64),
+		RequestID:  truncate(meta.RequestID, 64),
+	}
+	if err := s.auditRepo.Create(event); err != nil {
+		actor := ""
+		if meta.ActorID != nil {
+			actor = meta.ActorID.String()
+		}
+		log.Printf("[AUDIT] %s %s=%s by=%s ip=%s request=%s before=%s after=%s (not stored: %v)",
+			action, entityType, entityID, actor, meta.IPAddress, meta.RequestID, event.Before, event.After, err)
+	}
+}
+
+func (s *auditService) List(filter repository.AuditFilter, limit, offset int) ([]models.AuditEvent, int64, error) {
+	return s.auditRepo.List(filter, limit, offset)
+}
+
+func (s *auditService) Each(filter repository.AuditFilter, fn func(event *models.AuditEvent) error) error {
+	return s.auditRepo.Each(filter, fn)
+}
+
+// auditSnapshot captures the fields of an entity as they are stored now, under their JSON names.
+// The entity's own MarshalJSON is bypassed, so response-only changes (such as signed file URLs)
+// never reach the log. Relations (nested objects and lists of objects) and timestamps are left
+// out; fields hidden from JSON, such as password hashes, never appear. Callers may add fields the
+// JSON form hides, like issue attachments.
+func auditSnapshot(v interface{}) map[string]interface{} {
+	entity := reflect.Indirect(reflect.ValueOf(v))
+	if entity.Kind() != reflect.Struct {
+		return nil
+	}
+	raw := map[string]interface{}{}
+	auditFields(entity, raw)
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil
+	}
+	for key, value := range fields {
+		if auditIgnoredFields[key] || isAuditRelation(value) {
+			delete(fields, key)
+		}
+	}
+	return fields
+}
+
+// auditFields adds the exported fields of a struct, and of the structs it embeds, by JSON name.
+func auditFields(entity reflect.Value, fields map[string]interface{}) {
+	for i := 0; i < entity.NumField(); i++ {
+		field := entity.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" && field.Anonymous && field.Type.Kind() == reflect.Struct {
+			auditFields(entity.Field(i), fields)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = entity.Field(i).Interface()
+	}
+}
+
+func isAuditRelation(value interface{}) bool {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return true
+	case []interface{}:
+		if len(v) == 0 {
+			return false
+		}
+		_, isObject := v[0].(map[string]interface{})
+		return isObject
+	}
+	return false
+}
+
+// auditDiff keeps only the fields whose values differ. A field missing on one side counts as null.
+func auditDiff(before, after map[string]interface{}) (map[string]interface{}, map[string]interface{}) {
+	changedBefore := map[string]interface{}{}
+	changedAfter := map[string]interface{}{}
+	for key, value := range after {
+		if !reflect.DeepEqual(before[key], value) {
+			changedBefore[key] = before[key]
+			changedAfter[key] = value
+		}
+	}
+	for key, value := range before {
+		if _, ok := after[key]; !ok && value != nil {
+			changedBefore[key] = value
+			changedAfter[key] = nil
+		}
+	}
+	return changedBefore, changedAfter
+}
+
+func auditJSON(fields map[string]interface{}) string {
+	if fields == nil {
+		return ""
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"mellon-harmony-api/internal/models"
+	"mellon-harmony-api/internal/repository"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type memoryAuditRepository struct {
+	repository.AuditRepository
+	events []models.AuditEvent
+	err    error
+}
+
+func (r *memoryAuditRepository) Create(event *models.AuditEvent) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.events = append(r.events, *event)
+	return nil
+}
+
+func TestAuditSnapshot(t *testing.T) {
+	verifiedAt := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	user := &models.User{
+		ID:              uuid.MustParse("6f1c5a43-6f63-4a8a-9d0a-4b4f4c1f7e11"),
+		Name:            "Ana",
+		Email:           "ana@example.com",
+		Password:        "$2a$10$hash",
+		Role:            models.RoleUser,
+		EmailVerifiedAt: &verifiedAt,
+		CreatedAt:       time.Now(),
+	}
+	got := auditSnapshot(user)
+	want := map[string]interface{}{
+		"id":   user.ID.String(),
+		"name": "Ana",
+		"role": "user",
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("snapshot[%q] = %v, want %v", key, got[key], value)
+		}
+	}
+	for _, hidden := range []string{"password", "Password", "created_at", "updated_at"} {
+		if _, ok := got[hidden]; ok {
+			t.Errorf("snapshot has %q", hidden)
+		}
+	}
+	if got := auditSnapshot("not a struct"); got != nil {
+		t.Errorf("auditSnapshot of a string = %v, want nil", got)
+	}
+}
+
+func TestAuditSnapshotSkipsRelations(t *testing.T) {
+	clientID := uuid.New()
+	issue := &models.Issue{Title: "Logo", ClientID: &clientID, Client: &models.Client{Name: "Acme"}}
+	got := auditSnapshot(issue)
+	if got["title"] != "Logo" || got["client_id"] != clientID.String() {
+		t.Errorf("snapshot = %v", got)
+	}
+	if _, ok := got["client"]; ok {
+		t.Error("snapshot includes the client relation")
+	}
+}
+
+func TestAuditDiff(t *testing.T) {
+	tests := []struct {
+		name       string
+		before     map[string]interface{}
+		after      map[string]interface{}
+		wantBefore map[string]interface{}
+		wantAfter  map[string]interface{}
+	}{
+		{"unchanged", map[string]interface{}{"a": 1.0}, map[string]interface{}{"a": 1.0}, map[string]interface{}{}, map[string]interface{}{}},
+		{"changed", map[string]interface{}{"a": 1.0, "b": "x"}, map[string]interface{}{"a": 2.0, "b": "x"}, map[string]interface{}{"a": 1.0}, map[string]interface{}{"a": 2.0}},
+		{"added", map[string]interface{}{}, map[string]interface{}{"a": "x"}, map[string]interface{}{"a": nil}, map[string]interface{}{"a": "x"}},
+		{"removed", map[string]interface{}{"a": "x"}, map[string]interface{}{}, map[string]interface{}{"a": "x"}, map[string]interface{}{"a": nil}},
+		{"removed null", map[string]interface{}{"a": nil}, map[string]interface{}{}, map[string]interface{}{}, map[string]interface{}{}},
+		{"list", map[string]interface{}{"a": []interface{}{"x"}}, map[string]interface{}{"a": []interface{}{"x", "y"}}, map[string]interface{}{"a": []interface{}{"x"}}, map[string]interface{}{"a": []interface{}{"x", "y"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotBefore, gotAfter := auditDiff(tt.before, tt.after)
+			if !reflect.DeepEqual(gotBefore, tt.wantBefore) || !reflect.DeepEqual(gotAfter, tt.wantAfter) {
+				t.Errorf("auditDiff = %v, %v; want %v, %v", gotBefore, gotAfter, tt.wantBefore, tt.wantAfter)
+			}
+		})
+	}
+}
+
+func TestAuditServiceRecord(t *testing.T) {
+	repo := &memoryAuditRepository{}
+	s := NewAuditService(repo)
+	actor := uuid.New()
+	meta := models.AuditMeta{ActorID: &actor, ActorRole: "team_lead", IPAddress: "10.0.0.1", RequestID: strings.Repeat("r", 100)}
+
+	s.Record(meta, models.AuditUpdate, "issue", "1", map[string]interface{}{"title": "a", "status": "todo"}, map[string]interface{}{"title": "a", "status": "done"})
+	s.Record(meta, models.AuditUpdate, "issue", "1", map[string]interface{}{"title": "a"}, map[string]interface{}{"title": "a"})
+	s.Record(meta, models.AuditCreate, "issue", "2", nil, map[string]interface{}{"title": "b"})
+	s.Record(meta, models.AuditDelete, "issue", "3", map[string]interface{}{"title": "c"}, nil)
+
+	if len(repo.events) != 3 {
+		t.Fatalf("stored %d events, want 3 (an update that changed nothing is skipped)", len(repo.events))
+	}
+	update := repo.events[0]
+	if update.Before != `{"status":"todo"}` || update.After != `{"status":"done"}` {
+		t.Errorf("update stored %s -> %s, want only the changed status", update.Before, update.After)
+	}
+	if *update.ActorID != actor || update.ActorRole != "team_lead" || len(update.RequestID) != 64 {
+		t.Errorf("update meta = %+v", update)
+	}
+	if repo.events[1].Before != "" || repo.events[2].After != "" {
+		t.Errorf("create/delete stored %q and %q, want empty sides", repo.events[1].Before, repo.events[2].After)
+	}
+	var created map[string]interface{}
+	if err := json.Unmarshal([]byte(repo.events[1].After), &created); err != nil || created["title"] != "b" {
+		t.Errorf("create stored %q", repo.events[1].After)
+	}
+
+	// A failing store logs the event instead of failing the caller
+	repo.err = errors.New("database is down")
+	s.Record(meta, models.AuditCreate, "issue", "4", nil, map[string]interface{}{"title": "d"})
+}
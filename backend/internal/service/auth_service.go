@@ -2,6 +2,7 @@ package service
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"log"
@@ -9,66 +10,192 @@ import (
 	"mellon-harmony-api/internal/repository"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
 const resetTokenExpiry = time.Hour
 
+const (
+	defaultAccessTokenTTL  = 15 * time.Minute
+	defaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
 // ErrEmailNotConfigured is returned when SMTP is not set and a reset email cannot be sent.
 var ErrEmailNotConfigured = errors.New("email is not configured: set SMTP_HOST, SMTP_FROM and related env vars to send password reset emails")
 // ErrInvalidResetToken is returned when the reset token is invalid or expired.
 var ErrInvalidResetToken = errors.New("el enlace ha expirado o no es válido")
+// ErrInvalidRefreshToken is returned when a refresh token is unknown, expired, revoked or reused.
+var ErrInvalidRefreshToken = errors.New("la sesión ha expirado, inicia sesión nuevamente")
+// ErrPasswordLoginDisabled is returned for emails whose domain must sign in through SSO.
+var ErrPasswordLoginDisabled = errors.New("tu organización inicia sesión con SSO; usa el botón de inicio de sesión único")
+// ErrRegistrationDisabled is returned by Register when accounts can only be created from an invitation.
+var ErrRegistrationDisabled = errors.New("el registro público está deshabilitado; solicita una invitación a un administrador")
+// ErrSessionNotFound is returned when a session does not exist or belongs to another user.
+var ErrSessionNotFound = errors.New("session not found")
+// ErrSessionRevoked is returned when an access token belongs to a revoked session or an outdated token version.
+var ErrSessionRevoked = errors.New("session has been revoked")
+
+// TokenPair is the access/refresh token pair issued on login, registration and refresh.
+type TokenPair struct {
+	AccessToken      string
+	RefreshToken     string
+	AccessExpiresAt  time.Time
+	RefreshExpiresAt time.Time
+}
 
 type AuthService interface {
-	Login(email, password string) (string, *models.User, error)
+	Login(email, password string, meta models.SessionMeta) (*LoginResult, *models.User, error)
 	Register(name, email, password string, role models.UserRole) (*models.User, error)
-	GenerateToken(user *models.User) (string, error)
+	IssueTokens(user *models.User, meta models.SessionMeta) (*TokenPair, error)
+	// CompleteLogin applies the same second-factor rules as Login to a user whose identity was proven
+	// another way: signed in by the identity provider, or who just accepted an invitation.
+	CompleteLogin(user *models.User, meta models.SessionMeta) (*LoginResult, error)
+	RefreshTokens(refreshToken string, meta models.SessionMeta) (*TokenPair, *models.User, error)
+	Logout(sessionID uuid.UUID) error
+	ListSessions(userID uuid.UUID) ([]models.Session, error)
+	RevokeSession(userID, sessionID uuid.UUID) error
+	RevokeOtherSessions(userID, currentSessionID uuid.UUID) error
+	ValidateAccessToken(userID, sessionID uuid.UUID, tokenVersion int) error
+	BeginTwoFactorSetup(userID uuid.UUID) (*TwoFactorSetup, error)
+	BeginTwoFactorSetupWithChallenge(challengeToken string) (*TwoFactorSetup, error)
+	ConfirmTwoFactorSetup(userID uuid.UUID, code string) ([]string, error)
+	DisableTwoFactor(userID uuid.UUID, code string) error
+	RegenerateRecoveryCodes(userID uuid.UUID, code string) ([]string, error)
+	VerifyTwoFactorChallenge(challengeToken, code string, meta models.SessionMeta) (*TwoFactorVerification, error)
 	RequestPasswordReset(email string) error
 	ResetPassword(token, newPassword string) error
 }
 
+// AuthConfig holds token settings for AuthService.
+type AuthConfig struct {
+	JWTSecret       string
+	FrontendURL     string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// Roles that must complete TOTP enrollment before they can sign in
+	TwoFactorRequiredRoles []models.UserRole
+	// Issuer shown in authenticator apps (defaults to "Mellon Harmony")
+	TOTPIssuer string
+	// Email domains whose users must sign in through OIDC: password login, registration and reset are refused
+	PasswordLoginDisabledDomains []string
+	// When true, /auth/register is closed and accounts are only created by accepting an invitation
+	DisablePublicRegistration bool
+	// Per-account lockout after repeated failed logins
+	Lockout LockoutPolicy
+	// Requirements for new passwords (registration and reset); nil skips the checks
+	PasswordPolicy *PasswordPolicy
+	// Where failed logins and lockouts are recorded; nil writes them to the server log only
+	Audit AuditService
+}
+
 type authService struct {
-	userRepo     repository.UserRepository
-	jwtSecret    string
-	emailService EmailService
-	frontendURL  string
+	userRepo          repository.UserRepository
+	sessionRepo       repository.SessionRepository
+	apiTokenRepo      repository.APITokenRepository
+	jwtSecret         string
+	emailService      EmailService
+	emailVerification EmailVerificationService
+	frontendURL       string
+	accessTokenTTL    time.Duration
+	refreshTokenTTL   time.Duration
+	// two-factor settings, see two_factor.go
+	twoFactorRequiredRoles []models.UserRole
+	totpIssuer             string
+
+	passwordLoginDisabledDomains []string
+	disablePublicRegistration    bool
+	lockout                      LockoutPolicy
+	passwordPolicy               *PasswordPolicy
+	audit                        AuditService
 }
 
-func NewAuthService(userRepo repository.UserRepository, jwtSecret string, emailService EmailService, frontendURL string) AuthService {
+func NewAuthService(userRepo repository.UserRepository, sessionRepo repository.SessionRepository, apiTokenRepo repository.APITokenRepository, emailService EmailService, emailVerification EmailVerificationService, cfg AuthConfig) AuthService {
+	if cfg.AccessTokenTTL <= 0 {
+		cfg.AccessTokenTTL = defaultAccessTokenTTL
+	}
+	if cfg.RefreshTokenTTL <= 0 {
+		cfg.RefreshTokenTTL = defaultRefreshTokenTTL
+	}
+	if cfg.TOTPIssuer == "" {
+		cfg.TOTPIssuer = defaultTOTPIssuerName
+	}
 	return &authService{
-		userRepo:     userRepo,
-		jwtSecret:    jwtSecret,
-		emailService: emailService,
-		frontendURL:  strings.TrimSuffix(frontendURL, "/"),
+		userRepo:          userRepo,
+		sessionRepo:       sessionRepo,
+		apiTokenRepo:      apiTokenRepo,
+		jwtSecret:         cfg.JWTSecret,
+		emailService:      emailService,
+		emailVerification: emailVerification,
+		frontendURL:       strings.TrimSuffix(cfg.FrontendURL, "/"),
+		accessTokenTTL:    cfg.AccessTokenTTL,
+		refreshTokenTTL:   cfg.RefreshTokenTTL,
+
+		twoFactorRequiredRoles: cfg.TwoFactorRequiredRoles,
+		totpIssuer:             cfg.TOTPIssuer,
+
+		passwordLoginDisabledDomains: cfg.PasswordLoginDisabledDomains,
+		disablePublicRegistration:    cfg.DisablePublicRegistration,
+		lockout:                      cfg.Lockout.withDefaults(),
+		passwordPolicy:               cfg.PasswordPolicy,
+		audit:                        cfg.Audit,
 	}
 }
 
-func (s *authService) Login(email, password string) (string, *models.User, error) {
+// Login checks the password. Accounts with 2FA (or whose role requires it) get a challenge
+// token instead of a session; see VerifyTwoFactorChallenge.
+func (s *authService) Login(email, password string, meta models.SessionMeta) (*LoginResult, *models.User, error) {
+	if s.passwordLoginDisabled(email) {
+		return nil, nil, ErrPasswordLoginDisabled
+	}
 	user, err := s.userRepo.GetByEmail(email)
 	if err != nil {
-		return "", nil, errors.New("invalid credentials")
+		return nil, nil, errors.New("invalid credentials")
+	}
+	if err := s.checkLocked(user); err != nil {
+		return nil, nil, err
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return "", nil, errors.New("invalid credentials")
+		if lockErr := s.recordFailedLogin(user, meta); lockErr != nil {
+			return nil, nil, lockErr
+		}
+		return nil, nil, errors.New("invalid credentials")
 	}
 
-	token, err := s.GenerateToken(user)
+	result, err := s.loginResult(user, meta)
 	if err != nil {
-		return "", nil, err
+		return nil, nil, err
+	}
+	// With a second factor pending, the counter is only reset once the code is verified
+	if result.Tokens != nil {
+		s.clearFailedLogins(user)
 	}
 
-	return token, user, nil
+	return result, user, nil
 }
 
 func (s *authService) Register(name, email, password string, role models.UserRole) (*models.User, error) {
+	if s.disablePublicRegistration {
+		return nil, ErrRegistrationDisabled
+	}
+	if s.passwordLoginDisabled(email) {
+		return nil, ErrPasswordLoginDisabled
+	}
+
 	// Check if user already exists
 	_, err := s.userRepo.GetByEmail(email)
 	if err == nil {
 		return nil, errors.New("user with this email already exists")
 	}
+	if s.passwordPolicy != nil {
+		if err := s.passwordPolicy.Validate(password, email, name); err != nil {
+			return nil, err
+		}
+	}
 
 	// Hash password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -88,29 +215,207 @@ func (s *authService) Register(name, email, password string, role models.UserRol
 		return nil, err
 	}
 
+	// The account works right away, but account emails wait until the address is confirmed
+	if s.emailVerification != nil {
+		if err := s.emailVerification.StartVerification(user); err != nil {
+			log.Printf("Failed to start email verification for %s: %v", user.Email, err)
+		}
+	}
+
 	// Clear password before returning
 	user.Password = ""
 	return user, nil
 }
 
-func (s *authService) GenerateToken(user *models.User) (string, error) {
+// IssueTokens starts a new session for the user and returns its first token pair.
+func (s *authService) IssueTokens(user *models.User, meta models.SessionMeta) (*TokenPair, error) {
+	refreshToken, refreshHash, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	session := &models.Session{
+		UserID:           user.ID,
+		RefreshTokenHash: refreshHash,
+		UserAgent:        truncate(meta.UserAgent, 512),
+		IPAddress:        truncate(meta.IPAddress, 64),
+		ExpiresAt:        now.Add(s.refreshTokenTTL),
+		LastUsedAt:       now,
+	}
+	if err := s.sessionRepo.Create(session); err != nil {
+		return nil, err
+	}
+	return s.tokenPair(user, session, refreshToken)
+}
+
+// RefreshTokens rotates the refresh token of a session and issues a new access token.
+// Presenting a refresh token that was already rotated out revokes the whole session,
+// since it means the token was copied.
+func (s *authService) RefreshTokens(refreshToken string, meta models.SessionMeta) (*TokenPair, *models.User, error) {
+	hash := hashToken(refreshToken)
+	session, err := s.sessionRepo.GetByRefreshTokenHash(hash)
+	if err != nil {
+		if reused, err := s.sessionRepo.GetByPreviousTokenHash(hash); err == nil {
+			log.Printf("Refresh token reuse detected for session %s (user %s); revoking session", reused.ID, reused.UserID)
+			_ = s.sessionRepo.Revoke(reused.ID)
+		}
+		return nil, nil, ErrInvalidRefreshToken
+	}
+	if !session.IsActive() {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+	user, err := s.userRepo.GetByID(session.UserID)
+	if err != nil {
+		_ = s.sessionRepo.Revoke(session.ID)
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	newToken, newHash, err := newRefreshToken()
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	previous := session.RefreshTokenHash
+	session.PreviousTokenHash = &previous
+	session.RefreshTokenHash = newHash
+	session.ExpiresAt = now.Add(s.refreshTokenTTL)
+	session.LastUsedAt = now
+	if meta.IPAddress != "" {
+		session.IPAddress = truncate(meta.IPAddress, 64)
+	}
+	if meta.UserAgent != "" {
+		session.UserAgent = truncate(meta.UserAgent, 512)
+	}
+	// Only one of concurrent refreshes with the same token may rotate it
+	rotated, err := s.sessionRepo.Rotate(session)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !rotated {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	tokens, err := s.tokenPair(user, session, newToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tokens, user, nil
+}
+
+// Logout revokes the session so its refresh token and access tokens stop working.
+func (s *authService) Logout(sessionID uuid.UUID) error {
+	return s.sessionRepo.Revoke(sessionID)
+}
+
+// ListSessions returns the active sessions (devices) of a user, most recently used first.
+func (s *authService) ListSessions(userID uuid.UUID) ([]models.Session, error) {
+	return s.sessionRepo.GetActiveByUserID(userID)
+}
+
+// RevokeSession signs out one of the user's own sessions.
+func (s *authService) RevokeSession(userID, sessionID uuid.UUID) error {
+	session, err := s.sessionRepo.GetByID(sessionID)
+	if err != nil || session.UserID != userID {
+		return ErrSessionNotFound
+	}
+	return s.sessionRepo.Revoke(sessionID)
+}
+
+// RevokeOtherSessions signs out every session of the user except the one making the request.
+func (s *authService) RevokeOtherSessions(userID, currentSessionID uuid.UUID) error {
+	return s.sessionRepo.RevokeAllForUserExcept(userID, currentSessionID)
+}
+
+// ValidateAccessToken is called by the auth middleware on every request: the session must still
+// be active and the token version must match the user's current one (bumped on password reset
+// or role change).
+func (s *authService) ValidateAccessToken(userID, sessionID uuid.UUID, tokenVersion int) error {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return ErrSessionRevoked
+	}
+	if user.TokenVersion != tokenVersion {
+		return ErrSessionRevoked
+	}
+	session, err := s.sessionRepo.GetByID(sessionID)
+	if err != nil || session.UserID != userID || !session.IsActive() {
+		return ErrSessionRevoked
+	}
+	return nil
+}
+
+func (s *authService) tokenPair(user *models.User, session *models.Session, refreshToken string) (*TokenPair, error) {
+	accessExpiresAt := time.Now().Add(s.accessTokenTTL)
 	claims := jwt.MapClaims{
 		"user_id": user.ID.String(),
 		"email":   user.Email,
 		"role":    string(user.Role),
-		"exp":     time.Now().Add(time.Hour * 24 * 7).Unix(), // 7 days
+		"typ":     "access",
+		"sid":     session.ID.String(),
+		"ver":     user.TokenVersion,
+		"jti":     uuid.New().String(),
+		"iat":     time.Now().Unix(),
+		"exp":     accessExpiresAt.Unix(),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(s.jwtSecret))
+	accessToken, err := token.SignedString([]byte(s.jwtSecret))
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		AccessExpiresAt:  accessExpiresAt,
+		RefreshExpiresAt: session.ExpiresAt,
+	}, nil
+}
+
+// newRefreshToken returns a random opaque refresh token and the hash stored in the database.
+func newRefreshToken() (token, hash string, err error) {
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", "", errors.New("no se pudo generar la sesión")
+	}
+	token = hex.EncodeToString(tokenBytes)
+	return token, hashToken(token), nil
+}
+
+// passwordLoginDisabled reports whether the email's domain is configured to use SSO only.
+func (s *authService) passwordLoginDisabled(email string) bool {
+	return len(s.passwordLoginDisabledDomains) > 0 && emailInDomains(strings.ToLower(email), s.passwordLoginDisabledDomains)
+}
+
+// truncate cuts s to at most max bytes so it fits the column size, without splitting a character.
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
 func (s *authService) RequestPasswordReset(email string) error {
+	if s.passwordLoginDisabled(email) {
+		return ErrPasswordLoginDisabled
+	}
 	user, err := s.userRepo.GetByEmail(email)
 	if err != nil {
 		// Do not reveal whether the email exists
 		return nil
 	}
+	if !user.IsEmailVerified() {
+		// Never send reset links to an address the user has not proven to own
+		log.Printf("Password reset requested for %s but the email is not verified", email)
+		return nil
+	}
 
 	if s.emailService == nil || !s.emailService.IsConfigured() {
 		log.Printf("Password reset requested for %s but email is not configured", email)
@@ -144,13 +449,15 @@ func (s *authService) RequestPasswordReset(email string) error {
 }
 
 func (s *authService) ResetPassword(token, newPassword string) error {
-	if len(newPassword) < 6 {
-		return errors.New("la contraseña debe tener al menos 6 caracteres")
-	}
 	user, err := s.userRepo.GetByPasswordResetToken(token)
 	if err != nil {
 		return ErrInvalidResetToken
 	}
+	if s.passwordPolicy != nil {
+		if err := s.passwordPolicy.Validate(newPassword, user.Email, user.Name); err != nil {
+			return err
+		}
+	}
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
 	if err != nil {
 		return errors.New("no se pudo actualizar la contraseña")
@@ -158,8 +465,17 @@ func (s *authService) ResetPassword(token, newPassword string) error {
 	user.Password = string(hashedPassword)
 	user.PasswordResetToken = nil
 	user.PasswordResetExpiresAt = nil
+	// Sign out every device: whoever triggered the reset may not be the only one holding a session
+	user.TokenVersion++
 	if err := s.userRepo.Update(user); err != nil {
 		return errors.New("no se pudo actualizar la contraseña")
 	}
+	if err := s.sessionRepo.RevokeAllForUser(user.ID); err != nil {
+		log.Printf("Failed to revoke sessions for %s after password reset: %v", user.ID, err)
+	}
+	// Personal access tokens too: a leaked token must not outlive the password it was created under
+	if err := s.apiTokenRepo.RevokeAllForUser(user.ID); err != nil {
+		log.Printf("Failed to revoke API tokens for %s after password reset: %v", user.ID, err)
+	}
 	return nil
 }
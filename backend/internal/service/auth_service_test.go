@@ -0,0 +1,208 @@
+package service
+
+import (
+	"errors"
+	"mellon-harmony-api/internal/models"
+	"mellon-harmony-api/internal/repository"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func newTestAuthService(users *memoryUserRepository, sessions repository.SessionRepository) *authService {
+	return NewAuthService(users, sessions, nil, nil, nil, AuthConfig{JWTSecret: "secret"}).(*authService)
+}
+
+// racingSessions lets another refresh rotate the token between reading the session and rotating it.
+type racingSessions struct {
+	*memoryLoginSessionRepository
+}
+
+func (r racingSessions) GetByRefreshTokenHash(hash string) (*models.Session, error) {
+	session, err := r.memoryLoginSessionRepository.GetByRefreshTokenHash(hash)
+	if err == nil {
+		r.sessions[session.ID].RefreshTokenHash = "rotated-by-another-request"
+	}
+	return session, err
+}
+
+func TestAuthServiceRefreshTokens(t *testing.T) {
+	tests := []struct {
+		name string
+		// prepare changes the session after the first token pair was issued and returns the
+		// refresh token to present
+		prepare     func(t *testing.T, s *authService, sessions *memoryLoginSessionRepository, session *models.Session, token string) string
+		wantErr     bool
+		wantRevoked bool
+	}{
+		{
+			name: "current token",
+			prepare: func(t *testing.T, s *authService, sessions *memoryLoginSessionRepository, session *models.Session, token string) string {
+				return token
+			},
+		},
+		{
+			name: "unknown token",
+			prepare: func(t *testing.T, s *authService, sessions *memoryLoginSessionRepository, session *models.Session, token string) string {
+				return "not-a-token"
+			},
+			wantErr: true,
+		},
+		{
+			name: "rotated-out token revokes the session",
+			prepare: func(t *testing.T, s *authService, sessions *memoryLoginSessionRepository, session *models.Session, token string) string {
+				if _, _, err := s.RefreshTokens(token, models.SessionMeta{}); err != nil {
+					t.Fatal(err)
+				}
+				return token
+			},
+			wantErr:     true,
+			wantRevoked: true,
+		},
+		{
+			name: "revoked session",
+			prepare: func(t *testing.T, s *authService, sessions *memoryLoginSessionRepository, session *models.Session, token string) string {
+				sessions.Revoke(session.ID)
+				return token
+			},
+			wantErr:     true,
+			wantRevoked: true,
+		},
+		{
+			name: "expired session",
+			prepare: func(t *testing.T, s *authService, sessions *memoryLoginSessionRepository, session *models.Session, token string) string {
+				sessions.sessions[session.ID].ExpiresAt = time.Now().Add(-time.Minute)
+				return token
+			},
+			wantErr: true,
+		},
+		{
+			name: "deleted user",
+			prepare: func(t *testing.T, s *authService, sessions *memoryLoginSessionRepository, session *models.Session, token string) string {
+				delete(s.userRepo.(*memoryUserRepository).users, session.UserID)
+				return token
+			},
+			wantErr:     true,
+			wantRevoked: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &models.User{Email: "ana@example.com", Role: models.RoleUser}
+			users := newMemoryUserRepository(user)
+			sessions := newMemoryLoginSessionRepository()
+			s := newTestAuthService(users, sessions)
+
+			first, err := s.IssueTokens(user, models.SessionMeta{IPAddress: "10.0.0.1"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var session *models.Session
+			for _, stored := range sessions.sessions {
+				session = stored
+			}
+
+			presented := tt.prepare(t, s, sessions, session, first.RefreshToken)
+			tokens, got, err := s.RefreshTokens(presented, models.SessionMeta{IPAddress: "10.0.0.2"})
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidRefreshToken) {
+					t.Fatalf("RefreshTokens error = %v, want %v", err, ErrInvalidRefreshToken)
+				}
+			} else {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got.ID != user.ID || tokens.RefreshToken == first.RefreshToken || tokens.AccessToken == "" {
+					t.Fatalf("RefreshTokens = %+v for %s, want new tokens for %s", tokens, got.ID, user.ID)
+				}
+				stored := sessions.sessions[session.ID]
+				if stored.RefreshTokenHash != hashToken(tokens.RefreshToken) || *stored.PreviousTokenHash != hashToken(first.RefreshToken) || stored.IPAddress != "10.0.0.2" {
+					t.Errorf("session not rotated: %+v", stored)
+				}
+			}
+			if revoked := sessions.sessions[session.ID].RevokedAt != nil; revoked != tt.wantRevoked {
+				t.Errorf("session revoked = %v, want %v", revoked, tt.wantRevoked)
+			}
+		})
+	}
+}
+
+func TestAuthServiceRefreshTokensConcurrentRotation(t *testing.T) {
+	user := &models.User{Email: "ana@example.com"}
+	sessions := newMemoryLoginSessionRepository()
+	s := newTestAuthService(newMemoryUserRepository(user), racingSessions{sessions})
+	first, err := s.IssueTokens(user, models.SessionMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.RefreshTokens(first.RefreshToken, models.SessionMeta{}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("refresh that lost the race = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+	for _, stored := range sessions.sessions {
+		if stored.RefreshTokenHash != "rotated-by-another-request" {
+			t.Errorf("the losing refresh overwrote the token: %q", stored.RefreshTokenHash)
+		}
+	}
+}
+
+func TestAuthServiceValidateAccessToken(t *testing.T) {
+	user := &models.User{Email: "ana@example.com", TokenVersion: 2}
+	other := &models.User{Email: "luis@example.com"}
+	users := newMemoryUserRepository(user, other)
+	sessions := newMemoryLoginSessionRepository()
+	s := newTestAuthService(users, sessions)
+
+	active := &models.Session{UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}
+	expired := &models.Session{UserID: user.ID, ExpiresAt: time.Now().Add(-time.Hour)}
+	revoked := &models.Session{UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}
+	for _, session := range []*models.Session{active, expired, revoked} {
+		sessions.Create(session)
+	}
+	sessions.Revoke(revoked.ID)
+
+	tests := []struct {
+		name    string
+		userID  uuid.UUID
+		session uuid.UUID
+		version int
+		wantErr bool
+	}{
+		{"active session", user.ID, active.ID, 2, false},
+		{"outdated token version", user.ID, active.ID, 1, true},
+		{"revoked session", user.ID, revoked.ID, 2, true},
+		{"expired session", user.ID, expired.ID, 2, true},
+		{"session of another user", other.ID, active.ID, 0, true},
+		{"unknown session", user.ID, uuid.New(), 2, true},
+		{"unknown user", uuid.New(), active.ID, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.ValidateAccessToken(tt.userID, tt.session, tt.version)
+			if tt.wantErr != (err != nil) || (err != nil && !errors.Is(err, ErrSessionRevoked)) {
+				t.Errorf("ValidateAccessToken = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthServiceLogout(t *testing.T) {
+	user := &models.User{Email: "ana@example.com"}
+	users := newMemoryUserRepository(user)
+	sessions := newMemoryLoginSessionRepository()
+	s := newTestAuthService(users, sessions)
+	tokens, err := s.IssueTokens(user, models.SessionMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, _ := sessions.GetByRefreshTokenHash(hashToken(tokens.RefreshToken))
+	if err := s.Logout(session.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ValidateAccessToken(user.ID, session.ID, 0); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("access token after logout: %v, want %v", err, ErrSessionRevoked)
+	}
+	if _, _, err := s.RefreshTokens(tokens.RefreshToken, models.SessionMeta{}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("refresh after logout: %v, want %v", err, ErrInvalidRefreshToken)
+	}
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"errors"
+	"mellon-harmony-api/internal/models"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestAuthServiceRevokeSession(t *testing.T) {
+	user := &models.User{Email: "ana@example.com"}
+	other := &models.User{Email: "luis@example.com"}
+	tests := []struct {
+		name        string
+		userID      func() uuid.UUID
+		wantErr     error
+		wantRevoked bool
+	}{
+		{"own session", func() uuid.UUID { return user.ID }, nil, true},
+		{"session of another user", func() uuid.UUID { return other.ID }, ErrSessionNotFound, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessions := newMemoryLoginSessionRepository()
+			s := newTestAuthService(newMemoryUserRepository(user, other), sessions)
+			session := &models.Session{UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}
+			sessions.Create(session)
+
+			if err := s.RevokeSession(tt.userID(), session.ID); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RevokeSession = %v, want %v", err, tt.wantErr)
+			}
+			if revoked := sessions.sessions[session.ID].RevokedAt != nil; revoked != tt.wantRevoked {
+				t.Errorf("revoked = %v, want %v", revoked, tt.wantRevoked)
+			}
+		})
+	}
+	s := newTestAuthService(newMemoryUserRepository(user), newMemoryLoginSessionRepository())
+	if err := s.RevokeSession(user.ID, uuid.New()); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("RevokeSession of an unknown session = %v, want %v", err, ErrSessionNotFound)
+	}
+}
+
+func TestAuthServiceRevokeOtherSessions(t *testing.T) {
+	user := &models.User{Email: "ana@example.com"}
+	other := &models.User{Email: "luis@example.com"}
+	sessions := newMemoryLoginSessionRepository()
+	s := newTestAuthService(newMemoryUserRepository(user, other), sessions)
+
+	current := &models.Session{UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}
+	laptop := &models.Session{UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}
+	phone := &models.Session{UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}
+	othersSession := &models.Session{UserID: other.ID, ExpiresAt: time.Now().Add(time.Hour)}
+	for _, session := range []*models.Session{current, laptop, phone, othersSession} {
+		sessions.Create(session)
+	}
+
+	if err := s.RevokeOtherSessions(user.ID, current.ID); err != nil {
+		t.Fatal(err)
+	}
+	active, _ := s.ListSessions(user.ID)
+	if len(active) != 1 || active[0].ID != current.ID {
+		t.Errorf("active sessions = %v, want only the current one", active)
+	}
+	if othersActive, _ := s.ListSessions(other.ID); len(othersActive) != 1 {
+		t.Errorf("sessions of another user were revoked")
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s    string
+		max  int
+		want string
+	}{
+		{"Firefox", 10, "Firefox"},
+		{"Firefox", 7, "Firefox"},
+		{"Firefox", 4, "Fire"},
+		{"añb", 2, "a"}, // ñ is two bytes
+		{"añb", 3, "añ"},
+		{"日本", 4, "日"},
+		{"日本", 2, ""},
+		{"", 5, ""},
+	}
+	for _, tt := range tests {
+		got := truncate(tt.s, tt.max)
+		if got != tt.want || !strings.HasPrefix(tt.s, got) {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.s, tt.max, got, tt.want)
+		}
+	}
+}
@@ -9,26 +9,30 @@ import (
 
 type ClientService interface {
 	GetClient(id uuid.UUID) (*models.Client, error)
-	GetAllClients() ([]models.Client, error)
-	CreateClient(client *models.Client) error
-	UpdateClient(id uuid.UUID, updates map[string]interface{}) (*models.Client, error)
-	DeleteClient(id uuid.UUID) error
+	GetAllClients(opts repository.ListOptions) ([]models.Client, int64, error)
+	CreateClient(client *models.Client, meta models.AuditMeta) error
+	UpdateClient(id uuid.UUID, updates map[string]interface{}, meta models.AuditMeta) (*models.Client, error)
+	DeleteClient(id uuid.UUID, meta models.AuditMeta) error
 	GetClientMembers(clientID uuid.UUID) ([]models.ClientMember, error)
-	AddClientMember(clientID, userID uuid.UUID) error
-	RemoveClientMember(clientID, userID uuid.UUID) error
+	AddClientMember(clientID, userID uuid.UUID, meta models.AuditMeta) error
+	RemoveClientMember(clientID, userID uuid.UUID, meta models.AuditMeta) error
 }
 
 type clientService struct {
 	clientRepo     repository.ClientRepository
 	userRepo       repository.UserRepository
 	clientMemberRepo repository.ClientMemberRepository
+	fileService      *FileService
+	auditService     AuditService
 }
 
-func NewClientService(clientRepo repository.ClientRepository, userRepo repository.UserRepository, clientMemberRepo repository.ClientMemberRepository) ClientService {
+func NewClientService(clientRepo repository.ClientRepository, userRepo repository.UserRepository, clientMemberRepo repository.ClientMemberRepository, fileService *FileService, auditService AuditService) ClientService {
 	return &clientService{
 		clientRepo:       clientRepo,
 		userRepo:         userRepo,
 		clientMemberRepo: clientMemberRepo,
+		fileService:      fileService,
+		auditService:     auditService,
 	}
 }
 
@@ -42,19 +46,27 @@ func (s *clientService) GetClient(id uuid.UUID) (*models.Client, error) {
 	return client, nil
 }
 
-func (s *clientService) GetAllClients() ([]models.Client, error) {
-	return s.clientRepo.GetAll()
+func (s *clientService) GetAllClients(opts repository.ListOptions) ([]models.Client, int64, error) {
+	return s.clientRepo.List(opts)
 }
 
-func (s *clientService) CreateClient(client *models.Client) error {
-	return s.clientRepo.Create(client)
+func (s *clientService) CreateClient(client *models.Client, meta models.AuditMeta) error {
+	if err := s.clientRepo.Create(client); err != nil {
+		return err
+	}
+	if client.Logo != nil {
+		s.fileService.LinkFileURL(models.FileOwnerClient, client.ID, client.Logo)
+	}
+	s.auditService.Record(meta, models.AuditCreate, "client", client.ID.String(), nil, auditSnapshot(client))
+	return nil
 }
 
-func (s *clientService) UpdateClient(id uuid.UUID, updates map[string]interface{}) (*models.Client, error) {
+func (s *clientService) UpdateClient(id uuid.UUID, updates map[string]interface{}, meta models.AuditMeta) (*models.Client, error) {
 	client, err := s.clientRepo.GetByID(id)
 	if err != nil {
 		return nil, err
 	}
+	before := auditSnapshot(client)
 
 	if name, ok := updates["name"].(string); ok {
 		client.Name = name
@@ -80,26 +92,42 @@ func (s *clientService) UpdateClient(id uuid.UUID, updates map[string]interface{
 	if contactPhone, ok := updates["contact_phone"].(*string); ok {
 		client.ContactPhone = contactPhone
 	}
-	if logo, ok := updates["logo"].(*string); ok {
+	logo, logoChanged := updates["logo"].(*string)
+	if logoChanged {
 		client.Logo = logo
 	}
+	if quota, ok := updates["storage_quota"].(*int64); ok {
+		client.StorageQuota = quota
+	}
 
 	if err := s.clientRepo.Update(client); err != nil {
 		return nil, err
 	}
+	if logoChanged {
+		s.fileService.LinkFileURL(models.FileOwnerClient, id, client.Logo)
+	}
+	s.auditService.Record(meta, models.AuditUpdate, "client", id.String(), before, auditSnapshot(client))
 
 	return s.clientRepo.GetByID(id)
 }
 
-func (s *clientService) DeleteClient(id uuid.UUID) error {
-	return s.clientRepo.Delete(id)
+func (s *clientService) DeleteClient(id uuid.UUID, meta models.AuditMeta) error {
+	client, err := s.clientRepo.GetByID(id)
+	if err != nil {
+		return err
+	}
+	if err := s.clientRepo.Delete(id); err != nil {
+		return err
+	}
+	s.auditService.Record(meta, models.AuditDelete, "client", id.String(), auditSnapshot(client), nil)
+	return nil
 }
 
 func (s *clientService) GetClientMembers(clientID uuid.UUID) ([]models.ClientMember, error) {
 	return s.clientMemberRepo.GetByClientID(clientID)
 }
 
-func (s *clientService) AddClientMember(clientID, userID uuid.UUID) error {
+func (s *clientService) AddClientMember(clientID, userID uuid.UUID, meta models.AuditMeta) error {
 	_, err := s.clientRepo.GetByID(clientID)
 	if err != nil {
 		return err
@@ -112,9 +140,17 @@ func (s *clientService) AddClientMember(clientID, userID uuid.UUID) error {
 	if exists {
 		return nil // idempotent
 	}
-	return s.clientMemberRepo.Add(clientID, userID)
+	if err := s.clientMemberRepo.Add(clientID, userID); err != nil {
+		return err
+	}
+	s.auditService.Record(meta, models.AuditMemberAdded, "client", clientID.String(), nil, map[string]interface{}{"user_id": userID})
+	return nil
 }
 
-func (s *clientService) RemoveClientMember(clientID, userID uuid.UUID) error {
-	return s.clientMemberRepo.Remove(clientID, userID)
+func (s *clientService) RemoveClientMember(clientID, userID uuid.UUID, meta models.AuditMeta) error {
+	if err := s.clientMemberRepo.Remove(clientID, userID); err != nil {
+		return err
+	}
+	s.auditService.Record(meta, models.AuditMemberRemoved, "client", clientID.String(), map[string]interface{}{"user_id": userID}, nil)
+	return nil
 }
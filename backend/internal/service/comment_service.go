@@ -1,19 +1,35 @@
 package service
 
 import (
+	"errors"
 	"fmt"
 	"mellon-harmony-api/internal/models"
 	"mellon-harmony-api/internal/repository"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 )
 
+// ErrCommentForbidden is returned when someone other than the author edits a comment,
+// or deletes it without comment.moderate.
+var ErrCommentForbidden = errors.New("solo el autor puede modificar este comentario")
+
+// ErrModerationReasonRequired is returned when a moderator deletes someone else's comment without a reason.
+var ErrModerationReasonRequired = errors.New("indica el motivo para eliminar el comentario de otra persona")
+
+// ErrCommentModerated is returned when changing a comment a moderator already removed.
+var ErrCommentModerated = errors.New("el comentario fue eliminado por un moderador")
+
 type CommentService interface {
+	GetComment(id uuid.UUID) (*models.Comment, error)
 	GetComments(issueID uuid.UUID) ([]models.Comment, error)
 	CreateComment(issueID, userID uuid.UUID, text string, attachments []models.Attachment) (*models.Comment, error)
-	UpdateComment(id uuid.UUID, text string) (*models.Comment, error)
-	DeleteComment(id uuid.UUID) error
+	// UpdateComment changes the text of a comment; only its author may do so.
+	UpdateComment(id, userID uuid.UUID, text string) (*models.Comment, error)
+	// DeleteComment deletes the actor's own comment. A moderator (comment.moderate) deleting someone
+	// else's comment must give a reason; the comment then stays visible as removed and is returned.
+	DeleteComment(id uuid.UUID, actor *models.User, reason string, meta models.AuditMeta) (*models.Comment, error)
 }
 
 type commentService struct {
@@ -21,17 +37,27 @@ type commentService struct {
 	userRepo           repository.UserRepository
 	issueRepo          repository.IssueRepository
 	notificationService NotificationService
+	permissionService   PermissionService
+	fileService         *FileService
+	auditService        AuditService
 }
 
-func NewCommentService(commentRepo repository.CommentRepository, userRepo repository.UserRepository, issueRepo repository.IssueRepository, notificationService NotificationService) CommentService {
+func NewCommentService(commentRepo repository.CommentRepository, userRepo repository.UserRepository, issueRepo repository.IssueRepository, notificationService NotificationService, permissionService PermissionService, fileService *FileService, auditService AuditService) CommentService {
 	return &commentService{
 		commentRepo:        commentRepo,
 		userRepo:          userRepo,
 		issueRepo:         issueRepo,
 		notificationService: notificationService,
+		permissionService:   permissionService,
+		fileService:         fileService,
+		auditService:        auditService,
 	}
 }
 
+func (s *commentService) GetComment(id uuid.UUID) (*models.Comment, error) {
+	return s.commentRepo.GetByID(id)
+}
+
 func (s *commentService) GetComments(issueID uuid.UUID) ([]models.Comment, error) {
 	return s.commentRepo.GetByIssueID(issueID)
 }
@@ -44,6 +70,7 @@ func (s *commentService) CreateComment(issueID, userID uuid.UUID, text string, a
 	}
 
 	comment := &models.Comment{
+		ID:      uuid.New(),
 		IssueID: issueID,
 		UserID:  userID,
 		Text:    text,
@@ -51,6 +78,14 @@ func (s *commentService) CreateComment(issueID, userID uuid.UUID, text string, a
 
 	// Set attachments if provided
 	if len(attachments) > 0 {
+		clientID := issue.ClientID
+		if clientID == nil && issue.Project != nil {
+			clientID = issue.Project.ClientID
+		}
+		attachments, err = s.fileService.LinkAttachments(models.FileOwnerComment, comment.ID, clientID, attachments)
+		if err != nil {
+			return nil, err
+		}
 		if err := comment.SetAttachments(attachments); err != nil {
 			return nil, err
 		}
@@ -117,11 +152,17 @@ func (s *commentService) commentNotificationContent(issueTitle, authorName, text
 	return title, message
 }
 
-func (s *commentService) UpdateComment(id uuid.UUID, text string) (*models.Comment, error) {
+func (s *commentService) UpdateComment(id, userID uuid.UUID, text string) (*models.Comment, error) {
 	comment, err := s.commentRepo.GetByID(id)
 	if err != nil {
 		return nil, err
 	}
+	if comment.UserID != userID {
+		return nil, ErrCommentForbidden
+	}
+	if comment.IsModerated() {
+		return nil, ErrCommentModerated
+	}
 
 	comment.Text = text
 	if err := s.commentRepo.Update(comment); err != nil {
@@ -131,6 +172,40 @@ func (s *commentService) UpdateComment(id uuid.UUID, text string) (*models.Comme
 	return s.commentRepo.GetByID(id)
 }
 
-func (s *commentService) DeleteComment(id uuid.UUID) error {
-	return s.commentRepo.Delete(id)
+func (s *commentService) DeleteComment(id uuid.UUID, actor *models.User, reason string, meta models.AuditMeta) (*models.Comment, error) {
+	comment, err := s.commentRepo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	// Not even the author may delete a moderated comment, which would discard the moderation record
+	if comment.IsModerated() {
+		return nil, ErrCommentModerated
+	}
+	if comment.UserID == actor.ID {
+		return nil, s.commentRepo.Delete(id)
+	}
+	if !s.permissionService.HasPermission(actor, models.PermCommentModerate) {
+		return nil, ErrCommentForbidden
+	}
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, ErrModerationReasonRequired
+	}
+
+	now := time.Now()
+	comment.OriginalText = comment.Text
+	comment.OriginalAttachments = comment.Attachments
+	comment.Text = models.ModeratedCommentText
+	comment.Attachments = ""
+	comment.ModeratedBy = &actor.ID
+	comment.ModeratedAt = &now
+	comment.ModerationReason = reason
+	if err := s.commentRepo.Update(comment); err != nil {
+		return nil, err
+	}
+	s.auditService.Record(meta, models.AuditModerated, "comment", comment.ID.String(),
+		map[string]interface{}{"text": comment.OriginalText, "moderation_reason": ""},
+		map[string]interface{}{"text": comment.Text, "moderation_reason": reason})
+
+	return s.commentRepo.GetByID(id)
 }
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"mellon-harmony-api/internal/models"
+	"mellon-harmony-api/internal/repository"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type memoryCommentRepository struct {
+	repository.CommentRepository
+	comments map[uuid.UUID]*models.Comment
+}
+
+func newMemoryCommentRepository(comments ...*models.Comment) *memoryCommentRepository {
+	r := &memoryCommentRepository{comments: map[uuid.UUID]*models.Comment{}}
+	for _, comment := range comments {
+		if comment.ID == uuid.Nil {
+			comment.ID = uuid.New()
+		}
+		stored := *comment
+		r.comments[comment.ID] = &stored
+	}
+	return r
+}
+
+func (r *memoryCommentRepository) GetByID(id uuid.UUID) (*models.Comment, error) {
+	comment, ok := r.comments[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copy := *comment
+	return &copy, nil
+}
+
+func (r *memoryCommentRepository) Update(comment *models.Comment) error {
+	stored := *comment
+	r.comments[comment.ID] = &stored
+	return nil
+}
+
+func (r *memoryCommentRepository) Delete(id uuid.UUID) error {
+	delete(r.comments, id)
+	return nil
+}
+
+func newTestCommentService(comments *memoryCommentRepository, audit AuditService, users ...*models.User) CommentService {
+	permissions := NewPermissionService(newMemoryRoleRepository(), newMemoryUserRepository(users...), nil)
+	return NewCommentService(comments, nil, nil, nil, permissions, nil, audit)
+}
+
+func TestCommentServiceDeleteComment(t *testing.T) {
+	author := &models.User{ID: uuid.New(), Role: models.RoleUser}
+	other := &models.User{ID: uuid.New(), Role: models.RoleUser}
+	lead := &models.User{ID: uuid.New(), Role: models.RoleTeamLead}
+	tests := []struct {
+		name          string
+		actor         *models.User
+		reason        string
+		moderated     bool // the comment was already removed by a moderator
+		wantErr       error
+		wantDeleted   bool
+		wantModerated bool
+	}{
+		{"author", author, "", false, nil, true, false},
+		{"author of a moderated comment", author, "", true, ErrCommentModerated, false, true},
+		{"someone else", other, "spam", false, ErrCommentForbidden, false, false},
+		{"moderator without reason", lead, "  ", false, ErrModerationReasonRequired, false, false},
+		{"moderator", lead, " spam ", false, nil, false, true},
+		{"moderator, again", lead, "spam", true, ErrCommentModerated, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comment := &models.Comment{UserID: author.ID, Text: "compra aquí", Attachments: `[{"name":"a.pdf","url":"/files/a.pdf"}]`}
+			if tt.moderated {
+				comment.ModeratedAt, comment.ModeratedBy = new(time.Time), &lead.ID
+			}
+			comments := newMemoryCommentRepository(comment)
+			audit := &recordingAuditService{}
+			s := newTestCommentService(comments, audit, author, other, lead)
+
+			_, err := s.DeleteComment(comment.ID, tt.actor, tt.reason, models.AuditMeta{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("DeleteComment error = %v, want %v", err, tt.wantErr)
+			}
+			stored, ok := comments.comments[comment.ID]
+			if !ok != tt.wantDeleted {
+				t.Fatalf("comment deleted = %v, want %v", !ok, tt.wantDeleted)
+			}
+			if ok && stored.IsModerated() != tt.wantModerated {
+				t.Errorf("comment moderated = %v, want %v", stored.IsModerated(), tt.wantModerated)
+			}
+			if !tt.moderated && tt.wantModerated {
+				if stored.Text != models.ModeratedCommentText || stored.Attachments != "" || stored.OriginalText != "compra aquí" ||
+					stored.OriginalAttachments == "" || stored.ModerationReason != "spam" || *stored.ModeratedBy != lead.ID {
+					t.Errorf("moderated comment = %+v", stored)
+				}
+				if len(audit.events) != 1 || audit.events[0].action != models.AuditModerated {
+					t.Errorf("audited %+v, want one %s event", audit.events, models.AuditModerated)
+				}
+			} else if len(audit.events) != 0 {
+				t.Errorf("audited %+v, want nothing", audit.events)
+			}
+		})
+	}
+}
+
+func TestCommentServiceModeratedCommentHidesOriginal(t *testing.T) {
+	author := &models.User{ID: uuid.New(), Role: models.RoleUser}
+	lead := &models.User{ID: uuid.New(), Role: models.RoleTeamLead}
+	comment := &models.Comment{UserID: author.ID, Text: "compra aquí"}
+	comments := newMemoryCommentRepository(comment)
+	s := newTestCommentService(comments, &recordingAuditService{}, author, lead)
+
+	moderated, err := s.DeleteComment(comment.ID, lead, "spam", models.AuditMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := json.Marshal(moderated.ToResponse())
+	if strings.Contains(string(body), "compra aquí") || !strings.Contains(string(body), `"deleted_by_moderator":true`) {
+		t.Errorf("response %s exposes the original text or hides the moderation", body)
+	}
+	if _, err := s.UpdateComment(comment.ID, author.ID, "editado"); !errors.Is(err, ErrCommentModerated) {
+		t.Errorf("editing a moderated comment: %v, want %v", err, ErrCommentModerated)
+	}
+}
+
+func TestCommentServiceUpdateComment(t *testing.T) {
+	author := &models.User{ID: uuid.New()}
+	comment := &models.Comment{UserID: author.ID, Text: "hola"}
+	comments := newMemoryCommentRepository(comment)
+	s := newTestCommentService(comments, nil, author)
+
+	if _, err := s.UpdateComment(comment.ID, uuid.New(), "otro"); !errors.Is(err, ErrCommentForbidden) {
+		t.Errorf("editing someone else's comment: %v, want %v", err, ErrCommentForbidden)
+	}
+	updated, err := s.UpdateComment(comment.ID, author.ID, "adiós")
+	if err != nil || updated.Text != "adiós" {
+		t.Errorf("UpdateComment = %+v, %v", updated, err)
+	}
+}
@@ -3,13 +3,18 @@ package service
 import (
 	"bytes"
 	"fmt"
+	"math"
 	"net/smtp"
 	"strings"
+	"time"
 )
 
 // EmailService sends emails (e.g. password reset).
 type EmailService interface {
 	SendPasswordResetEmail(toEmail, userName, resetLink string) error
+	SendInvitationEmail(toEmail, inviterName, role, inviteLink string) error
+	SendEmailVerificationEmail(toEmail, userName, verifyLink string) error
+	SendAccountLockedEmail(toEmail, userName string, lockedFor time.Duration, ipAddress, resetLink string) error
 	IsConfigured() bool
 }
 
@@ -52,14 +57,6 @@ func (s *emailService) SendPasswordResetEmail(toEmail, userName, resetLink strin
 		return fmt.Errorf("email is not configured: set SMTP_HOST, SMTP_FROM and related env vars to send password reset emails")
 	}
 
-	addr := s.host + ":" + s.port
-	auth := smtp.PlainAuth("", s.user, s.password, s.host)
-
-	fromHeader := s.from
-	if s.fromName != "" {
-		fromHeader = s.fromName + " <" + s.from + ">"
-	}
-
 	subject := "Restablecer contraseña - Mellon Harmony"
 	body := fmt.Sprintf(`Hola %s,
 
@@ -74,6 +71,100 @@ Si no solicitaste este cambio, puedes ignorar este correo. Tu contraseña no ser
 — Mellon Harmony
 `, userName, resetLink)
 
+	return s.send(toEmail, subject, body)
+}
+
+func (s *emailService) SendInvitationEmail(toEmail, inviterName, role, inviteLink string) error {
+	if !s.IsConfigured() {
+		return fmt.Errorf("email is not configured: set SMTP_HOST, SMTP_FROM and related env vars to send invitation emails")
+	}
+
+	subject := "Invitación a Mellon Harmony"
+	body := fmt.Sprintf(`Hola,
+
+%s te invitó a unirte a Mellon Harmony con el rol "%s".
+
+Haz clic en el siguiente enlace para crear tu cuenta (el enlace solo puede usarse una vez):
+
+%s
+
+Si no esperabas esta invitación, puedes ignorar este correo.
+
+— Mellon Harmony
+`, inviterName, role, inviteLink)
+
+	return s.send(toEmail, subject, body)
+}
+
+func (s *emailService) SendEmailVerificationEmail(toEmail, userName, verifyLink string) error {
+	if !s.IsConfigured() {
+		return fmt.Errorf("email is not configured: set SMTP_HOST, SMTP_FROM and related env vars to send verification emails")
+	}
+
+	subject := "Confirma tu correo - Mellon Harmony"
+	body := fmt.Sprintf(`Hola %s,
+
+Confirma que esta dirección de correo es tuya haciendo clic en el siguiente enlace (válido durante 48 horas):
+
+%s
+
+Mientras no la confirmes no podremos enviarte enlaces para restablecer tu contraseña ni avisos de seguridad.
+
+Si no creaste una cuenta ni cambiaste tu correo en Mellon Harmony, puedes ignorar este mensaje.
+
+— Mellon Harmony
+`, userName, verifyLink)
+
+	return s.send(toEmail, subject, body)
+}
+
+func (s *emailService) SendAccountLockedEmail(toEmail, userName string, lockedFor time.Duration, ipAddress, resetLink string) error {
+	if !s.IsConfigured() {
+		return fmt.Errorf("email is not configured: set SMTP_HOST, SMTP_FROM and related env vars to send security notifications")
+	}
+
+	subject := "Tu cuenta fue bloqueada temporalmente - Mellon Harmony"
+	body := fmt.Sprintf(`Hola %s,
+
+Detectamos varios intentos fallidos de inicio de sesión en tu cuenta de Mellon Harmony (último intento desde la IP %s).
+Por seguridad bloqueamos el acceso durante %s.
+
+Si fuiste tú, espera a que termine el bloqueo e inténtalo de nuevo. Si no fuiste tú, te recomendamos cambiar tu contraseña:
+
+%s
+
+— Mellon Harmony
+`, userName, ipAddress, formatLockDuration(lockedFor), resetLink)
+
+	return s.send(toEmail, subject, body)
+}
+
+// formatLockDuration renders a lockout duration in Spanish, e.g. "15 minutos" or "2 horas".
+func formatLockDuration(d time.Duration) string {
+	if d >= time.Hour {
+		hours := int(d.Round(time.Hour) / time.Hour)
+		if hours == 1 {
+			return "1 hora"
+		}
+		return fmt.Sprintf("%d horas", hours)
+	}
+	minutes := int(math.Ceil(d.Minutes()))
+	if minutes <= 1 {
+		return "1 minuto"
+	}
+	return fmt.Sprintf("%d minutos", minutes)
+}
+
+// send delivers a plain-text UTF-8 email through the configured SMTP server.
+func (s *emailService) send(toEmail, subject, body string) error {
+	addr := s.host + ":" + s.port
+	auth := smtp.PlainAuth("", s.user, s.password, s.host)
+
+	fromHeader := s.from
+	if s.fromName != "" {
+		fromHeader = s.fromName + " <" + s.from + ">"
+	}
+
 	var msg bytes.Buffer
 	msg.WriteString("From: " + fromHeader + "\r\n")
 	msg.WriteString("To: " + toEmail + "\r\n")
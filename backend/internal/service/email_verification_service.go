@@ -0,0 +1,109 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"mellon-harmony-api/internal/models"
+	"mellon-harmony-api/internal/repository"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const emailVerificationExpiry = 48 * time.Hour
+
+// ErrInvalidVerificationToken is returned when a verification link is unknown or expired.
+var ErrInvalidVerificationToken = errors.New("el enlace de verificación ha expirado o no es válido")
+
+// ErrEmailAlreadyVerified is returned when asking for a new link for an already verified address.
+var ErrEmailAlreadyVerified = errors.New("tu correo ya está verificado")
+
+// EmailVerificationService proves that users own their email address before account emails are sent to it.
+type EmailVerificationService interface {
+	// StartVerification marks the user's current email as unverified, saves a fresh token and emails the link.
+	StartVerification(user *models.User) error
+	VerifyEmail(token string) (*models.User, error)
+	ResendVerification(userID uuid.UUID) error
+}
+
+type emailVerificationService struct {
+	userRepo     repository.UserRepository
+	emailService EmailService
+	frontendURL  string
+}
+
+func NewEmailVerificationService(userRepo repository.UserRepository, emailService EmailService, frontendURL string) EmailVerificationService {
+	return &emailVerificationService{
+		userRepo:     userRepo,
+		emailService: emailService,
+		frontendURL:  strings.TrimSuffix(strings.TrimSpace(strings.Split(frontendURL, ",")[0]), "/"),
+	}
+}
+
+func (s *emailVerificationService) StartVerification(user *models.User) error {
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return errors.New("no se pudo generar el enlace de verificación")
+	}
+	token := hex.EncodeToString(tokenBytes)
+	tokenHash := hashToken(token)
+	expiresAt := time.Now().Add(emailVerificationExpiry)
+	user.EmailVerifiedAt = nil
+	user.EmailVerificationToken = &tokenHash
+	user.EmailVerificationExpiresAt = &expiresAt
+	if err := s.userRepo.Update(user); err != nil {
+		return err
+	}
+
+	if s.emailService == nil || !s.emailService.IsConfigured() {
+		log.Printf("Email verification needed for %s but email is not configured", user.Email)
+		return nil
+	}
+	if s.frontendURL == "" {
+		log.Printf("Email verification needed for %s but FRONTEND_URL is not set", user.Email)
+		return nil
+	}
+	verifyLink := s.frontendURL + "/verificar-correo?token=" + token
+	if err := s.emailService.SendEmailVerificationEmail(user.Email, user.Name, verifyLink); err != nil {
+		log.Printf("Failed to send verification email to %s: %v", user.Email, err)
+	}
+	return nil
+}
+
+func (s *emailVerificationService) VerifyEmail(token string) (*models.User, error) {
+	if token == "" {
+		return nil, ErrInvalidVerificationToken
+	}
+	user, err := s.userRepo.GetByEmailVerificationToken(hashToken(token))
+	if err != nil {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	now := time.Now()
+	user.EmailVerifiedAt = &now
+	user.EmailVerificationToken = nil
+	user.EmailVerificationExpiresAt = nil
+	if err := s.userRepo.Update(user); err != nil {
+		return nil, err
+	}
+
+	user.Password = ""
+	return user, nil
+}
+
+func (s *emailVerificationService) ResendVerification(userID uuid.UUID) error {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	if user.IsEmailVerified() {
+		return ErrEmailAlreadyVerified
+	}
+	if s.emailService == nil || !s.emailService.IsConfigured() {
+		return ErrEmailNotConfigured
+	}
+	return s.StartVerification(user)
+}
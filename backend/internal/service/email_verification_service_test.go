@@ -0,0 +1,120 @@
+package service
+
+import (
+	"errors"
+	"mellon-harmony-api/internal/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+// linkToken returns the token query parameter of an emailed link.
+func linkToken(t *testing.T, link string) string {
+	t.Helper()
+	_, token, ok := strings.Cut(link, "?token=")
+	if !ok || token == "" {
+		t.Fatalf("no token in link %q", link)
+	}
+	return token
+}
+
+func TestEmailVerificationService(t *testing.T) {
+	user := &models.User{Email: "ana@example.com"}
+	users := newMemoryUserRepository(user)
+	emails := &recordingEmailService{}
+	s := NewEmailVerificationService(users, emails, "https://app.example.com/, https://other.example.com")
+
+	if err := s.ResendVerification(user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if len(emails.sent) != 1 || !strings.HasPrefix(emails.sent[0].link, "https://app.example.com/verificar-correo?token=") {
+		t.Fatalf("sent %+v, want one verification link on the first frontend URL", emails.sent)
+	}
+	token := linkToken(t, emails.sent[0].link)
+	if stored := users.users[user.ID]; stored.EmailVerificationToken == nil || *stored.EmailVerificationToken == token {
+		t.Error("the token must be stored hashed")
+	}
+
+	verified, err := s.VerifyEmail(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verified.IsEmailVerified() || verified.Password != "" {
+		t.Errorf("VerifyEmail = %+v, want a verified user without password", verified)
+	}
+	if _, err := s.VerifyEmail(token); !errors.Is(err, ErrInvalidVerificationToken) {
+		t.Errorf("link used twice: %v, want %v", err, ErrInvalidVerificationToken)
+	}
+	if err := s.ResendVerification(user.ID); !errors.Is(err, ErrEmailAlreadyVerified) {
+		t.Errorf("resend after verifying: %v, want %v", err, ErrEmailAlreadyVerified)
+	}
+}
+
+func TestEmailVerificationServiceVerifyEmailRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		token func(t *testing.T, users *memoryUserRepository, user *models.User, link string) string
+	}{
+		{"empty", func(t *testing.T, users *memoryUserRepository, user *models.User, link string) string {
+			return ""
+		}},
+		{"unknown", func(t *testing.T, users *memoryUserRepository, user *models.User, link string) string {
+			return "0123456789abcdef"
+		}},
+		{"expired", func(t *testing.T, users *memoryUserRepository, user *models.User, link string) string {
+			past := time.Now().Add(-time.Minute)
+			users.users[user.ID].EmailVerificationExpiresAt = &past
+			return linkToken(t, link)
+		}},
+		{"superseded by a newer link", func(t *testing.T, users *memoryUserRepository, user *models.User, link string) string {
+			stored, _ := users.GetByID(user.ID)
+			NewEmailVerificationService(users, nil, "").StartVerification(stored)
+			return linkToken(t, link)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &models.User{Email: "ana@example.com"}
+			users := newMemoryUserRepository(user)
+			emails := &recordingEmailService{}
+			s := NewEmailVerificationService(users, emails, "https://app.example.com")
+			stored, _ := users.GetByID(user.ID)
+			if err := s.StartVerification(stored); err != nil {
+				t.Fatal(err)
+			}
+			token := tt.token(t, users, user, emails.sent[0].link)
+			if _, err := s.VerifyEmail(token); !errors.Is(err, ErrInvalidVerificationToken) {
+				t.Errorf("VerifyEmail = %v, want %v", err, ErrInvalidVerificationToken)
+			}
+			if users.users[user.ID].IsEmailVerified() {
+				t.Error("email marked verified")
+			}
+		})
+	}
+}
+
+func TestEmailVerificationServiceResendWithoutEmail(t *testing.T) {
+	user := &models.User{Email: "ana@example.com"}
+	s := NewEmailVerificationService(newMemoryUserRepository(user), nil, "https://app.example.com")
+	if err := s.ResendVerification(user.ID); !errors.Is(err, ErrEmailNotConfigured) {
+		t.Errorf("ResendVerification = %v, want %v", err, ErrEmailNotConfigured)
+	}
+}
+
+func TestAuthServiceRequestPasswordResetNeedsVerifiedEmail(t *testing.T) {
+	verifiedAt := time.Now()
+	verified := &models.User{Email: "ana@example.com", EmailVerifiedAt: &verifiedAt}
+	unverified := &models.User{Email: "luis@example.com"}
+	emails := &recordingEmailService{}
+	s := NewAuthService(newMemoryUserRepository(verified, unverified), newMemoryLoginSessionRepository(), nil, emails, nil,
+		AuthConfig{JWTSecret: "secret", FrontendURL: "https://app.example.com"})
+
+	for _, email := range []string{unverified.Email, "nobody@example.com", verified.Email} {
+		if err := s.RequestPasswordReset(email); err != nil {
+			t.Fatalf("RequestPasswordReset(%s) = %v", email, err)
+		}
+	}
+	if len(emails.sent) != 1 || emails.sent[0].to != verified.Email {
+		t.Errorf("sent %+v, want a single reset email to %s", emails.sent, verified.Email)
+	}
+}
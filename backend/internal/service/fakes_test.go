@@ -0,0 +1,797 @@
+package service
+
+import (
+	"mellon-harmony-api/internal/models"
+	"mellon-harmony-api/internal/repository"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// The fakes below keep rows in memory and implement the repository methods the tests reach; the
+// embedded interface is nil, so any other method panics and shows the test needs more of it.
+
+type memoryUserRepository struct {
+	repository.UserRepository
+	users map[uuid.UUID]*models.User
+}
+
+func newMemoryUserRepository(users ...*models.User) *memoryUserRepository {
+	r := &memoryUserRepository{users: map[uuid.UUID]*models.User{}}
+	for _, user := range users {
+		r.Create(user)
+	}
+	return r
+}
+
+func (r *memoryUserRepository) Create(user *models.User) error {
+	if user.ID == uuid.Nil {
+		user.ID = uuid.New()
+	}
+	stored := *user
+	r.users[user.ID] = &stored
+	return nil
+}
+
+func (r *memoryUserRepository) GetByID(id uuid.UUID) (*models.User, error) {
+	user, ok := r.users[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copy := *user
+	return &copy, nil
+}
+
+func (r *memoryUserRepository) GetByEmail(email string) (*models.User, error) {
+	for _, user := range r.users {
+		if user.Email == email {
+			copy := *user
+			return &copy, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *memoryUserRepository) Update(user *models.User) error {
+	stored := *user
+	r.users[user.ID] = &stored
+	return nil
+}
+
+type memoryLoginSessionRepository struct {
+	repository.SessionRepository
+	sessions map[uuid.UUID]*models.Session
+}
+
+func newMemoryLoginSessionRepository() *memoryLoginSessionRepository {
+	return &memoryLoginSessionRepository{sessions: map[uuid.UUID]*models.Session{}}
+}
+
+func (r *memoryLoginSessionRepository) Create(session *models.Session) error {
+	if session.ID == uuid.Nil {
+		session.ID = uuid.New()
+	}
+	stored := *session
+	r.sessions[session.ID] = &stored
+	return nil
+}
+
+func (r *memoryLoginSessionRepository) GetByID(id uuid.UUID) (*models.Session, error) {
+	session, ok := r.sessions[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copy := *session
+	return &copy, nil
+}
+
+func (r *memoryLoginSessionRepository) find(match func(*models.Session) bool) (*models.Session, error) {
+	for _, session := range r.sessions {
+		if match(session) {
+			copy := *session
+			return &copy, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *memoryLoginSessionRepository) GetByRefreshTokenHash(hash string) (*models.Session, error) {
+	return r.find(func(s *models.Session) bool { return s.RefreshTokenHash == hash })
+}
+
+func (r *memoryLoginSessionRepository) GetByPreviousTokenHash(hash string) (*models.Session, error) {
+	return r.find(func(s *models.Session) bool { return s.PreviousTokenHash != nil && *s.PreviousTokenHash == hash })
+}
+
+func (r *memoryLoginSessionRepository) Rotate(session *models.Session) (bool, error) {
+	stored, ok := r.sessions[session.ID]
+	if !ok || stored.RevokedAt != nil || session.PreviousTokenHash == nil || stored.RefreshTokenHash != *session.PreviousTokenHash {
+		return false, nil
+	}
+	updated := *session
+	updated.RevokedAt = stored.RevokedAt
+	r.sessions[session.ID] = &updated
+	return true, nil
+}
+
+func (r *memoryLoginSessionRepository) Revoke(id uuid.UUID) error {
+	if session, ok := r.sessions[id]; ok && session.RevokedAt == nil {
+		now := time.Now()
+		session.RevokedAt = &now
+	}
+	return nil
+}
+
+func (r *memoryLoginSessionRepository) GetActiveByUserID(userID uuid.UUID) ([]models.Session, error) {
+	var active []models.Session
+	for _, session := range r.sessions {
+		if session.UserID == userID && session.IsActive() {
+			active = append(active, *session)
+		}
+	}
+	return active, nil
+}
+
+func (r *memoryLoginSessionRepository) RevokeAllForUserExcept(userID, keepID uuid.UUID) error {
+	for id, session := range r.sessions {
+		if session.UserID == userID && id != keepID {
+			r.Revoke(id)
+		}
+	}
+	return nil
+}
+
+func (r *memoryUserRepository) IncrementFailedLogins(id uuid.UUID, resetBefore time.Time) (int, error) {
+	user := r.users[id]
+	if user.LastFailedLoginAt != nil && user.LastFailedLoginAt.Before(resetBefore) {
+		user.FailedLoginAttempts = 0
+	}
+	now := time.Now()
+	user.FailedLoginAttempts++
+	user.LastFailedLoginAt = &now
+	return user.FailedLoginAttempts, nil
+}
+
+func (r *memoryUserRepository) SetLockedUntil(id uuid.UUID, until *time.Time) error {
+	r.users[id].LockedUntil = until
+	return nil
+}
+
+func (r *memoryUserRepository) ResetFailedLogins(id uuid.UUID) error {
+	user := r.users[id]
+	user.FailedLoginAttempts = 0
+	user.LastFailedLoginAt = nil
+	user.LockedUntil = nil
+	return nil
+}
+
+func (r *memoryUserRepository) UseTOTPStep(id uuid.UUID, step int64) (bool, error) {
+	user := r.users[id]
+	if user.TOTPLastUsedStep >= step {
+		return false, nil
+	}
+	user.TOTPLastUsedStep = step
+	return true, nil
+}
+
+func (r *memoryUserRepository) ReplaceRecoveryCodes(id uuid.UUID, previous, remaining string) (bool, error) {
+	user := r.users[id]
+	if user.TOTPRecoveryCodes != previous {
+		return false, nil
+	}
+	user.TOTPRecoveryCodes = remaining
+	return true, nil
+}
+
+type memoryOIDCStateRepository struct {
+	states map[string]models.OIDCLoginState
+	codes  map[string]models.OIDCLoginCode
+}
+
+func newMemoryOIDCStateRepository() *memoryOIDCStateRepository {
+	return &memoryOIDCStateRepository{states: map[string]models.OIDCLoginState{}, codes: map[string]models.OIDCLoginCode{}}
+}
+
+func (r *memoryOIDCStateRepository) Create(state *models.OIDCLoginState) error {
+	r.states[state.StateHash] = *state
+	return nil
+}
+
+func (r *memoryOIDCStateRepository) Consume(stateHash string) (*models.OIDCLoginState, error) {
+	state, ok := r.states[stateHash]
+	if !ok || !state.ExpiresAt.After(time.Now()) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	delete(r.states, stateHash)
+	return &state, nil
+}
+
+func (r *memoryOIDCStateRepository) DeleteExpired() error {
+	for hash, state := range r.states {
+		if !state.ExpiresAt.After(time.Now()) {
+			delete(r.states, hash)
+		}
+	}
+	return nil
+}
+
+func (r *memoryOIDCStateRepository) CreateCode(code *models.OIDCLoginCode) error {
+	r.codes[code.CodeHash] = *code
+	return nil
+}
+
+func (r *memoryOIDCStateRepository) ConsumeCode(codeHash string) (*models.OIDCLoginCode, error) {
+	code, ok := r.codes[codeHash]
+	if !ok || !code.ExpiresAt.After(time.Now()) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	delete(r.codes, codeHash)
+	return &code, nil
+}
+
+type memoryRoleRepository struct {
+	repository.RoleRepository
+	roles []models.Role
+}
+
+// newMemoryRoleRepository returns the built-in roles plus extra.
+func newMemoryRoleRepository(extra ...models.Role) *memoryRoleRepository {
+	return &memoryRoleRepository{roles: append(models.BuiltInRoles(), extra...)}
+}
+
+func (r *memoryRoleRepository) GetAll() ([]models.Role, error) {
+	return r.roles, nil
+}
+
+type memoryIssueRepository struct {
+	repository.IssueRepository
+	issues map[uuid.UUID]*models.Issue
+}
+
+func newMemoryIssueRepository(issues ...*models.Issue) *memoryIssueRepository {
+	r := &memoryIssueRepository{issues: map[uuid.UUID]*models.Issue{}}
+	for _, issue := range issues {
+		if issue.ID == uuid.Nil {
+			issue.ID = uuid.New()
+		}
+		stored := *issue
+		r.issues[issue.ID] = &stored
+	}
+	return r
+}
+
+func (r *memoryIssueRepository) GetByID(id uuid.UUID) (*models.Issue, error) {
+	issue, ok := r.issues[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copy := *issue
+	return &copy, nil
+}
+
+func (r *memoryIssueRepository) Update(issue *models.Issue) error {
+	stored := *issue
+	r.issues[issue.ID] = &stored
+	return nil
+}
+
+type memoryClientRepository struct {
+	repository.ClientRepository
+	clients map[uuid.UUID]*models.Client
+}
+
+func newMemoryClientRepository(clients ...*models.Client) *memoryClientRepository {
+	r := &memoryClientRepository{clients: map[uuid.UUID]*models.Client{}}
+	for _, client := range clients {
+		if client.ID == uuid.Nil {
+			client.ID = uuid.New()
+		}
+		r.clients[client.ID] = client
+	}
+	return r
+}
+
+func (r *memoryClientRepository) GetByID(id uuid.UUID) (*models.Client, error) {
+	client, ok := r.clients[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copy := *client
+	return &copy, nil
+}
+
+// memoryClientMemberRepository holds client memberships as client ID -> member user IDs.
+type memoryClientMemberRepository struct {
+	repository.ClientMemberRepository
+	members map[uuid.UUID]map[uuid.UUID]bool
+}
+
+func newMemoryClientMemberRepository() *memoryClientMemberRepository {
+	return &memoryClientMemberRepository{members: map[uuid.UUID]map[uuid.UUID]bool{}}
+}
+
+func (r *memoryClientMemberRepository) Add(clientID, userID uuid.UUID) error {
+	if r.members[clientID] == nil {
+		r.members[clientID] = map[uuid.UUID]bool{}
+	}
+	r.members[clientID][userID] = true
+	return nil
+}
+
+func (r *memoryClientMemberRepository) Exists(clientID, userID uuid.UUID) (bool, error) {
+	return r.members[clientID][userID], nil
+}
+
+func (r *memoryClientMemberRepository) GetClientIDsForUser(userID uuid.UUID) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	for clientID, members := range r.members {
+		if members[userID] {
+			ids = append(ids, clientID)
+		}
+	}
+	return ids, nil
+}
+
+func (r *memoryUserRepository) GetByEmailVerificationToken(tokenHash string) (*models.User, error) {
+	for _, user := range r.users {
+		if user.EmailVerificationToken != nil && *user.EmailVerificationToken == tokenHash &&
+			user.EmailVerificationExpiresAt != nil && user.EmailVerificationExpiresAt.After(time.Now()) {
+			copy := *user
+			return &copy, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// sentEmail is one message recorded by recordingEmailService.
+type sentEmail struct {
+	kind string
+	to   string
+	link string
+}
+
+// recordingEmailService records the emails it is asked to send instead of sending them.
+type recordingEmailService struct {
+	sent []sentEmail
+}
+
+func (s *recordingEmailService) SendPasswordResetEmail(toEmail, userName, resetLink string) error {
+	s.sent = append(s.sent, sentEmail{"reset", toEmail, resetLink})
+	return nil
+}
+
+func (s *recordingEmailService) SendInvitationEmail(toEmail, inviterName, role, inviteLink string) error {
+	s.sent = append(s.sent, sentEmail{"invitation", toEmail, inviteLink})
+	return nil
+}
+
+func (s *recordingEmailService) SendEmailVerificationEmail(toEmail, userName, verifyLink string) error {
+	s.sent = append(s.sent, sentEmail{"verification", toEmail, verifyLink})
+	return nil
+}
+
+func (s *recordingEmailService) SendAccountLockedEmail(toEmail, userName string, lockedFor time.Duration, ipAddress, resetLink string) error {
+	s.sent = append(s.sent, sentEmail{"locked", toEmail, resetLink})
+	return nil
+}
+
+func (s *recordingEmailService) IsConfigured() bool {
+	return true
+}
+
+type memoryAPITokenRepository struct {
+	repository.APITokenRepository
+	tokens map[uuid.UUID]*models.APIToken
+}
+
+func newMemoryAPITokenRepository() *memoryAPITokenRepository {
+	return &memoryAPITokenRepository{tokens: map[uuid.UUID]*models.APIToken{}}
+}
+
+func (r *memoryAPITokenRepository) Create(token *models.APIToken) error {
+	if token.ID == uuid.Nil {
+		token.ID = uuid.New()
+	}
+	stored := *token
+	r.tokens[token.ID] = &stored
+	return nil
+}
+
+func (r *memoryAPITokenRepository) GetByHash(hash string) (*models.APIToken, error) {
+	for _, token := range r.tokens {
+		if token.TokenHash == hash {
+			copy := *token
+			return &copy, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *memoryAPITokenRepository) GetByUserID(userID uuid.UUID) ([]models.APIToken, error) {
+	var tokens []models.APIToken
+	for _, token := range r.tokens {
+		if token.UserID == userID && token.RevokedAt == nil {
+			tokens = append(tokens, *token)
+		}
+	}
+	return tokens, nil
+}
+
+func (r *memoryAPITokenRepository) Revoke(userID, id uuid.UUID) (bool, error) {
+	token, ok := r.tokens[id]
+	if !ok || token.UserID != userID || token.RevokedAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	token.RevokedAt = &now
+	return true, nil
+}
+
+func (r *memoryAPITokenRepository) RevokeAllForUser(userID uuid.UUID) error {
+	for _, token := range r.tokens {
+		if token.UserID == userID {
+			r.Revoke(userID, token.ID)
+		}
+	}
+	return nil
+}
+
+func (r *memoryAPITokenRepository) TouchLastUsed(id uuid.UUID, ip string) error {
+	if token, ok := r.tokens[id]; ok {
+		now := time.Now()
+		token.LastUsedAt = &now
+		token.LastUsedIP = ip
+	}
+	return nil
+}
+
+// recordedEvent is one call to recordingAuditService.Record.
+type recordedEvent struct {
+	action     string
+	entityType string
+	entityID   string
+	before     map[string]interface{}
+	after      map[string]interface{}
+}
+
+// recordingAuditService keeps recorded events in memory.
+type recordingAuditService struct {
+	AuditService
+	events []recordedEvent
+}
+
+func (s *recordingAuditService) Record(meta models.AuditMeta, action, entityType, entityID string, before, after map[string]interface{}) {
+	s.events = append(s.events, recordedEvent{action, entityType, entityID, before, after})
+}
+
+// memoryFileRepository keeps file records in memory. Clients (for quotas) and the storage keys
+// that live entities mention (IsReferenced) are set by the test. It is locked because uploads
+// are scanned in the background.
+type memoryFileRepository struct {
+	repository.FileRepository
+	mu         sync.Mutex
+	files      map[uuid.UUID]*models.File
+	clients    map[uuid.UUID]*models.Client
+	referenced map[string]bool
+	// deletedOwners are owner IDs whose entity was deleted, for ReleaseDeletedOwners
+	deletedOwners map[uuid.UUID]bool
+}
+
+func newMemoryFileRepository(clients ...*models.Client) *memoryFileRepository {
+	r := &memoryFileRepository{
+		files:         map[uuid.UUID]*models.File{},
+		clients:       map[uuid.UUID]*models.Client{},
+		referenced:    map[string]bool{},
+		deletedOwners: map[uuid.UUID]bool{},
+	}
+	for _, client := range clients {
+		if client.ID == uuid.Nil {
+			client.ID = uuid.New()
+		}
+		r.clients[client.ID] = client
+	}
+	return r
+}
+
+// get returns a copy of the stored file, for tests to inspect.
+func (r *memoryFileRepository) get(id uuid.UUID) *models.File {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	file, ok := r.files[id]
+	if !ok {
+		return nil
+	}
+	stored := *file
+	return &stored
+}
+
+func (r *memoryFileRepository) Create(file *models.File, check repository.QuotaCheck) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if file.ClientID != nil && check != nil {
+		if err := r.checkQuota(*file.ClientID, file.Size+file.ThumbnailSize, check); err != nil {
+			return err
+		}
+	}
+	if file.ID == uuid.Nil {
+		file.ID = uuid.New()
+	}
+	if file.CreatedAt.IsZero() {
+		file.CreatedAt = time.Now()
+	}
+	stored := *file
+	r.files[file.ID] = &stored
+	return nil
+}
+
+func (r *memoryFileRepository) checkQuota(clientID uuid.UUID, extra int64, check repository.QuotaCheck) error {
+	usage, err := r.clientUsage(clientID)
+	if err == gorm.ErrRecordNotFound {
+		return nil
+	}
+	return check(usage, extra)
+}
+
+func (r *memoryFileRepository) clientUsage(clientID uuid.UUID) (*models.FileUsage, error) {
+	client, ok := r.clients[clientID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	usage := &models.FileUsage{ClientID: &client.ID, ClientName: client.Name, StorageQuota: client.StorageQuota}
+	for _, file := range r.files {
+		if file.ClientID != nil && *file.ClientID == clientID {
+			usage.Files++
+			usage.Bytes += file.Size + file.ThumbnailSize
+		}
+	}
+	return usage, nil
+}
+
+func (r *memoryFileRepository) GetByID(id uuid.UUID) (*models.File, error) {
+	if file := r.get(id); file != nil {
+		return file, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *memoryFileRepository) find(match func(*models.File) bool) []models.File {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var files []models.File
+	for _, file := range r.files {
+		if match(file) {
+			files = append(files, *file)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].CreatedAt.Before(files[j].CreatedAt) })
+	return files
+}
+
+func (r *memoryFileRepository) GetByKeys(keys []string) ([]models.File, error) {
+	return r.find(func(file *models.File) bool {
+		for _, key := range keys {
+			if file.Key == key {
+				return true
+			}
+		}
+		return false
+	}), nil
+}
+
+func (r *memoryFileRepository) GetServed(key string) ([]models.File, error) {
+	return r.find(func(file *models.File) bool {
+		if file.Key == key {
+			return true
+		}
+		for _, thumbKey := range file.GetThumbnails() {
+			if thumbKey == key {
+				return true
+			}
+		}
+		return false
+	}), nil
+}
+
+func (r *memoryFileRepository) Link(ownerType string, ownerID uuid.UUID, ids []uuid.UUID, clientID *uuid.UUID, check repository.QuotaCheck) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if clientID != nil {
+		var charged []*models.File
+		var extra int64
+		for _, id := range ids {
+			if file, ok := r.files[id]; ok && file.OwnerID == nil && (file.ClientID == nil || *file.ClientID != *clientID) {
+				charged = append(charged, file)
+				extra += file.Size + file.ThumbnailSize
+			}
+		}
+		if extra > 0 && check != nil {
+			if err := r.checkQuota(*clientID, extra, check); err != nil {
+				return err
+			}
+		}
+		for _, file := range charged {
+			id := *clientID
+			file.ClientID = &id
+		}
+	}
+	for _, id := range ids {
+		file, ok := r.files[id]
+		if !ok || (file.OwnerID != nil && (file.OwnerType != ownerType || *file.OwnerID != ownerID)) {
+			continue
+		}
+		owner := ownerID
+		file.OwnerType, file.OwnerID, file.DetachedAt = ownerType, &owner, nil
+	}
+	return nil
+}
+
+func (r *memoryFileRepository) ListVersions(firstVersionID uuid.UUID) ([]models.File, error) {
+	files := r.find(func(file *models.File) bool { return file.FirstVersionID() == firstVersionID })
+	sort.Slice(files, func(i, j int) bool { return files[i].Version > files[j].Version })
+	return files, nil
+}
+
+func (r *memoryFileRepository) Release(ownerType string, ownerID uuid.UUID, keep []uuid.UUID, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	kept := map[uuid.UUID]bool{}
+	for _, id := range keep {
+		if file, ok := r.files[id]; ok {
+			kept[file.FirstVersionID()] = true
+		}
+	}
+	for _, file := range r.files {
+		if file.OwnerID != nil && file.OwnerType == ownerType && *file.OwnerID == ownerID && !kept[file.FirstVersionID()] {
+			detachedAt := now
+			file.OwnerType, file.OwnerID, file.DetachedAt = "", nil, &detachedAt
+		}
+	}
+	return nil
+}
+
+func (r *memoryFileRepository) Detach(id uuid.UUID, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if file, ok := r.files[id]; ok {
+		file.DetachedAt = &now
+	}
+	return nil
+}
+
+func (r *memoryFileRepository) ReleaseDeletedOwners(now time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var released int64
+	for _, file := range r.files {
+		if file.OwnerID != nil && r.deletedOwners[*file.OwnerID] {
+			detachedAt := now
+			file.OwnerType, file.OwnerID, file.DetachedAt = "", nil, &detachedAt
+			released++
+		}
+	}
+	return released, nil
+}
+
+func (r *memoryFileRepository) ListUnowned(before time.Time, limit int) ([]models.File, error) {
+	files := r.find(func(file *models.File) bool {
+		since := file.CreatedAt
+		if file.DetachedAt != nil {
+			since = *file.DetachedAt
+		}
+		return file.OwnerID == nil && since.Before(before)
+	})
+	if len(files) > limit {
+		files = files[:limit]
+	}
+	return files, nil
+}
+
+func (r *memoryFileRepository) IsReferenced(key string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for mentioned := range r.referenced {
+		if strings.Contains(mentioned, key) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memoryFileRepository) SetScanStatus(id uuid.UUID, status, signature string, scannedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if file, ok := r.files[id]; ok {
+		file.ScanStatus, file.ScanSignature, file.ScannedAt = status, signature, &scannedAt
+	}
+	return nil
+}
+
+func (r *memoryFileRepository) ListPendingScan(before time.Time, limit int) ([]models.File, error) {
+	files := r.find(func(file *models.File) bool {
+		return file.ScanStatus == models.FileScanPending && file.CreatedAt.Before(before)
+	})
+	if len(files) > limit {
+		files = files[:limit]
+	}
+	return files, nil
+}
+
+func (r *memoryFileRepository) GetScanStatuses(ids []uuid.UUID) (map[uuid.UUID]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	statuses := map[uuid.UUID]string{}
+	for _, id := range ids {
+		if file, ok := r.files[id]; ok {
+			statuses[id] = file.ScanStatus
+		}
+	}
+	return statuses, nil
+}
+
+func (r *memoryFileRepository) GetClientUsage(clientID uuid.UUID) (*models.FileUsage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.clientUsage(clientID)
+}
+
+func (r *memoryFileRepository) GetProjectUsage(clientID uuid.UUID) ([]models.FileUsage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	byProject := map[uuid.UUID]*models.FileUsage{}
+	var usage []models.FileUsage
+	for _, file := range r.files {
+		if file.ClientID == nil || *file.ClientID != clientID {
+			continue
+		}
+		var projectID uuid.UUID
+		if file.ProjectID != nil {
+			projectID = *file.ProjectID
+		}
+		if byProject[projectID] == nil {
+			byProject[projectID] = &models.FileUsage{ClientID: file.ClientID, ProjectID: file.ProjectID}
+		}
+		byProject[projectID].Files++
+		byProject[projectID].Bytes += file.Size + file.ThumbnailSize
+	}
+	for _, project := range byProject {
+		usage = append(usage, *project)
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Bytes > usage[j].Bytes })
+	return usage, nil
+}
+
+func (r *memoryFileRepository) GetUsageByClient() ([]models.FileUsage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var usage []models.FileUsage
+	for id := range r.clients {
+		client, _ := r.clientUsage(id)
+		usage = append(usage, *client)
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Bytes > usage[j].Bytes })
+	return usage, nil
+}
+
+func (r *memoryFileRepository) GetUnassignedUsage() (*models.FileUsage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	usage := &models.FileUsage{}
+	for _, file := range r.files {
+		if file.ClientID == nil {
+			usage.Files++
+			usage.Bytes += file.Size + file.ThumbnailSize
+		}
+	}
+	return usage, nil
+}
+
+func (r *memoryFileRepository) Delete(id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.files, id)
+	return nil
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ErrFileTypeMismatch is returned when the contents of an upload do not match its extension
+// (e.g. an executable renamed to .pdf).
+var ErrFileTypeMismatch = errors.New("file content does not match its type")
+
+// ErrNotAnImage is returned for avatars and logos that are not JPEG, PNG, GIF or WebP images.
+var ErrNotAnImage = errors.New("file is not a supported image (JPEG, PNG, GIF or WebP)")
+
+// Content types detected from file contents. Office documents before 2007 (.doc, .xls) are
+// OLE compound files; .docx and .xlsx are ZIP archives; .mov files are detected as MP4.
+const (
+	contentTypeJPEG = "image/jpeg"
+	contentTypePNG  = "image/png"
+	contentTypeGIF  = "image/gif"
+	contentTypeWebP = "image/webp"
+	contentTypePDF  = "application/pdf"
+	contentTypeZIP  = "application/zip"
+	contentTypeRAR  = "application/x-rar-compressed"
+	contentTypeOLE  = "application/x-ole-storage"
+	contentTypeText = "text/plain; charset=utf-8"
+	contentTypeMP4  = "video/mp4"
+	contentTypeMOV  = "video/quicktime"
+	contentTypeWebM = "video/webm"
+	contentTypePSD  = "image/vnd.adobe.photoshop"
+)
+
+// extensionContentTypes lists, per allowed attachment extension, the detected content type the file
+// must have and the content type it is stored and served with.
+var extensionContentTypes = map[string]struct{ detected, stored string }{
+	".jpg":  {contentTypeJPEG, contentTypeJPEG},
+	".jpeg": {contentTypeJPEG, contentTypeJPEG},
+	".png":  {contentTypePNG, contentTypePNG},
+	".gif":  {contentTypeGIF, contentTypeGIF},
+	".pdf":  {contentTypePDF, contentTypePDF},
+	".doc":  {contentTypeOLE, "application/msword"},
+	".xls":  {contentTypeOLE, "application/vnd.ms-excel"},
+	".docx": {contentTypeZIP, "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+	".xlsx": {contentTypeZIP, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+	".zip":  {contentTypeZIP, contentTypeZIP},
+	".rar":  {contentTypeRAR, "application/vnd.rar"},
+	".txt":  {contentTypeText, contentTypeText},
+	".mp4":  {contentTypeMP4, contentTypeMP4},
+	".mov":  {contentTypeMP4, contentTypeMOV},
+	".webm": {contentTypeWebM, contentTypeWebM},
+	".psd":  {contentTypePSD, contentTypePSD},
+}
+
+// imageExtensions is the extension stored for each supported image type.
+var imageExtensions = map[string]string{
+	contentTypeJPEG: ".jpg",
+	contentTypePNG:  ".png",
+	contentTypeGIF:  ".gif",
+	contentTypeWebP: ".webp",
+}
+
+var oleSignature = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+// IsAllowedAttachmentExt reports whether attachments with the extension are accepted.
+func IsAllowedAttachmentExt(ext string) bool {
+	_, ok := extensionContentTypes[strings.ToLower(ext)]
+	return ok
+}
+
+// detectContentType sniffs the content type of data from its leading bytes, ignoring whatever
+// the client claimed.
+func detectContentType(data []byte) string {
+	if bytes.HasPrefix(data, oleSignature) {
+		return contentTypeOLE
+	}
+	if bytes.HasPrefix(data, []byte("8BPS")) {
+		return contentTypePSD
+	}
+	// MP4 and QuickTime files both start with an ftyp box, whatever their brand
+	if len(data) >= 12 && string(data[4:8]) == "ftyp" {
+		return contentTypeMP4
+	}
+	detected := http.DetectContentType(data)
+	if strings.HasPrefix(detected, "text/plain") {
+		return contentTypeText
+	}
+	return detected
+}
+
+// checkContentType verifies that data is what ext says it is and returns the content type to
+// store. Any plain text is accepted as .txt, but markup (HTML, XML) is not.
+func checkContentType(data []byte, ext string) (string, error) {
+	expected, ok := extensionContentTypes[strings.ToLower(ext)]
+	if !ok {
+		return "", ErrFileTypeMismatch
+	}
+	if detectContentType(data) != expected.detected {
+		return "", ErrFileTypeMismatch
+	}
+	return expected.stored, nil
+}
+
+// checkImage verifies that data is a supported image and returns its content type and extension.
+func checkImage(data []byte) (contentType, ext string, err error) {
+	contentType = detectContentType(data)
+	ext, ok := imageExtensions[contentType]
+	if !ok {
+		return "", "", ErrNotAnImage
+	}
+	return contentType, ext, nil
+}
+
+// IsImageContentType reports whether the content type is an image browsers display (JPEG, PNG, GIF, WebP).
+func IsImageContentType(contentType string) bool {
+	_, ok := imageExtensions[contentType]
+	return ok
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+// Leading bytes of files of each type, enough for content detection.
+var (
+	samplePDF  = []byte("%PDF-1.7\n1 0 obj\n")
+	sampleZIP  = []byte("PK\x03\x04\x14\x00\x00\x00\x08\x00")
+	sampleOLE  = append([]byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}, make([]byte, 8)...)
+	sampleMP4  = []byte("\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00")
+	sampleMOV  = []byte("\x00\x00\x00\x14ftypqt  \x00\x00\x00\x00")
+	samplePSD  = []byte("8BPS\x00\x01\x00\x00\x00\x00")
+	sampleEXE  = []byte("MZ\x90\x00\x03\x00\x00\x00\x04\x00")
+	sampleHTML = []byte("<!DOCTYPE html><html><script>alert(1)</script>")
+	sampleText = []byte("Reunión del lunes: revisar el logo\n")
+	sampleGIF  = []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00")
+	sampleWebP = []byte("RIFF\x1a\x00\x00\x00WEBPVP8 ")
+)
+
+func TestCheckContentType(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		ext     string
+		want    string
+		wantErr bool
+	}{
+		{"pdf", samplePDF, ".pdf", "application/pdf", false},
+		{"upper case extension", samplePDF, ".PDF", "application/pdf", false},
+		{"docx", sampleZIP, ".docx", "application/vnd.openxmlformats-officedocument.wordprocessingml.document", false},
+		{"zip", sampleZIP, ".zip", "application/zip", false},
+		{"doc", sampleOLE, ".doc", "application/msword", false},
+		{"xls", sampleOLE, ".xls", "application/vnd.ms-excel", false},
+		{"mp4", sampleMP4, ".mp4", "video/mp4", false},
+		{"mov", sampleMOV, ".mov", "video/quicktime", false},
+		{"psd", samplePSD, ".psd", "image/vnd.adobe.photoshop", false},
+		{"text", sampleText, ".txt", "text/plain; charset=utf-8", false},
+		{"gif", sampleGIF, ".gif", "image/gif", false},
+		{"executable renamed to pdf", sampleEXE, ".pdf", "", true},
+		{"html renamed to txt", sampleHTML, ".txt", "", true},
+		{"pdf renamed to docx", samplePDF, ".docx", "", true},
+		{"pdf renamed to jpg", samplePDF, ".jpg", "", true},
+		{"extension not allowed", sampleText, ".html", "", true},
+		{"empty file", nil, ".pdf", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := checkContentType(tt.data, tt.ext)
+			if got != tt.want || (err != nil) != tt.wantErr {
+				t.Fatalf("checkContentType = %q, %v; want %q, error %v", got, err, tt.want, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrFileTypeMismatch) {
+				t.Errorf("error = %v, want %v", err, ErrFileTypeMismatch)
+			}
+		})
+	}
+}
+
+func TestCheckImage(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		wantExt string
+		wantErr bool
+	}{
+		{"gif", sampleGIF, ".gif", false},
+		{"webp", sampleWebP, ".webp", false},
+		{"jpeg", []byte("\xFF\xD8\xFF\xE0\x00\x10JFIF\x00"), ".jpg", false},
+		{"png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0DIHDR"), ".png", false},
+		{"svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg"><script/></svg>`), "", true},
+		{"psd", samplePSD, "", true},
+		{"pdf", samplePDF, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ext, err := checkImage(tt.data)
+			if ext != tt.wantExt || (err != nil) != tt.wantErr {
+				t.Fatalf("checkImage = %q, %v; want %q, error %v", ext, err, tt.wantExt, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrNotAnImage) {
+				t.Errorf("error = %v, want %v", err, ErrNotAnImage)
+			}
+		})
+	}
+}
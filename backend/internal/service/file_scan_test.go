@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mellon-harmony-api/internal/models"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// stubScanner returns the verdict for the file contents, or the error for them.
+type stubScanner struct {
+	infected map[string]string // contents to signature
+	errs     map[string]error
+}
+
+func (s stubScanner) Scan(ctx context.Context, r io.Reader) (*ScanResult, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.errs[string(data)]; err != nil {
+		return nil, err
+	}
+	if signature, ok := s.infected[string(data)]; ok {
+		return &ScanResult{Infected: true, Signature: signature}, nil
+	}
+	return &ScanResult{}, nil
+}
+
+// storePending stores contents with a preview as a pending attachment uploaded at createdAt.
+func storePending(t *testing.T, storage Storage, files *memoryFileRepository, contents string, createdAt time.Time) *models.File {
+	t.Helper()
+	ctx := context.Background()
+	key := path.Join("c1", "p1", "files", uuid.NewString()+".txt")
+	record := &models.File{Key: key, Purpose: models.FilePurposeAttachment, ScanStatus: models.FileScanPending, CreatedAt: createdAt}
+	record.SetThumbnails(map[string]string{"200": key + "_200.jpg"})
+	if err := storage.Put(ctx, key, strings.NewReader(contents), int64(len(contents)), "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Put(ctx, key+"_200.jpg", strings.NewReader("preview"), 7, "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+	if err := files.Create(record, nil); err != nil {
+		t.Fatal(err)
+	}
+	return record
+}
+
+func TestFileServiceScanFile(t *testing.T) {
+	scanner := stubScanner{
+		infected: map[string]string{"virus": "Eicar-Test-Signature"},
+		errs: map[string]error{
+			"huge":    fmt.Errorf("%w: INSTREAM size limit exceeded. ERROR", ErrScanSizeLimit),
+			"timeout": fmt.Errorf("%w: i/o timeout", ErrScannerUnavailable),
+		},
+	}
+	tests := []struct {
+		contents       string
+		wantStatus     string
+		wantErr        error
+		wantServeErr   error
+		wantQuarantine bool
+	}{
+		{"notes", models.FileScanClean, nil, nil, false},
+		{"virus", models.FileScanInfected, nil, ErrFileInfected, true},
+		{"huge", models.FileScanTooLarge, nil, ErrFileNotScanned, false},
+		{"timeout", models.FileScanPending, ErrScannerUnavailable, ErrFileScanPending, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.contents, func(t *testing.T) {
+			s, storage, files := newTestFileService(t, scanner)
+			ctx := context.Background()
+			file := storePending(t, storage, files, tt.contents, time.Now())
+
+			if err := s.ScanFile(ctx, file); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ScanFile = %v, want %v", err, tt.wantErr)
+			}
+			stored := files.get(file.ID)
+			if stored.ScanStatus != tt.wantStatus {
+				t.Errorf("status = %q, want %q", stored.ScanStatus, tt.wantStatus)
+			}
+			if tt.wantStatus == models.FileScanInfected && stored.ScanSignature != "Eicar-Test-Signature" {
+				t.Errorf("signature = %q", stored.ScanSignature)
+			}
+			if got := s.ScanStatuses([]uuid.UUID{file.ID})[file.ID]; got != tt.wantStatus {
+				t.Errorf("ScanStatuses = %q, want %q", got, tt.wantStatus)
+			}
+			for _, key := range []string{file.Key, file.Key + "_200.jpg"} {
+				quarantined := readStored(t, storage, path.Join(QuarantineDir, key)) != ""
+				if quarantined != tt.wantQuarantine || quarantined == (readStored(t, storage, key) != "") {
+					t.Errorf("%s quarantined = %v, want %v", key, quarantined, tt.wantQuarantine)
+				}
+				if _, err := s.OpenFile(ctx, key); !errors.Is(err, tt.wantServeErr) {
+					t.Errorf("OpenFile(%s) = %v, want %v", key, err, tt.wantServeErr)
+				}
+			}
+		})
+	}
+}
+
+func TestFileServiceRescanPending(t *testing.T) {
+	scanner := stubScanner{errs: map[string]error{"flaky": fmt.Errorf("%w: connection reset", ErrScannerUnavailable)}}
+	s, storage, files := newTestFileService(t, scanner)
+	old := time.Now().Add(-time.Hour)
+	// The failing file is the oldest, so it is scanned first
+	failing := storePending(t, storage, files, "flaky", old.Add(-time.Minute))
+	pending := storePending(t, storage, files, "notes", old)
+	recent := storePending(t, storage, files, "notes", time.Now())
+
+	scanned, err := s.RescanPending(context.Background(), 10*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scanned != 1 {
+		t.Errorf("scanned %d files, want 1", scanned)
+	}
+	want := map[*models.File]string{failing: models.FileScanPending, pending: models.FileScanClean, recent: models.FileScanPending}
+	for file, status := range want {
+		if got := files.get(file.ID).ScanStatus; got != status {
+			t.Errorf("file %s status = %q, want %q", file.Key, got, status)
+		}
+	}
+}
+
+func TestFileServiceScanWithoutScanner(t *testing.T) {
+	s, storage, files := newTestFileService(t, nil)
+	file := storePending(t, storage, files, "notes", time.Now().Add(-time.Hour))
+	if err := s.ScanFile(context.Background(), file); !errors.Is(err, ErrScannerUnavailable) {
+		t.Errorf("ScanFile = %v, want %v", err, ErrScannerUnavailable)
+	}
+	if scanned, err := s.RescanPending(context.Background(), time.Minute); scanned != 0 || err != nil {
+		t.Errorf("RescanPending = %d, %v; want nothing scanned", scanned, err)
+	}
+}
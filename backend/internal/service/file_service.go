@@ -1,45 +1,136 @@
 package service
 
 import (
+	"bytes"
+	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
-	"mime/multipart"
-	"os"
+	"log"
+	"mellon-harmony-api/internal/models"
+	"mellon-harmony-api/internal/repository"
+	"net/url"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
 )
 
 const (
-	// MaxFileSize is 10MB in bytes
-	MaxFileSize = 10 * 1024 * 1024
-	// UploadDir is the directory where files are stored
+	// DefaultMaxFileSize is 10MB in bytes, the default limit of every upload purpose
+	DefaultMaxFileSize = 10 * 1024 * 1024
+	// MaxImageSize is the largest image that can be processed (metadata stripping, thumbnails), which is done in memory
+	MaxImageSize = 50 * 1024 * 1024
+	// UploadDir is the default local upload directory and the prefix of public file paths ("uploads/...")
 	UploadDir = "uploads"
 	// UnclassifiedFolder is used when client or project is not provided
 	UnclassifiedFolder = "general"
+	// QuarantineDir holds infected files under their original key; it is never served
+	QuarantineDir = "quarantine"
 )
 
-type FileService struct {
-	uploadDir string
+// sweepBatchSize is the number of unowned files deleted per query by the sweeper.
+const sweepBatchSize = 100
+
+// maxConcurrentScans limits the virus scans running in the background at once.
+const maxConcurrentScans = 4
+
+// sniffLength is the number of leading bytes used to detect the content type (see http.DetectContentType).
+const sniffLength = 512
+
+// ErrFileTooLarge is returned for uploads over the size limit of their purpose.
+var ErrFileTooLarge = errors.New("file exceeds the maximum allowed size")
+
+// ErrInvalidUpload is returned for uploads with a missing or invalid purpose, user_id or client_id.
+var ErrInvalidUpload = errors.New("invalid upload")
+
+// ErrFileTypeNotAllowed is returned for attachments whose extension is not accepted.
+var ErrFileTypeNotAllowed = errors.New("file type not allowed")
+
+// ErrFileScanPending is returned when serving a file that has not been scanned for viruses yet.
+var ErrFileScanPending = errors.New("file is being scanned for viruses")
+
+// ErrFileInfected is returned when serving a file in which the virus scanner found malware.
+var ErrFileInfected = errors.New("file is infected and was quarantined")
+
+// ErrFileNotScanned is returned when serving a file that was too large for the virus scanner.
+var ErrFileNotScanned = errors.New("file is too large to be scanned for viruses")
+
+// UploadLimits are the maximum sizes in bytes of uploads by purpose; zero means DefaultMaxFileSize.
+type UploadLimits struct {
+	Attachment int64
+	Avatar     int64
+	ClientLogo int64
+	// ClientQuota is the storage quota of clients without one of their own, in bytes; zero means unlimited
+	ClientQuota int64
 }
 
-func NewFileService(uploadDir string) *FileService {
-	// Create upload directory if it doesn't exist
-	if uploadDir == "" {
-		uploadDir = UploadDir
+// For returns the limit of an upload purpose.
+func (l UploadLimits) For(purpose string) int64 {
+	limit := l.Attachment
+	switch purpose {
+	case models.FilePurposeAvatar:
+		limit = l.Avatar
+	case models.FilePurposeClientLogo:
+		limit = l.ClientLogo
 	}
-
-	// Ensure directory exists
-	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		panic(fmt.Sprintf("Failed to create upload directory: %v", err))
+	if limit <= 0 {
+		return DefaultMaxFileSize
 	}
+	return limit
+}
+
+// Upload is a file to be saved: its original name, its size and its contents.
+type Upload struct {
+	Name string
+	Size int64
+	Body io.Reader
+}
+
+// UploadOptions say what an upload is for. UserID is required for avatars and ClientID for logos;
+// attachments are filed under ClientID and ProjectID when given.
+type UploadOptions struct {
+	Purpose   string // models.FilePurposeAttachment (default), FilePurposeAvatar or FilePurposeClientLogo
+	UserID    string
+	ClientID  string
+	ProjectID string
+}
+
+// FileService validates uploads, names them, keeps them in a Storage and records them in the files table.
+// With a Scanner, attachments are scanned for viruses in the background and only served once clean.
+type FileService struct {
+	storage Storage
+	files   repository.FileRepository
+	scanner Scanner
+	limits  UploadLimits
+
+	scanSlots    chan struct{}
+	scanStatuses sync.Map // final scan status (clean, infected) by file ID
+}
 
+// NewFileService creates the file service; scanner may be nil to disable virus scanning.
+func NewFileService(storage Storage, files repository.FileRepository, scanner Scanner, limits UploadLimits) *FileService {
 	return &FileService{
-		uploadDir: uploadDir,
+		storage:   storage,
+		files:     files,
+		scanner:   scanner,
+		limits:    limits,
+		scanSlots: make(chan struct{}, maxConcurrentScans),
 	}
 }
 
+// Limits returns the configured upload size limits.
+func (s *FileService) Limits() UploadLimits {
+	return s.limits
+}
+
 // safeFolderName returns a safe segment for path (UUID or "general" only)
 func safeFolderName(id string) string {
 	id = strings.TrimSpace(id)
@@ -62,143 +153,586 @@ func safeFolderName(id string) string {
 	return id
 }
 
+// CheckUpload validates what is known about an upload before its contents arrive: the purpose and
+// its required IDs, the size limit, the client's storage quota and, for attachments, the extension.
+// Save checks it again.
+func (s *FileService) CheckUpload(name string, size int64, opts UploadOptions) error {
+	if limit := s.limits.For(opts.Purpose); size > limit {
+		return fmt.Errorf("%w of %d bytes", ErrFileTooLarge, limit)
+	}
+	switch opts.Purpose {
+	case models.FilePurposeAvatar:
+		if safeFolderName(opts.UserID) == UnclassifiedFolder {
+			return fmt.Errorf("%w: valid user_id required for avatar upload", ErrInvalidUpload)
+		}
+	case models.FilePurposeClientLogo:
+		if safeFolderName(opts.ClientID) == UnclassifiedFolder {
+			return fmt.Errorf("%w: valid client_id required for logo upload", ErrInvalidUpload)
+		}
+	case "", models.FilePurposeAttachment:
+		if !IsAllowedAttachmentExt(filepath.Ext(name)) {
+			return ErrFileTypeNotAllowed
+		}
+	default:
+		return fmt.Errorf("%w: unknown upload_purpose %q", ErrInvalidUpload, opts.Purpose)
+	}
+	if opts.Purpose != models.FilePurposeAvatar {
+		return s.checkClientQuota(opts.ClientID, size)
+	}
+	return nil
+}
+
+// Save validates and stores an upload for the given purpose.
+func (s *FileService) Save(upload Upload, uploadedBy uuid.UUID, opts UploadOptions) (*models.File, error) {
+	if err := s.CheckUpload(upload.Name, upload.Size, opts); err != nil {
+		return nil, err
+	}
+	switch opts.Purpose {
+	case models.FilePurposeAvatar:
+		return s.SaveAvatarFile(upload, uploadedBy, opts.UserID)
+	case models.FilePurposeClientLogo:
+		return s.SaveClientLogoFile(upload, uploadedBy, opts.ClientID)
+	}
+	return s.SaveFile(upload, uploadedBy, opts.ClientID, opts.ProjectID)
+}
+
 // SaveFile saves an uploaded file under uploads/{client_id}/{project_id}/images|files/
 // clientID and projectID can be empty or UUIDs; empty/invalid values use "general".
 // Returns path with forward slashes for URLs (e.g. "uploads/client_id/project_id/images/unique.jpg").
-func (s *FileService) SaveFile(fileHeader *multipart.FileHeader, clientID, projectID string) (string, error) {
-	// Validate file size
-	if fileHeader.Size > MaxFileSize {
-		return "", fmt.Errorf("file size exceeds maximum allowed size of %d bytes", MaxFileSize)
+func (s *FileService) SaveFile(upload Upload, uploadedBy uuid.UUID, clientID, projectID string) (*models.File, error) {
+	record := &models.File{Purpose: models.FilePurposeAttachment, UploadedBy: uploadedBy}
+	if id, err := uuid.Parse(safeFolderName(clientID)); err == nil {
+		record.ClientID = &id
 	}
+	if id, err := uuid.Parse(safeFolderName(projectID)); err == nil {
+		record.ProjectID = &id
+	}
+	return s.saveAttachment(upload, record)
+}
 
-	clientID = safeFolderName(clientID)
-	projectID = safeFolderName(projectID)
-
-	// images vs files by content type
-	subdir := "files"
-	if strings.HasPrefix(fileHeader.Header.Get("Content-Type"), "image/") {
-		subdir = "images"
+// saveAttachment stores an attachment under the client and project folders of record.
+func (s *FileService) saveAttachment(upload Upload, record *models.File) (*models.File, error) {
+	clientID, projectID := UnclassifiedFolder, UnclassifiedFolder
+	if record.ClientID != nil {
+		clientID = record.ClientID.String()
+	}
+	if record.ProjectID != nil {
+		projectID = record.ProjectID.String()
 	}
 
-	dir := filepath.Join(s.uploadDir, clientID, projectID, subdir)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create upload directory: %w", err)
+	// Validate file size and the client's storage quota
+	if limit := s.limits.For(models.FilePurposeAttachment); upload.Size > limit {
+		return nil, fmt.Errorf("%w of %d bytes", ErrFileTooLarge, limit)
+	}
+	if err := s.checkClientQuota(clientID, upload.Size); err != nil {
+		return nil, err
 	}
 
-	// Open the uploaded file
-	file, err := fileHeader.Open()
+	head, body, err := sniffUpload(upload.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to open file: %w", err)
+		return nil, err
 	}
-	defer file.Close()
-
-	ext := filepath.Ext(fileHeader.Filename)
-	uniqueName := generateUniqueFilename(ext)
-	filePath := filepath.Join(dir, uniqueName)
-
-	dst, err := os.Create(filePath)
+	// The contents must match the extension; the Content-Type sent by the client is ignored
+	ext := strings.ToLower(filepath.Ext(upload.Name))
+	contentType, err := checkContentType(head, ext)
 	if err != nil {
-		return "", fmt.Errorf("failed to create file: %w", err)
+		return nil, err
 	}
-	defer dst.Close()
 
-	if _, err := io.Copy(dst, file); err != nil {
-		return "", fmt.Errorf("failed to save file: %w", err)
+	// images vs files by content type
+	subdir := "files"
+	if IsImageContentType(contentType) {
+		subdir = "images"
 	}
 
-	// Return path with forward slashes for URL consistency (e.g. uploads/client_id/project_id/images/unique.jpg)
-	return filepath.ToSlash(filepath.Join(s.uploadDir, clientID, projectID, subdir, uniqueName)), nil
+	upload.Body = body
+	key := path.Join(clientID, projectID, subdir, generateUniqueFilename(ext))
+	return s.store(upload, key, contentType, record)
 }
 
 // SaveAvatarFile saves an uploaded image as a user avatar under uploads/avatars/{userID}/
 // userID must be a valid UUID. Returns path with forward slashes (e.g. uploads/avatars/user_id/unique.jpg).
-func (s *FileService) SaveAvatarFile(fileHeader *multipart.FileHeader, userID string) (string, error) {
-	if fileHeader.Size > MaxFileSize {
-		return "", fmt.Errorf("file size exceeds maximum allowed size of %d bytes", MaxFileSize)
-	}
-	if !strings.HasPrefix(fileHeader.Header.Get("Content-Type"), "image/") {
-		return "", fmt.Errorf("avatar must be an image file")
+func (s *FileService) SaveAvatarFile(upload Upload, uploadedBy uuid.UUID, userID string) (*models.File, error) {
+	if limit := s.limits.For(models.FilePurposeAvatar); upload.Size > limit {
+		return nil, fmt.Errorf("%w of %d bytes", ErrFileTooLarge, limit)
 	}
 	userID = safeFolderName(userID)
 	if userID == UnclassifiedFolder {
-		return "", fmt.Errorf("valid user_id required for avatar upload")
-	}
-	dir := filepath.Join(s.uploadDir, "avatars", userID)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create upload directory: %w", err)
+		return nil, fmt.Errorf("valid user_id required for avatar upload")
 	}
-	file, err := fileHeader.Open()
+	head, body, err := sniffUpload(upload.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to open file: %w", err)
+		return nil, err
 	}
-	defer file.Close()
-	ext := filepath.Ext(fileHeader.Filename)
-	uniqueName := generateUniqueFilename(ext)
-	filePath := filepath.Join(dir, uniqueName)
-	dst, err := os.Create(filePath)
+	contentType, ext, err := checkImage(head)
 	if err != nil {
-		return "", fmt.Errorf("failed to create file: %w", err)
-	}
-	defer dst.Close()
-	if _, err := io.Copy(dst, file); err != nil {
-		return "", fmt.Errorf("failed to save file: %w", err)
+		return nil, fmt.Errorf("avatar must be an image file: %w", err)
 	}
-	return filepath.ToSlash(filepath.Join(s.uploadDir, "avatars", userID, uniqueName)), nil
+	upload.Body = body
+	record := &models.File{Purpose: models.FilePurposeAvatar, UploadedBy: uploadedBy}
+	return s.store(upload, path.Join("avatars", userID, generateUniqueFilename(ext)), contentType, record)
 }
 
 // SaveClientLogoFile saves an uploaded image as a client logo under uploads/logos/{clientID}/
 // clientID must be a valid UUID. Returns path with forward slashes (e.g. uploads/logos/client_id/unique.jpg).
-func (s *FileService) SaveClientLogoFile(fileHeader *multipart.FileHeader, clientID string) (string, error) {
-	if fileHeader.Size > MaxFileSize {
-		return "", fmt.Errorf("file size exceeds maximum allowed size of %d bytes", MaxFileSize)
-	}
-	if !strings.HasPrefix(fileHeader.Header.Get("Content-Type"), "image/") {
-		return "", fmt.Errorf("logo must be an image file")
+func (s *FileService) SaveClientLogoFile(upload Upload, uploadedBy uuid.UUID, clientID string) (*models.File, error) {
+	if limit := s.limits.For(models.FilePurposeClientLogo); upload.Size > limit {
+		return nil, fmt.Errorf("%w of %d bytes", ErrFileTooLarge, limit)
 	}
 	clientID = safeFolderName(clientID)
 	if clientID == UnclassifiedFolder {
-		return "", fmt.Errorf("valid client_id required for logo upload")
+		return nil, fmt.Errorf("valid client_id required for logo upload")
+	}
+	head, body, err := sniffUpload(upload.Body)
+	if err != nil {
+		return nil, err
+	}
+	contentType, ext, err := checkImage(head)
+	if err != nil {
+		return nil, fmt.Errorf("logo must be an image file: %w", err)
+	}
+	upload.Body = body
+	record := &models.File{Purpose: models.FilePurposeClientLogo, UploadedBy: uploadedBy}
+	if id, err := uuid.Parse(clientID); err == nil {
+		record.ClientID = &id
+	}
+	return s.store(upload, path.Join("logos", clientID, generateUniqueFilename(ext)), contentType, record)
+}
+
+// sniffUpload reads the leading bytes of an upload for content detection and returns them with
+// a reader of the whole upload.
+func sniffUpload(r io.Reader) ([]byte, io.Reader, error) {
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	head = head[:n]
+	return head, io.MultiReader(bytes.NewReader(head), r), nil
+}
+
+// store keeps a validated upload under key and records it; record.Path() is its public path
+// ("uploads/{key}"). Images are read into memory, stripped of metadata and get previews of each
+// of ThumbnailSizes next to them; other files are streamed to storage. The file has no owner until
+// an entity referencing it is saved. Attachments are pending until scanned when a scanner is set.
+func (s *FileService) store(upload Upload, key, contentType string, record *models.File) (*models.File, error) {
+	ctx := context.Background()
+	var body io.Reader
+	var size int64
+	var thumbnails []*thumbnail
+	var counter *countingReader
+	hash := sha256.New()
+	if IsImageContentType(contentType) {
+		if upload.Size > MaxImageSize {
+			return nil, fmt.Errorf("%w: images can be at most %d bytes", ErrFileTooLarge, MaxImageSize)
+		}
+		data, err := io.ReadAll(io.LimitReader(upload.Body, MaxImageSize+1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+		if len(data) > MaxImageSize {
+			return nil, fmt.Errorf("%w: images can be at most %d bytes", ErrFileTooLarge, MaxImageSize)
+		}
+		processed, img, err := processImage(data, contentType)
+		if err != nil {
+			return nil, err
+		}
+		for _, thumbSize := range ThumbnailSizes {
+			thumb, err := makeThumbnail(img, thumbSize)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create thumbnail: %w", err)
+			}
+			thumbnails = append(thumbnails, thumb)
+		}
+		hash.Write(processed)
+		body, size = bytes.NewReader(processed), int64(len(processed))
+	} else {
+		// Upload.Size was checked against the limit, so never read past it
+		counter = &countingReader{r: io.LimitReader(upload.Body, upload.Size)}
+		body, size = io.TeeReader(counter, hash), upload.Size
+	}
+
+	stored := []string{}
+	cleanup := func() {
+		for _, k := range stored {
+			s.storage.Delete(ctx, k)
+		}
+	}
+	if err := s.storage.Put(ctx, key, body, size, contentType); err != nil {
+		return nil, err
+	}
+	stored = append(stored, key)
+	if counter != nil && counter.n != upload.Size {
+		cleanup()
+		return nil, fmt.Errorf("upload is incomplete: received %d of %d bytes", counter.n, upload.Size)
+	}
+
+	thumbnailKeys := map[string]string{}
+	var thumbnailSize int64
+	for i, thumb := range thumbnails {
+		thumbKey := fmt.Sprintf("%s_%d%s", strings.TrimSuffix(key, path.Ext(key)), ThumbnailSizes[i], thumb.ext)
+		if err := s.storage.Put(ctx, thumbKey, bytes.NewReader(thumb.data), int64(len(thumb.data)), thumb.contentType); err != nil {
+			cleanup()
+			return nil, err
+		}
+		stored = append(stored, thumbKey)
+		thumbnailKeys[strconv.Itoa(ThumbnailSizes[i])] = thumbKey
+		thumbnailSize += int64(len(thumb.data))
+	}
+
+	record.Key = key
+	record.Name = filepath.Base(upload.Name)
+	record.ContentType = contentType
+	record.Size = size
+	record.Checksum = hex.EncodeToString(hash.Sum(nil))
+	record.SetThumbnails(thumbnailKeys)
+	record.ThumbnailSize = thumbnailSize
+	if record.Version == 0 {
+		record.Version = 1
+	}
+	record.ScanStatus = models.FileScanClean
+	if s.scanner != nil && record.Purpose == models.FilePurposeAttachment {
+		record.ScanStatus = models.FileScanPending
+	}
+	if err := s.files.Create(record, s.quotaCheck); err != nil {
+		cleanup()
+		if errors.Is(err, ErrStorageQuotaExceeded) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to record file: %w", err)
+	}
+	if record.ScanStatus == models.FileScanPending {
+		file := *record
+		go func() {
+			if err := s.ScanFile(context.Background(), &file); err != nil {
+				log.Printf("Failed to scan file %s, will retry: %v", file.ID, err)
+			}
+		}()
 	}
-	dir := filepath.Join(s.uploadDir, "logos", clientID)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create upload directory: %w", err)
+	return record, nil
+}
+
+// LinkAttachments makes the entity the owner of the uploaded files among its attachments and
+// releases files it no longer references, with their previous versions. It returns the attachments
+// with FileID and Versions set for uploads.
+// Files owned by another entity are referenced but not taken over. Files new to the entity count
+// against the storage quota of clientID (the entity's client, nil for none), whichever client they
+// were uploaded for; ErrStorageQuotaExceeded is returned when they do not fit.
+func (s *FileService) LinkAttachments(ownerType string, ownerID uuid.UUID, clientID *uuid.UUID, attachments []models.Attachment) ([]models.Attachment, error) {
+	urls := make([]string, len(attachments))
+	for i, att := range attachments {
+		urls[i] = att.URL
 	}
-	file, err := fileHeader.Open()
+	files, err := s.link(ownerType, ownerID, clientID, urls)
 	if err != nil {
-		return "", fmt.Errorf("failed to open file: %w", err)
+		return nil, err
+	}
+	for i := range attachments {
+		attachments[i].FileID = nil
+		attachments[i].Versions = 0
+		if files[i] != nil {
+			attachments[i].FileID = &files[i].ID
+			attachments[i].Versions = files[i].Version
+		}
+	}
+	return attachments, nil
+}
+
+// LinkFileURL makes the entity the owner of the uploaded file at fileURL (an avatar or logo),
+// releasing the one it replaces. A nil or external URL only releases the previous file.
+func (s *FileService) LinkFileURL(ownerType string, ownerID uuid.UUID, fileURL *string) {
+	var urls []string
+	if fileURL != nil {
+		urls = append(urls, *fileURL)
+	}
+	s.link(ownerType, ownerID, nil, urls)
+}
+
+// link resolves file URLs to recorded files and makes them the entity's files. The result has one
+// entry per URL, nil for external links and unknown files. Files are matched by URL rather than by
+// a client-supplied ID, so a file cannot be claimed without knowing its link. Only an exceeded
+// quota is returned; other errors are logged, as the sweeper checks references again before
+// deleting anything.
+func (s *FileService) link(ownerType string, ownerID uuid.UUID, clientID *uuid.UUID, urls []string) ([]*models.File, error) {
+	result := make([]*models.File, len(urls))
+	var keys []string
+	urlKeys := make([]string, len(urls))
+	for i, fileURL := range urls {
+		if u, err := url.Parse(fileURL); err == nil {
+			if key, ok := storedFilePath(u.Path); ok {
+				urlKeys[i] = key
+				keys = append(keys, key)
+			}
+		}
 	}
-	defer file.Close()
-	ext := filepath.Ext(fileHeader.Filename)
-	uniqueName := generateUniqueFilename(ext)
-	filePath := filepath.Join(dir, uniqueName)
-	dst, err := os.Create(filePath)
+
+	files, err := s.files.GetByKeys(keys)
 	if err != nil {
-		return "", fmt.Errorf("failed to create file: %w", err)
+		log.Printf("Failed to load files of %s %s: %v", ownerType, ownerID, err)
+		return result, nil
+	}
+	byKey := make(map[string]*models.File, len(files))
+	for i := range files {
+		byKey[files[i].Key] = &files[i]
+	}
+
+	var linked []uuid.UUID
+	for i := range urls {
+		if file := byKey[urlKeys[i]]; urlKeys[i] != "" && file != nil {
+			result[i] = file
+			linked = append(linked, file.ID)
+		}
+	}
+	if err := s.files.Link(ownerType, ownerID, linked, clientID, s.quotaCheck); err != nil {
+		if errors.Is(err, ErrStorageQuotaExceeded) {
+			return nil, err
+		}
+		log.Printf("Failed to link files to %s %s: %v", ownerType, ownerID, err)
+		return result, nil
 	}
-	defer dst.Close()
-	if _, err := io.Copy(dst, file); err != nil {
-		return "", fmt.Errorf("failed to save file: %w", err)
+	if err := s.files.Release(ownerType, ownerID, linked, time.Now()); err != nil {
+		log.Printf("Failed to release files of %s %s: %v", ownerType, ownerID, err)
 	}
-	return filepath.ToSlash(filepath.Join(s.uploadDir, "logos", clientID, uniqueName)), nil
+	return result, nil
 }
 
-// DeleteFile deletes a file from the upload directory
-func (s *FileService) DeleteFile(filePath string) error {
-	// Ensure the file is within the upload directory for security
-	if !strings.HasPrefix(filePath, s.uploadDir) {
-		return fmt.Errorf("invalid file path: %s", filePath)
+// Sweep deletes files that have had no owner for longer than grace. Files whose owner was deleted
+// are released first, so their grace period starts now. A file that a live entity still mentions
+// (e.g. saved before it was recorded) is kept and its grace period restarted.
+func (s *FileService) Sweep(ctx context.Context, grace time.Duration) (int, error) {
+	now := time.Now()
+	if _, err := s.files.ReleaseDeletedOwners(now); err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	cutoff := now.Add(-grace)
+	for {
+		files, err := s.files.ListUnowned(cutoff, sweepBatchSize)
+		if err != nil {
+			return deleted, err
+		}
+		for i := range files {
+			file := &files[i]
+			referenced, err := s.files.IsReferenced(file.Key)
+			if err != nil {
+				return deleted, err
+			}
+			if referenced {
+				if err := s.files.Detach(file.ID, now); err != nil {
+					return deleted, err
+				}
+				continue
+			}
+			keys := []string{file.Key}
+			for _, thumbKey := range file.GetThumbnails() {
+				keys = append(keys, thumbKey)
+			}
+			if file.ScanStatus == models.FileScanInfected {
+				for i := range keys {
+					keys[i] = path.Join(QuarantineDir, keys[i])
+				}
+			}
+			for _, key := range keys {
+				if err := s.storage.Delete(ctx, key); err != nil {
+					return deleted, err
+				}
+			}
+			if err := s.files.Delete(file.ID); err != nil {
+				return deleted, err
+			}
+			deleted++
+		}
+		if len(files) < sweepBatchSize {
+			return deleted, nil
+		}
 	}
+}
 
-	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to delete file: %w", err)
+// ScanFile scans a stored file for viruses and records the result. Infected files and their previews
+// are moved under QuarantineDir, and files over the scanner's size limit are marked too_large. If the
+// scanner fails otherwise the file stays pending and the error is returned.
+func (s *FileService) ScanFile(ctx context.Context, file *models.File) error {
+	if s.scanner == nil {
+		return ErrScannerUnavailable
 	}
+	s.scanSlots <- struct{}{}
+	defer func() { <-s.scanSlots }()
 
+	stored, err := s.storage.Open(ctx, file.Key)
+	if err != nil {
+		return err
+	}
+	result, err := s.scanner.Scan(ctx, stored)
+	stored.Close()
+	status := models.FileScanClean
+	switch {
+	case errors.Is(err, ErrScanSizeLimit):
+		// Scanning again would fail the same way; the file is never served
+		status = models.FileScanTooLarge
+		result = &ScanResult{}
+		log.Printf("⚠️  File %s (%s) is too large for the virus scanner and will not be served: %v", file.ID, file.Key, err)
+	case err != nil:
+		return err
+	case result.Infected:
+		status = models.FileScanInfected
+		log.Printf("⚠️  File %s (%s) uploaded by %s is infected with %s, quarantining it", file.ID, file.Key, file.UploadedBy, result.Signature)
+		if err := s.quarantine(ctx, file); err != nil {
+			return fmt.Errorf("failed to quarantine file: %w", err)
+		}
+	}
+	if err := s.files.SetScanStatus(file.ID, status, result.Signature, time.Now()); err != nil {
+		return err
+	}
+	file.ScanStatus = status
+	file.ScanSignature = result.Signature
+	s.scanStatuses.Store(file.ID, status)
 	return nil
 }
 
-// GetFilePath returns the full path to a file
-func (s *FileService) GetFilePath(relativePath string) string {
-	return filepath.Join(s.uploadDir, relativePath)
+// quarantine moves a file and its previews under QuarantineDir, keeping their keys.
+func (s *FileService) quarantine(ctx context.Context, file *models.File) error {
+	keys := []string{file.Key}
+	for _, thumbKey := range file.GetThumbnails() {
+		keys = append(keys, thumbKey)
+	}
+	for _, key := range keys {
+		src, err := s.storage.Open(ctx, key)
+		if errors.Is(err, ErrFileNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		err = s.storage.Put(ctx, path.Join(QuarantineDir, key), src, src.Size, src.ContentType)
+		src.Close()
+		if err != nil {
+			return err
+		}
+		if err := s.storage.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RescanPending scans files that are still pending after olderThan, e.g. because the scanner was
+// unavailable when they were uploaded. Files that fail to scan are logged and stay pending for the
+// next run; the others are still scanned.
+func (s *FileService) RescanPending(ctx context.Context, olderThan time.Duration) (int, error) {
+	if s.scanner == nil {
+		return 0, nil
+	}
+	files, err := s.files.ListPendingScan(time.Now().Add(-olderThan), sweepBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	scanned := 0
+	for i := range files {
+		if err := s.ScanFile(ctx, &files[i]); err != nil {
+			log.Printf("Failed to scan file %s, will retry: %v", files[i].ID, err)
+			continue
+		}
+		scanned++
+	}
+	return scanned, nil
+}
+
+// ScanStatuses returns the scan status of files by ID, for attachments in responses. Final
+// statuses are cached, so only pending files are looked up again.
+func (s *FileService) ScanStatuses(ids []uuid.UUID) map[uuid.UUID]string {
+	statuses := make(map[uuid.UUID]string, len(ids))
+	var missing []uuid.UUID
+	for _, id := range ids {
+		if status, ok := s.scanStatuses.Load(id); ok {
+			statuses[id] = status.(string)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return statuses
+	}
+	loaded, err := s.files.GetScanStatuses(missing)
+	if err != nil {
+		log.Printf("Failed to load file scan statuses: %v", err)
+		return statuses
+	}
+	for id, status := range loaded {
+		statuses[id] = status
+		if status != models.FileScanPending {
+			s.scanStatuses.Store(id, status)
+		}
+	}
+	return statuses
+}
+
+// StartSweeper runs Sweep every interval in the background, after retrying pending virus scans.
+func (s *FileService) StartSweeper(interval, grace time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			if scanned, err := s.RescanPending(context.Background(), interval); err != nil {
+				log.Printf("Failed to scan pending files: %v", err)
+			} else if scanned > 0 {
+				log.Printf("Scanned %d pending files", scanned)
+			}
+			deleted, err := s.Sweep(context.Background(), grace)
+			if err != nil {
+				log.Printf("File sweeper failed: %v", err)
+			}
+			if deleted > 0 {
+				log.Printf("File sweeper deleted %d unreferenced files", deleted)
+			}
+		}
+	}()
+}
+
+// DeleteFile deletes a file given its public path ("uploads/...")
+func (s *FileService) DeleteFile(filePath string) error {
+	return s.storage.Delete(context.Background(), FileKey(filePath))
+}
+
+// OpenFile opens a file given its public path ("uploads/..." or the key itself) for serving.
+// Files that are not clean are refused with ErrFileScanPending, ErrFileInfected or ErrFileNotScanned,
+// and so are their previews, which show the same content. Quarantined files are never served.
+func (s *FileService) OpenFile(ctx context.Context, filePath string) (*StoredFile, error) {
+	key := FileKey(filePath)
+	if key == QuarantineDir || strings.HasPrefix(key, QuarantineDir+"/") {
+		return nil, ErrFileNotFound
+	}
+	files, err := s.files.GetServed(key)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		switch file.ScanStatus {
+		case models.FileScanPending:
+			return nil, ErrFileScanPending
+		case models.FileScanInfected:
+			return nil, ErrFileInfected
+		case models.FileScanTooLarge:
+			return nil, ErrFileNotScanned
+		}
+	}
+	return s.storage.Open(ctx, key)
+}
+
+// FileKey converts a public file path ("uploads/...") to its storage key.
+func FileKey(filePath string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(filePath, "/"), UploadDir+"/")
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
 }
 
 // generateUniqueFilename generates a unique filename with the given extension
@@ -0,0 +1,341 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mellon-harmony-api/internal/models"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func newTestFileService(t *testing.T, scanner Scanner, clients ...*models.Client) (*FileService, *LocalStorage, *memoryFileRepository) {
+	t.Helper()
+	storage, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := newMemoryFileRepository(clients...)
+	return NewFileService(storage, files, scanner, UploadLimits{}), storage, files
+}
+
+// textUpload is a .txt attachment with the given contents.
+func textUpload(name, content string) Upload {
+	return Upload{Name: name, Size: int64(len(content)), Body: strings.NewReader(content)}
+}
+
+// readStored returns the contents stored under key, or "" if there are none.
+func readStored(t *testing.T, storage Storage, key string) string {
+	t.Helper()
+	file, err := storage.Open(context.Background(), key)
+	if errors.Is(err, ErrFileNotFound) {
+		return ""
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	data, _ := io.ReadAll(file)
+	return string(data)
+}
+
+func TestUploadLimitsFor(t *testing.T) {
+	limits := UploadLimits{Attachment: 100, Avatar: 10}
+	tests := []struct {
+		purpose string
+		want    int64
+	}{
+		{"", 100},
+		{models.FilePurposeAttachment, 100},
+		{models.FilePurposeAvatar, 10},
+		{models.FilePurposeClientLogo, DefaultMaxFileSize},
+	}
+	for _, tt := range tests {
+		if got := limits.For(tt.purpose); got != tt.want {
+			t.Errorf("For(%q) = %d, want %d", tt.purpose, got, tt.want)
+		}
+	}
+}
+
+func TestSafeFolderName(t *testing.T) {
+	id := uuid.New().String()
+	tests := []struct {
+		id   string
+		want string
+	}{
+		{id, id},
+		{" " + id + " ", id},
+		{strings.ToUpper(id), strings.ToUpper(id)},
+		{"", UnclassifiedFolder},
+		{"../avatars", UnclassifiedFolder},
+		{"a/b", UnclassifiedFolder},
+		{"client name", UnclassifiedFolder},
+	}
+	for _, tt := range tests {
+		if got := safeFolderName(tt.id); got != tt.want {
+			t.Errorf("safeFolderName(%q) = %q, want %q", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestFileKey(t *testing.T) {
+	for _, filePath := range []string{"uploads/c1/a.txt", "/uploads/c1/a.txt", "c1/a.txt"} {
+		if got := FileKey(filePath); got != "c1/a.txt" {
+			t.Errorf("FileKey(%q) = %q, want c1/a.txt", filePath, got)
+		}
+	}
+}
+
+func TestFileServiceCheckUpload(t *testing.T) {
+	s, _, _ := newTestFileService(t, nil)
+	userID := uuid.New().String()
+	tests := []struct {
+		name    string
+		file    string
+		size    int64
+		opts    UploadOptions
+		wantErr error
+	}{
+		{"attachment", "notes.txt", 10, UploadOptions{}, nil},
+		{"attachment, upper case extension", "REPORT.PDF", 10, UploadOptions{Purpose: models.FilePurposeAttachment}, nil},
+		{"attachment type not allowed", "setup.exe", 10, UploadOptions{}, ErrFileTypeNotAllowed},
+		{"attachment too large", "notes.txt", DefaultMaxFileSize + 1, UploadOptions{}, ErrFileTooLarge},
+		{"avatar", "me.png", 10, UploadOptions{Purpose: models.FilePurposeAvatar, UserID: userID}, nil},
+		{"avatar without user", "me.png", 10, UploadOptions{Purpose: models.FilePurposeAvatar}, ErrInvalidUpload},
+		{"logo with invalid client", "logo.png", 10, UploadOptions{Purpose: models.FilePurposeClientLogo, ClientID: "../x"}, ErrInvalidUpload},
+		{"unknown purpose", "notes.txt", 10, UploadOptions{Purpose: "backup"}, ErrInvalidUpload},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.CheckUpload(tt.file, tt.size, tt.opts); !errors.Is(err, tt.wantErr) {
+				t.Errorf("CheckUpload = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFileServiceSaveFile(t *testing.T) {
+	s, storage, files := newTestFileService(t, nil)
+	uploader := uuid.New()
+	clientID, projectID := uuid.New(), uuid.New()
+	content := "meeting notes"
+
+	record, err := s.SaveFile(textUpload("notes.txt", content), uploader, clientID.String(), projectID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantDir := path.Join(clientID.String(), projectID.String(), "files")
+	if path.Dir(record.Key) != wantDir || path.Ext(record.Key) != ".txt" {
+		t.Errorf("key = %q, want a .txt file in %s", record.Key, wantDir)
+	}
+	sum := sha256.Sum256([]byte(content))
+	stored := files.get(record.ID)
+	if stored == nil || stored.Name != "notes.txt" || stored.Size != int64(len(content)) || stored.Checksum != hex.EncodeToString(sum[:]) ||
+		stored.UploadedBy != uploader || *stored.ClientID != clientID || *stored.ProjectID != projectID || stored.Version != 1 {
+		t.Errorf("recorded %+v", stored)
+	}
+	if stored.OwnerID != nil || stored.ScanStatus != models.FileScanClean {
+		t.Errorf("a new upload without a scanner should be clean and unowned: %+v", stored)
+	}
+	if got := readStored(t, storage, record.Key); got != content {
+		t.Errorf("stored %q, want %q", got, content)
+	}
+
+	// Invalid folders fall back to the general folder
+	record, err = s.SaveFile(textUpload("notes.txt", content), uploader, "../../etc", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(record.Key, "general/general/files/") || record.ClientID != nil {
+		t.Errorf("key = %q, client %v; want the general folder", record.Key, record.ClientID)
+	}
+}
+
+func TestFileServiceSaveFileIncomplete(t *testing.T) {
+	s, storage, files := newTestFileService(t, nil)
+	// The client announced more bytes than it sent
+	upload := Upload{Name: "notes.txt", Size: 100, Body: strings.NewReader("only a part")}
+	if _, err := s.SaveFile(upload, uuid.New(), "", ""); err == nil {
+		t.Fatal("an incomplete upload should fail")
+	}
+	if len(files.files) != 0 {
+		t.Errorf("recorded %d files, want none", len(files.files))
+	}
+	storage.Walk(func(key string) error {
+		t.Errorf("left %s in storage", key)
+		return nil
+	})
+}
+
+func TestFileServiceLinkAttachments(t *testing.T) {
+	s, _, files := newTestFileService(t, nil)
+	uploader := uuid.New()
+	first, _ := s.SaveFile(textUpload("a.txt", "a"), uploader, "", "")
+	second, _ := s.SaveFile(textUpload("b.txt", "b"), uploader, "", "")
+	issueID := uuid.New()
+
+	attachments, err := s.LinkAttachments(models.FileOwnerIssue, issueID, nil, []models.Attachment{
+		{URL: "http://api.test/api/v1/files/" + first.Path()},
+		{URL: second.Path()},
+		{URL: "https://example.com/" + first.Path()[len("uploads/"):]},
+		{URL: "uploads/unknown/file.txt"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attachments[0].FileID == nil || *attachments[0].FileID != first.ID || attachments[1].FileID == nil || *attachments[1].FileID != second.ID {
+		t.Errorf("uploads not resolved: %+v", attachments)
+	}
+	if attachments[2].FileID != nil || attachments[3].FileID != nil {
+		t.Errorf("external link or unknown file resolved: %+v", attachments[2:])
+	}
+	for _, file := range []*models.File{first, second} {
+		if stored := files.get(file.ID); stored.OwnerID == nil || *stored.OwnerID != issueID || stored.OwnerType != models.FileOwnerIssue {
+			t.Errorf("file %s owned by %s %v, want the issue", file.Key, stored.OwnerType, stored.OwnerID)
+		}
+	}
+
+	// Another entity referencing the same upload does not take it over
+	if _, err := s.LinkAttachments(models.FileOwnerComment, uuid.New(), nil, []models.Attachment{{URL: first.Path()}}); err != nil {
+		t.Fatal(err)
+	}
+	if stored := files.get(first.ID); *stored.OwnerID != issueID {
+		t.Errorf("file taken over by %s", stored.OwnerType)
+	}
+
+	// Files the issue no longer references are released
+	if _, err := s.LinkAttachments(models.FileOwnerIssue, issueID, nil, []models.Attachment{{URL: second.Path()}}); err != nil {
+		t.Fatal(err)
+	}
+	if stored := files.get(first.ID); stored.OwnerID != nil || stored.DetachedAt == nil {
+		t.Errorf("removed attachment not released: %+v", stored)
+	}
+	if stored := files.get(second.ID); stored.OwnerID == nil {
+		t.Error("kept attachment released")
+	}
+}
+
+func TestFileServiceLinkFileURL(t *testing.T) {
+	s, _, files := newTestFileService(t, nil)
+	userID := uuid.New()
+	old, _ := s.SaveFile(textUpload("a.txt", "a"), userID, "", "")
+	replacement, _ := s.SaveFile(textUpload("b.txt", "b"), userID, "", "")
+
+	oldURL, newURL := old.Path(), replacement.Path()
+	s.LinkFileURL(models.FileOwnerUser, userID, &oldURL)
+	s.LinkFileURL(models.FileOwnerUser, userID, &newURL)
+	if files.get(old.ID).OwnerID != nil || files.get(replacement.ID).OwnerID == nil {
+		t.Error("replacing the avatar should release the previous one")
+	}
+	s.LinkFileURL(models.FileOwnerUser, userID, nil)
+	if files.get(replacement.ID).OwnerID != nil {
+		t.Error("removing the avatar should release it")
+	}
+}
+
+func TestFileServiceSweep(t *testing.T) {
+	s, storage, files := newTestFileService(t, nil)
+	ctx := context.Background()
+	uploader := uuid.New()
+	grace := time.Hour
+	old := time.Now().Add(-2 * grace)
+
+	save := func(name string) *models.File {
+		record, err := s.SaveFile(textUpload(name, name), uploader, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		files.files[record.ID].CreatedAt = old
+		return record
+	}
+	expired := save("expired.txt")
+	recent, _ := s.SaveFile(textUpload("recent.txt", "recent"), uploader, "", "")
+	owned := save("owned.txt")
+	ownerDeleted := save("owner-deleted.txt")
+	mentioned := save("mentioned.txt")
+	infected := save("infected.txt")
+
+	s.LinkAttachments(models.FileOwnerIssue, uuid.New(), nil, []models.Attachment{{URL: owned.Path()}})
+	deletedIssue := uuid.New()
+	s.LinkAttachments(models.FileOwnerIssue, deletedIssue, nil, []models.Attachment{{URL: ownerDeleted.Path()}})
+	files.deletedOwners[deletedIssue] = true
+	files.referenced[`[{"url":"`+mentioned.Path()+`"}]`] = true
+	if err := s.quarantine(ctx, infected); err != nil {
+		t.Fatal(err)
+	}
+	files.files[infected.ID].ScanStatus = models.FileScanInfected
+
+	deleted, err := s.Sweep(ctx, grace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 2 {
+		t.Errorf("Sweep deleted %d files, want 2", deleted)
+	}
+	for _, file := range []*models.File{expired, infected} {
+		if files.get(file.ID) != nil {
+			t.Errorf("%s still recorded", file.Name)
+		}
+	}
+	if readStored(t, storage, expired.Key) != "" || readStored(t, storage, path.Join(QuarantineDir, infected.Key)) != "" {
+		t.Error("swept files left in storage")
+	}
+	for _, file := range []*models.File{recent, owned, ownerDeleted, mentioned} {
+		if files.get(file.ID) == nil || readStored(t, storage, file.Key) == "" {
+			t.Errorf("%s was swept", file.Name)
+		}
+	}
+	// The grace period of a file whose owner was deleted, or that is still mentioned, starts again
+	for _, file := range []*models.File{ownerDeleted, mentioned} {
+		if stored := files.get(file.ID); stored.OwnerID != nil || stored.DetachedAt == nil || stored.DetachedAt.Before(old) {
+			t.Errorf("%s: owner %v, detached at %v; want released now", file.Name, stored.OwnerID, stored.DetachedAt)
+		}
+	}
+}
+
+func TestFileServiceOpenFile(t *testing.T) {
+	s, storage, files := newTestFileService(t, nil)
+	ctx := context.Background()
+	statuses := []string{models.FileScanClean, models.FileScanPending, models.FileScanInfected}
+	records := map[string]*models.File{}
+	for _, status := range statuses {
+		record, _ := s.SaveFile(textUpload(status+".txt", status), uuid.New(), "", "")
+		files.files[record.ID].ScanStatus = status
+		// A preview shows the same content as its file
+		files.files[record.ID].SetThumbnails(map[string]string{"200": record.Key + "_200.jpg"})
+		storage.Put(ctx, record.Key+"_200.jpg", strings.NewReader("preview"), 7, "image/jpeg")
+		records[status] = record
+	}
+	storage.Put(ctx, path.Join(QuarantineDir, "x.txt"), strings.NewReader("x"), 1, "")
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr error
+	}{
+		{"clean", records[models.FileScanClean].Path(), nil},
+		{"preview of clean", records[models.FileScanClean].Key + "_200.jpg", nil},
+		{"pending", records[models.FileScanPending].Path(), ErrFileScanPending},
+		{"preview of pending", records[models.FileScanPending].Key + "_200.jpg", ErrFileScanPending},
+		{"infected", records[models.FileScanInfected].Path(), ErrFileInfected},
+		{"quarantine", "uploads/" + QuarantineDir + "/x.txt", ErrFileNotFound},
+		{"missing", "uploads/general/general/files/missing.txt", ErrFileNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := s.OpenFile(ctx, tt.path)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("OpenFile(%q) = %v, want %v", tt.path, err, tt.wantErr)
+			}
+			if file != nil {
+				file.Close()
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"mellon-harmony-api/internal/models"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultFileURLTTL = time.Hour
+
+// publicImageFolders hold avatars and client logos (see FileService), which can be left public.
+var publicImageFolders = []string{"avatars/", "logos/"}
+
+// FileURLSigner signs URLs of uploaded files with an HMAC and an expiry, and checks them when the
+// file is requested. URLs are stored unsigned; a signature is added each time one is sent to a client.
+type FileURLSigner struct {
+	secret       []byte
+	ttl          time.Duration
+	publicImages bool
+}
+
+// NewFileURLSigner creates a signer. With publicImages, avatars and logos are served without a signature.
+func NewFileURLSigner(secret string, ttl time.Duration, publicImages bool) *FileURLSigner {
+	if ttl <= 0 {
+		ttl = defaultFileURLTTL
+	}
+	key := sha256.Sum256([]byte("file-urls:" + secret))
+	return &FileURLSigner{
+		secret:       key[:],
+		ttl:          ttl,
+		publicImages: publicImages,
+	}
+}
+
+// SignURL adds expires and signature parameters to a stored file URL (".../files/uploads/..." or a
+// bare "uploads/..." path). Other URLs, such as external links, and public images are returned unchanged.
+func (s *FileURLSigner) SignURL(fileURL string) string {
+	u, err := url.Parse(fileURL)
+	if err != nil {
+		return fileURL
+	}
+	path, ok := storedFilePath(u.Path)
+	if !ok {
+		return fileURL
+	}
+	query := u.Query()
+	query.Del(models.FileURLExpiresParam)
+	query.Del(models.FileURLSignatureParam)
+	if !s.IsPublic(path) {
+		expires := s.expiry(time.Now())
+		query.Set(models.FileURLExpiresParam, strconv.FormatInt(expires, 10))
+		query.Set(models.FileURLSignatureParam, s.signature(path, expires))
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// Verify reports whether signature is valid for path (as requested from /files) and not expired.
+func (s *FileURLSigner) Verify(path, expires, signature string) bool {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(s.signature(canonicalFilePath(path), exp)))
+}
+
+// IsPublic reports whether path may be served without a signature.
+func (s *FileURLSigner) IsPublic(path string) bool {
+	if !s.publicImages {
+		return false
+	}
+	path = canonicalFilePath(path)
+	for _, folder := range publicImageFolders {
+		if strings.HasPrefix(path, folder) {
+			return true
+		}
+	}
+	return false
+}
+
+// expiry rounds the expiry up to a quarter of the TTL, so a file keeps the same URL for a while
+// and browsers can cache it.
+func (s *FileURLSigner) expiry(now time.Time) int64 {
+	step := int64(s.ttl / time.Second / 4)
+	if step < 1 {
+		step = 1
+	}
+	exp := now.Add(s.ttl).Unix()
+	return (exp/step + 1) * step
+}
+
+func (s *FileURLSigner) signature(path string, expires int64) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(path + "\n" + strconv.FormatInt(expires, 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// storedFilePath extracts the path of an uploaded file ("uploads/...") from a stored URL path,
+// either behind the /files route or bare.
+func storedFilePath(urlPath string) (string, bool) {
+	// Bare paths contain "/files/" too (uploads/{client}/{project}/files/...)
+	if i := strings.Index(urlPath, "/files/uploads/"); i >= 0 {
+		urlPath = urlPath[i+len("/files/"):]
+	}
+	urlPath = strings.TrimPrefix(urlPath, "/")
+	if !strings.HasPrefix(urlPath, "uploads/") {
+		return "", false
+	}
+	return canonicalFilePath(urlPath), true
+}
+
+// canonicalFilePath is the path relative to the upload directory, as resolved by the file handler.
+func canonicalFilePath(path string) string {
+	path = strings.TrimPrefix(path, "/")
+	return strings.TrimPrefix(path, "uploads/")
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"mellon-harmony-api/internal/models"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestFileURLSignerSignURL(t *testing.T) {
+	tests := []struct {
+		name         string
+		publicImages bool
+		url          string
+		wantSigned   bool
+		wantPath     string // path the file handler verifies, when signed
+	}{
+		{"served file", false, "http://api.test/api/v1/files/uploads/c1/p1/files/report.pdf", true, "c1/p1/files/report.pdf"},
+		{"bare path", false, "uploads/c1/p1/files/report.pdf", true, "c1/p1/files/report.pdf"},
+		{"external link", false, "https://example.com/report.pdf", false, ""},
+		{"avatar, private images", false, "http://api.test/api/v1/files/uploads/avatars/u1/me.png", true, "avatars/u1/me.png"},
+		{"avatar, public images", true, "http://api.test/api/v1/files/uploads/avatars/u1/me.png", false, ""},
+		{"logo, public images", true, "uploads/logos/c1/logo.png", false, ""},
+		{"attachment, public images", true, "uploads/c1/p1/images/shot.png", true, "c1/p1/images/shot.png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer := NewFileURLSigner("secret", time.Hour, tt.publicImages)
+			signed := signer.SignURL(tt.url)
+			u, err := url.Parse(signed)
+			if err != nil {
+				t.Fatalf("SignURL(%q) = %q, not a URL: %v", tt.url, signed, err)
+			}
+			expires, signature := u.Query().Get(models.FileURLExpiresParam), u.Query().Get(models.FileURLSignatureParam)
+			if !tt.wantSigned {
+				if signature != "" || expires != "" {
+					t.Fatalf("SignURL(%q) = %q, want it unsigned", tt.url, signed)
+				}
+				return
+			}
+			if !signer.Verify(tt.wantPath, expires, signature) {
+				t.Fatalf("Verify(%q) rejected the signature of %q", tt.wantPath, signed)
+			}
+			if models.StripFileURLSignature(signed) != tt.url {
+				t.Errorf("StripFileURLSignature(%q) = %q, want %q", signed, models.StripFileURLSignature(signed), tt.url)
+			}
+		})
+	}
+}
+
+func TestFileURLSignerResignsSignedURL(t *testing.T) {
+	signer := NewFileURLSigner("secret", time.Hour, false)
+	stale := "uploads/c1/p1/files/report.pdf?expires=1&signature=old&v=2"
+	u, _ := url.Parse(signer.SignURL(stale))
+	q := u.Query()
+	if got := q[models.FileURLSignatureParam]; len(got) != 1 || got[0] == "old" {
+		t.Fatalf("signature = %v, want one fresh signature", got)
+	}
+	if q.Get("v") != "2" {
+		t.Errorf("other query parameters were dropped: %q", u.RawQuery)
+	}
+	if !signer.Verify("c1/p1/files/report.pdf", q.Get(models.FileURLExpiresParam), q.Get(models.FileURLSignatureParam)) {
+		t.Error("Verify rejected the new signature")
+	}
+}
+
+func TestFileURLSignerVerify(t *testing.T) {
+	signer := NewFileURLSigner("secret", time.Hour, false)
+	path := "c1/p1/files/report.pdf"
+	future := time.Now().Add(time.Hour).Unix()
+	valid := signer.signature(path, future)
+	past := time.Now().Add(-time.Minute).Unix()
+
+	tests := []struct {
+		name      string
+		signer    *FileURLSigner
+		path      string
+		expires   string
+		signature string
+		want      bool
+	}{
+		{"valid", signer, path, strconv.FormatInt(future, 10), valid, true},
+		{"uploads prefix", signer, "uploads/" + path, strconv.FormatInt(future, 10), valid, true},
+		{"other file", signer, "c1/p1/files/other.pdf", strconv.FormatInt(future, 10), valid, false},
+		{"extended expiry", signer, path, strconv.FormatInt(future+1, 10), valid, false},
+		{"expired", signer, path, strconv.FormatInt(past, 10), signer.signature(path, past), false},
+		{"malformed expiry", signer, path, "soon", valid, false},
+		{"missing signature", signer, path, strconv.FormatInt(future, 10), "", false},
+		{"other secret", NewFileURLSigner("other", time.Hour, false), path, strconv.FormatInt(future, 10), valid, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.signer.Verify(tt.path, tt.expires, tt.signature); got != tt.want {
+				t.Errorf("Verify(%q, %q, %q) = %v, want %v", tt.path, tt.expires, tt.signature, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileURLSignerExpiry(t *testing.T) {
+	tests := []struct {
+		ttl time.Duration
+	}{
+		{time.Hour},
+		{10 * time.Minute},
+		{2 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ttl.String(), func(t *testing.T) {
+			signer := NewFileURLSigner("secret", tt.ttl, false)
+			now := time.Now()
+			exp := signer.expiry(now)
+			if min := now.Add(tt.ttl).Unix(); exp <= min || exp > min+int64(tt.ttl/time.Second) {
+				t.Errorf("expiry = %d, want after %d and within a TTL of it", exp, min)
+			}
+			// Nearby signatures share the expiry, so a file keeps its URL and can be cached
+			if step := int64(tt.ttl / time.Second / 4); step > 1 && exp%step != 0 {
+				t.Errorf("expiry %d is not a multiple of %d", exp, step)
+			}
+		})
+	}
+	if got := NewFileURLSigner("secret", 0, false).ttl; got != defaultFileURLTTL {
+		t.Errorf("ttl = %s for a zero TTL, want the default %s", got, defaultFileURLTTL)
+	}
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mellon-harmony-api/internal/models"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrAttachmentNotFound is returned for files that are not uploaded attachments of the issue, and for
+// versions that do not belong to the attachment.
+var ErrAttachmentNotFound = errors.New("attachment not found")
+
+// FileVersions returns the versions of the attachment a file belongs to, latest first.
+func (s *FileService) FileVersions(id uuid.UUID) ([]models.File, error) {
+	file, err := s.files.GetByID(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.files.ListVersions(file.FirstVersionID())
+}
+
+// nextVersion prepares the record of a new version of an attachment, filed and owned like its
+// latest version.
+func nextVersion(latest *models.File, uploadedBy uuid.UUID) *models.File {
+	first := latest.FirstVersionID()
+	return &models.File{
+		Purpose:    models.FilePurposeAttachment,
+		UploadedBy: uploadedBy,
+		ClientID:   latest.ClientID,
+		ProjectID:  latest.ProjectID,
+		OwnerType:  latest.OwnerType,
+		OwnerID:    latest.OwnerID,
+		VersionOf:  &first,
+		Version:    latest.Version + 1,
+	}
+}
+
+// SaveVersion validates and stores an upload as the new version of an attachment, given its latest
+// version. The upload may have another name and type; it is checked like any attachment.
+func (s *FileService) SaveVersion(upload Upload, uploadedBy uuid.UUID, latest *models.File) (*models.File, error) {
+	if latest.Purpose != models.FilePurposeAttachment {
+		return nil, fmt.Errorf("%w: only attachments have versions", ErrInvalidUpload)
+	}
+	if !IsAllowedAttachmentExt(filepath.Ext(upload.Name)) {
+		return nil, ErrFileTypeNotAllowed
+	}
+	return s.saveAttachment(upload, nextVersion(latest, uploadedBy))
+}
+
+// RestoreVersion copies a previous version of an attachment, with its previews, as the new latest
+// version so no history is lost. Versions that are not clean cannot be restored (ErrFileScanPending,
+// ErrFileInfected, ErrFileNotScanned).
+func (s *FileService) RestoreVersion(ctx context.Context, version, latest *models.File, restoredBy uuid.UUID) (*models.File, error) {
+	clientID := UnclassifiedFolder
+	if latest.ClientID != nil {
+		clientID = latest.ClientID.String()
+	}
+	if err := s.checkClientQuota(clientID, version.Size+version.ThumbnailSize); err != nil {
+		return nil, err
+	}
+
+	src, err := s.OpenFile(ctx, version.Key)
+	if err != nil {
+		return nil, err
+	}
+	ext := path.Ext(version.Key)
+	key := path.Join(path.Dir(version.Key), generateUniqueFilename(ext))
+	err = s.storage.Put(ctx, key, src, src.Size, src.ContentType)
+	src.Close()
+	if err != nil {
+		return nil, err
+	}
+	stored := []string{key}
+	cleanup := func() {
+		for _, k := range stored {
+			s.storage.Delete(ctx, k)
+		}
+	}
+
+	thumbnailKeys := map[string]string{}
+	for size, thumbKey := range version.GetThumbnails() {
+		thumb, err := s.storage.Open(ctx, thumbKey)
+		if errors.Is(err, ErrFileNotFound) {
+			continue
+		}
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+		copyKey := fmt.Sprintf("%s_%s%s", strings.TrimSuffix(key, ext), size, path.Ext(thumbKey))
+		err = s.storage.Put(ctx, copyKey, thumb, thumb.Size, thumb.ContentType)
+		thumb.Close()
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+		stored = append(stored, copyKey)
+		thumbnailKeys[size] = copyKey
+	}
+
+	record := nextVersion(latest, restoredBy)
+	record.Key = key
+	record.Name = version.Name
+	record.ContentType = version.ContentType
+	record.Size = version.Size
+	record.Checksum = version.Checksum
+	record.SetThumbnails(thumbnailKeys)
+	record.ThumbnailSize = version.ThumbnailSize
+	record.ScanStatus = version.ScanStatus
+	record.ScannedAt = version.ScannedAt
+	if err := s.files.Create(record, s.quotaCheck); err != nil {
+		cleanup()
+		if errors.Is(err, ErrStorageQuotaExceeded) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to record file: %w", err)
+	}
+	return record, nil
+}
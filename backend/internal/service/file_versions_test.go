@@ -0,0 +1,198 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"mellon-harmony-api/internal/models"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestNextVersion(t *testing.T) {
+	clientID, projectID, ownerID, uploader := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	first := &models.File{ID: uuid.New(), Purpose: models.FilePurposeAttachment, ClientID: &clientID, ProjectID: &projectID,
+		OwnerType: models.FileOwnerIssue, OwnerID: &ownerID, Version: 1, Name: "brief.pdf", Key: "a/b/files/x.pdf"}
+	second := nextVersion(first, uploader)
+	if *second.VersionOf != first.ID || second.Version != 2 || second.UploadedBy != uploader {
+		t.Errorf("nextVersion of the first = %+v", second)
+	}
+	if *second.ClientID != clientID || *second.ProjectID != projectID || second.OwnerType != models.FileOwnerIssue || *second.OwnerID != ownerID {
+		t.Errorf("nextVersion is not filed and owned like the latest: %+v", second)
+	}
+	if second.Key != "" || second.Name != "" {
+		t.Errorf("nextVersion copied the stored file: %+v", second)
+	}
+	// Later versions still point to the first one
+	second.ID = uuid.New()
+	if third := nextVersion(second, uploader); *third.VersionOf != first.ID || third.Version != 3 {
+		t.Errorf("nextVersion of the second = %+v", third)
+	}
+}
+
+func TestFileServiceSaveVersion(t *testing.T) {
+	s, storage, _ := newTestFileService(t, nil)
+	uploader := uuid.New()
+	first, err := s.SaveFile(textUpload("brief.txt", "first draft"), uploader, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := s.SaveVersion(textUpload("brief-v2.txt", "second draft"), uuid.New(), first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Version != 2 || *second.VersionOf != first.ID || second.Name != "brief-v2.txt" || second.Key == first.Key {
+		t.Errorf("SaveVersion = %+v", second)
+	}
+	if readStored(t, storage, second.Key) != "second draft" || readStored(t, storage, first.Key) != "first draft" {
+		t.Error("versions do not keep their own contents")
+	}
+
+	if _, err := s.SaveVersion(textUpload("brief.exe", "MZ"), uploader, second); !errors.Is(err, ErrFileTypeNotAllowed) {
+		t.Errorf("SaveVersion with a blocked type = %v, want %v", err, ErrFileTypeNotAllowed)
+	}
+	avatar := &models.File{ID: uuid.New(), Purpose: models.FilePurposeAvatar, Version: 1}
+	if _, err := s.SaveVersion(textUpload("me.txt", "x"), uploader, avatar); !errors.Is(err, ErrInvalidUpload) {
+		t.Errorf("SaveVersion of an avatar = %v, want %v", err, ErrInvalidUpload)
+	}
+
+	for _, id := range []uuid.UUID{first.ID, second.ID} {
+		versions, err := s.FileVersions(id)
+		if err != nil || len(versions) != 2 || versions[0].ID != second.ID || versions[1].ID != first.ID {
+			t.Errorf("FileVersions(%s) = %v, %v; want the second then the first", id, versions, err)
+		}
+	}
+	if _, err := s.FileVersions(uuid.New()); !errors.Is(err, ErrAttachmentNotFound) {
+		t.Errorf("FileVersions of an unknown file = %v, want %v", err, ErrAttachmentNotFound)
+	}
+}
+
+func TestFileServiceRestoreVersion(t *testing.T) {
+	client := &models.Client{Name: "Acme"}
+	s, storage, files := newTestFileService(t, nil, client)
+	uploader := uuid.New()
+	data := encodeJPEG(t, testImage(1200, 600, true))
+	first, err := s.SaveFile(Upload{Name: "logo.jpg", Size: int64(len(data)), Body: bytes.NewReader(data)}, uploader, client.ID.String(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := s.SaveVersion(textUpload("logo.txt", "no logo yet"), uploader, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restorer := uuid.New()
+	restored, err := s.RestoreVersion(context.Background(), first, second, restorer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Version != 3 || *restored.VersionOf != first.ID || restored.UploadedBy != restorer || restored.Name != "logo.jpg" || restored.ContentType != first.ContentType {
+		t.Errorf("RestoreVersion = %+v", restored)
+	}
+	if restored.Key == first.Key || readStored(t, storage, restored.Key) != string(data) {
+		t.Errorf("restored version %q is not a copy of %q", restored.Key, first.Key)
+	}
+	thumbnails := first.GetThumbnails()
+	if len(thumbnails) == 0 || len(restored.GetThumbnails()) != len(thumbnails) {
+		t.Fatalf("restored thumbnails %v, want copies of %v", restored.GetThumbnails(), thumbnails)
+	}
+	for size, key := range restored.GetThumbnails() {
+		if key == thumbnails[size] || readStored(t, storage, key) != readStored(t, storage, thumbnails[size]) {
+			t.Errorf("%s thumbnail %q is not a copy of %q", size, key, thumbnails[size])
+		}
+	}
+	// A version can be restored again, from its own record
+	if _, err := s.RestoreVersion(context.Background(), first, restored, restorer); err != nil {
+		t.Fatal(err)
+	}
+	if versions, _ := s.FileVersions(first.ID); len(versions) != 4 {
+		t.Errorf("got %d versions, want 4", len(versions))
+	}
+
+	tests := []struct {
+		name    string
+		prepare func(version *models.File)
+		wantErr error
+	}{
+		{"pending", func(version *models.File) { version.ScanStatus = models.FileScanPending }, ErrFileScanPending},
+		{"infected", func(version *models.File) { version.ScanStatus = models.FileScanInfected }, ErrFileInfected},
+		{"too large to scan", func(version *models.File) { version.ScanStatus = models.FileScanTooLarge }, ErrFileNotScanned},
+		{"over quota", func(version *models.File) { client.StorageQuota = int64Ptr(1) }, ErrStorageQuotaExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client.StorageQuota = nil
+			files.files[second.ID].ScanStatus = models.FileScanClean
+			tt.prepare(files.files[second.ID])
+			before := len(files.files)
+			if _, err := s.RestoreVersion(context.Background(), files.get(second.ID), restored, restorer); !errors.Is(err, tt.wantErr) {
+				t.Errorf("RestoreVersion = %v, want %v", err, tt.wantErr)
+			}
+			if len(files.files) != before {
+				t.Error("a refused restore was recorded")
+			}
+		})
+	}
+}
+
+func TestIssueServiceAttachmentVersions(t *testing.T) {
+	fileService, storage, files := newTestFileService(t, nil)
+	issue := &models.Issue{Title: "Brochure"}
+	issues := newMemoryIssueRepository(issue)
+	s := NewIssueService(issues, nil, nil, nil, nil, fileService, NewAuditService(&memoryAuditRepository{}))
+	uploader := uuid.New()
+
+	first, _ := fileService.SaveFile(textUpload("brochure.txt", "first draft"), uploader, "", "")
+	linked, _ := fileService.SaveFile(textUpload("notes.txt", "notes"), uploader, "", "")
+	data, _ := json.Marshal([]models.Attachment{
+		{Type: "link", URL: "https://example.com/brief"},
+		{Type: "file", URL: "/" + first.Path(), Name: "brochure.txt"},
+	})
+	if _, err := s.UpdateIssue(issue.ID, map[string]interface{}{"attachments": string(data)}, models.AuditMeta{}); err != nil {
+		t.Fatal(err)
+	}
+	// notes.txt belongs to another task; the issue only links to it
+	other := uuid.New()
+	files.Link(models.FileOwnerIssue, other, []uuid.UUID{linked.ID}, nil, nil)
+	current, _ := issues.GetByID(issue.ID)
+
+	if _, err := s.AttachmentVersions(current, linked.ID); !errors.Is(err, ErrAttachmentNotFound) {
+		t.Errorf("versions of another task's file = %v, want %v", err, ErrAttachmentNotFound)
+	}
+	if _, err := s.AttachmentVersions(current, uuid.New()); !errors.Is(err, ErrAttachmentNotFound) {
+		t.Errorf("versions of an unknown file = %v, want %v", err, ErrAttachmentNotFound)
+	}
+
+	updated, err := s.AddAttachmentVersion(current, first.ID, Upload{Name: "brochure.pdf", Size: int64(len(samplePDF)), Body: bytes.NewReader(samplePDF)}, uploader, models.AuditMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	atts := updated.GetAttachments()
+	versions, _ := s.AttachmentVersions(updated, first.ID)
+	if len(versions) != 2 || atts[1].FileID == nil || *atts[1].FileID != versions[0].ID {
+		t.Fatalf("attachment %+v does not refer to the new version of %v", atts[1], versions)
+	}
+	if atts[1].URL != "/"+versions[0].Path() || atts[1].Name != "brochure.pdf" || atts[1].Versions != 2 || atts[0].URL != "https://example.com/brief" {
+		t.Errorf("attachments after a new version = %+v", atts)
+	}
+	if owner := files.get(first.ID).OwnerID; owner == nil || *owner != issue.ID {
+		t.Error("the previous version was released")
+	}
+
+	restored, err := s.RestoreAttachmentVersion(updated, versions[0].ID, first.ID, uploader, models.AuditMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	atts = restored.GetAttachments()
+	latest := files.get(*atts[1].FileID)
+	if latest.Version != 3 || atts[1].Name != "brochure.txt" || !strings.HasSuffix(atts[1].URL, latest.Key) || readStored(t, storage, latest.Key) != "first draft" {
+		t.Errorf("restored attachment %+v, file %+v", atts[1], latest)
+	}
+	if _, err := s.RestoreAttachmentVersion(restored, first.ID, linked.ID, uploader, models.AuditMeta{}); !errors.Is(err, ErrAttachmentNotFound) {
+		t.Errorf("restoring a version of another file = %v, want %v", err, ErrAttachmentNotFound)
+	}
+}
@@ -0,0 +1,305 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+
+	// Decoders for image.Decode and image.DecodeConfig
+	_ "image/gif"
+
+	_ "golang.org/x/image/webp"
+
+	"golang.org/x/image/draw"
+)
+
+// ThumbnailSizes are the sizes (longest side, in pixels) of the previews generated for uploaded images.
+var ThumbnailSizes = []int{200, 800}
+
+// maxImagePixels bounds the decoded size of an uploaded image, so a small file cannot expand
+// into gigabytes of pixels.
+const maxImagePixels = 50_000_000
+
+const (
+	uprightJPEGQuality   = 92
+	thumbnailJPEGQuality = 85
+)
+
+// ErrImageTooLarge is returned for images whose dimensions exceed maxImagePixels.
+var ErrImageTooLarge = errors.New("image dimensions are too large")
+
+// ErrInvalidImage is returned for images that cannot be decoded.
+var ErrInvalidImage = errors.New("image is damaged or in an unsupported format")
+
+// thumbnail is a generated preview of an image.
+type thumbnail struct {
+	data        []byte
+	contentType string
+	ext         string
+}
+
+// processImage removes EXIF, XMP, IPTC and text metadata (location, camera, author) from an image
+// and decodes it for thumbnails. JPEG and PNG metadata is removed without re-encoding, except for
+// JPEGs whose EXIF orientation rotates the picture: those are re-encoded upright, since they would
+// be shown sideways once the orientation tag is gone. GIFs carry no such metadata and are kept as is.
+func processImage(data []byte, contentType string) ([]byte, image.Image, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, ErrInvalidImage
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxImagePixels {
+		return nil, nil, ErrImageTooLarge
+	}
+
+	orientation := 1
+	switch contentType {
+	case contentTypeJPEG:
+		data, orientation, err = stripJPEGMetadata(data)
+	case contentTypePNG:
+		data, err = stripPNGMetadata(data)
+	case contentTypeWebP:
+		data, err = stripWebPMetadata(data)
+	}
+	if err != nil {
+		return nil, nil, ErrInvalidImage
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, ErrInvalidImage
+	}
+	if orientation != 1 {
+		img = orientImage(img, orientation)
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: uprightJPEGQuality}); err != nil {
+			return nil, nil, fmt.Errorf("failed to process image: %w", err)
+		}
+		data = buf.Bytes()
+	}
+	return data, img, nil
+}
+
+// makeThumbnail scales img to fit within size×size, never enlarging it. Opaque images become
+// JPEG; images with transparency stay PNG.
+func makeThumbnail(img image.Image, size int) (*thumbnail, error) {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w > size || h > size {
+		if w >= h {
+			w, h = size, max(1, h*size/w)
+		} else {
+			w, h = max(1, w*size/h), size
+		}
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+
+	var buf bytes.Buffer
+	if dst.Opaque() {
+		if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: thumbnailJPEGQuality}); err != nil {
+			return nil, err
+		}
+		return &thumbnail{data: buf.Bytes(), contentType: contentTypeJPEG, ext: ".jpg"}, nil
+	}
+	if err := png.Encode(&buf, dst); err != nil {
+		return nil, err
+	}
+	return &thumbnail{data: buf.Bytes(), contentType: contentTypePNG, ext: ".png"}, nil
+}
+
+// stripJPEGMetadata drops APP1 (EXIF, XMP), APP13 (IPTC) and comment segments and returns the
+// EXIF orientation (1 when absent). Other segments, including ICC color profiles, are kept.
+func stripJPEGMetadata(data []byte) ([]byte, int, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, 0, ErrInvalidImage
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, 0xFF, 0xD8)
+	orientation := 1
+	i := 2
+	for i < len(data) {
+		if data[i] != 0xFF {
+			return nil, 0, ErrInvalidImage
+		}
+		// Skip fill bytes before the marker
+		for i+1 < len(data) && data[i+1] == 0xFF {
+			i++
+		}
+		if i+1 >= len(data) {
+			return nil, 0, ErrInvalidImage
+		}
+		marker := data[i+1]
+		if marker == 0xD9 || (marker >= 0xD0 && marker <= 0xD7) || marker == 0x01 {
+			out = append(out, data[i:i+2]...)
+			i += 2
+			continue
+		}
+		if i+4 > len(data) {
+			return nil, 0, ErrInvalidImage
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:i+4]))
+		if end > len(data) {
+			return nil, 0, ErrInvalidImage
+		}
+		if marker == 0xDA {
+			// Start of scan: the compressed image data follows up to the end
+			out = append(out, data[i:]...)
+			return out, orientation, nil
+		}
+		switch marker {
+		case 0xE1:
+			if o := exifOrientation(data[i+4 : end]); o != 1 {
+				orientation = o
+			}
+		case 0xED, 0xFE:
+		default:
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+	return out, orientation, nil
+}
+
+// exifOrientation reads the orientation tag (0x0112) of IFD0 from an APP1 payload.
+func exifOrientation(payload []byte) int {
+	if !bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+		return 1
+	}
+	tiff := payload[6:]
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	offset := int64(order.Uint32(tiff[4:8]))
+	if offset+2 > int64(len(tiff)) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[offset:]))
+	for k := 0; k < entries; k++ {
+		entry := offset + 2 + int64(12*k)
+		if entry+12 > int64(len(tiff)) {
+			break
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if value := int(order.Uint16(tiff[entry+8:])); value >= 1 && value <= 8 {
+				return value
+			}
+			break
+		}
+	}
+	return 1
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// pngMetadataChunks are the ancillary PNG chunks that carry metadata rather than pixels or color.
+var pngMetadataChunks = map[string]bool{"eXIf": true, "tEXt": true, "zTXt": true, "iTXt": true, "tIME": true}
+
+func stripPNGMetadata(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, ErrInvalidImage
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, pngSignature...)
+	i := len(pngSignature)
+	for i < len(data) {
+		if i+8 > len(data) {
+			return nil, ErrInvalidImage
+		}
+		end := int64(i) + 12 + int64(binary.BigEndian.Uint32(data[i:i+4]))
+		if end > int64(len(data)) {
+			return nil, ErrInvalidImage
+		}
+		if !pngMetadataChunks[string(data[i+4:i+8])] {
+			out = append(out, data[i:end]...)
+		}
+		if string(data[i+4:i+8]) == "IEND" {
+			break
+		}
+		i = int(end)
+	}
+	return out, nil
+}
+
+// stripWebPMetadata drops the EXIF and XMP chunks of a WebP file and clears their VP8X flags.
+func stripWebPMetadata(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, ErrInvalidImage
+	}
+	out := make([]byte, 12, len(data))
+	copy(out, data[:12])
+	i := 12
+	for i+8 <= len(data) {
+		fourCC := string(data[i : i+4])
+		size := int64(binary.LittleEndian.Uint32(data[i+4 : i+8]))
+		end := int64(i) + 8 + size + size%2
+		if end > int64(len(data)) {
+			end = int64(len(data))
+		}
+		switch fourCC {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			start := len(out)
+			out = append(out, data[i:end]...)
+			if start+8 < len(out) {
+				out[start+8] &^= 0x04 | 0x08 // XMP and EXIF present flags
+			}
+		default:
+			out = append(out, data[i:end]...)
+		}
+		i = int(end)
+	}
+	binary.LittleEndian.PutUint32(out[4:8], uint32(len(out)-8))
+	return out, nil
+}
+
+// orientImage applies an EXIF orientation (2-8) so the image is upright.
+func orientImage(img image.Image, orientation int) image.Image {
+	bounds := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			default:
+				sx, sy = x, y
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], src.Pix[src.PixOffset(sx, sy):src.PixOffset(sx, sy)+4])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,310 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"mellon-harmony-api/internal/models"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// testImage is a w×h white picture with a red top-left corner, so orientation can be checked.
+func testImage(w, h int, opaque bool) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{255, 255, 255, 255})
+		}
+	}
+	if !opaque {
+		img.Set(w-1, h-1, color.RGBA{})
+	}
+	for y := 0; y < h/4; y++ {
+		for x := 0; x < w/4; x++ {
+			img.Set(x, y, color.RGBA{255, 0, 0, 255})
+		}
+	}
+	return img
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// jpegSegment builds a JPEG marker segment with its length.
+func jpegSegment(marker byte, payload []byte) []byte {
+	segment := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// exifPayload is an APP1 EXIF payload with an orientation tag and a GPS-like text marker.
+func exifPayload(orientation uint16) []byte {
+	payload := []byte("Exif\x00\x00II*\x00\x08\x00\x00\x00\x01\x00")
+	entry := make([]byte, 12)
+	binary.LittleEndian.PutUint16(entry[0:], 0x0112)
+	binary.LittleEndian.PutUint16(entry[2:], 3) // SHORT
+	binary.LittleEndian.PutUint32(entry[4:], 1)
+	binary.LittleEndian.PutUint16(entry[8:], orientation)
+	payload = append(payload, entry...)
+	payload = append(payload, 0, 0, 0, 0)
+	return append(payload, []byte("GPS 40.4168N 3.7038W")...)
+}
+
+// withJPEGSegments inserts segments right after the SOI marker of a JPEG.
+func withJPEGSegments(data []byte, segments ...[]byte) []byte {
+	out := append([]byte{}, data[:2]...)
+	for _, segment := range segments {
+		out = append(out, segment...)
+	}
+	return append(out, data[2:]...)
+}
+
+// pngChunk builds a PNG chunk with its CRC.
+func pngChunk(kind string, data []byte) []byte {
+	chunk := make([]byte, 4, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	chunk = append(chunk, kind...)
+	chunk = append(chunk, data...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+// withPNGChunks inserts chunks right after the IHDR chunk of a PNG.
+func withPNGChunks(data []byte, chunks ...[]byte) []byte {
+	ihdrEnd := len(pngSignature) + 12 + 13
+	out := append([]byte{}, data[:ihdrEnd]...)
+	for _, chunk := range chunks {
+		out = append(out, chunk...)
+	}
+	return append(out, data[ihdrEnd:]...)
+}
+
+func TestProcessImageStripsJPEGMetadata(t *testing.T) {
+	plain := encodeJPEG(t, testImage(40, 20, true))
+	tagged := withJPEGSegments(plain,
+		jpegSegment(0xE1, exifPayload(1)),
+		jpegSegment(0xE1, []byte("http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta>Ana</x:xmpmeta>")),
+		jpegSegment(0xED, []byte("Photoshop 3.0\x00IPTC author")),
+		jpegSegment(0xFE, []byte("shot by Ana")),
+		jpegSegment(0xE2, []byte("ICC_PROFILE\x00profile")),
+	)
+
+	processed, img, err := processImage(tagged, contentTypeJPEG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, leaked := range []string{"Exif", "GPS", "xmpmeta", "IPTC", "shot by"} {
+		if bytes.Contains(processed, []byte(leaked)) {
+			t.Errorf("processed image still contains %q", leaked)
+		}
+	}
+	if !bytes.Contains(processed, []byte("ICC_PROFILE")) {
+		t.Error("the color profile was removed")
+	}
+	// Without rotation the compressed image data is kept as is
+	if !bytes.HasSuffix(processed, plain[len(plain)-100:]) || img.Bounds().Dx() != 40 {
+		t.Error("image data was re-encoded")
+	}
+}
+
+func TestProcessImageOrientation(t *testing.T) {
+	tests := []struct {
+		orientation  uint16
+		wantW, wantH int
+		// wantRed is where the red top-left corner ends up
+		wantRed image.Point
+	}{
+		{3, 40, 20, image.Pt(39, 19)},
+		{6, 20, 40, image.Pt(19, 0)},
+		{8, 20, 40, image.Pt(0, 39)},
+	}
+	for _, tt := range tests {
+		data := withJPEGSegments(encodeJPEG(t, testImage(40, 20, true)), jpegSegment(0xE1, exifPayload(tt.orientation)))
+		processed, img, err := processImage(data, contentTypeJPEG)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if img.Bounds().Dx() != tt.wantW || img.Bounds().Dy() != tt.wantH {
+			t.Errorf("orientation %d: %v, want %dx%d", tt.orientation, img.Bounds(), tt.wantW, tt.wantH)
+		}
+		if r, g, _, _ := img.At(tt.wantRed.X, tt.wantRed.Y).RGBA(); r < 0xC000 || g > 0x4000 {
+			t.Errorf("orientation %d: pixel %v is not red", tt.orientation, tt.wantRed)
+		}
+		if bytes.Contains(processed, []byte("Exif")) {
+			t.Errorf("orientation %d: EXIF kept", tt.orientation)
+		}
+		if _, _, err := image.Decode(bytes.NewReader(processed)); err != nil {
+			t.Errorf("orientation %d: re-encoded image does not decode: %v", tt.orientation, err)
+		}
+	}
+}
+
+func TestProcessImageStripsPNGMetadata(t *testing.T) {
+	tagged := withPNGChunks(encodePNG(t, testImage(10, 10, true)),
+		pngChunk("tEXt", []byte("Author\x00Ana")),
+		pngChunk("eXIf", exifPayload(1)[6:]),
+		pngChunk("tIME", []byte{0x07, 0xEA, 10, 17, 12, 0, 0}),
+		pngChunk("gAMA", []byte{0, 0, 0xB1, 0x8F}),
+	)
+	processed, _, err := processImage(tagged, contentTypePNG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, leaked := range []string{"tEXt", "Author", "eXIf", "tIME"} {
+		if bytes.Contains(processed, []byte(leaked)) {
+			t.Errorf("processed image still contains %q", leaked)
+		}
+	}
+	if !bytes.Contains(processed, []byte("gAMA")) {
+		t.Error("color information was removed")
+	}
+}
+
+func TestProcessImageInvalid(t *testing.T) {
+	huge := encodePNG(t, testImage(1, 1, true))
+	// Claim 10000×10000 pixels in the header
+	binary.BigEndian.PutUint32(huge[16:], 10000)
+	binary.BigEndian.PutUint32(huge[20:], 10000)
+	binary.BigEndian.PutUint32(huge[29:], crc32.ChecksumIEEE(huge[12:29]))
+	tests := []struct {
+		name        string
+		data        []byte
+		contentType string
+		wantErr     error
+	}{
+		{"truncated", encodePNG(t, testImage(10, 10, true))[:40], contentTypePNG, ErrInvalidImage},
+		{"not an image", samplePDF, contentTypePNG, ErrInvalidImage},
+		{"too many pixels", huge, contentTypePNG, ErrImageTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := processImage(tt.data, tt.contentType); !errors.Is(err, tt.wantErr) {
+				t.Errorf("processImage = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMakeThumbnail(t *testing.T) {
+	tests := []struct {
+		name         string
+		img          image.Image
+		size         int
+		wantW, wantH int
+		wantType     string
+	}{
+		{"landscape", testImage(1000, 500, true), 200, 200, 100, contentTypeJPEG},
+		{"portrait", testImage(300, 900, true), 200, 66, 200, contentTypeJPEG},
+		{"smaller than the size", testImage(50, 30, true), 200, 50, 30, contentTypeJPEG},
+		{"transparent", testImage(400, 400, false), 200, 200, 200, contentTypePNG},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			thumb, err := makeThumbnail(tt.img, tt.size)
+			if err != nil {
+				t.Fatal(err)
+			}
+			config, _, err := image.DecodeConfig(bytes.NewReader(thumb.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.Width != tt.wantW || config.Height != tt.wantH || thumb.contentType != tt.wantType {
+				t.Errorf("thumbnail %dx%d %s, want %dx%d %s", config.Width, config.Height, thumb.contentType, tt.wantW, tt.wantH, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestFileServiceSaveImage(t *testing.T) {
+	s, storage, files := newTestFileService(t, nil)
+	data := withJPEGSegments(encodeJPEG(t, testImage(1200, 600, true)), jpegSegment(0xE1, exifPayload(1)))
+
+	record, err := s.SaveFile(Upload{Name: "photo.jpg", Size: int64(len(data)), Body: bytes.NewReader(data)}, uuid.New(), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := readStored(t, storage, record.Key)
+	if bytes.Contains([]byte(stored), []byte("GPS")) || int64(len(stored)) != record.Size {
+		t.Errorf("stored image keeps its metadata or has the wrong size (%d, recorded %d)", len(stored), record.Size)
+	}
+	thumbnails := files.get(record.ID).GetThumbnails()
+	if len(thumbnails) != len(ThumbnailSizes) {
+		t.Fatalf("thumbnails = %v, want one per size", thumbnails)
+	}
+	var thumbnailSize int64
+	for size, key := range thumbnails {
+		preview := readStored(t, storage, key)
+		config, _, err := image.DecodeConfig(bytes.NewReader([]byte(preview)))
+		if err != nil || (size == "200" && config.Width != 200) || (size == "800" && config.Width != 800) {
+			t.Errorf("preview %s: %dx%d, %v", size, config.Width, config.Height, err)
+		}
+		thumbnailSize += int64(len(preview))
+	}
+	if record.ThumbnailSize != thumbnailSize {
+		t.Errorf("ThumbnailSize = %d, want %d", record.ThumbnailSize, thumbnailSize)
+	}
+}
+
+func TestFileServiceSaveChecksContents(t *testing.T) {
+	tests := []struct {
+		name    string
+		upload  Upload
+		opts    UploadOptions
+		wantErr error
+	}{
+		{"executable renamed to pdf", Upload{Name: "invoice.pdf", Size: int64(len(sampleEXE)), Body: bytes.NewReader(sampleEXE)}, UploadOptions{}, ErrFileTypeMismatch},
+		{"damaged image", Upload{Name: "photo.png", Size: 20, Body: bytes.NewReader(append(append([]byte{}, pngSignature...), make([]byte, 12)...))}, UploadOptions{}, ErrInvalidImage},
+		{"pdf as avatar", Upload{Name: "me.png", Size: int64(len(samplePDF)), Body: bytes.NewReader(samplePDF)}, UploadOptions{Purpose: models.FilePurposeAvatar, UserID: uuid.New().String()}, ErrNotAnImage},
+		{"pdf as logo", Upload{Name: "logo.png", Size: int64(len(samplePDF)), Body: bytes.NewReader(samplePDF)}, UploadOptions{Purpose: models.FilePurposeClientLogo, ClientID: uuid.New().String()}, ErrNotAnImage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, storage, _ := newTestFileService(t, nil)
+			if _, err := s.Save(tt.upload, uuid.New(), tt.opts); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Save = %v, want %v", err, tt.wantErr)
+			}
+			storage.Walk(func(key string) error {
+				t.Errorf("left %s in storage", key)
+				return nil
+			})
+		})
+	}
+}
+
+func TestFileServiceSaveAvatarExtension(t *testing.T) {
+	// The stored extension follows the contents, not the uploaded name
+	s, _, _ := newTestFileService(t, nil)
+	data := encodePNG(t, testImage(10, 10, true))
+	record, err := s.SaveAvatarFile(Upload{Name: "me.jpg", Size: int64(len(data)), Body: bytes.NewReader(data)}, uuid.New(), uuid.New().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.ContentType != contentTypePNG || record.Key[len(record.Key)-4:] != ".png" {
+		t.Errorf("avatar stored as %s (%s), want a .png", record.Key, record.ContentType)
+	}
+	if _, err := s.OpenFile(context.Background(), record.Path()); err != nil {
+		t.Errorf("avatar not served: %v", err)
+	}
+}
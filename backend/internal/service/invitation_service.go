@@ -0,0 +1,278 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"mellon-harmony-api/internal/models"
+	"mellon-harmony-api/internal/repository"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInvitationNotFound is returned for unknown invitation IDs.
+var ErrInvitationNotFound = errors.New("invitación no encontrada")
+
+// ErrInvalidInvitation is returned when an invitation link is unknown, expired, revoked or already used.
+var ErrInvalidInvitation = errors.New("la invitación ha expirado o no es válida")
+
+// ErrInvitationForbidden is returned when the inviter's role may not grant the requested role, or
+// the inviter may not add members to one of the requested clients.
+var ErrInvitationForbidden = errors.New("no tienes permiso para invitar con ese rol o a esos clientes")
+
+// ErrInvitationEmailTaken is returned when the invited email already has an account.
+var ErrInvitationEmailTaken = errors.New("ya existe un usuario con ese correo")
+
+// ErrInvitationClientNotFound is returned when a requested client membership does not exist.
+var ErrInvitationClientNotFound = errors.New("uno de los clientes no existe")
+
+// InvitationService manages invitation-only registration.
+type InvitationService interface {
+	CreateInvitation(inviter *models.User, email string, role models.UserRole, clientIDs []uuid.UUID) (*models.Invitation, error)
+	ListInvitations() ([]models.Invitation, error)
+	ResendInvitation(inviter *models.User, id uuid.UUID) (*models.Invitation, error)
+	RevokeInvitation(inviter *models.User, id uuid.UUID) error
+	GetInvitationByToken(token string) (*models.Invitation, error)
+	AcceptInvitation(token, name, password string) (*models.User, error)
+}
+
+// InvitationConfig holds settings for InvitationService.
+type InvitationConfig struct {
+	FrontendURL    string
+	TTL            time.Duration // how long an invitation link is valid (defaults to 7 days)
+	PasswordPolicy *PasswordPolicy
+}
+
+type invitationService struct {
+	invitationRepo    repository.InvitationRepository
+	userRepo          repository.UserRepository
+	clientRepo        repository.ClientRepository
+	clientMemberRepo  repository.ClientMemberRepository
+	permissionService PermissionService
+	emailService      EmailService
+	frontendURL       string
+	ttl               time.Duration
+	passwordPolicy    *PasswordPolicy
+}
+
+func NewInvitationService(invitationRepo repository.InvitationRepository, userRepo repository.UserRepository, clientRepo repository.ClientRepository, clientMemberRepo repository.ClientMemberRepository, permissionService PermissionService, emailService EmailService, cfg InvitationConfig) InvitationService {
+	if cfg.TTL <= 0 {
+		cfg.TTL = 7 * 24 * time.Hour
+	}
+	return &invitationService{
+		invitationRepo:    invitationRepo,
+		userRepo:          userRepo,
+		clientRepo:        clientRepo,
+		clientMemberRepo:  clientMemberRepo,
+		permissionService: permissionService,
+		emailService:      emailService,
+		frontendURL:       strings.TrimSuffix(strings.TrimSpace(strings.Split(cfg.FrontendURL, ",")[0]), "/"),
+		ttl:               cfg.TTL,
+		passwordPolicy:    cfg.PasswordPolicy,
+	}
+}
+
+// canInvite reports whether the inviter (who holds user.invite, checked by the handler) may grant
+// role: only admins invite admins, everyone else roles whose permissions they hold themselves.
+func (s *invitationService) canInvite(inviter *models.User, role models.UserRole) bool {
+	return s.permissionService.CanGrantRole(inviter, role)
+}
+
+// canAddToClient reports whether the inviter may make the invited user a member of clientID:
+// client.manage covers every client, otherwise only clients the inviter belongs to.
+func (s *invitationService) canAddToClient(inviter *models.User, clientID uuid.UUID) bool {
+	if s.permissionService.HasPermission(inviter, models.PermClientManage) {
+		return true
+	}
+	member, _ := s.clientMemberRepo.Exists(clientID, inviter.ID)
+	return member
+}
+
+func (s *invitationService) CreateInvitation(inviter *models.User, email string, role models.UserRole, clientIDs []uuid.UUID) (*models.Invitation, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if role == "" {
+		role = models.RoleUser
+	}
+	if !s.permissionService.RoleExists(role) {
+		return nil, ErrRoleNotFound
+	}
+	if !s.canInvite(inviter, role) {
+		return nil, ErrInvitationForbidden
+	}
+	if _, err := s.userRepo.GetByEmail(email); err == nil {
+		return nil, ErrInvitationEmailTaken
+	}
+
+	invitation := &models.Invitation{
+		Email:     email,
+		Role:      role,
+		InvitedBy: inviter.ID,
+		ExpiresAt: time.Now().Add(s.ttl),
+	}
+	seen := map[uuid.UUID]bool{}
+	for _, clientID := range clientIDs {
+		if seen[clientID] {
+			continue
+		}
+		seen[clientID] = true
+		if _, err := s.clientRepo.GetByID(clientID); err != nil {
+			return nil, ErrInvitationClientNotFound
+		}
+		if !s.canAddToClient(inviter, clientID) {
+			return nil, ErrInvitationForbidden
+		}
+		invitation.Clients = append(invitation.Clients, models.InvitationClient{ClientID: clientID})
+	}
+
+	token, err := newInvitationToken()
+	if err != nil {
+		return nil, err
+	}
+	invitation.TokenHash = hashToken(token)
+
+	if err := s.invitationRepo.RevokePendingForEmail(email); err != nil {
+		return nil, err
+	}
+	if err := s.invitationRepo.Create(invitation); err != nil {
+		return nil, err
+	}
+
+	created, err := s.invitationRepo.GetByID(invitation.ID)
+	if err != nil {
+		return nil, err
+	}
+	s.deliver(created, inviter, token)
+	return created, nil
+}
+
+func (s *invitationService) ListInvitations() ([]models.Invitation, error) {
+	return s.invitationRepo.GetAll()
+}
+
+// ResendInvitation issues a fresh link (the previous one stops working) and extends the expiry.
+func (s *invitationService) ResendInvitation(inviter *models.User, id uuid.UUID) (*models.Invitation, error) {
+	invitation, err := s.invitationRepo.GetByID(id)
+	if err != nil {
+		return nil, ErrInvitationNotFound
+	}
+	if invitation.AcceptedAt != nil || invitation.RevokedAt != nil {
+		return nil, ErrInvalidInvitation
+	}
+	// The role may have been deleted since the invitation was sent
+	if !s.permissionService.RoleExists(invitation.Role) {
+		return nil, ErrRoleNotFound
+	}
+	if !s.canInvite(inviter, invitation.Role) {
+		return nil, ErrInvitationForbidden
+	}
+
+	token, err := newInvitationToken()
+	if err != nil {
+		return nil, err
+	}
+	invitation.TokenHash = hashToken(token)
+	invitation.ExpiresAt = time.Now().Add(s.ttl)
+	if err := s.invitationRepo.Update(invitation); err != nil {
+		return nil, err
+	}
+	s.deliver(invitation, inviter, token)
+	return invitation, nil
+}
+
+// RevokeInvitation is limited, like ResendInvitation, to inviters who could have sent the invitation.
+func (s *invitationService) RevokeInvitation(inviter *models.User, id uuid.UUID) error {
+	invitation, err := s.invitationRepo.GetByID(id)
+	if err != nil {
+		return ErrInvitationNotFound
+	}
+	if invitation.AcceptedAt != nil {
+		return ErrInvalidInvitation
+	}
+	if !s.canInvite(inviter, invitation.Role) {
+		return ErrInvitationForbidden
+	}
+	if invitation.RevokedAt != nil {
+		return nil
+	}
+	now := time.Now()
+	invitation.RevokedAt = &now
+	return s.invitationRepo.Update(invitation)
+}
+
+// GetInvitationByToken returns a pending invitation so the signup page can show the email and role.
+func (s *invitationService) GetInvitationByToken(token string) (*models.Invitation, error) {
+	if token == "" {
+		return nil, ErrInvalidInvitation
+	}
+	invitation, err := s.invitationRepo.GetByTokenHash(hashToken(token))
+	if err != nil || !invitation.IsPending() {
+		return nil, ErrInvalidInvitation
+	}
+	return invitation, nil
+}
+
+// AcceptInvitation creates the invited account with the invitation's role and client memberships.
+func (s *invitationService) AcceptInvitation(token, name, password string) (*models.User, error) {
+	invitation, err := s.GetInvitationByToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.userRepo.GetByEmail(invitation.Email); err == nil {
+		return nil, ErrInvitationEmailTaken
+	}
+	if s.passwordPolicy != nil {
+		if err := s.passwordPolicy.Validate(password, invitation.Email, name); err != nil {
+			return nil, err
+		}
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	// The invitation link was delivered to this address, which proves the user owns it
+	verifiedAt := time.Now()
+	user := &models.User{
+		Name:            strings.TrimSpace(name),
+		Email:           invitation.Email,
+		Password:        string(hashedPassword),
+		Role:            invitation.Role,
+		EmailVerifiedAt: &verifiedAt,
+	}
+	if err := s.invitationRepo.Accept(invitation, user); err != nil {
+		if errors.Is(err, repository.ErrInvitationUsed) {
+			return nil, ErrInvalidInvitation
+		}
+		return nil, err
+	}
+
+	user.Password = ""
+	return user, nil
+}
+
+// deliver emails the invitation link. Without SMTP the link is returned to the inviter
+// in InviteLink so they can share it manually.
+func (s *invitationService) deliver(invitation *models.Invitation, inviter *models.User, token string) {
+	link := s.frontendURL + "/invitacion?token=" + token
+	if s.emailService == nil || !s.emailService.IsConfigured() {
+		log.Printf("Invitation created for %s but email is not configured; returning the link to the inviter", invitation.Email)
+		invitation.InviteLink = link
+		return
+	}
+	if err := s.emailService.SendInvitationEmail(invitation.Email, inviter.Name, string(invitation.Role), link); err != nil {
+		log.Printf("Failed to send invitation email to %s: %v", invitation.Email, err)
+		invitation.InviteLink = link
+	}
+}
+
+func newInvitationToken() (string, error) {
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", errors.New("no se pudo generar el enlace de invitación")
+	}
+	return hex.EncodeToString(tokenBytes), nil
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"errors"
+	"mellon-harmony-api/internal/models"
+	"mellon-harmony-api/internal/repository"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type memoryInvitationRepository struct {
+	repository.InvitationRepository
+	invitations map[uuid.UUID]*models.Invitation
+}
+
+func newMemoryInvitationRepository() *memoryInvitationRepository {
+	return &memoryInvitationRepository{invitations: map[uuid.UUID]*models.Invitation{}}
+}
+
+func (r *memoryInvitationRepository) Create(invitation *models.Invitation) error {
+	if invitation.ID == uuid.Nil {
+		invitation.ID = uuid.New()
+	}
+	stored := *invitation
+	r.invitations[invitation.ID] = &stored
+	return nil
+}
+
+func (r *memoryInvitationRepository) GetByID(id uuid.UUID) (*models.Invitation, error) {
+	invitation, ok := r.invitations[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copy := *invitation
+	return &copy, nil
+}
+
+func (r *memoryInvitationRepository) Update(invitation *models.Invitation) error {
+	stored := *invitation
+	r.invitations[invitation.ID] = &stored
+	return nil
+}
+
+func (r *memoryInvitationRepository) RevokePendingForEmail(email string) error {
+	now := time.Now()
+	for _, invitation := range r.invitations {
+		if invitation.Email == email && invitation.IsPending() {
+			invitation.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+// invitationFixture has one client the coordinator belongs to and one they do not. The
+// coordinator role may invite users but not manage clients.
+type invitationFixture struct {
+	service     InvitationService
+	invitations *memoryInvitationRepository
+	admin       *models.User
+	coordinator *models.User
+	ownClient   uuid.UUID
+	otherClient uuid.UUID
+}
+
+func newInvitationFixture() *invitationFixture {
+	coordinatorRole := models.Role{Name: "coordinator"}
+	coordinatorRole.SetPermissions([]string{models.PermUserInvite})
+	admin := &models.User{Email: "admin@example.com", Role: models.RoleAdmin}
+	coordinator := &models.User{Email: "coordinator@example.com", Role: "coordinator"}
+	users := newMemoryUserRepository(admin, coordinator, &models.User{Email: "taken@example.com", Role: models.RoleUser})
+
+	own, other := &models.Client{Name: "Acme"}, &models.Client{Name: "Globex"}
+	clients := newMemoryClientRepository(own, other)
+	members := newMemoryClientMemberRepository()
+	members.Add(own.ID, coordinator.ID)
+
+	invitations := newMemoryInvitationRepository()
+	permissions := NewPermissionService(newMemoryRoleRepository(coordinatorRole), users, nil)
+	return &invitationFixture{
+		service:     NewInvitationService(invitations, users, clients, members, permissions, nil, InvitationConfig{FrontendURL: "https://app.example.com"}),
+		invitations: invitations,
+		admin:       admin,
+		coordinator: coordinator,
+		ownClient:   own.ID,
+		otherClient: other.ID,
+	}
+}
+
+func TestInvitationServiceCreateInvitation(t *testing.T) {
+	f := newInvitationFixture()
+	tests := []struct {
+		name      string
+		inviter   *models.User
+		email     string
+		role      models.UserRole
+		clientIDs []uuid.UUID
+		wantErr   error
+		// wantClients is the number of client memberships on the invitation
+		wantClients int
+	}{
+		{"admin, any client", f.admin, "new@example.com", models.RoleTeamLead, []uuid.UUID{f.ownClient, f.otherClient}, nil, 2},
+		{"own client, repeated", f.coordinator, "New@Example.com", models.RoleUser, []uuid.UUID{f.ownClient, f.ownClient}, nil, 1},
+		{"client the inviter is not a member of", f.coordinator, "new@example.com", models.RoleUser, []uuid.UUID{f.ownClient, f.otherClient}, ErrInvitationForbidden, 0},
+		{"unknown client", f.admin, "new@example.com", models.RoleUser, []uuid.UUID{uuid.New()}, ErrInvitationClientNotFound, 0},
+		{"email taken", f.admin, " Taken@Example.com ", models.RoleUser, nil, ErrInvitationEmailTaken, 0},
+		{"default role", f.coordinator, "new@example.com", "", nil, nil, 0},
+		{"own role", f.coordinator, "new@example.com", "coordinator", nil, nil, 0},
+		{"role with permissions the inviter lacks", f.coordinator, "new@example.com", models.RoleTeamLead, nil, ErrInvitationForbidden, 0},
+		{"admin by a non-admin", f.coordinator, "new@example.com", models.RoleAdmin, nil, ErrInvitationForbidden, 0},
+		{"admin by an admin", f.admin, "new@example.com", models.RoleAdmin, nil, nil, 0},
+		{"unknown role", f.admin, "new@example.com", "superuser", nil, ErrRoleNotFound, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invitation, err := f.service.CreateInvitation(tt.inviter, tt.email, tt.role, tt.clientIDs)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CreateInvitation error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			wantRole := tt.role
+			if wantRole == "" {
+				wantRole = models.RoleUser
+			}
+			if invitation.Email != "new@example.com" || invitation.Role != wantRole || invitation.InviteLink == "" {
+				t.Errorf("CreateInvitation = %+v", invitation)
+			}
+			if len(invitation.Clients) != tt.wantClients {
+				t.Errorf("got %d client memberships, want %d", len(invitation.Clients), tt.wantClients)
+			}
+		})
+	}
+}
+
+func TestInvitationServiceCreateInvitationRevokesPending(t *testing.T) {
+	f := newInvitationFixture()
+	first, err := f.service.CreateInvitation(f.admin, "new@example.com", models.RoleUser, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.service.CreateInvitation(f.admin, "new@example.com", models.RoleUser, nil); err != nil {
+		t.Fatal(err)
+	}
+	if f.invitations.invitations[first.ID].RevokedAt == nil {
+		t.Error("the earlier invitation to the same email is still pending")
+	}
+}
+
+func TestInvitationServiceResendAndRevoke(t *testing.T) {
+	f := newInvitationFixture()
+	lead, err := f.service.CreateInvitation(f.admin, "lead@example.com", models.RoleTeamLead, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.service.ResendInvitation(f.coordinator, lead.ID); !errors.Is(err, ErrInvitationForbidden) {
+		t.Errorf("resend by an inviter who could not grant the role: %v, want %v", err, ErrInvitationForbidden)
+	}
+	if err := f.service.RevokeInvitation(f.coordinator, lead.ID); !errors.Is(err, ErrInvitationForbidden) {
+		t.Errorf("revoke by an inviter who could not grant the role: %v, want %v", err, ErrInvitationForbidden)
+	}
+
+	plain, err := f.service.CreateInvitation(f.admin, "user@example.com", models.RoleUser, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resent, err := f.service.ResendInvitation(f.coordinator, plain.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resent.InviteLink == plain.InviteLink {
+		t.Error("resending kept the previous link")
+	}
+	if err := f.service.RevokeInvitation(f.coordinator, plain.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.service.ResendInvitation(f.admin, plain.ID); !errors.Is(err, ErrInvalidInvitation) {
+		t.Errorf("resend after revoking: %v, want %v", err, ErrInvalidInvitation)
+	}
+}
@@ -1,56 +1,205 @@
 package service
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"mellon-harmony-api/internal/models"
 	"mellon-harmony-api/internal/repository"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// ErrIssueNotFound is returned for unknown issues and for issues the user may not access,
+// so issue IDs cannot be probed.
+var ErrIssueNotFound = errors.New("issue not found")
+
 type IssueService interface {
-	GetIssue(id uuid.UUID) (*models.Issue, error)
-	GetIssues(filters map[string]interface{}) ([]models.Issue, error)
+	// GetIssueForUser returns the issue only if CanAccessIssue allows it, otherwise ErrIssueNotFound.
+	GetIssueForUser(id uuid.UUID, user *models.User) (*models.Issue, error)
+	CanAccessIssue(user *models.User, issue *models.Issue) bool
+	// CanDeleteIssue allows the creator and roles with issue.view_all (leads, admins).
+	CanDeleteIssue(user *models.User, issue *models.Issue) bool
+	// CanFileIssueUnder reports whether the user may put an issue under the given project and client
+	// (either may be nil): roles with issue.view_all, or members of each.
+	CanFileIssueUnder(user *models.User, projectID, clientID *uuid.UUID) bool
+	// GetIssues returns one page of the issues matching filter that CanAccessIssue allows the user
+	// to see, and the total number of them.
+	GetIssues(filter repository.IssueFilter, opts repository.ListOptions, user *models.User) ([]models.Issue, int64, error)
+	// GetAttachmentsForUser returns the issues matching filter that CanAccessIssue allows the user
+	// to see, with only the fields of IssueRepository.GetAttachments, for attachment archives.
+	GetAttachmentsForUser(filter repository.IssueFilter, user *models.User) ([]models.Issue, error)
 	GetIssuesByAssignedTo(userID uuid.UUID) ([]models.Issue, error)
-	CreateIssue(issue *models.Issue) error
-	UpdateIssue(id uuid.UUID, updates map[string]interface{}) (*models.Issue, error)
-	UpdateIssueStatus(id uuid.UUID, status models.IssueStatus, approvedAt *time.Time) (*models.Issue, error)
-	DeleteIssue(id uuid.UUID) error
+	CreateIssue(issue *models.Issue, meta models.AuditMeta) error
+	UpdateIssue(id uuid.UUID, updates map[string]interface{}, meta models.AuditMeta) (*models.Issue, error)
+	UpdateIssueStatus(id uuid.UUID, status models.IssueStatus, approvedAt *time.Time, meta models.AuditMeta) (*models.Issue, error)
+	DeleteIssue(id uuid.UUID, meta models.AuditMeta) error
+	// AttachmentVersions returns the versions of an uploaded attachment of the issue, latest first.
+	// fileID may be any of its versions; ErrAttachmentNotFound if it is not an attachment of the issue.
+	AttachmentVersions(issue *models.Issue, fileID uuid.UUID) ([]models.File, error)
+	// AttachmentScanStatuses returns the virus scan status of uploaded attachments by file ID.
+	AttachmentScanStatuses(fileIDs []uuid.UUID) map[uuid.UUID]string
+	// AddAttachmentVersion stores upload as the new version of an attachment, which then refers to it.
+	AddAttachmentVersion(issue *models.Issue, fileID uuid.UUID, upload Upload, uploadedBy uuid.UUID, meta models.AuditMeta) (*models.Issue, error)
+	// RestoreAttachmentVersion makes a copy of a previous version the new version of an attachment.
+	RestoreAttachmentVersion(issue *models.Issue, fileID, versionID uuid.UUID, restoredBy uuid.UUID, meta models.AuditMeta) (*models.Issue, error)
 }
 
 type issueService struct {
-	issueRepo repository.IssueRepository
-	userRepo  repository.UserRepository
+	issueRepo         repository.IssueRepository
+	userRepo          repository.UserRepository
+	clientMemberRepo  repository.ClientMemberRepository
+	projectRepo       repository.ProjectRepository
+	permissionService PermissionService
+	fileService       *FileService
+	auditService      AuditService
 }
 
-func NewIssueService(issueRepo repository.IssueRepository, userRepo repository.UserRepository) IssueService {
+func NewIssueService(issueRepo repository.IssueRepository, userRepo repository.UserRepository, clientMemberRepo repository.ClientMemberRepository, projectRepo repository.ProjectRepository, permissionService PermissionService, fileService *FileService, auditService AuditService) IssueService {
 	return &issueService{
-		issueRepo: issueRepo,
-		userRepo:  userRepo,
+		issueRepo:         issueRepo,
+		userRepo:          userRepo,
+		clientMemberRepo:  clientMemberRepo,
+		projectRepo:       projectRepo,
+		permissionService: permissionService,
+		fileService:       fileService,
+		auditService:      auditService,
 	}
 }
 
-func (s *issueService) GetIssue(id uuid.UUID) (*models.Issue, error) {
-	return s.issueRepo.GetByID(id)
+func (s *issueService) GetIssueForUser(id uuid.UUID, user *models.User) (*models.Issue, error) {
+	issue, err := s.issueRepo.GetByID(id)
+	if err != nil || !s.CanAccessIssue(user, issue) {
+		return nil, ErrIssueNotFound
+	}
+	return issue, nil
+}
+
+// CanAccessIssue is the access policy for reading and changing an issue and its comments:
+// roles with issue.view_all (leads, admins), the assignee, the creator, members of the issue's
+// client (or of its project's client) and members of its project.
+func (s *issueService) CanAccessIssue(user *models.User, issue *models.Issue) bool {
+	if user == nil || issue == nil {
+		return false
+	}
+	if s.permissionService.HasPermission(user, models.PermIssueViewAll) {
+		return true
+	}
+	if issue.CreatedBy == user.ID || (issue.AssignedTo != nil && *issue.AssignedTo == user.ID) {
+		return true
+	}
+	if issue.ClientID != nil {
+		if member, _ := s.clientMemberRepo.Exists(*issue.ClientID, user.ID); member {
+			return true
+		}
+	}
+	if issue.ProjectID != nil {
+		if member, _ := s.projectRepo.IsMember(*issue.ProjectID, user.ID); member {
+			return true
+		}
+		if issue.Project != nil && issue.Project.ClientID != nil && (issue.ClientID == nil || *issue.Project.ClientID != *issue.ClientID) {
+			if member, _ := s.clientMemberRepo.Exists(*issue.Project.ClientID, user.ID); member {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *issueService) CanDeleteIssue(user *models.User, issue *models.Issue) bool {
+	if user == nil || issue == nil {
+		return false
+	}
+	return issue.CreatedBy == user.ID || s.permissionService.HasPermission(user, models.PermIssueViewAll)
 }
 
-func (s *issueService) GetIssues(filters map[string]interface{}) ([]models.Issue, error) {
-	return s.issueRepo.GetAll(filters)
+// CanFileIssueUnder counts project members and members of the project's client as members of a project.
+func (s *issueService) CanFileIssueUnder(user *models.User, projectID, clientID *uuid.UUID) bool {
+	if user == nil {
+		return false
+	}
+	if s.permissionService.HasPermission(user, models.PermIssueViewAll) {
+		return true
+	}
+	if clientID != nil {
+		if member, _ := s.clientMemberRepo.Exists(*clientID, user.ID); !member {
+			return false
+		}
+	}
+	if projectID != nil {
+		if member, _ := s.projectRepo.IsMember(*projectID, user.ID); member {
+			return true
+		}
+		project, err := s.projectRepo.GetByID(*projectID)
+		if err != nil || project.ClientID == nil {
+			return false
+		}
+		member, _ := s.clientMemberRepo.Exists(*project.ClientID, user.ID)
+		return member
+	}
+	return true
+}
+
+func (s *issueService) GetIssues(filter repository.IssueFilter, opts repository.ListOptions, user *models.User) ([]models.Issue, int64, error) {
+	if !s.permissionService.HasPermission(user, models.PermIssueViewAll) {
+		filter.VisibleTo = &user.ID
+	}
+	return s.issueRepo.List(filter, opts)
+}
+
+func (s *issueService) GetAttachmentsForUser(filter repository.IssueFilter, user *models.User) ([]models.Issue, error) {
+	if !s.permissionService.HasPermission(user, models.PermIssueViewAll) {
+		filter.VisibleTo = &user.ID
+	}
+	return s.issueRepo.GetAttachments(filter)
 }
 
 func (s *issueService) GetIssuesByAssignedTo(userID uuid.UUID) ([]models.Issue, error) {
 	return s.issueRepo.GetByAssignedTo(userID)
 }
 
-func (s *issueService) CreateIssue(issue *models.Issue) error {
-	return s.issueRepo.Create(issue)
+func (s *issueService) CreateIssue(issue *models.Issue, meta models.AuditMeta) error {
+	// The ID is needed to link uploaded attachments before the issue is stored
+	if issue.ID == uuid.Nil {
+		issue.ID = uuid.New()
+	}
+	if issue.Attachments != "" {
+		attachments, err := s.fileService.LinkAttachments(models.FileOwnerIssue, issue.ID, s.storageClientID(issue), issue.GetAttachments())
+		if err != nil {
+			return err
+		}
+		issue.SetAttachments(attachments)
+	}
+	if err := s.issueRepo.Create(issue); err != nil {
+		return err
+	}
+	s.auditService.Record(meta, models.AuditCreate, "issue", issue.ID.String(), nil, issueSnapshot(issue))
+	return nil
 }
 
-func (s *issueService) UpdateIssue(id uuid.UUID, updates map[string]interface{}) (*models.Issue, error) {
+// storageClientID is the client whose storage quota the issue's files count against: its own
+// client, or else its project's.
+func (s *issueService) storageClientID(issue *models.Issue) *uuid.UUID {
+	if issue.ClientID != nil {
+		return issue.ClientID
+	}
+	if issue.ProjectID != nil {
+		if project, err := s.projectRepo.GetByID(*issue.ProjectID); err == nil {
+			return project.ClientID
+		}
+	}
+	return nil
+}
+
+func (s *issueService) UpdateIssue(id uuid.UUID, updates map[string]interface{}, meta models.AuditMeta) (*models.Issue, error) {
 	issue, err := s.issueRepo.GetByID(id)
 	if err != nil {
 		return nil, err
 	}
+	before := issueSnapshot(issue)
 
 	if title, ok := updates["title"].(string); ok {
 		issue.Title = title
@@ -83,20 +232,27 @@ func (s *issueService) UpdateIssue(id uuid.UUID, updates map[string]interface{})
 	}
 	if attachments, ok := updates["attachments"].(string); ok {
 		issue.Attachments = attachments
+		linked, err := s.fileService.LinkAttachments(models.FileOwnerIssue, id, s.storageClientID(issue), issue.GetAttachments())
+		if err != nil {
+			return nil, err
+		}
+		issue.SetAttachments(linked)
 	}
 
 	if err := s.issueRepo.Update(issue); err != nil {
 		return nil, err
 	}
+	s.auditService.Record(meta, models.AuditUpdate, "issue", id.String(), before, issueSnapshot(issue))
 
 	return s.issueRepo.GetByID(id)
 }
 
-func (s *issueService) UpdateIssueStatus(id uuid.UUID, status models.IssueStatus, approvedAt *time.Time) (*models.Issue, error) {
+func (s *issueService) UpdateIssueStatus(id uuid.UUID, status models.IssueStatus, approvedAt *time.Time, meta models.AuditMeta) (*models.Issue, error) {
 	issue, err := s.issueRepo.GetByID(id)
 	if err != nil {
 		return nil, err
 	}
+	before := issueSnapshot(issue)
 
 	issue.Status = status
 	if status == models.StatusDone && approvedAt != nil {
@@ -105,10 +261,122 @@ func (s *issueService) UpdateIssueStatus(id uuid.UUID, status models.IssueStatus
 	if err := s.issueRepo.Update(issue); err != nil {
 		return nil, err
 	}
+	s.auditService.Record(meta, models.AuditStatusChange, "issue", id.String(), before, issueSnapshot(issue))
 
 	return s.issueRepo.GetByID(id)
 }
 
-func (s *issueService) DeleteIssue(id uuid.UUID) error {
-	return s.issueRepo.Delete(id)
+func (s *issueService) DeleteIssue(id uuid.UUID, meta models.AuditMeta) error {
+	issue, err := s.issueRepo.GetByID(id)
+	if err != nil {
+		return err
+	}
+	if err := s.issueRepo.Delete(id); err != nil {
+		return err
+	}
+	s.auditService.Record(meta, models.AuditDelete, "issue", id.String(), issueSnapshot(issue), nil)
+	return nil
+}
+
+func (s *issueService) AttachmentVersions(issue *models.Issue, fileID uuid.UUID) ([]models.File, error) {
+	_, versions, err := s.findAttachment(issue, fileID)
+	return versions, err
+}
+
+func (s *issueService) AttachmentScanStatuses(fileIDs []uuid.UUID) map[uuid.UUID]string {
+	return s.fileService.ScanStatuses(fileIDs)
+}
+
+func (s *issueService) AddAttachmentVersion(issue *models.Issue, fileID uuid.UUID, upload Upload, uploadedBy uuid.UUID, meta models.AuditMeta) (*models.Issue, error) {
+	index, versions, err := s.findAttachment(issue, fileID)
+	if err != nil {
+		return nil, err
+	}
+	version, err := s.fileService.SaveVersion(upload, uploadedBy, &versions[0])
+	if err != nil {
+		return nil, err
+	}
+	return s.replaceAttachment(issue, index, version, meta)
+}
+
+func (s *issueService) RestoreAttachmentVersion(issue *models.Issue, fileID, versionID uuid.UUID, restoredBy uuid.UUID, meta models.AuditMeta) (*models.Issue, error) {
+	index, versions, err := s.findAttachment(issue, fileID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range versions {
+		if versions[i].ID != versionID {
+			continue
+		}
+		restored, err := s.fileService.RestoreVersion(context.Background(), &versions[i], &versions[0], restoredBy)
+		if err != nil {
+			return nil, err
+		}
+		return s.replaceAttachment(issue, index, restored, meta)
+	}
+	return nil, ErrAttachmentNotFound
+}
+
+// findAttachment returns the index of the issue's attachment that fileID is a version of, and its
+// versions, latest first. Only uploads owned by the issue qualify: files it merely links to belong
+// to another task or comment.
+func (s *issueService) findAttachment(issue *models.Issue, fileID uuid.UUID) (int, []models.File, error) {
+	versions, err := s.fileService.FileVersions(fileID)
+	if err != nil {
+		return -1, nil, err
+	}
+	if len(versions) == 0 || versions[0].OwnerType != models.FileOwnerIssue ||
+		versions[0].OwnerID == nil || *versions[0].OwnerID != issue.ID {
+		return -1, nil, ErrAttachmentNotFound
+	}
+	for i, att := range issue.GetAttachments() {
+		if att.FileID == nil {
+			continue
+		}
+		for _, version := range versions {
+			if version.ID == *att.FileID {
+				return i, versions, nil
+			}
+		}
+	}
+	return -1, nil, ErrAttachmentNotFound
+}
+
+// replaceAttachment points an attachment of the issue at another version and saves the issue.
+func (s *issueService) replaceAttachment(issue *models.Issue, index int, version *models.File, meta models.AuditMeta) (*models.Issue, error) {
+	attachments := issue.GetAttachments()
+	att := &attachments[index]
+	// Keep the form of the stored URL (absolute or "uploads/..."), only the file changes
+	if u, err := url.Parse(att.URL); err == nil {
+		if key, ok := storedFilePath(u.Path); ok {
+			att.URL = strings.Replace(att.URL, key, version.Key, 1)
+		}
+	}
+	att.Name = version.Name
+	att.Type = "file"
+	if IsImageContentType(version.ContentType) {
+		att.Type = "image"
+	}
+	data, err := json.Marshal(models.StripAttachmentSignatures(attachments))
+	if err != nil {
+		return nil, err
+	}
+	return s.UpdateIssue(issue.ID, map[string]interface{}{"attachments": string(data)}, meta)
+}
+
+// issueSnapshot is the audited form of an issue; attachments are stored outside its JSON form.
+func issueSnapshot(issue *models.Issue) map[string]interface{} {
+	snapshot := auditSnapshot(issue)
+	if snapshot != nil {
+		attachments := []string{}
+		for _, att := range issue.GetAttachments() {
+			if att.Name != "" {
+				attachments = append(attachments, att.Name)
+			} else {
+				attachments = append(attachments, att.URL)
+			}
+		}
+		snapshot["attachments"] = attachments
+	}
+	return snapshot
 }
@@ -9,7 +9,7 @@ import (
 
 type NotificationService interface {
 	CreateNotification(userID uuid.UUID, notificationType models.NotificationType, title, message string, relatedID *uuid.UUID) error
-	GetUserNotifications(userID uuid.UUID) ([]models.Notification, error)
+	GetUserNotifications(userID uuid.UUID, opts repository.ListOptions) ([]models.Notification, int64, error)
 	GetUnreadNotifications(userID uuid.UUID) ([]models.Notification, error)
 	MarkAsRead(notificationID uuid.UUID) error
 	MarkAllAsRead(userID uuid.UUID) error
@@ -39,8 +39,8 @@ func (s *notificationService) CreateNotification(userID uuid.UUID, notificationT
 	return s.notificationRepo.Create(notification)
 }
 
-func (s *notificationService) GetUserNotifications(userID uuid.UUID) ([]models.Notification, error) {
-	return s.notificationRepo.GetByUserID(userID)
+func (s *notificationService) GetUserNotifications(userID uuid.UUID, opts repository.ListOptions) ([]models.Notification, int64, error) {
+	return s.notificationRepo.GetByUserID(userID, opts)
 }
 
 func (s *notificationService) GetUnreadNotifications(userID uuid.UUID) ([]models.Notification, error) {
@@ -0,0 +1,439 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"mellon-harmony-api/internal/models"
+	"mellon-harmony-api/internal/repository"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// OIDCStateTTL is how long a login may take at the identity provider.
+const OIDCStateTTL = 10 * time.Minute
+
+// oidcLoginCodeTTL is how long the frontend has to exchange the code from the callback.
+const oidcLoginCodeTTL = time.Minute
+
+// ErrOIDCNotConfigured is returned when single sign-on is used without OIDC_ISSUER_URL/OIDC_CLIENT_ID.
+var ErrOIDCNotConfigured = errors.New("el inicio de sesión con SSO no está configurado")
+
+// ErrOIDCLoginFailed is returned for any invalid callback (state, code, ID token or claims).
+var ErrOIDCLoginFailed = errors.New("no se pudo completar el inicio de sesión con SSO")
+
+// ErrOIDCUserNotAllowed is returned when the IdP account cannot be mapped onto a user.
+var ErrOIDCUserNotAllowed = errors.New("tu cuenta no tiene acceso a Mellon Harmony")
+
+// OIDCConfig holds the OpenID Connect client settings.
+type OIDCConfig struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string   // this API's /auth/oidc/callback URL, registered at the IdP
+	Scopes       []string // defaults to openid, email, profile
+	// AutoProvision creates a RoleUser account for unknown emails; otherwise only existing users may sign in.
+	AutoProvision bool
+	// AllowedDomains restricts which email domains may sign in (empty = any).
+	AllowedDomains []string
+}
+
+// OIDCService implements the authorization-code flow with PKCE against a single identity provider.
+type OIDCService interface {
+	IsConfigured() bool
+	// AuthorizationURL returns the IdP URL and the state it carries; the caller binds the state to
+	// the browser (a cookie checked in the callback) so a login cannot be started elsewhere.
+	AuthorizationURL() (authURL, state string, err error)
+	HandleCallback(code, state string) (*models.User, error)
+	// IssueLoginCode returns a single-use code for the user, redeemed by RedeemLoginCode.
+	IssueLoginCode(user *models.User) (string, error)
+	RedeemLoginCode(code string) (*models.User, error)
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type oidcService struct {
+	cfg        OIDCConfig
+	userRepo   repository.UserRepository
+	stateRepo  repository.OIDCStateRepository
+	httpClient *http.Client
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]*rsa.PublicKey
+}
+
+func NewOIDCService(cfg OIDCConfig, userRepo repository.UserRepository, stateRepo repository.OIDCStateRepository) OIDCService {
+	cfg.IssuerURL = strings.TrimSuffix(cfg.IssuerURL, "/")
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	return &oidcService{
+		cfg:        cfg,
+		userRepo:   userRepo,
+		stateRepo:  stateRepo,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (s *oidcService) IsConfigured() bool {
+	return s.cfg.IssuerURL != "" && s.cfg.ClientID != "" && s.cfg.RedirectURL != ""
+}
+
+// AuthorizationURL stores a fresh state/nonce/PKCE verifier and returns the IdP URL to redirect to.
+func (s *oidcService) AuthorizationURL() (string, string, error) {
+	if !s.IsConfigured() {
+		return "", "", ErrOIDCNotConfigured
+	}
+	discovery, err := s.getDiscovery()
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := randomURLToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomURLToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := randomURLToken(48)
+	if err != nil {
+		return "", "", err
+	}
+	_ = s.stateRepo.DeleteExpired()
+	if err := s.stateRepo.Create(&models.OIDCLoginState{
+		StateHash:    hashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(OIDCStateTTL),
+	}); err != nil {
+		return "", "", err
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", s.cfg.ClientID)
+	params.Set("redirect_uri", s.cfg.RedirectURL)
+	params.Set("scope", strings.Join(s.cfg.Scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	params.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + params.Encode(), state, nil
+}
+
+func (s *oidcService) IssueLoginCode(user *models.User) (string, error) {
+	code, err := randomURLToken(32)
+	if err != nil {
+		return "", err
+	}
+	if err := s.stateRepo.CreateCode(&models.OIDCLoginCode{
+		CodeHash:  hashToken(code),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(oidcLoginCodeTTL),
+	}); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// RedeemLoginCode consumes a code from IssueLoginCode and returns its user.
+func (s *oidcService) RedeemLoginCode(code string) (*models.User, error) {
+	if code == "" {
+		return nil, ErrOIDCLoginFailed
+	}
+	loginCode, err := s.stateRepo.ConsumeCode(hashToken(code))
+	if err != nil {
+		return nil, ErrOIDCLoginFailed
+	}
+	user, err := s.userRepo.GetByID(loginCode.UserID)
+	if err != nil {
+		return nil, ErrOIDCLoginFailed
+	}
+	return user, nil
+}
+
+// HandleCallback exchanges the authorization code, validates the ID token and returns the
+// user matching its email claim (provisioning one if enabled).
+func (s *oidcService) HandleCallback(code, state string) (*models.User, error) {
+	if !s.IsConfigured() {
+		return nil, ErrOIDCNotConfigured
+	}
+	if code == "" || state == "" {
+		return nil, ErrOIDCLoginFailed
+	}
+	loginState, err := s.stateRepo.Consume(hashToken(state))
+	if err != nil {
+		return nil, ErrOIDCLoginFailed
+	}
+
+	idToken, err := s.exchangeCode(code, loginState.CodeVerifier)
+	if err != nil {
+		log.Printf("OIDC code exchange failed: %v", err)
+		return nil, ErrOIDCLoginFailed
+	}
+	claims, err := s.verifyIDToken(idToken, loginState.Nonce)
+	if err != nil {
+		log.Printf("OIDC ID token rejected: %v", err)
+		return nil, ErrOIDCLoginFailed
+	}
+
+	email, _ := claims["email"].(string)
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return nil, ErrOIDCUserNotAllowed
+	}
+	// Providers that send email_verified=false must not be trusted to map onto existing accounts
+	verified, present := claims["email_verified"]
+	emailVerified := verified == true || verified == "true"
+	if present && !emailVerified {
+		return nil, ErrOIDCUserNotAllowed
+	}
+	if !emailInDomains(email, s.cfg.AllowedDomains) {
+		return nil, ErrOIDCUserNotAllowed
+	}
+
+	user, err := s.userRepo.GetByEmail(email)
+	if err == nil {
+		if emailVerified && !user.IsEmailVerified() {
+			now := time.Now()
+			user.EmailVerifiedAt = &now
+			if err := s.userRepo.Update(user); err != nil {
+				log.Printf("Failed to mark %s as verified after SSO login: %v", email, err)
+			}
+		}
+		return user, nil
+	}
+	if !s.cfg.AutoProvision {
+		return nil, ErrOIDCUserNotAllowed
+	}
+	return s.provisionUser(email, emailVerified, claims)
+}
+
+func (s *oidcService) provisionUser(email string, emailVerified bool, claims jwt.MapClaims) (*models.User, error) {
+	name, _ := claims["name"].(string)
+	if strings.TrimSpace(name) == "" {
+		name = strings.Split(email, "@")[0]
+	}
+	// SSO users get an unusable random password; they can set one later via password reset if allowed
+	randomPassword, err := randomURLToken(32)
+	if err != nil {
+		return nil, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(randomPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	user := &models.User{
+		Name:     name,
+		Email:    email,
+		Password: string(hashedPassword),
+		Role:     models.RoleUser,
+	}
+	if emailVerified {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+	if err := s.userRepo.Create(user); err != nil {
+		return nil, err
+	}
+	log.Printf("Provisioned user %s from SSO login", email)
+	return user, nil
+}
+
+func (s *oidcService) exchangeCode(code, verifier string) (string, error) {
+	discovery, err := s.getDiscovery()
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", s.cfg.RedirectURL)
+	form.Set("client_id", s.cfg.ClientID)
+	form.Set("code_verifier", verifier)
+
+	req, err := http.NewRequest(http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if s.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(s.cfg.ClientID), url.QueryEscape(s.cfg.ClientSecret))
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned %s", resp.Status)
+	}
+	var body struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	if body.IDToken == "" {
+		return "", errors.New("token response has no id_token")
+	}
+	return body.IDToken, nil
+}
+
+func (s *oidcService) verifyIDToken(idToken, nonce string) (jwt.MapClaims, error) {
+	discovery, err := s.getDiscovery()
+	if err != nil {
+		return nil, err
+	}
+	token, err := jwt.Parse(idToken, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return s.getKey(kid)
+	},
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithIssuer(discovery.Issuer),
+		jwt.WithAudience(s.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil || !token.Valid {
+		return nil, fmt.Errorf("invalid id_token: %v", err)
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid id_token claims")
+	}
+	if claims["nonce"] != nonce {
+		return nil, errors.New("nonce mismatch")
+	}
+	return claims, nil
+}
+
+func (s *oidcService) getDiscovery() (*oidcDiscovery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.discovery != nil {
+		return s.discovery, nil
+	}
+	var discovery oidcDiscovery
+	if err := s.getJSON(s.cfg.IssuerURL+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed: %w", err)
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != s.cfg.IssuerURL {
+		return nil, fmt.Errorf("OIDC discovery issuer %q does not match %q", discovery.Issuer, s.cfg.IssuerURL)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("OIDC discovery document is incomplete")
+	}
+	s.discovery = &discovery
+	return s.discovery, nil
+}
+
+// getKey returns the signing key for kid, reloading the JWKS once when the IdP has rotated keys.
+func (s *oidcService) getKey(kid string) (*rsa.PublicKey, error) {
+	discovery, err := s.getDiscovery()
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if key, ok := s.keys[kid]; ok {
+		return key, nil
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := s.getJSON(discovery.JWKSURI, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to load JWKS: %w", err)
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	s.keys = keys
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (s *oidcService) getJSON(rawURL string, out interface{}) error {
+	resp, err := s.httpClient.Get(rawURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %s", rawURL, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// randomURLToken returns n random bytes encoded as unpadded base64url.
+func randomURLToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.New("no se pudo generar un valor aleatorio")
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// emailInDomains reports whether email belongs to one of domains (an empty list matches everything).
+func emailInDomains(email string, domains []string) bool {
+	if len(domains) == 0 {
+		return true
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+	for _, d := range domains {
+		if strings.EqualFold(strings.TrimPrefix(strings.TrimSpace(d), "@"), domain) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"mellon-harmony-api/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testIdentityProvider serves discovery, JWKS and a token endpoint that returns an ID token
+// built from claims, with the nonce of the login being completed.
+type testIdentityProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	claims jwt.MapClaims
+	// nonce is copied into the ID token; the test sets it from the stored login state
+	nonce string
+}
+
+func newTestIdentityProvider(t *testing.T) *testIdentityProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &testIdentityProvider{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                idp.server.URL,
+			AuthorizationEndpoint: idp.server.URL + "/authorize",
+			TokenEndpoint:         idp.server.URL + "/token",
+			JWKSURI:               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kid": "test",
+			"kty": "RSA",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		claims := jwt.MapClaims{
+			"iss":   idp.server.URL,
+			"aud":   "mellon",
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"nonce": idp.nonce,
+		}
+		for k, v := range idp.claims {
+			claims[k] = v
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "test"
+		signed, err := token.SignedString(key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": signed})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// startLogin begins a login and returns the state the IdP redirects back with.
+func (idp *testIdentityProvider) startLogin(t *testing.T, s OIDCService, states *memoryOIDCStateRepository) string {
+	t.Helper()
+	authURL, state, err := s.AuthorizationURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _ := url.Parse(authURL)
+	if parsed.Query().Get("state") != state || parsed.Query().Get("code_challenge_method") != "S256" {
+		t.Fatalf("unexpected authorization URL %s", authURL)
+	}
+	idp.nonce = states.states[hashToken(state)].Nonce
+	return state
+}
+
+func TestOIDCServiceHandleCallback(t *testing.T) {
+	existing := &models.User{Email: "ana@example.com", Role: models.RoleTeamLead}
+	tests := []struct {
+		name          string
+		claims        jwt.MapClaims
+		autoProvision bool
+		domains       []string
+		wantErr       error
+		wantEmail     string
+	}{
+		{"existing user", jwt.MapClaims{"email": "Ana@Example.com", "email_verified": true}, false, nil, nil, "ana@example.com"},
+		{"unverified email", jwt.MapClaims{"email": "ana@example.com", "email_verified": false}, false, nil, ErrOIDCUserNotAllowed, ""},
+		{"no email", jwt.MapClaims{}, false, nil, ErrOIDCUserNotAllowed, ""},
+		{"domain not allowed", jwt.MapClaims{"email": "ana@example.com"}, false, []string{"mellon.dev"}, ErrOIDCUserNotAllowed, ""},
+		{"unknown user", jwt.MapClaims{"email": "luis@example.com"}, false, nil, ErrOIDCUserNotAllowed, ""},
+		{"unknown user provisioned", jwt.MapClaims{"email": "luis@example.com", "name": "Luis"}, true, nil, nil, "luis@example.com"},
+		{"wrong nonce", jwt.MapClaims{"email": "ana@example.com", "nonce": "other"}, false, nil, ErrOIDCLoginFailed, ""},
+		{"wrong audience", jwt.MapClaims{"email": "ana@example.com", "aud": "someone-else"}, false, nil, ErrOIDCLoginFailed, ""},
+		{"expired token", jwt.MapClaims{"email": "ana@example.com", "exp": time.Now().Add(-time.Hour).Unix()}, false, nil, ErrOIDCLoginFailed, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newTestIdentityProvider(t)
+			idp.claims = tt.claims
+			users := newMemoryUserRepository(existing)
+			states := newMemoryOIDCStateRepository()
+			s := NewOIDCService(OIDCConfig{
+				IssuerURL:      idp.server.URL,
+				ClientID:       "mellon",
+				RedirectURL:    "https://api.example.com/auth/oidc/callback",
+				AutoProvision:  tt.autoProvision,
+				AllowedDomains: tt.domains,
+			}, users, states)
+
+			state := idp.startLogin(t, s, states)
+			user, err := s.HandleCallback("code", state)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("HandleCallback error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if user.Email != tt.wantEmail {
+				t.Errorf("HandleCallback user = %s, want %s", user.Email, tt.wantEmail)
+			}
+			if tt.autoProvision && user.Role != models.RoleUser {
+				t.Errorf("provisioned role = %s, want %s", user.Role, models.RoleUser)
+			}
+		})
+	}
+}
+
+func TestOIDCServiceHandleCallbackStateIsSingleUse(t *testing.T) {
+	idp := newTestIdentityProvider(t)
+	idp.claims = jwt.MapClaims{"email": "ana@example.com"}
+	states := newMemoryOIDCStateRepository()
+	s := NewOIDCService(OIDCConfig{IssuerURL: idp.server.URL, ClientID: "mellon", RedirectURL: "https://api.example.com/cb"},
+		newMemoryUserRepository(&models.User{Email: "ana@example.com"}), states)
+
+	state := idp.startLogin(t, s, states)
+	if _, err := s.HandleCallback("code", state); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.HandleCallback("code", state); !errors.Is(err, ErrOIDCLoginFailed) {
+		t.Errorf("replayed callback = %v, want %v", err, ErrOIDCLoginFailed)
+	}
+	if _, err := s.HandleCallback("code", "never-issued"); !errors.Is(err, ErrOIDCLoginFailed) {
+		t.Errorf("unknown state = %v, want %v", err, ErrOIDCLoginFailed)
+	}
+
+	expired := idp.startLogin(t, s, states)
+	stored := states.states[hashToken(expired)]
+	stored.ExpiresAt = time.Now().Add(-time.Second)
+	states.states[hashToken(expired)] = stored
+	if _, err := s.HandleCallback("code", expired); !errors.Is(err, ErrOIDCLoginFailed) {
+		t.Errorf("expired state = %v, want %v", err, ErrOIDCLoginFailed)
+	}
+}
+
+func TestOIDCServiceRedeemLoginCode(t *testing.T) {
+	user := &models.User{Email: "ana@example.com"}
+	states := newMemoryOIDCStateRepository()
+	s := NewOIDCService(OIDCConfig{}, newMemoryUserRepository(user), states)
+
+	code, err := s.IssueLoginCode(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.RedeemLoginCode(code); err != nil || got.ID != user.ID {
+		t.Fatalf("RedeemLoginCode = %v, %v; want %s", got, err, user.ID)
+	}
+	if _, err := s.RedeemLoginCode(code); !errors.Is(err, ErrOIDCLoginFailed) {
+		t.Errorf("redeemed twice: %v, want %v", err, ErrOIDCLoginFailed)
+	}
+	if _, err := s.RedeemLoginCode(""); !errors.Is(err, ErrOIDCLoginFailed) {
+		t.Errorf("empty code: %v, want %v", err, ErrOIDCLoginFailed)
+	}
+}
+
+func TestEmailInDomains(t *testing.T) {
+	tests := []struct {
+		email   string
+		domains []string
+		want    bool
+	}{
+		{"ana@example.com", nil, true},
+		{"ana@example.com", []string{"example.com"}, true},
+		{"ana@Example.COM", []string{" @example.com "}, true},
+		{"ana@mail.example.com", []string{"example.com"}, false},
+		{"ana@example.com.evil.io", []string{"example.com"}, false},
+		{"example.com", []string{"example.com"}, false},
+	}
+	for _, tt := range tests {
+		if got := emailInDomains(tt.email, tt.domains); got != tt.want {
+			t.Errorf("emailInDomains(%q, %v) = %v, want %v", tt.email, tt.domains, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package service
+
+import (
+	"bufio"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+const (
+	defaultPasswordMinLength  = 8
+	defaultPasswordMinClasses = 3
+	// bcrypt ignores (and newer versions reject) anything past 72 bytes
+	passwordMaxBytes = 72
+)
+
+// bundledBreachList holds SHA-1 hashes of the most common leaked passwords. Point
+// PASSWORD_BREACH_LIST at a full Pwned Passwords download for broader coverage.
+//
+//go:embed data/breached_passwords.txt
+var bundledBreachList string
+
+// Password policy violation codes, returned to clients in PasswordPolicyError.
+const (
+	PasswordTooShort     = "too_short"
+	PasswordTooLong      = "too_long"
+	PasswordCharClasses  = "char_classes"
+	PasswordPersonalInfo = "personal_info"
+	PasswordBreached     = "breached"
+)
+
+// ErrPasswordPolicy matches (errors.Is) every PasswordPolicyError.
+var ErrPasswordPolicy = errors.New("password does not meet the policy")
+
+// PasswordViolation is one rule the password failed.
+type PasswordViolation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicyError lists every rule a new password failed, so the UI can show them all at once.
+type PasswordPolicyError struct {
+	Violations []PasswordViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return "La contraseña no cumple los requisitos: " + strings.Join(messages, "; ")
+}
+
+func (e *PasswordPolicyError) Is(target error) bool {
+	return target == ErrPasswordPolicy
+}
+
+// PasswordPolicyConfig configures password requirements for new passwords.
+type PasswordPolicyConfig struct {
+	MinLength  int
+	MinClasses int // of lowercase, uppercase, digits and symbols (0-4)
+	// DisallowPersonalInfo rejects passwords containing the user's name or email.
+	DisallowPersonalInfo bool
+	// CheckBreached rejects passwords found in the breach list.
+	CheckBreached bool
+	// BreachListPath overrides the bundled list: either a file of SHA-1 hashes ("HASH" or
+	// "HASH:COUNT" per line) or a directory of range files named by 5-character hash prefix
+	// ("ABCDE.txt" containing "SUFFIX:COUNT" lines), as produced by the Pwned Passwords downloader.
+	BreachListPath string
+}
+
+// PasswordPolicy validates new passwords on registration, reset and change.
+type PasswordPolicy struct {
+	cfg    PasswordPolicyConfig
+	breach *breachList
+}
+
+func NewPasswordPolicy(cfg PasswordPolicyConfig) (*PasswordPolicy, error) {
+	if cfg.MinLength <= 0 {
+		cfg.MinLength = defaultPasswordMinLength
+	}
+	if cfg.MinClasses < 0 || cfg.MinClasses > 4 {
+		cfg.MinClasses = defaultPasswordMinClasses
+	}
+	policy := &PasswordPolicy{cfg: cfg}
+	if cfg.CheckBreached {
+		breach, err := loadBreachList(cfg.BreachListPath)
+		if err != nil {
+			return nil, err
+		}
+		policy.breach = breach
+	}
+	return policy, nil
+}
+
+// MinLength is the configured minimum number of characters.
+func (p *PasswordPolicy) MinLength() int {
+	return p.cfg.MinLength
+}
+
+// Validate returns a *PasswordPolicyError describing every failed rule, or nil.
+func (p *PasswordPolicy) Validate(password, email, name string) error {
+	var violations []PasswordViolation
+	add := func(code, message string) {
+		violations = append(violations, PasswordViolation{Code: code, Message: message})
+	}
+
+	if len([]rune(password)) < p.cfg.MinLength {
+		add(PasswordTooShort, fmt.Sprintf("debe tener al menos %d caracteres", p.cfg.MinLength))
+	}
+	if len(password) > passwordMaxBytes {
+		add(PasswordTooLong, fmt.Sprintf("no puede superar %d bytes", passwordMaxBytes))
+	}
+	if p.cfg.MinClasses > 0 && characterClasses(password) < p.cfg.MinClasses {
+		add(PasswordCharClasses, fmt.Sprintf("debe combinar al menos %d de: minúsculas, mayúsculas, números y símbolos", p.cfg.MinClasses))
+	}
+	if p.cfg.DisallowPersonalInfo && containsPersonalInfo(password, email, name) {
+		add(PasswordPersonalInfo, "no puede contener tu nombre ni tu correo")
+	}
+	if p.breach != nil && p.breach.contains(password) {
+		add(PasswordBreached, "aparece en filtraciones de datos conocidas; elige otra")
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	count := 0
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			count++
+		}
+	}
+	return count
+}
+
+// containsPersonalInfo checks the email, its local part and each name word of 3+ characters.
+func containsPersonalInfo(password, email, name string) bool {
+	lowered := strings.ToLower(password)
+	var parts []string
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email != "" {
+		parts = append(parts, email, strings.Split(email, "@")[0])
+	}
+	parts = append(parts, strings.Fields(strings.ToLower(name))...)
+	for _, part := range parts {
+		if len([]rune(part)) >= 3 && strings.Contains(lowered, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// breachList looks passwords up by SHA-1 using k-anonymity ranges: the 5-character hash prefix
+// selects a bucket of suffixes, so a directory source only ever reads one small file per check.
+type breachList struct {
+	dir     string              // directory of prefix range files, read on demand
+	buckets map[string][]string // in-memory prefix -> suffixes (bundled list or single file)
+}
+
+func loadBreachList(path string) (*breachList, error) {
+	if path == "" {
+		list := &breachList{buckets: map[string][]string{}}
+		if err := list.load(strings.NewReader(bundledBreachList)); err != nil {
+			return nil, fmt.Errorf("bundled password breach list: %w", err)
+		}
+		return list, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("password breach list: %w", err)
+	}
+	if info.IsDir() {
+		return &breachList{dir: path}, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("password breach list: %w", err)
+	}
+	defer f.Close()
+	list := &breachList{buckets: map[string][]string{}}
+	if err := list.load(f); err != nil {
+		return nil, fmt.Errorf("password breach list: %w", err)
+	}
+	return list, nil
+}
+
+// load reads "HASH" or "HASH:COUNT" lines (40 hex characters, any case); blank lines and # comments are skipped.
+func (b *breachList) load(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hash := strings.ToUpper(strings.SplitN(line, ":", 2)[0])
+		if len(hash) != 40 {
+			continue
+		}
+		b.buckets[hash[:5]] = append(b.buckets[hash[:5]], hash[5:])
+	}
+	return scanner.Err()
+}
+
+func (b *breachList) contains(password string) bool {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	if b.dir == "" {
+		for _, candidate := range b.buckets[prefix] {
+			if candidate == suffix {
+				return true
+			}
+		}
+		return false
+	}
+
+	f, err := os.Open(filepath.Join(b.dir, prefix+".txt"))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if strings.EqualFold(strings.SplitN(strings.TrimSpace(scanner.Text()), ":", 2)[0], suffix) {
+			return true
+		}
+	}
+	return false
+}
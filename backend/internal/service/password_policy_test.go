@@ -0,0 +1,136 @@
+package service
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	strict := PasswordPolicyConfig{MinLength: 10, MinClasses: 3, DisallowPersonalInfo: true}
+	tests := []struct {
+		name     string
+		cfg      PasswordPolicyConfig
+		password string
+		want     []string // violation codes, in order
+	}{
+		{"valid", strict, "Tr1angle-Sky", nil},
+		{"too short", strict, "Tr1-Sky", []string{PasswordTooShort}},
+		{"length counts characters", PasswordPolicyConfig{MinLength: 4, MinClasses: 0}, "ñññ", []string{PasswordTooShort}},
+		{"too long", strict, "Aa1-" + strings.Repeat("x", passwordMaxBytes), []string{PasswordTooLong}},
+		{"two classes", strict, "triangle-sky", []string{PasswordCharClasses}},
+		{"no classes required", PasswordPolicyConfig{MinLength: 8, MinClasses: 0}, "aaaaaaaa", nil},
+		{"four classes required", PasswordPolicyConfig{MinLength: 8, MinClasses: 4}, "Triangle1sky", []string{PasswordCharClasses}},
+		{"name", strict, "Xx-Garcia-2026", []string{PasswordPersonalInfo}},
+		{"email local part", strict, "ANA.GARCIA!99", []string{PasswordPersonalInfo}},
+		{"short name words are allowed", strict, "Tr1angle-Al", nil},
+		{"personal info allowed", PasswordPolicyConfig{MinLength: 10, MinClasses: 3}, "Xx-Garcia-2026", nil},
+		{"every failed rule", strict, "garcia", []string{PasswordTooShort, PasswordCharClasses, PasswordPersonalInfo}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := NewPasswordPolicy(tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = policy.Validate(tt.password, "ana.garcia@example.com", "Al Garcia")
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("Validate(%q) = %v, want nil", tt.password, err)
+				}
+				return
+			}
+			var policyErr *PasswordPolicyError
+			if !errors.As(err, &policyErr) || !errors.Is(err, ErrPasswordPolicy) {
+				t.Fatalf("Validate(%q) = %v, want a PasswordPolicyError", tt.password, err)
+			}
+			var codes []string
+			for _, v := range policyErr.Violations {
+				codes = append(codes, v.Code)
+			}
+			if !reflect.DeepEqual(codes, tt.want) {
+				t.Errorf("Validate(%q) violations = %v, want %v", tt.password, codes, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewPasswordPolicyDefaults(t *testing.T) {
+	tests := []struct {
+		name           string
+		cfg            PasswordPolicyConfig
+		wantMinLength  int
+		wantMinClasses int
+	}{
+		{"zero length", PasswordPolicyConfig{MinLength: 0, MinClasses: 2}, defaultPasswordMinLength, 2},
+		{"no classes", PasswordPolicyConfig{MinLength: 12, MinClasses: 0}, 12, 0},
+		{"negative classes", PasswordPolicyConfig{MinLength: 12, MinClasses: -1}, 12, defaultPasswordMinClasses},
+		{"too many classes", PasswordPolicyConfig{MinLength: 12, MinClasses: 5}, 12, defaultPasswordMinClasses},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := NewPasswordPolicy(tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if policy.MinLength() != tt.wantMinLength || policy.cfg.MinClasses != tt.wantMinClasses {
+				t.Errorf("got length %d, classes %d; want %d, %d", policy.MinLength(), policy.cfg.MinClasses, tt.wantMinLength, tt.wantMinClasses)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicyBreachList(t *testing.T) {
+	const leaked = "Leaked-Passw0rd"
+	hash := sha1Hex(leaked)
+
+	file := filepath.Join(t.TempDir(), "pwned.txt")
+	list := "# comment\n\n" + sha1Hex("other") + ":3\n" + strings.ToLower(hash) + ":12\n"
+	if err := os.WriteFile(file, []byte(list), 0600); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, hash[:5]+".txt"), []byte(hash[5:]+":12\r\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		password string
+		want     bool
+	}{
+		{"file, leaked", file, leaked, true},
+		{"file, not leaked", file, "Unl1sted-Sky", false},
+		{"directory, leaked", dir, leaked, true},
+		{"directory, no range file", dir, "Unl1sted-Sky", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := NewPasswordPolicy(PasswordPolicyConfig{MinLength: 8, MinClasses: 0, CheckBreached: true, BreachListPath: tt.path})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = policy.Validate(tt.password, "", "")
+			var policyErr *PasswordPolicyError
+			got := errors.As(err, &policyErr) && len(policyErr.Violations) == 1 && policyErr.Violations[0].Code == PasswordBreached
+			if got != tt.want {
+				t.Errorf("Validate(%q) = %v, want breached %v", tt.password, err, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewPasswordPolicy(PasswordPolicyConfig{CheckBreached: true, BreachListPath: filepath.Join(dir, "missing")}); err == nil {
+		t.Error("a missing breach list should fail")
+	}
+}
@@ -0,0 +1,289 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"mellon-harmony-api/internal/models"
+	"mellon-harmony-api/internal/repository"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// roleCacheTTL bounds how long another instance's role edits take to apply here.
+const roleCacheTTL = time.Minute
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{1,19}$`)
+
+// ErrRoleNotFound is returned for unknown role names.
+var ErrRoleNotFound = errors.New("rol no encontrado")
+
+// ErrRoleExists is returned when creating a role whose name is taken.
+var ErrRoleExists = errors.New("ya existe un rol con ese nombre")
+
+// ErrInvalidRole is returned for malformed role names or unknown permissions.
+var ErrInvalidRole = errors.New("nombre de rol o permisos no válidos; el nombre usa minúsculas, números y _ (2-20 caracteres)")
+
+// ErrRoleProtected is returned when editing the admin role or deleting a built-in role.
+var ErrRoleProtected = errors.New("este rol no se puede modificar")
+
+// ErrPermissionEscalation is returned when someone grants a permission or role they do not hold themselves.
+var ErrPermissionEscalation = errors.New("no puedes otorgar permisos o roles que no tienes")
+
+// ErrRoleInUse is returned when deleting a role that users still have.
+var ErrRoleInUse = errors.New("hay usuarios con este rol; asígnales otro antes de eliminarlo")
+
+// PermissionService answers what each role may do and manages custom roles.
+// Handlers ask it for named permissions instead of comparing role names.
+type PermissionService interface {
+	HasPermission(user *models.User, permission string) bool
+	// UserHasPermission loads the user so role changes apply without signing in again.
+	UserHasPermission(userID uuid.UUID, permission string) bool
+	RoleExists(name models.UserRole) bool
+	// CanGrantRole reports whether actor may give role to a user (or manage users who have it):
+	// admin only for the admin role, otherwise only roles whose permissions the actor holds.
+	CanGrantRole(actor *models.User, role models.UserRole) bool
+	ListRoles() ([]models.Role, error)
+	// CreateRole and UpdateRole refuse to grant permissions the actor does not hold (ErrPermissionEscalation).
+	CreateRole(actor *models.User, name models.UserRole, label, description string, permissions []string, meta models.AuditMeta) (*models.Role, error)
+	UpdateRole(actor *models.User, name models.UserRole, label, description *string, permissions []string, meta models.AuditMeta) (*models.Role, error)
+	DeleteRole(name models.UserRole, meta models.AuditMeta) error
+}
+
+type permissionService struct {
+	roleRepo     repository.RoleRepository
+	userRepo     repository.UserRepository
+	auditService AuditService
+
+	mu       sync.RWMutex
+	roles    map[models.UserRole]map[string]bool
+	loadedAt time.Time
+}
+
+func NewPermissionService(roleRepo repository.RoleRepository, userRepo repository.UserRepository, auditService AuditService) PermissionService {
+	return &permissionService{
+		roleRepo:     roleRepo,
+		userRepo:     userRepo,
+		auditService: auditService,
+	}
+}
+
+func (s *permissionService) HasPermission(user *models.User, permission string) bool {
+	if user == nil {
+		return false
+	}
+	// Admins always hold every permission, so a bad edit can never lock everyone out
+	if user.Role == models.RoleAdmin {
+		return true
+	}
+	return s.rolePermissions()[user.Role][permission]
+}
+
+func (s *permissionService) UserHasPermission(userID uuid.UUID, permission string) bool {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return false
+	}
+	return s.HasPermission(user, permission)
+}
+
+func (s *permissionService) RoleExists(name models.UserRole) bool {
+	_, ok := s.rolePermissions()[name]
+	return ok
+}
+
+func (s *permissionService) CanGrantRole(actor *models.User, role models.UserRole) bool {
+	if actor == nil {
+		return false
+	}
+	if actor.Role == models.RoleAdmin {
+		return true
+	}
+	if role == models.RoleAdmin {
+		return false
+	}
+	for permission := range s.rolePermissions()[role] {
+		if !s.HasPermission(actor, permission) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkGrant returns ErrPermissionEscalation if actor lacks any of permissions.
+func (s *permissionService) checkGrant(actor *models.User, permissions []string) error {
+	for _, p := range permissions {
+		if !s.HasPermission(actor, p) {
+			return ErrPermissionEscalation
+		}
+	}
+	return nil
+}
+
+func (s *permissionService) ListRoles() ([]models.Role, error) {
+	return s.roleRepo.GetAll()
+}
+
+func (s *permissionService) CreateRole(actor *models.User, name models.UserRole, label, description string, permissions []string, meta models.AuditMeta) (*models.Role, error) {
+	name = models.UserRole(strings.ToLower(strings.TrimSpace(string(name))))
+	if !roleNamePattern.MatchString(string(name)) {
+		return nil, ErrInvalidRole
+	}
+	perms, err := normalizePermissions(permissions)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkGrant(actor, perms); err != nil {
+		return nil, err
+	}
+	if _, err := s.roleRepo.GetByName(name); err == nil {
+		return nil, ErrRoleExists
+	}
+
+	label = strings.TrimSpace(label)
+	if label == "" {
+		label = string(name)
+	}
+	role := &models.Role{
+		Name:        name,
+		Label:       label,
+		Description: strings.TrimSpace(description),
+	}
+	role.SetPermissions(perms)
+	if err := s.roleRepo.Create(role); err != nil {
+		return nil, err
+	}
+	s.invalidate()
+	s.auditService.Record(meta, models.AuditCreate, "role", string(role.Name), nil, auditSnapshot(role))
+	return role, nil
+}
+
+// UpdateRole changes a role's label, description and, when permissions is non-nil, its permission set.
+// Permissions the role already has may be kept or removed; only added ones must be held by actor.
+func (s *permissionService) UpdateRole(actor *models.User, name models.UserRole, label, description *string, permissions []string, meta models.AuditMeta) (*models.Role, error) {
+	role, err := s.roleRepo.GetByName(name)
+	if err != nil {
+		return nil, ErrRoleNotFound
+	}
+	if role.Name == models.RoleAdmin {
+		return nil, ErrRoleProtected
+	}
+	before := auditSnapshot(role)
+
+	if label != nil && strings.TrimSpace(*label) != "" {
+		role.Label = strings.TrimSpace(*label)
+	}
+	if description != nil {
+		role.Description = strings.TrimSpace(*description)
+	}
+	if permissions != nil {
+		perms, err := normalizePermissions(permissions)
+		if err != nil {
+			return nil, err
+		}
+		current := map[string]bool{}
+		for _, p := range role.GetPermissions() {
+			current[p] = true
+		}
+		var added []string
+		for _, p := range perms {
+			if !current[p] {
+				added = append(added, p)
+			}
+		}
+		if err := s.checkGrant(actor, added); err != nil {
+			return nil, err
+		}
+		role.SetPermissions(perms)
+	}
+	if err := s.roleRepo.Update(role); err != nil {
+		return nil, err
+	}
+	s.invalidate()
+	s.auditService.Record(meta, models.AuditUpdate, "role", string(role.Name), before, auditSnapshot(role))
+	return role, nil
+}
+
+func (s *permissionService) DeleteRole(name models.UserRole, meta models.AuditMeta) error {
+	role, err := s.roleRepo.GetByName(name)
+	if err != nil {
+		return ErrRoleNotFound
+	}
+	if role.BuiltIn {
+		return ErrRoleProtected
+	}
+	count, err := s.roleRepo.CountUsers(name)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrRoleInUse
+	}
+	if err := s.roleRepo.Delete(name); err != nil {
+		return err
+	}
+	s.invalidate()
+	s.auditService.Record(meta, models.AuditDelete, "role", string(name), auditSnapshot(role), nil)
+	return nil
+}
+
+// rolePermissions returns the cached role -> permission set map, reloading it when stale.
+// If the roles cannot be loaded the previous map is kept (empty on startup, which denies everything but admin).
+func (s *permissionService) rolePermissions() map[models.UserRole]map[string]bool {
+	s.mu.RLock()
+	roles, fresh := s.roles, time.Since(s.loadedAt) < roleCacheTTL
+	s.mu.RUnlock()
+	if fresh {
+		return roles
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.roles != nil && time.Since(s.loadedAt) < roleCacheTTL {
+		return s.roles
+	}
+	all, err := s.roleRepo.GetAll()
+	if err != nil {
+		log.Printf("Failed to load roles: %v", err)
+		return s.roles
+	}
+	loaded := make(map[models.UserRole]map[string]bool, len(all))
+	for _, role := range all {
+		set := map[string]bool{}
+		for _, p := range role.GetPermissions() {
+			set[p] = true
+		}
+		loaded[role.Name] = set
+	}
+	s.roles = loaded
+	s.loadedAt = time.Now()
+	return loaded
+}
+
+func (s *permissionService) invalidate() {
+	s.mu.Lock()
+	s.loadedAt = time.Time{}
+	s.mu.Unlock()
+}
+
+// normalizePermissions validates and de-duplicates permissions, keeping the canonical order.
+func normalizePermissions(permissions []string) ([]string, error) {
+	requested := map[string]bool{}
+	for _, p := range permissions {
+		p = strings.TrimSpace(p)
+		if !models.IsPermission(p) {
+			return nil, ErrInvalidRole
+		}
+		requested[p] = true
+	}
+	result := []string{}
+	for _, p := range models.AllPermissions {
+		if requested[p.Name] {
+			result = append(result, p.Name)
+		}
+	}
+	return result, nil
+}
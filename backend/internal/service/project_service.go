@@ -13,10 +13,10 @@ var monthNamesES = []string{"", "Ene", "Feb", "Mar", "Abr", "May", "Jun", "Jul",
 type ProjectService interface {
 	GetProject(id uuid.UUID) (*models.Project, error)
 	GetAllProjects() ([]models.Project, error)
-	GetProjectsForUser(userID uuid.UUID, role string) ([]models.Project, error)
-	CreateProject(project *models.Project) error
-	UpdateProject(id uuid.UUID, updates map[string]interface{}) (*models.Project, error)
-	DeleteProject(id uuid.UUID) error
+	GetProjectsForUser(userID uuid.UUID, allClients bool, opts repository.ListOptions) ([]models.Project, int64, error)
+	CreateProject(project *models.Project, meta models.AuditMeta) error
+	UpdateProject(id uuid.UUID, updates map[string]interface{}, meta models.AuditMeta) (*models.Project, error)
+	DeleteProject(id uuid.UUID, meta models.AuditMeta) error
 	AddMember(projectID, userID uuid.UUID, role string) error
 	RemoveMember(projectID, userID uuid.UUID) error
 	BulkCreateMonthlyProjects(month, year int, clientIDs []uuid.UUID, types []string, createdBy uuid.UUID, addClientMembers bool) ([]models.Project, error)
@@ -27,14 +27,16 @@ type projectService struct {
 	userRepo         repository.UserRepository
 	clientRepo       repository.ClientRepository
 	clientMemberRepo repository.ClientMemberRepository
+	auditService     AuditService
 }
 
-func NewProjectService(projectRepo repository.ProjectRepository, userRepo repository.UserRepository, clientMemberRepo repository.ClientMemberRepository, clientRepo repository.ClientRepository) ProjectService {
+func NewProjectService(projectRepo repository.ProjectRepository, userRepo repository.UserRepository, clientMemberRepo repository.ClientMemberRepository, clientRepo repository.ClientRepository, auditService AuditService) ProjectService {
 	return &projectService{
 		projectRepo:      projectRepo,
 		userRepo:         userRepo,
 		clientMemberRepo: clientMemberRepo,
 		clientRepo:       clientRepo,
+		auditService:     auditService,
 	}
 }
 
@@ -46,44 +48,35 @@ func (s *projectService) GetAllProjects() ([]models.Project, error) {
 	return s.projectRepo.GetAll()
 }
 
-// GetProjectsForUser returns all projects for admin/team_lead; for regular users only projects whose client has the user as a member.
-func (s *projectService) GetProjectsForUser(userID uuid.UUID, role string) ([]models.Project, error) {
-	all, err := s.projectRepo.GetAll()
-	if err != nil {
-		return nil, err
-	}
-	if role == string(models.RoleAdmin) || role == string(models.RoleTeamLead) {
-		return all, nil
+// GetProjectsForUser returns one page of all projects when allClients is set (project.view_all); otherwise only of projects whose client has the user as a member.
+func (s *projectService) GetProjectsForUser(userID uuid.UUID, allClients bool, opts repository.ListOptions) ([]models.Project, int64, error) {
+	if allClients {
+		return s.projectRepo.List(nil, opts)
 	}
 	clientIDs, err := s.clientMemberRepo.GetClientIDsForUser(userID)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	if len(clientIDs) == 0 {
-		return []models.Project{}, nil
+		return []models.Project{}, 0, nil
 	}
-	set := make(map[uuid.UUID]bool)
-	for _, id := range clientIDs {
-		set[id] = true
-	}
-	var out []models.Project
-	for _, p := range all {
-		if p.ClientID != nil && set[*p.ClientID] {
-			out = append(out, p)
-		}
-	}
-	return out, nil
+	return s.projectRepo.List(clientIDs, opts)
 }
 
-func (s *projectService) CreateProject(project *models.Project) error {
-	return s.projectRepo.Create(project)
+func (s *projectService) CreateProject(project *models.Project, meta models.AuditMeta) error {
+	if err := s.projectRepo.Create(project); err != nil {
+		return err
+	}
+	s.auditService.Record(meta, models.AuditCreate, "project", project.ID.String(), nil, auditSnapshot(project))
+	return nil
 }
 
-func (s *projectService) UpdateProject(id uuid.UUID, updates map[string]interface{}) (*models.Project, error) {
+func (s *projectService) UpdateProject(id uuid.UUID, updates map[string]interface{}, meta models.AuditMeta) (*models.Project, error) {
 	project, err := s.projectRepo.GetByID(id)
 	if err != nil {
 		return nil, err
 	}
+	before := auditSnapshot(project)
 
 	if name, ok := updates["name"].(string); ok {
 		project.Name = name
@@ -113,12 +106,21 @@ func (s *projectService) UpdateProject(id uuid.UUID, updates map[string]interfac
 	if err := s.projectRepo.Update(project); err != nil {
 		return nil, err
 	}
+	s.auditService.Record(meta, models.AuditUpdate, "project", id.String(), before, auditSnapshot(project))
 
 	return s.projectRepo.GetByID(id)
 }
 
-func (s *projectService) DeleteProject(id uuid.UUID) error {
-	return s.projectRepo.Delete(id)
+func (s *projectService) DeleteProject(id uuid.UUID, meta models.AuditMeta) error {
+	project, err := s.projectRepo.GetByID(id)
+	if err != nil {
+		return err
+	}
+	if err := s.projectRepo.Delete(id); err != nil {
+		return err
+	}
+	s.auditService.Record(meta, models.AuditDelete, "project", id.String(), auditSnapshot(project), nil)
+	return nil
 }
 
 func (s *projectService) AddMember(projectID, userID uuid.UUID, role string) error {
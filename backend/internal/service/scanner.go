@@ -0,0 +1,174 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// ErrScannerUnavailable is returned when the virus scanner cannot be reached or fails to scan.
+var ErrScannerUnavailable = errors.New("virus scanner unavailable")
+
+// ErrScanSizeLimit is returned for files larger than the scanner accepts. Unlike ErrScannerUnavailable,
+// scanning the file again fails the same way.
+var ErrScanSizeLimit = errors.New("file exceeds the virus scanner size limit")
+
+// ScanResult is the verdict of a virus scan.
+type ScanResult struct {
+	Infected  bool
+	Signature string // name of the malware found, e.g. "Eicar-Test-Signature"
+}
+
+// Scanner checks file contents for malware.
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (*ScanResult, error)
+}
+
+// ScannerConfig selects and configures the virus scanner.
+type ScannerConfig struct {
+	Driver       string // "" or "none" (no scanning) or "clamd"
+	ClamdAddress string // host:port of clamd's TCP socket
+	Timeout      time.Duration
+}
+
+// NewScanner builds the configured scanner; it returns nil when scanning is disabled.
+func NewScanner(cfg ScannerConfig) (Scanner, error) {
+	switch cfg.Driver {
+	case "", "none":
+		return nil, nil
+	case "clamd":
+		if cfg.ClamdAddress == "" {
+			return nil, fmt.Errorf("clamd scanner requires an address")
+		}
+		return NewClamdScanner(cfg.ClamdAddress, cfg.Timeout), nil
+	}
+	return nil, fmt.Errorf("unknown scanner driver %q (use none or clamd)", cfg.Driver)
+}
+
+const (
+	defaultClamdTimeout = 5 * time.Minute
+	// clamdChunkSize must stay under clamd's StreamMaxLength of a single chunk
+	clamdChunkSize = 64 * 1024
+)
+
+// ClamdScanner scans files with ClamAV's daemon over its TCP socket, using the INSTREAM command.
+// Files larger than clamd's StreamMaxLength (25MB by default) fail with ErrScanSizeLimit, so raise
+// it to the largest upload allowed.
+type ClamdScanner struct {
+	address string
+	timeout time.Duration
+}
+
+func NewClamdScanner(address string, timeout time.Duration) *ClamdScanner {
+	if timeout <= 0 {
+		timeout = defaultClamdTimeout
+	}
+	return &ClamdScanner{address: address, timeout: timeout}
+}
+
+// Ping checks that clamd is reachable.
+func (s *ClamdScanner) Ping(ctx context.Context) error {
+	reply, err := s.command(ctx, "zPING\x00", nil)
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("%w: unexpected reply %q", ErrScannerUnavailable, reply)
+	}
+	return nil
+}
+
+func (s *ClamdScanner) Scan(ctx context.Context, r io.Reader) (*ScanResult, error) {
+	reply, err := s.command(ctx, "zINSTREAM\x00", r)
+	if err != nil {
+		return nil, err
+	}
+	// Replies are "stream: OK", "stream: {signature} FOUND" or "{message} ERROR", e.g.
+	// "INSTREAM size limit exceeded. ERROR" past StreamMaxLength
+	reply = strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case reply == "OK":
+		return &ScanResult{}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return &ScanResult{Infected: true, Signature: strings.TrimSuffix(reply, " FOUND")}, nil
+	case strings.Contains(reply, "size limit exceeded"):
+		return nil, fmt.Errorf("%w: %s", ErrScanSizeLimit, reply)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrScannerUnavailable, reply)
+}
+
+// command sends a null-terminated command to clamd, followed by stream in length-prefixed chunks
+// when given, and returns the reply.
+func (s *ClamdScanner) command(ctx context.Context, cmd string, stream io.Reader) (string, error) {
+	dialer := net.Dialer{Timeout: 10 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", s.address)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrScannerUnavailable, err)
+	}
+	defer conn.Close()
+	deadline := time.Now().Add(s.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	if _, err := io.WriteString(conn, cmd); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrScannerUnavailable, err)
+	}
+	if stream != nil {
+		if err := writeClamdStream(conn, stream); err != nil {
+			// clamd replies before closing the connection when the stream exceeds StreamMaxLength
+			if errors.Is(err, ErrScannerUnavailable) {
+				if reply, readErr := readClamdReply(conn); readErr == nil {
+					return reply, nil
+				}
+			}
+			return "", err
+		}
+	}
+	return readClamdReply(conn)
+}
+
+// readClamdReply reads a null-terminated reply.
+func readClamdReply(conn net.Conn) (string, error) {
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && !(err == io.EOF && reply != "") {
+		return "", fmt.Errorf("%w: %v", ErrScannerUnavailable, err)
+	}
+	return strings.TrimSpace(strings.TrimSuffix(reply, "\x00")), nil
+}
+
+// writeClamdStream sends r as INSTREAM chunks: a 4-byte big-endian length and the data, ended by
+// a zero-length chunk.
+func writeClamdStream(w io.Writer, r io.Reader) error {
+	buf := make([]byte, clamdChunkSize)
+	var size [4]byte
+	for {
+		n, readErr := io.ReadFull(r, buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size[:], uint32(n))
+			if _, err := w.Write(append(size[:], buf[:n]...)); err != nil {
+				// clamd closes the connection once the stream exceeds StreamMaxLength
+				return fmt.Errorf("%w: %v", ErrScannerUnavailable, err)
+			}
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return fmt.Errorf("failed to read file: %w", readErr)
+		}
+	}
+	_, err := w.Write(bytes.Repeat([]byte{0}, 4))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrScannerUnavailable, err)
+	}
+	return nil
+}
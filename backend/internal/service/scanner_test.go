@@ -0,0 +1,160 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClamd answers clamd's zPING and zINSTREAM commands. reply decides the verdict of a stream;
+// streams over maxLength get clamd's size limit error, after which the rest is drained like a
+// socket buffer would.
+type fakeClamd struct {
+	maxLength int
+	reply     func(data []byte) string
+}
+
+func startFakeClamd(t *testing.T, clamd *fakeClamd) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go clamd.handle(conn)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func (c *fakeClamd) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	command, err := r.ReadString(0)
+	if err != nil {
+		return
+	}
+	switch command {
+	case "zPING\x00":
+		io.WriteString(conn, "PONG\x00")
+	case "zINSTREAM\x00":
+		var data []byte
+		var size [4]byte
+		for {
+			if _, err := io.ReadFull(r, size[:]); err != nil {
+				return
+			}
+			n := int(binary.BigEndian.Uint32(size[:]))
+			if n == 0 {
+				break
+			}
+			if c.maxLength > 0 && len(data)+n > c.maxLength {
+				io.WriteString(conn, "INSTREAM size limit exceeded. ERROR\x00")
+				io.Copy(io.Discard, r)
+				return
+			}
+			chunk := make([]byte, n)
+			if _, err := io.ReadFull(r, chunk); err != nil {
+				return
+			}
+			data = append(data, chunk...)
+		}
+		io.WriteString(conn, c.reply(data)+"\x00")
+	default:
+		io.WriteString(conn, "UNKNOWN COMMAND\x00")
+	}
+}
+
+// eicarLike marks test streams as infected.
+func eicarLike(data []byte) string {
+	if bytes.Contains(data, []byte("EICAR")) {
+		return "stream: Eicar-Test-Signature FOUND"
+	}
+	return "stream: OK"
+}
+
+func TestClamdScannerScan(t *testing.T) {
+	tests := []struct {
+		name          string
+		clamd         *fakeClamd
+		data          string
+		want          *ScanResult
+		wantErr       error
+		wantRetryable bool
+	}{
+		{"clean", &fakeClamd{reply: eicarLike}, "meeting notes", &ScanResult{}, nil, false},
+		{"infected", &fakeClamd{reply: eicarLike}, "X5O!P%@AP EICAR test", &ScanResult{Infected: true, Signature: "Eicar-Test-Signature"}, nil, false},
+		{"empty file", &fakeClamd{reply: eicarLike}, "", &ScanResult{}, nil, false},
+		{"larger than a chunk", &fakeClamd{reply: func(data []byte) string {
+			if len(data) != 3*clamdChunkSize+1 {
+				return "stream: wrong length ERROR"
+			}
+			return "stream: OK"
+		}}, strings.Repeat("a", 3*clamdChunkSize+1), &ScanResult{}, nil, false},
+		{"size limit exceeded", &fakeClamd{maxLength: 100, reply: eicarLike}, strings.Repeat("a", 1000), nil, ErrScanSizeLimit, false},
+		{"other error", &fakeClamd{reply: func([]byte) string { return "Can't allocate memory ERROR" }}, "notes", nil, ErrScannerUnavailable, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanner := NewClamdScanner(startFakeClamd(t, tt.clamd), 5*time.Second)
+			got, err := scanner.Scan(context.Background(), strings.NewReader(tt.data))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Scan error = %v, want %v", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrScannerUnavailable) != tt.wantRetryable {
+				t.Errorf("Scan error %v: retryable = %v, want %v", err, !tt.wantRetryable, tt.wantRetryable)
+			}
+			if tt.want != nil && (got == nil || *got != *tt.want) {
+				t.Errorf("Scan = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClamdScannerUnreachable(t *testing.T) {
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	address := listener.Addr().String()
+	listener.Close()
+
+	scanner := NewClamdScanner(address, time.Second)
+	if _, err := scanner.Scan(context.Background(), strings.NewReader("notes")); !errors.Is(err, ErrScannerUnavailable) {
+		t.Errorf("Scan = %v, want %v", err, ErrScannerUnavailable)
+	}
+	if err := scanner.Ping(context.Background()); !errors.Is(err, ErrScannerUnavailable) {
+		t.Errorf("Ping = %v, want %v", err, ErrScannerUnavailable)
+	}
+}
+
+func TestClamdScannerPing(t *testing.T) {
+	scanner := NewClamdScanner(startFakeClamd(t, &fakeClamd{reply: eicarLike}), time.Second)
+	if err := scanner.Ping(context.Background()); err != nil {
+		t.Errorf("Ping = %v", err)
+	}
+}
+
+func TestNewScanner(t *testing.T) {
+	for _, driver := range []string{"", "none"} {
+		if scanner, err := NewScanner(ScannerConfig{Driver: driver}); scanner != nil || err != nil {
+			t.Errorf("NewScanner(%q) = %v, %v; want no scanner", driver, scanner, err)
+		}
+	}
+	if _, err := NewScanner(ScannerConfig{Driver: "clamd"}); err == nil {
+		t.Error("clamd without an address should fail")
+	}
+	if _, err := NewScanner(ScannerConfig{Driver: "sophos"}); err == nil {
+		t.Error("an unknown driver should fail")
+	}
+}
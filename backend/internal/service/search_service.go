@@ -0,0 +1,59 @@
+package service
+
+import (
+	"errors"
+	"html"
+	"mellon-harmony-api/internal/models"
+	"mellon-harmony-api/internal/repository"
+	"strings"
+)
+
+// ErrInvalidSearchType is returned for a result type other than the models.SearchType* values.
+var ErrInvalidSearchType = errors.New("invalid search type")
+
+type SearchService interface {
+	// Search runs a full-text search over issues, comments, projects and clients visible to user.
+	// types narrows the result types (all when empty).
+	Search(user *models.User, text string, types []string, limit int) ([]models.SearchResult, error)
+}
+
+type searchService struct {
+	searchRepo        repository.SearchRepository
+	permissionService PermissionService
+}
+
+func NewSearchService(searchRepo repository.SearchRepository, permissionService PermissionService) SearchService {
+	return &searchService{
+		searchRepo:        searchRepo,
+		permissionService: permissionService,
+	}
+}
+
+// searchHighlighter escapes the search results and turns the highlight markers into <mark> tags.
+var searchHighlighter = strings.NewReplacer(repository.SearchHighlightStart, "<mark>", repository.SearchHighlightStop, "</mark>")
+
+func (s *searchService) Search(user *models.User, text string, types []string, limit int) ([]models.SearchResult, error) {
+	for _, t := range types {
+		switch t {
+		case models.SearchTypeIssue, models.SearchTypeComment, models.SearchTypeProject, models.SearchTypeClient:
+		default:
+			return nil, ErrInvalidSearchType
+		}
+	}
+	results, err := s.searchRepo.Search(repository.SearchQuery{
+		Text:        text,
+		Types:       types,
+		UserID:      user.ID,
+		AllIssues:   s.permissionService.HasPermission(user, models.PermIssueViewAll),
+		AllProjects: s.permissionService.HasPermission(user, models.PermProjectViewAll),
+		Limit:       limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range results {
+		results[i].Title = searchHighlighter.Replace(html.EscapeString(results[i].Title))
+		results[i].Snippet = searchHighlighter.Replace(html.EscapeString(results[i].Snippet))
+	}
+	return results, nil
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"errors"
+	"mellon-harmony-api/internal/models"
+	"mellon-harmony-api/internal/repository"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// recordingSearchRepository returns its results and records the query it was given.
+type recordingSearchRepository struct {
+	results []models.SearchResult
+	query   *repository.SearchQuery
+}
+
+func (r *recordingSearchRepository) Search(q repository.SearchQuery) ([]models.SearchResult, error) {
+	r.query = &q
+	results := make([]models.SearchResult, len(r.results))
+	copy(results, r.results)
+	return results, nil
+}
+
+func TestSearchServiceVisibility(t *testing.T) {
+	projectViewer := models.Role{Name: "project_viewer"}
+	projectViewer.SetPermissions([]string{models.PermProjectViewAll})
+	admin := &models.User{ID: uuid.New(), Role: models.RoleAdmin}
+	lead := &models.User{ID: uuid.New(), Role: models.RoleTeamLead}
+	viewer := &models.User{ID: uuid.New(), Role: "project_viewer"}
+	user := &models.User{ID: uuid.New(), Role: models.RoleUser}
+	permissions := NewPermissionService(newMemoryRoleRepository(projectViewer), newMemoryUserRepository(admin, lead, viewer, user), nil)
+
+	tests := []struct {
+		name            string
+		user            *models.User
+		wantAllIssues   bool
+		wantAllProjects bool
+	}{
+		{"admin", admin, true, true},
+		{"team lead", lead, true, true},
+		{"every project, own issues", viewer, false, true},
+		{"user", user, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &recordingSearchRepository{}
+			s := NewSearchService(repo, permissions)
+			if _, err := s.Search(tt.user, "logo", []string{models.SearchTypeIssue, models.SearchTypeClient}, 10); err != nil {
+				t.Fatal(err)
+			}
+			q := repo.query
+			if q.UserID != tt.user.ID || q.AllIssues != tt.wantAllIssues || q.AllProjects != tt.wantAllProjects {
+				t.Errorf("query = %+v, want all issues %v, all projects %v", q, tt.wantAllIssues, tt.wantAllProjects)
+			}
+			if q.Text != "logo" || q.Limit != 10 || len(q.Types) != 2 {
+				t.Errorf("query = %+v", q)
+			}
+		})
+	}
+
+	repo := &recordingSearchRepository{}
+	if _, err := NewSearchService(repo, permissions).Search(user, "logo", []string{models.SearchTypeIssue, "users"}, 10); !errors.Is(err, ErrInvalidSearchType) {
+		t.Errorf("Search with an unknown type = %v, want %v", err, ErrInvalidSearchType)
+	}
+	if repo.query != nil {
+		t.Error("an invalid search reached the repository")
+	}
+}
+
+func TestSearchServiceHighlights(t *testing.T) {
+	start, stop := repository.SearchHighlightStart, repository.SearchHighlightStop
+	repo := &recordingSearchRepository{results: []models.SearchResult{{
+		Type:    models.SearchTypeIssue,
+		Title:   "Nuevo " + start + "logo" + stop + " <b>",
+		Snippet: `<script>alert("x")</script> el ` + start + "logotipo" + stop + " & más",
+	}}}
+	user := &models.User{ID: uuid.New(), Role: models.RoleUser}
+	s := NewSearchService(repo, NewPermissionService(newMemoryRoleRepository(), newMemoryUserRepository(user), nil))
+	results, err := s.Search(user, "logo", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Nuevo <mark>logo</mark> &lt;b&gt;"; results[0].Title != want {
+		t.Errorf("title = %q, want %q", results[0].Title, want)
+	}
+	if want := "&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt; el <mark>logotipo</mark> &amp; más"; results[0].Snippet != want {
+		t.Errorf("snippet = %q, want %q", results[0].Snippet, want)
+	}
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ErrFileNotFound is returned by a Storage for keys that do not exist.
+var ErrFileNotFound = errors.New("file not found")
+
+// ErrInvalidFileKey is returned for keys that are empty, absolute or climb out of the storage root.
+var ErrInvalidFileKey = errors.New("invalid file path")
+
+// Storage keeps uploaded files. Keys are slash-separated paths relative to the upload root,
+// e.g. "avatars/{user_id}/{name}.png"; the API exposes them as "uploads/{key}".
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Open returns the file contents; callers must close it.
+	Open(ctx context.Context, key string) (*StoredFile, error)
+	Stat(ctx context.Context, key string) (*FileInfo, error)
+	// Delete removes the file; deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// FileInfo describes a stored file.
+type FileInfo struct {
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// StoredFile is an open stored file. It supports seeking so it can be served with range requests.
+type StoredFile struct {
+	io.ReadSeekCloser
+	FileInfo
+}
+
+// StorageConfig selects and configures the storage driver.
+type StorageConfig struct {
+	Driver   string // "local" (default) or "s3"
+	LocalDir string
+	S3       S3Config
+}
+
+// NewStorage builds the configured storage driver.
+func NewStorage(cfg StorageConfig) (Storage, error) {
+	switch cfg.Driver {
+	case "", "local":
+		return NewLocalStorage(cfg.LocalDir)
+	case "s3":
+		return NewS3Storage(cfg.S3)
+	}
+	return nil, fmt.Errorf("unknown storage driver %q (use local or s3)", cfg.Driver)
+}
+
+// cleanFileKey validates a storage key.
+func cleanFileKey(key string) (string, error) {
+	key = strings.TrimPrefix(key, "/")
+	if key == "" || strings.Contains(key, "..") || strings.Contains(key, "\\") {
+		return "", ErrInvalidFileKey
+	}
+	return key, nil
+}
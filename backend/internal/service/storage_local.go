@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// LocalStorage keeps files on the local disk under a root directory. Files are lost when the
+// disk is (e.g. on every Railway redeploy without a volume); use S3Storage there.
+type LocalStorage struct {
+	root string
+}
+
+func NewLocalStorage(root string) (*LocalStorage, error) {
+	if root == "" {
+		root = UploadDir
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create upload directory: %w", err)
+	}
+	return &LocalStorage{root: root}, nil
+}
+
+func (s *LocalStorage) path(key string) (string, error) {
+	key, err := cleanFileKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+func (s *LocalStorage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	fullPath, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return fmt.Errorf("failed to create upload directory: %w", err)
+	}
+
+	// Write to a temporary file first so readers never see a partial file
+	tmp, err := os.CreateTemp(filepath.Dir(fullPath), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to save file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), fullPath); err != nil {
+		return fmt.Errorf("failed to save file: %w", err)
+	}
+	return nil
+}
+
+func (s *LocalStorage) Open(ctx context.Context, key string) (*StoredFile, error) {
+	fullPath, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(fullPath)
+	if os.IsNotExist(err) {
+		return nil, ErrFileNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if stat.IsDir() {
+		file.Close()
+		return nil, ErrFileNotFound
+	}
+	return &StoredFile{ReadSeekCloser: file, FileInfo: localFileInfo(key, stat)}, nil
+}
+
+func (s *LocalStorage) Stat(ctx context.Context, key string) (*FileInfo, error) {
+	fullPath, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := os.Stat(fullPath)
+	if os.IsNotExist(err) || (err == nil && stat.IsDir()) {
+		return nil, ErrFileNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	info := localFileInfo(key, stat)
+	return &info, nil
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	fullPath, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	return nil
+}
+
+// Walk calls fn with the key of every file under the root (used to migrate uploads to another storage).
+func (s *LocalStorage) Walk(fn func(key string) error) error {
+	return filepath.WalkDir(s.root, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if path.Base(key)[0] == '.' {
+			return nil // temporary files of uploads in progress
+		}
+		return fn(key)
+	})
+}
+
+func localFileInfo(key string, stat os.FileInfo) FileInfo {
+	return FileInfo{
+		Size:        stat.Size(),
+		ContentType: mime.TypeByExtension(path.Ext(key)),
+		ModTime:     stat.ModTime(),
+	}
+}
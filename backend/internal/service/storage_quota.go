@@ -0,0 +1,134 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"mellon-harmony-api/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrStorageQuotaExceeded is returned for uploads that would take a client over its storage quota.
+var ErrStorageQuotaExceeded = errors.New("client storage quota exceeded")
+
+// ClientStorage is the storage used by a client's uploads against its quota.
+type ClientStorage struct {
+	ClientID   uuid.UUID `json:"client_id"`
+	ClientName string    `json:"client_name"`
+	Files      int64     `json:"files"`
+	Bytes      int64     `json:"bytes"`
+	// Quota in bytes, null when unlimited; QuotaIsDefault is set when the client has no quota of its own
+	Quota          *int64             `json:"quota"`
+	QuotaIsDefault bool               `json:"quota_is_default"`
+	Projects       []models.FileUsage `json:"projects,omitempty"`
+}
+
+// StorageOverview is the storage used by every client, largest first, and by files of no client.
+type StorageOverview struct {
+	Clients    []ClientStorage  `json:"clients"`
+	Unassigned models.FileUsage `json:"unassigned"`
+	Files      int64            `json:"files"`
+	Bytes      int64            `json:"bytes"`
+}
+
+func (s *FileService) clientStorage(usage *models.FileUsage) ClientStorage {
+	storage := ClientStorage{
+		ClientName: usage.ClientName,
+		Files:      usage.Files,
+		Bytes:      usage.Bytes,
+		Quota:      usage.StorageQuota,
+	}
+	if usage.ClientID != nil {
+		storage.ClientID = *usage.ClientID
+	}
+	if storage.Quota == nil {
+		storage.QuotaIsDefault = true
+		if s.limits.ClientQuota > 0 {
+			quota := s.limits.ClientQuota
+			storage.Quota = &quota
+		}
+	} else if *storage.Quota <= 0 {
+		storage.Quota = nil
+	}
+	return storage
+}
+
+// checkClientQuota refuses an upload of size bytes for a client that would exceed its quota, before
+// anything is stored. Uploads without a client (or for unknown clients) have no quota. The files
+// repository checks again when recording or linking the file, under a per-client lock (quotaCheck).
+func (s *FileService) checkClientQuota(clientID string, size int64) error {
+	id, err := uuid.Parse(safeFolderName(clientID))
+	if err != nil {
+		return nil
+	}
+	usage, err := s.files.GetClientUsage(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check storage quota: %w", err)
+	}
+	return s.quotaCheck(usage, size)
+}
+
+// quotaCheck is the repository.QuotaCheck of the client quotas.
+func (s *FileService) quotaCheck(usage *models.FileUsage, size int64) error {
+	storage := s.clientStorage(usage)
+	if storage.Quota != nil && storage.Bytes+size > *storage.Quota {
+		return fmt.Errorf("%w: %s uses %s of its %s quota, %s more do not fit",
+			ErrStorageQuotaExceeded, storage.ClientName, formatBytes(storage.Bytes), formatBytes(*storage.Quota), formatBytes(size))
+	}
+	return nil
+}
+
+// GetClientStorage returns the storage used by a client, by project.
+func (s *FileService) GetClientStorage(clientID uuid.UUID) (*ClientStorage, error) {
+	usage, err := s.files.GetClientUsage(clientID)
+	if err != nil {
+		return nil, err
+	}
+	storage := s.clientStorage(usage)
+	if storage.Projects, err = s.files.GetProjectUsage(clientID); err != nil {
+		return nil, err
+	}
+	return &storage, nil
+}
+
+// GetStorageOverview returns the storage used by every client, sorted by consumption.
+func (s *FileService) GetStorageOverview() (*StorageOverview, error) {
+	usage, err := s.files.GetUsageByClient()
+	if err != nil {
+		return nil, err
+	}
+	unassigned, err := s.files.GetUnassignedUsage()
+	if err != nil {
+		return nil, err
+	}
+	overview := &StorageOverview{
+		Clients:    make([]ClientStorage, len(usage)),
+		Unassigned: *unassigned,
+		Files:      unassigned.Files,
+		Bytes:      unassigned.Bytes,
+	}
+	for i := range usage {
+		overview.Clients[i] = s.clientStorage(&usage[i])
+		overview.Files += usage[i].Files
+		overview.Bytes += usage[i].Bytes
+	}
+	return overview, nil
+}
+
+// formatBytes formats a size for messages, e.g. "1.5 GB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 3; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGT"[exp])
+}
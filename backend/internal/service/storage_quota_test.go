@@ -0,0 +1,171 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"mellon-harmony-api/internal/models"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func int64Ptr(n int64) *int64 { return &n }
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1536, "1.5 KB"},
+		{10 * 1024 * 1024, "10.0 MB"},
+		{5 * 1024 * 1024 * 1024, "5.0 GB"},
+		{3 * 1024 * 1024 * 1024 * 1024, "3.0 TB"},
+		{2048 * 1024 * 1024 * 1024 * 1024, "2048.0 TB"},
+	}
+	for _, tt := range tests {
+		if got := formatBytes(tt.n); got != tt.want {
+			t.Errorf("formatBytes(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestFileServiceQuotaCheck(t *testing.T) {
+	tests := []struct {
+		name         string
+		clientQuota  *int64 // the client's own quota
+		defaultQuota int64
+		used, extra  int64
+		wantErr      bool
+	}{
+		{"within own quota", int64Ptr(100), 0, 60, 40, false},
+		{"over own quota", int64Ptr(100), 0, 60, 41, true},
+		{"own quota overrides the default", int64Ptr(1000), 100, 500, 100, false},
+		{"own zero quota is unlimited", int64Ptr(0), 100, 500, 100, false},
+		{"over the default quota", nil, 100, 90, 20, true},
+		{"no quota at all", nil, 0, 1 << 40, 1 << 40, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewFileService(nil, nil, nil, UploadLimits{ClientQuota: tt.defaultQuota})
+			usage := &models.FileUsage{ClientName: "Acme", StorageQuota: tt.clientQuota, Bytes: tt.used}
+			err := s.quotaCheck(usage, tt.extra)
+			if (err != nil) != tt.wantErr || (err != nil && !errors.Is(err, ErrStorageQuotaExceeded)) {
+				t.Errorf("quotaCheck = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFileServiceSaveOverQuota(t *testing.T) {
+	client := &models.Client{Name: "Acme", StorageQuota: int64Ptr(30)}
+	s, storage, files := newTestFileService(t, nil, client)
+	clientID := client.ID.String()
+
+	if _, err := s.SaveFile(textUpload("a.txt", strings.Repeat("a", 20)), uuid.New(), clientID, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CheckUpload("b.txt", 11, UploadOptions{ClientID: clientID}); !errors.Is(err, ErrStorageQuotaExceeded) {
+		t.Errorf("CheckUpload over quota = %v, want %v", err, ErrStorageQuotaExceeded)
+	}
+	if _, err := s.SaveFile(textUpload("b.txt", strings.Repeat("b", 11)), uuid.New(), clientID, ""); !errors.Is(err, ErrStorageQuotaExceeded) {
+		t.Fatalf("SaveFile over quota = %v, want %v", err, ErrStorageQuotaExceeded)
+	}
+	if _, err := s.SaveFile(textUpload("c.txt", strings.Repeat("c", 10)), uuid.New(), clientID, ""); err != nil {
+		t.Errorf("SaveFile filling the quota = %v", err)
+	}
+	// Files of no client or of unknown clients have no quota
+	if _, err := s.SaveFile(textUpload("d.txt", strings.Repeat("d", 100)), uuid.New(), "", ""); err != nil {
+		t.Errorf("SaveFile without client = %v", err)
+	}
+	if _, err := s.SaveFile(textUpload("e.txt", strings.Repeat("e", 100)), uuid.New(), uuid.New().String(), ""); err != nil {
+		t.Errorf("SaveFile for an unknown client = %v", err)
+	}
+	var keys int
+	storage.Walk(func(string) error { keys++; return nil })
+	if keys != 4 || len(files.files) != 4 {
+		t.Errorf("stored %d files and recorded %d, want 4", keys, len(files.files))
+	}
+}
+
+func TestFileServiceQuotaCountsThumbnails(t *testing.T) {
+	client := &models.Client{Name: "Acme"}
+	s, _, files := newTestFileService(t, nil, client)
+	data := encodeJPEG(t, testImage(1200, 600, true))
+	record, err := s.SaveFile(Upload{Name: "photo.jpg", Size: int64(len(data)), Body: bytes.NewReader(data)}, uuid.New(), client.ID.String(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	usage, _ := files.GetClientUsage(client.ID)
+	if record.ThumbnailSize == 0 || usage.Bytes != record.Size+record.ThumbnailSize {
+		t.Errorf("usage = %d, want the image (%d) and its previews (%d)", usage.Bytes, record.Size, record.ThumbnailSize)
+	}
+}
+
+func TestFileServiceLinkChargesOwningClient(t *testing.T) {
+	full := &models.Client{Name: "Full", StorageQuota: int64Ptr(10)}
+	roomy := &models.Client{Name: "Roomy", StorageQuota: int64Ptr(100)}
+	s, _, files := newTestFileService(t, nil, full, roomy)
+	// Uploaded without a client, or for another client, then attached to an issue of the entity's client
+	general, _ := s.SaveFile(textUpload("a.txt", strings.Repeat("a", 20)), uuid.New(), "", "")
+	other, _ := s.SaveFile(textUpload("b.txt", strings.Repeat("b", 20)), uuid.New(), roomy.ID.String(), "")
+
+	issueID := uuid.New()
+	_, err := s.LinkAttachments(models.FileOwnerIssue, issueID, &full.ID, []models.Attachment{{URL: general.Path()}})
+	if !errors.Is(err, ErrStorageQuotaExceeded) {
+		t.Fatalf("LinkAttachments over quota = %v, want %v", err, ErrStorageQuotaExceeded)
+	}
+	if stored := files.get(general.ID); stored.OwnerID != nil || stored.ClientID != nil {
+		t.Errorf("refused file was linked or charged: %+v", stored)
+	}
+
+	if _, err := s.LinkAttachments(models.FileOwnerIssue, issueID, &roomy.ID, []models.Attachment{{URL: general.Path()}, {URL: other.Path()}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []*models.File{general, other} {
+		if stored := files.get(file.ID); stored.ClientID == nil || *stored.ClientID != roomy.ID || stored.OwnerID == nil {
+			t.Errorf("%s: client %v, owner %v; want charged to and owned by the issue", file.Name, stored.ClientID, stored.OwnerID)
+		}
+	}
+	// Relinking files the entity already owns charges nothing more
+	roomy.StorageQuota = int64Ptr(40)
+	if _, err := s.LinkAttachments(models.FileOwnerIssue, issueID, &roomy.ID, []models.Attachment{{URL: general.Path()}, {URL: other.Path()}}); err != nil {
+		t.Errorf("relinking = %v", err)
+	}
+}
+
+func TestFileServiceStorageReports(t *testing.T) {
+	acme := &models.Client{Name: "Acme", StorageQuota: int64Ptr(1000)}
+	globex := &models.Client{Name: "Globex"}
+	s, _, _ := newTestFileService(t, nil, acme, globex)
+	s.limits.ClientQuota = 500
+	web, app := uuid.New(), uuid.New()
+	s.SaveFile(textUpload("a.txt", strings.Repeat("a", 30)), uuid.New(), acme.ID.String(), web.String())
+	s.SaveFile(textUpload("b.txt", strings.Repeat("b", 20)), uuid.New(), acme.ID.String(), app.String())
+	s.SaveFile(textUpload("c.txt", strings.Repeat("c", 20)), uuid.New(), acme.ID.String(), app.String())
+	s.SaveFile(textUpload("d.txt", strings.Repeat("d", 5)), uuid.New(), "", "")
+
+	storage, err := s.GetClientStorage(acme.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if storage.Files != 3 || storage.Bytes != 70 || *storage.Quota != 1000 || storage.QuotaIsDefault {
+		t.Errorf("GetClientStorage = %+v", storage)
+	}
+	if len(storage.Projects) != 2 || *storage.Projects[0].ProjectID != app || storage.Projects[0].Bytes != 40 {
+		t.Errorf("projects = %+v, want app (40 bytes) first", storage.Projects)
+	}
+
+	overview, err := s.GetStorageOverview()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if overview.Files != 4 || overview.Bytes != 75 || overview.Unassigned.Bytes != 5 || len(overview.Clients) != 2 {
+		t.Fatalf("GetStorageOverview = %+v", overview)
+	}
+	if g := overview.Clients[1]; g.ClientName != "Globex" || !g.QuotaIsDefault || g.Quota == nil || *g.Quota != 500 {
+		t.Errorf("Globex = %+v, want the default quota", g)
+	}
+}
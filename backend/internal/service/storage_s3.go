@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Config configures S3Storage. Any S3-compatible service works (AWS S3, MinIO, Cloudflare R2, ...).
+type S3Config struct {
+	Endpoint        string // host[:port] without scheme, e.g. "s3.amazonaws.com" or "localhost:9000"
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	UseSSL          bool
+	Prefix          string // optional key prefix, e.g. "harmony/" to share a bucket
+}
+
+// S3Storage keeps files in an S3-compatible bucket.
+type S3Storage struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// NewS3Storage connects to the bucket, which must already exist.
+func NewS3Storage(cfg S3Config) (*S3Storage, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, fmt.Errorf("S3_ENDPOINT and S3_BUCKET are required for the s3 storage driver")
+	}
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKeyID, cfg.SecretAccessKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 configuration: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	exists, err := client.BucketExists(ctx, cfg.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach S3 bucket %q: %w", cfg.Bucket, err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("S3 bucket %q does not exist", cfg.Bucket)
+	}
+
+	prefix := strings.Trim(cfg.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &S3Storage{
+		client: client,
+		bucket: cfg.Bucket,
+		prefix: prefix,
+	}, nil
+}
+
+func (s *S3Storage) objectName(key string) (string, error) {
+	key, err := cleanFileKey(key)
+	if err != nil {
+		return "", err
+	}
+	return s.prefix + key, nil
+}
+
+func (s *S3Storage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	name, err := s.objectName(key)
+	if err != nil {
+		return err
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	if _, err := s.client.PutObject(ctx, s.bucket, name, r, size, minio.PutObjectOptions{ContentType: contentType}); err != nil {
+		return fmt.Errorf("failed to save file: %w", err)
+	}
+	return nil
+}
+
+func (s *S3Storage) Open(ctx context.Context, key string) (*StoredFile, error) {
+	name, err := s.objectName(key)
+	if err != nil {
+		return nil, err
+	}
+	object, err := s.client.GetObject(ctx, s.bucket, name, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, s3Error(err)
+	}
+	// GetObject is lazy; Stat makes the request and reports missing objects
+	stat, err := object.Stat()
+	if err != nil {
+		object.Close()
+		return nil, s3Error(err)
+	}
+	return &StoredFile{ReadSeekCloser: object, FileInfo: s3FileInfo(stat)}, nil
+}
+
+func (s *S3Storage) Stat(ctx context.Context, key string) (*FileInfo, error) {
+	name, err := s.objectName(key)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := s.client.StatObject(ctx, s.bucket, name, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, s3Error(err)
+	}
+	info := s3FileInfo(stat)
+	return &info, nil
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	name, err := s.objectName(key)
+	if err != nil {
+		return err
+	}
+	if err := s.client.RemoveObject(ctx, s.bucket, name, minio.RemoveObjectOptions{}); err != nil {
+		if s3Error(err) == ErrFileNotFound {
+			return nil
+		}
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	return nil
+}
+
+func s3Error(err error) error {
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchKey", "NotFound":
+		return ErrFileNotFound
+	}
+	return err
+}
+
+func s3FileInfo(stat minio.ObjectInfo) FileInfo {
+	return FileInfo{
+		Size:        stat.Size,
+		ContentType: stat.ContentType,
+		ModTime:     stat.LastModified,
+	}
+}
@@ -0,0 +1,319 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCleanFileKey(t *testing.T) {
+	tests := []struct {
+		key     string
+		want    string
+		wantErr bool
+	}{
+		{"avatars/u1/me.png", "avatars/u1/me.png", false},
+		{"/avatars/u1/me.png", "avatars/u1/me.png", false},
+		{"", "", true},
+		{"/", "", true},
+		{"../etc/passwd", "", true},
+		{"avatars/../../etc/passwd", "", true},
+		{`avatars\..\me.png`, "", true},
+	}
+	for _, tt := range tests {
+		got, err := cleanFileKey(tt.key)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("cleanFileKey(%q) = %q, %v; want %q, error %v", tt.key, got, err, tt.want, tt.wantErr)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidFileKey) {
+			t.Errorf("cleanFileKey(%q) error = %v, want %v", tt.key, err, ErrInvalidFileKey)
+		}
+	}
+}
+
+func TestNewStorage(t *testing.T) {
+	if _, err := NewStorage(StorageConfig{Driver: "ftp"}); err == nil {
+		t.Error("an unknown driver should fail")
+	}
+	if _, err := NewStorage(StorageConfig{Driver: "s3"}); err == nil {
+		t.Error("the s3 driver without endpoint and bucket should fail")
+	}
+	storage, err := NewStorage(StorageConfig{LocalDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := storage.(*LocalStorage); !ok {
+		t.Errorf("default driver = %T, want *LocalStorage", storage)
+	}
+}
+
+// testStorage runs the behavior every driver shares.
+func testStorage(t *testing.T, storage Storage) {
+	ctx := context.Background()
+	const key = "c1/p1/files/report.pdf"
+
+	if _, err := storage.Open(ctx, key); !errors.Is(err, ErrFileNotFound) {
+		t.Fatalf("Open of a missing key = %v, want %v", err, ErrFileNotFound)
+	}
+	if _, err := storage.Stat(ctx, key); !errors.Is(err, ErrFileNotFound) {
+		t.Fatalf("Stat of a missing key = %v, want %v", err, ErrFileNotFound)
+	}
+	if err := storage.Put(ctx, "../outside.txt", strings.NewReader("x"), 1, "text/plain"); !errors.Is(err, ErrInvalidFileKey) {
+		t.Fatalf("Put outside the root = %v, want %v", err, ErrInvalidFileKey)
+	}
+
+	content := "%PDF-1.4 report"
+	if err := storage.Put(ctx, key, strings.NewReader(content), int64(len(content)), "application/pdf"); err != nil {
+		t.Fatal(err)
+	}
+	info, err := storage.Stat(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != int64(len(content)) || info.ContentType != "application/pdf" {
+		t.Errorf("Stat = %+v, want size %d and application/pdf", info, len(content))
+	}
+
+	file, err := storage.Open(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(file)
+	if string(got) != content || file.Size != int64(len(content)) {
+		t.Errorf("Open read %q (size %d), want %q", got, file.Size, content)
+	}
+	// Range requests seek into the file
+	if _, err := file.Seek(5, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	rest, _ := io.ReadAll(file)
+	if string(rest) != content[5:] {
+		t.Errorf("read after seeking %q, want %q", rest, content[5:])
+	}
+	file.Close()
+
+	// Overwriting replaces the contents
+	if err := storage.Put(ctx, key, strings.NewReader("v2"), 2, "application/pdf"); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := storage.Stat(ctx, key); info == nil || info.Size != 2 {
+		t.Errorf("Stat after overwrite = %+v, want size 2", info)
+	}
+
+	if err := storage.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storage.Stat(ctx, key); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Stat after Delete = %v, want %v", err, ErrFileNotFound)
+	}
+	if err := storage.Delete(ctx, key); err != nil {
+		t.Errorf("deleting a missing key = %v, want nil", err)
+	}
+}
+
+func TestLocalStorage(t *testing.T) {
+	storage, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStorage(t, storage)
+}
+
+func TestLocalStorageDirectoryIsNotAFile(t *testing.T) {
+	storage, _ := NewLocalStorage(t.TempDir())
+	ctx := context.Background()
+	storage.Put(ctx, "c1/p1/a.txt", strings.NewReader("a"), 1, "")
+	if _, err := storage.Open(ctx, "c1/p1"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Open of a directory = %v, want %v", err, ErrFileNotFound)
+	}
+	if _, err := storage.Stat(ctx, "c1"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Stat of a directory = %v, want %v", err, ErrFileNotFound)
+	}
+}
+
+func TestLocalStorageWalk(t *testing.T) {
+	root := t.TempDir()
+	storage, _ := NewLocalStorage(root)
+	ctx := context.Background()
+	for _, key := range []string{"avatars/u1/me.png", "c1/p1/files/a.pdf", "c1/p1/files/b.pdf"} {
+		if err := storage.Put(ctx, key, strings.NewReader("x"), 1, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// An upload in progress is skipped
+	if err := os.WriteFile(filepath.Join(root, "c1", "p1", "files", ".upload-123"), []byte("x"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var keys []string
+	if err := storage.Walk(func(key string) error {
+		keys = append(keys, key)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(keys)
+	want := []string{"avatars/u1/me.png", "c1/p1/files/a.pdf", "c1/p1/files/b.pdf"}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("Walk = %v, want %v", keys, want)
+	}
+}
+
+// fakeS3 is a minimal S3 API for one bucket, enough for S3Storage.
+type fakeS3 struct {
+	bucket string
+	mu     sync.Mutex
+	// objects maps the object name (with the prefix) to its contents and content type
+	objects map[string][2]string
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, name, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != s.bucket {
+		s.notFound(w, r, "NoSuchBucket")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if name == "" {
+		w.WriteHeader(http.StatusOK) // HEAD bucket
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		body, err := readS3Payload(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.objects[name] = [2]string{string(body), r.Header.Get("Content-Type")}
+		w.Header().Set("ETag", `"etag"`)
+	case http.MethodGet, http.MethodHead:
+		object, ok := s.objects[name]
+		if !ok {
+			s.notFound(w, r, "NoSuchKey")
+			return
+		}
+		content := object[0]
+		status := http.StatusOK
+		if start, ok := strings.CutPrefix(r.Header.Get("Range"), "bytes="); ok {
+			from, _ := strconv.Atoi(strings.TrimSuffix(start, "-"))
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", from, len(content)-1, len(content)))
+			content = content[from:]
+			status = http.StatusPartialContent
+		}
+		w.Header().Set("Content-Type", object[1])
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		w.Header().Set("ETag", `"etag"`)
+		w.WriteHeader(status)
+		if r.Method == http.MethodGet {
+			io.WriteString(w, content)
+		}
+	case http.MethodDelete:
+		delete(s.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func (s *fakeS3) notFound(w http.ResponseWriter, r *http.Request, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusNotFound)
+	if r.Method != http.MethodHead {
+		fmt.Fprintf(w, "<Error><Code>%s</Code><Message>not found</Message></Error>", code)
+	}
+}
+
+// readS3Payload reads a PUT body, decoding the aws-chunked encoding used by streaming signatures.
+func readS3Payload(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return io.ReadAll(r.Body)
+	}
+	var body bytes.Buffer
+	reader := bufio.NewReader(r.Body)
+	for {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(header), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return body.Bytes(), nil
+		}
+		if _, err := io.CopyN(&body, reader, size); err != nil {
+			return nil, err
+		}
+		reader.ReadString('\n')
+	}
+}
+
+func newTestS3Storage(t *testing.T, prefix string) (*S3Storage, *fakeS3) {
+	t.Helper()
+	backend := &fakeS3{bucket: "harmony", objects: map[string][2]string{}}
+	server := httptest.NewServer(backend)
+	t.Cleanup(server.Close)
+	storage, err := NewS3Storage(S3Config{
+		Endpoint:        strings.TrimPrefix(server.URL, "http://"),
+		Region:          "us-east-1",
+		Bucket:          "harmony",
+		AccessKeyID:     "key",
+		SecretAccessKey: "secret",
+		Prefix:          prefix,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return storage, backend
+}
+
+func TestS3Storage(t *testing.T) {
+	storage, _ := newTestS3Storage(t, "")
+	testStorage(t, storage)
+}
+
+func TestS3StoragePrefix(t *testing.T) {
+	storage, backend := newTestS3Storage(t, "/shared/harmony/")
+	ctx := context.Background()
+	if err := storage.Put(ctx, "/avatars/u1/me.png", strings.NewReader("png"), 3, ""); err != nil {
+		t.Fatal(err)
+	}
+	object, ok := backend.objects["shared/harmony/avatars/u1/me.png"]
+	if !ok {
+		t.Fatalf("objects = %v, want the key under the prefix", backend.objects)
+	}
+	if object[1] != "application/octet-stream" {
+		t.Errorf("content type = %q, want application/octet-stream when none is given", object[1])
+	}
+	if _, err := storage.Stat(ctx, "avatars/u1/me.png"); err != nil {
+		t.Errorf("Stat through the prefix = %v", err)
+	}
+}
+
+func TestNewS3StorageMissingBucket(t *testing.T) {
+	server := httptest.NewServer(&fakeS3{bucket: "other"})
+	defer server.Close()
+	_, err := NewS3Storage(S3Config{Endpoint: strings.TrimPrefix(server.URL, "http://"), Region: "us-east-1", Bucket: "harmony"})
+	if err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("NewS3Storage = %v, want a missing bucket error", err)
+	}
+}
@@ -0,0 +1,436 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mellon-harmony-api/internal/models"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	totpPeriod            = 30 // seconds per time step (RFC 6238 default)
+	totpDigits            = 6
+	totpSkew              = 1 // accept codes from one step before/after to absorb clock drift
+	totpSecretBytes       = 20
+	recoveryCodeCount     = 10
+	challengeTokenTTL     = 5 * time.Minute
+	challengeTokenType    = "2fa_challenge"
+	defaultTOTPIssuerName = "Mellon Harmony"
+)
+
+// ErrInvalidTwoFactorCode is returned when a TOTP or recovery code does not match.
+var ErrInvalidTwoFactorCode = errors.New("código de verificación inválido")
+
+// ErrInvalidChallengeToken is returned when a login challenge is unknown or expired.
+var ErrInvalidChallengeToken = errors.New("la verificación ha expirado, inicia sesión nuevamente")
+
+// ErrTwoFactorAlreadyEnabled is returned when starting setup for an account that already has 2FA.
+var ErrTwoFactorAlreadyEnabled = errors.New("la verificación en dos pasos ya está activada")
+
+// ErrTwoFactorNotEnabled is returned when an operation needs 2FA to be active.
+var ErrTwoFactorNotEnabled = errors.New("la verificación en dos pasos no está activada")
+
+// ErrTwoFactorSetupNotStarted is returned when confirming setup without a pending secret.
+var ErrTwoFactorSetupNotStarted = errors.New("primero inicia la configuración de la verificación en dos pasos")
+
+// ErrTwoFactorRequired is returned when disabling 2FA for a role that must use it.
+var ErrTwoFactorRequired = errors.New("tu rol requiere la verificación en dos pasos")
+
+// LoginResult is the outcome of a password check: either a full token pair or, when a second
+// factor is needed, a short-lived challenge token to exchange at /auth/2fa/verify.
+type LoginResult struct {
+	Tokens                 *TokenPair
+	ChallengeToken         string
+	TwoFactorSetupRequired bool // the role requires 2FA but the user has not enrolled yet
+}
+
+// TwoFactorSetup is what the client needs to enrol an authenticator app.
+type TwoFactorSetup struct {
+	Secret          string
+	ProvisioningURI string // otpauth:// URI, rendered as a QR code by the frontend
+}
+
+// TwoFactorVerification is returned after a challenge is completed. RecoveryCodes is only set
+// when the challenge also finished a forced enrollment.
+type TwoFactorVerification struct {
+	Tokens        *TokenPair
+	User          *models.User
+	RecoveryCodes []string
+}
+
+// requiresTwoFactor reports whether the user's role must use 2FA (AuthConfig.TwoFactorRequiredRoles).
+func (s *authService) requiresTwoFactor(user *models.User) bool {
+	for _, role := range s.twoFactorRequiredRoles {
+		if role == user.Role {
+			return true
+		}
+	}
+	return false
+}
+
+// loginResult issues tokens directly or a challenge if the account needs a second factor.
+func (s *authService) loginResult(user *models.User, meta models.SessionMeta) (*LoginResult, error) {
+	setupRequired := !user.TOTPEnabled && s.requiresTwoFactor(user)
+	if user.TOTPEnabled || setupRequired {
+		challenge, err := s.challengeToken(user)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{ChallengeToken: challenge, TwoFactorSetupRequired: setupRequired}, nil
+	}
+	tokens, err := s.IssueTokens(user, meta)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{Tokens: tokens}, nil
+}
+
+// CompleteLogin is Login without the password: accounts with 2FA, or whose role requires it, still
+// get a challenge, so SSO or an invitation link cannot be used to skip the local second factor.
+func (s *authService) CompleteLogin(user *models.User, meta models.SessionMeta) (*LoginResult, error) {
+	return s.loginResult(user, meta)
+}
+
+// BeginTwoFactorSetup generates a new secret for the user. It is only activated by ConfirmTwoFactorSetup.
+func (s *authService) BeginTwoFactorSetup(userID uuid.UUID) (*TwoFactorSetup, error) {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.beginSetup(user)
+}
+
+// BeginTwoFactorSetupWithChallenge is used during login when the role requires 2FA and the user has not enrolled.
+func (s *authService) BeginTwoFactorSetupWithChallenge(challengeToken string) (*TwoFactorSetup, error) {
+	user, err := s.userFromChallenge(challengeToken)
+	if err != nil {
+		return nil, err
+	}
+	return s.beginSetup(user)
+}
+
+func (s *authService) beginSetup(user *models.User) (*TwoFactorSetup, error) {
+	if user.TOTPEnabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	user.TOTPSecret = &secret
+	if err := s.userRepo.Update(user); err != nil {
+		return nil, err
+	}
+	return &TwoFactorSetup{
+		Secret:          secret,
+		ProvisioningURI: totpProvisioningURI(s.totpIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTwoFactorSetup enables 2FA once the user proves the authenticator works, and returns
+// the recovery codes (shown only once).
+func (s *authService) ConfirmTwoFactorSetup(userID uuid.UUID, code string) ([]string, error) {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.confirmSetup(user, code)
+}
+
+func (s *authService) confirmSetup(user *models.User, code string) ([]string, error) {
+	if user.TOTPEnabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	if user.TOTPSecret == nil || *user.TOTPSecret == "" {
+		return nil, ErrTwoFactorSetupNotStarted
+	}
+	step, ok := validateTOTP(*user.TOTPSecret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	user.TOTPEnabled = true
+	user.TOTPLastUsedStep = step
+	user.TOTPRecoveryCodes = hashes
+	if err := s.userRepo.Update(user); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableTwoFactor turns 2FA off after checking a current code (TOTP or recovery).
+func (s *authService) DisableTwoFactor(userID uuid.UUID, code string) error {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	if !user.TOTPEnabled {
+		return ErrTwoFactorNotEnabled
+	}
+	if s.requiresTwoFactor(user) {
+		return ErrTwoFactorRequired
+	}
+	if err := s.checkSecondFactor(user, code); err != nil {
+		return err
+	}
+	user.TOTPEnabled = false
+	user.TOTPSecret = nil
+	user.TOTPLastUsedStep = 0
+	user.TOTPRecoveryCodes = ""
+	return s.userRepo.Update(user)
+}
+
+// RegenerateRecoveryCodes replaces every recovery code after checking a current TOTP code.
+func (s *authService) RegenerateRecoveryCodes(userID uuid.UUID, code string) ([]string, error) {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.TOTPEnabled {
+		return nil, ErrTwoFactorNotEnabled
+	}
+	if err := s.checkSecondFactor(user, code); err != nil {
+		return nil, err
+	}
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	user.TOTPRecoveryCodes = hashes
+	if err := s.userRepo.Update(user); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// VerifyTwoFactorChallenge completes a login: it checks the code against the enrolled authenticator
+// (or a recovery code), or finishes a forced enrollment, and then starts the session.
+func (s *authService) VerifyTwoFactorChallenge(challengeToken, code string, meta models.SessionMeta) (*TwoFactorVerification, error) {
+	user, err := s.userFromChallenge(challengeToken)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkLocked(user); err != nil {
+		return nil, err
+	}
+	result := &TwoFactorVerification{User: user}
+	if user.TOTPEnabled {
+		err = s.checkSecondFactor(user, code)
+	} else {
+		if !s.requiresTwoFactor(user) {
+			return nil, ErrInvalidChallengeToken
+		}
+		result.RecoveryCodes, err = s.confirmSetup(user, code)
+	}
+	if err != nil {
+		// Wrong codes, also while enrolling, count towards the same lockout as wrong passwords
+		if errors.Is(err, ErrInvalidTwoFactorCode) {
+			if lockErr := s.recordFailedLogin(user, meta); lockErr != nil {
+				return nil, lockErr
+			}
+		}
+		return nil, err
+	}
+	s.clearFailedLogins(user)
+	tokens, err := s.IssueTokens(user, meta)
+	if err != nil {
+		return nil, err
+	}
+	result.Tokens = tokens
+	return result, nil
+}
+
+// checkSecondFactor accepts a TOTP code (once per time step) or consumes a recovery code. Both are
+// claimed with a conditional update, so concurrent requests cannot use the same code twice.
+func (s *authService) checkSecondFactor(user *models.User, code string) error {
+	code = strings.TrimSpace(code)
+	if user.TOTPSecret != nil && len(code) == totpDigits {
+		step, ok := validateTOTP(*user.TOTPSecret, code, time.Now())
+		if !ok || step <= user.TOTPLastUsedStep {
+			return ErrInvalidTwoFactorCode
+		}
+		claimed, err := s.userRepo.UseTOTPStep(user.ID, step)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			return ErrInvalidTwoFactorCode
+		}
+		user.TOTPLastUsedStep = step
+		return nil
+	}
+	remaining, ok := consumeRecoveryCode(user.TOTPRecoveryCodes, code)
+	if !ok {
+		return ErrInvalidTwoFactorCode
+	}
+	claimed, err := s.userRepo.ReplaceRecoveryCodes(user.ID, user.TOTPRecoveryCodes, remaining)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return ErrInvalidTwoFactorCode
+	}
+	user.TOTPRecoveryCodes = remaining
+	return nil
+}
+
+func (s *authService) challengeToken(user *models.User) (string, error) {
+	claims := jwt.MapClaims{
+		"user_id": user.ID.String(),
+		"typ":     challengeTokenType,
+		"ver":     user.TokenVersion,
+		"exp":     time.Now().Add(challengeTokenTTL).Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(s.jwtSecret))
+}
+
+func (s *authService) userFromChallenge(challengeToken string) (*models.User, error) {
+	token, err := jwt.Parse(challengeToken, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return []byte(s.jwtSecret), nil
+	})
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidChallengeToken
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["typ"] != challengeTokenType {
+		return nil, ErrInvalidChallengeToken
+	}
+	userIDStr, _ := claims["user_id"].(string)
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, ErrInvalidChallengeToken
+	}
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, ErrInvalidChallengeToken
+	}
+	if version, _ := claims["ver"].(float64); int(version) != user.TokenVersion {
+		return nil, ErrInvalidChallengeToken
+	}
+	return user, nil
+}
+
+// generateTOTPSecret returns a random 160-bit secret encoded as unpadded base32.
+func generateTOTPSecret() (string, error) {
+	secret := make([]byte, totpSecretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return "", errors.New("no se pudo generar el secreto de verificación")
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret), nil
+}
+
+// totpCode computes the RFC 6238 code (HMAC-SHA1, 6 digits) for a time step.
+func totpCode(secret string, step int64) (string, error) {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", value%1000000), nil
+}
+
+// validateTOTP checks a code against the current step ± totpSkew and returns the matching step.
+func validateTOTP(secret, code string, now time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	current := now.Unix() / totpPeriod
+	for delta := int64(-totpSkew); delta <= totpSkew; delta++ {
+		expected, err := totpCode(secret, current+delta)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return current + delta, true
+		}
+	}
+	return 0, false
+}
+
+// totpProvisioningURI builds the otpauth:// URI understood by authenticator apps.
+func totpProvisioningURI(issuer, account, secret string) string {
+	label := url.PathEscape(issuer + ":" + account)
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprintf("%d", totpDigits))
+	params.Set("period", fmt.Sprintf("%d", totpPeriod))
+	// Some authenticator apps show "+" literally, so encode spaces as %20
+	return "otpauth://totp/" + label + "?" + strings.ReplaceAll(params.Encode(), "+", "%20")
+}
+
+// generateRecoveryCodes returns recovery codes in plain text (for the user) and as the JSON
+// array of hashes stored on the user.
+func generateRecoveryCodes() ([]string, string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	for i := range codes {
+		raw := make([]byte, 5)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, "", errors.New("no se pudieron generar los códigos de recuperación")
+		}
+		code := strings.ToLower(encoding.EncodeToString(raw)) // 8 chars
+		codes[i] = code[:4] + "-" + code[4:]
+		hashes[i] = hashToken(normalizeRecoveryCode(codes[i]))
+	}
+	data, err := json.Marshal(hashes)
+	if err != nil {
+		return nil, "", err
+	}
+	return codes, string(data), nil
+}
+
+// consumeRecoveryCode removes a matching code from the stored hashes and returns the remaining JSON.
+func consumeRecoveryCode(stored, code string) (string, bool) {
+	if stored == "" || code == "" {
+		return stored, false
+	}
+	var hashes []string
+	if err := json.Unmarshal([]byte(stored), &hashes); err != nil {
+		return stored, false
+	}
+	target := hashToken(normalizeRecoveryCode(code))
+	for i, h := range hashes {
+		if subtle.ConstantTimeCompare([]byte(h), []byte(target)) == 1 {
+			hashes = append(hashes[:i], hashes[i+1:]...)
+			data, err := json.Marshal(hashes)
+			if err != nil {
+				return stored, false
+			}
+			return string(data), true
+		}
+	}
+	return stored, false
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
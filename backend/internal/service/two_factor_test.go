@@ -0,0 +1,229 @@
+package service
+
+import (
+	"errors"
+	"mellon-harmony-api/internal/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key of the RFC 6238 test vectors, "12345678901234567890", in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, truncated to 6 digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := totpCode(rfcSecret, tt.unix/totpPeriod)
+		if err != nil || got != tt.want {
+			t.Errorf("totpCode at %d = %q, %v; want %q", tt.unix, got, err, tt.want)
+		}
+	}
+	if _, err := totpCode("not base32!", 1); err == nil {
+		t.Error("an invalid secret should fail")
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := now.Unix() / totpPeriod
+	code := func(step int64) string {
+		c, _ := totpCode(rfcSecret, step)
+		return c
+	}
+	tests := []struct {
+		name     string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", code(step), step, true},
+		{"with spaces", " " + code(step) + " ", step, true},
+		{"previous step", code(step - 1), step - 1, true},
+		{"next step", code(step + 1), step + 1, true},
+		{"two steps old", code(step - 2), 0, false},
+		{"wrong code", "000000", 0, false},
+		{"too short", code(step)[:5], 0, false},
+		{"empty", "", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := validateTOTP(rfcSecret, tt.code, now)
+			if ok != tt.wantOK || got != tt.wantStep {
+				t.Errorf("validateTOTP(%q) = %d, %v; want %d, %v", tt.code, got, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, stored, err := generateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("got %d codes, want %d", len(codes), recoveryCodeCount)
+	}
+	tests := []struct {
+		name   string
+		code   string
+		wantOK bool
+	}{
+		{"as shown", codes[0], true},
+		{"upper case without dash", "  " + strings.ToUpper(codes[1][:4]+codes[1][5:]) + " ", true},
+		{"unknown", "abcd-efgh", false},
+		{"empty", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remaining, ok := consumeRecoveryCode(stored, tt.code)
+			if ok != tt.wantOK {
+				t.Fatalf("consumeRecoveryCode(%q) ok = %v, want %v", tt.code, ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if _, again := consumeRecoveryCode(remaining, tt.code); again {
+				t.Error("a used recovery code was accepted again")
+			}
+		})
+	}
+}
+
+func newTwoFactorUser(t *testing.T) (*authService, *memoryUserRepository, *models.User, []string) {
+	t.Helper()
+	secret := rfcSecret
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &models.User{Email: "ana@example.com", Role: models.RoleAdmin, TOTPSecret: &secret, TOTPEnabled: true, TOTPRecoveryCodes: hashes}
+	users := newMemoryUserRepository(user)
+	return newTestAuthService(users, newMemoryLoginSessionRepository()), users, user, codes
+}
+
+func TestAuthServiceCheckSecondFactor(t *testing.T) {
+	current, _ := totpCode(rfcSecret, time.Now().Unix()/totpPeriod)
+	tests := []struct {
+		name string
+		// use returns the code to check after preparing the stored user
+		use     func(users *memoryUserRepository, user *models.User, codes []string) string
+		wantErr error
+	}{
+		{"current code", func(users *memoryUserRepository, user *models.User, codes []string) string {
+			return current
+		}, nil},
+		{"recovery code", func(users *memoryUserRepository, user *models.User, codes []string) string {
+			return codes[3]
+		}, nil},
+		{"wrong code", func(users *memoryUserRepository, user *models.User, codes []string) string {
+			return "000000"
+		}, ErrInvalidTwoFactorCode},
+		{"code already used", func(users *memoryUserRepository, user *models.User, codes []string) string {
+			user.TOTPLastUsedStep = time.Now().Unix()/totpPeriod + totpSkew
+			return current
+		}, ErrInvalidTwoFactorCode},
+		{"code used meanwhile by another login", func(users *memoryUserRepository, user *models.User, codes []string) string {
+			users.users[user.ID].TOTPLastUsedStep = time.Now().Unix()/totpPeriod + totpSkew
+			return current
+		}, ErrInvalidTwoFactorCode},
+		{"recovery code used meanwhile by another login", func(users *memoryUserRepository, user *models.User, codes []string) string {
+			users.users[user.ID].TOTPRecoveryCodes, _ = consumeRecoveryCode(user.TOTPRecoveryCodes, codes[3])
+			return codes[3]
+		}, ErrInvalidTwoFactorCode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, users, stored, codes := newTwoFactorUser(t)
+			user, _ := users.GetByID(stored.ID)
+			code := tt.use(users, user, codes)
+			if err := s.checkSecondFactor(user, code); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("checkSecondFactor = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			// The same code is refused on the next attempt, even by a request that loaded the user before
+			stale, _ := users.GetByID(stored.ID)
+			stale.TOTPLastUsedStep = 0
+			stale.TOTPRecoveryCodes = stored.TOTPRecoveryCodes
+			if err := s.checkSecondFactor(stale, code); !errors.Is(err, ErrInvalidTwoFactorCode) {
+				t.Errorf("code accepted twice: %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthServiceVerifyTwoFactorChallengeLockout(t *testing.T) {
+	tests := []struct {
+		name     string
+		enrolled bool
+	}{
+		{"enrolled", true},
+		{"forced enrollment", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := rfcSecret
+			user := &models.User{Email: "ana@example.com", Role: models.RoleAdmin, TOTPSecret: &secret, TOTPEnabled: tt.enrolled}
+			users := newMemoryUserRepository(user)
+			s := NewAuthService(users, newMemoryLoginSessionRepository(), nil, nil, nil, AuthConfig{
+				JWTSecret:              "secret",
+				TwoFactorRequiredRoles: []models.UserRole{models.RoleAdmin},
+				Lockout:                LockoutPolicy{Threshold: 3},
+			}).(*authService)
+			challenge, err := s.challengeToken(user)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for attempt := 1; attempt <= 3; attempt++ {
+				_, err := s.VerifyTwoFactorChallenge(challenge, "000000", models.SessionMeta{})
+				if attempt < 3 && !errors.Is(err, ErrInvalidTwoFactorCode) {
+					t.Fatalf("attempt %d: %v, want %v", attempt, err, ErrInvalidTwoFactorCode)
+				}
+				if attempt == 3 && !errors.Is(err, ErrAccountLocked) {
+					t.Fatalf("attempt %d: %v, want %v", attempt, err, ErrAccountLocked)
+				}
+			}
+			// Locked: even the right code is refused
+			current, _ := totpCode(rfcSecret, time.Now().Unix()/totpPeriod)
+			if _, err := s.VerifyTwoFactorChallenge(challenge, current, models.SessionMeta{}); !errors.Is(err, ErrAccountLocked) {
+				t.Errorf("right code while locked: %v, want %v", err, ErrAccountLocked)
+			}
+		})
+	}
+}
+
+func TestAuthServiceVerifyTwoFactorChallenge(t *testing.T) {
+	s, users, user, _ := newTwoFactorUser(t)
+	challenge, _ := s.challengeToken(user)
+	current, _ := totpCode(rfcSecret, time.Now().Unix()/totpPeriod)
+
+	result, err := s.VerifyTwoFactorChallenge(challenge, current, models.SessionMeta{})
+	if err != nil || result.Tokens == nil {
+		t.Fatalf("VerifyTwoFactorChallenge = %+v, %v; want tokens", result, err)
+	}
+	if _, err := s.VerifyTwoFactorChallenge(challenge, current, models.SessionMeta{}); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Errorf("replayed code: %v, want %v", err, ErrInvalidTwoFactorCode)
+	}
+	if _, err := s.VerifyTwoFactorChallenge("not-a-token", current, models.SessionMeta{}); !errors.Is(err, ErrInvalidChallengeToken) {
+		t.Errorf("invalid challenge: %v, want %v", err, ErrInvalidChallengeToken)
+	}
+	// A password reset or role change bumps the token version, which voids pending challenges
+	users.users[user.ID].TokenVersion++
+	if _, err := s.VerifyTwoFactorChallenge(challenge, current, models.SessionMeta{}); !errors.Is(err, ErrInvalidChallengeToken) {
+		t.Errorf("outdated challenge: %v, want %v", err, ErrInvalidChallengeToken)
+	}
+}
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mellon-harmony-api/internal/models"
+	"mellon-harmony-api/internal/repository"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrUploadNotFound is returned for unknown or expired uploads and for uploads of other users.
+var ErrUploadNotFound = errors.New("upload not found")
+
+// ErrUploadOffsetMismatch is returned when a chunk does not start where the received bytes end.
+var ErrUploadOffsetMismatch = errors.New("upload offset does not match the bytes received")
+
+// ErrUploadTooLong is returned when a chunk would go past the declared upload length.
+var ErrUploadTooLong = errors.New("chunk exceeds the upload length")
+
+const defaultUploadSessionTTL = 24 * time.Hour
+
+// UploadService implements resumable uploads: an upload is created with its total length, its bytes
+// are sent in one or more chunks (resuming from the last received offset after a failure) and the
+// file is saved through FileService once all of them have arrived.
+type UploadService interface {
+	CreateUpload(uploadedBy uuid.UUID, filename string, length int64, opts UploadOptions) (*models.UploadSession, error)
+	// GetUpload returns one of the user's uploads, with File set once it is complete.
+	GetUpload(id, uploadedBy uuid.UUID) (*models.UploadSession, error)
+	// AppendChunk writes chunk at offset, which must equal the bytes received so far. Bytes of an
+	// interrupted chunk are kept. When the last byte arrives the file is saved; if it is rejected
+	// (e.g. its contents do not match its type) the upload is discarded and the error returned.
+	AppendChunk(id, uploadedBy uuid.UUID, offset int64, chunk io.Reader) (*models.UploadSession, error)
+	DeleteUpload(id, uploadedBy uuid.UUID) error
+	// StartCleanup removes expired uploads and their received bytes every interval in the background.
+	StartCleanup(interval time.Duration)
+}
+
+type uploadService struct {
+	sessionRepo repository.UploadSessionRepository
+	fileService *FileService
+	tempDir     string
+	ttl         time.Duration
+}
+
+// NewUploadService keeps the bytes of uploads in progress under tempDir, which must be shared by
+// every instance of the API when more than one runs. Chunks of the same upload are serialized
+// through the database, so they may reach any instance.
+func NewUploadService(sessionRepo repository.UploadSessionRepository, fileService *FileService, tempDir string, ttl time.Duration) (UploadService, error) {
+	if tempDir == "" {
+		tempDir = filepath.Join(os.TempDir(), "harmony-uploads")
+	}
+	if err := os.MkdirAll(tempDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create upload temp directory: %w", err)
+	}
+	if ttl <= 0 {
+		ttl = defaultUploadSessionTTL
+	}
+	return &uploadService{
+		sessionRepo: sessionRepo,
+		fileService: fileService,
+		tempDir:     tempDir,
+		ttl:         ttl,
+	}, nil
+}
+
+func (s *uploadService) CreateUpload(uploadedBy uuid.UUID, filename string, length int64, opts UploadOptions) (*models.UploadSession, error) {
+	if opts.Purpose == "" {
+		opts.Purpose = models.FilePurposeAttachment
+	}
+	if filename == "" {
+		return nil, fmt.Errorf("%w: filename required", ErrInvalidUpload)
+	}
+	if length <= 0 {
+		return nil, fmt.Errorf("%w: upload length must be positive", ErrInvalidUpload)
+	}
+	if err := s.fileService.CheckUpload(filename, length, opts); err != nil {
+		return nil, err
+	}
+
+	session := &models.UploadSession{
+		UploadedBy: uploadedBy,
+		Filename:   filepath.Base(filename),
+		Purpose:    opts.Purpose,
+		UserID:     opts.UserID,
+		ClientID:   opts.ClientID,
+		ProjectID:  opts.ProjectID,
+		Length:     length,
+		ExpiresAt:  time.Now().Add(s.ttl),
+	}
+	if err := s.sessionRepo.Create(session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (s *uploadService) GetUpload(id, uploadedBy uuid.UUID) (*models.UploadSession, error) {
+	session, err := s.sessionRepo.GetByID(id)
+	if err != nil || session.UploadedBy != uploadedBy || time.Now().After(session.ExpiresAt) {
+		return nil, ErrUploadNotFound
+	}
+	return session, nil
+}
+
+func (s *uploadService) AppendChunk(id, uploadedBy uuid.UUID, offset int64, chunk io.Reader) (*models.UploadSession, error) {
+	unlock, err := s.sessionRepo.Lock(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock upload: %w", err)
+	}
+	defer unlock()
+
+	session, err := s.GetUpload(id, uploadedBy)
+	if err != nil {
+		return nil, err
+	}
+	if session.IsComplete() {
+		if offset != session.Length {
+			return session, ErrUploadOffsetMismatch
+		}
+		return session, nil
+	}
+
+	part, err := os.OpenFile(s.partPath(id), os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload: %w", err)
+	}
+	// The bytes on disk are what was received, even if recording the last offset failed
+	received, err := part.Seek(0, io.SeekEnd)
+	if err != nil {
+		part.Close()
+		return nil, fmt.Errorf("failed to open upload: %w", err)
+	}
+	if offset != received {
+		part.Close()
+		session.Offset = received
+		return session, ErrUploadOffsetMismatch
+	}
+
+	written, copyErr := io.Copy(part, io.LimitReader(chunk, session.Length-received+1))
+	if received+written > session.Length {
+		part.Truncate(received)
+		part.Close()
+		return session, ErrUploadTooLong
+	}
+	if err := part.Close(); err != nil && copyErr == nil {
+		copyErr = err
+	}
+	session.Offset = received + written
+	if err := s.sessionRepo.Update(session); err != nil {
+		return nil, err
+	}
+	if copyErr != nil {
+		return session, fmt.Errorf("upload interrupted at byte %d: %w", session.Offset, copyErr)
+	}
+	if session.Offset < session.Length {
+		return session, nil
+	}
+	return s.complete(session)
+}
+
+// complete saves a fully received upload and removes its temporary file.
+func (s *uploadService) complete(session *models.UploadSession) (*models.UploadSession, error) {
+	part, err := os.Open(s.partPath(session.ID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload: %w", err)
+	}
+	file, err := s.fileService.Save(Upload{Name: session.Filename, Size: session.Length, Body: part}, session.UploadedBy, UploadOptions{
+		Purpose:   session.Purpose,
+		UserID:    session.UserID,
+		ClientID:  session.ClientID,
+		ProjectID: session.ProjectID,
+	})
+	part.Close()
+	if err != nil {
+		s.discard(session.ID)
+		return nil, err
+	}
+
+	os.Remove(s.partPath(session.ID))
+	session.FileID = &file.ID
+	session.File = file
+	if err := s.sessionRepo.Update(session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (s *uploadService) DeleteUpload(id, uploadedBy uuid.UUID) error {
+	unlock, err := s.sessionRepo.Lock(id)
+	if err != nil {
+		return fmt.Errorf("failed to lock upload: %w", err)
+	}
+	defer unlock()
+
+	if _, err := s.GetUpload(id, uploadedBy); err != nil {
+		return err
+	}
+	return s.discard(id)
+}
+
+// discard removes an upload and the bytes received for it. A saved file is left to the file sweeper.
+func (s *uploadService) discard(id uuid.UUID) error {
+	if err := os.Remove(s.partPath(id)); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove upload %s: %v", id, err)
+	}
+	return s.sessionRepo.Delete(id)
+}
+
+func (s *uploadService) StartCleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			expired, err := s.sessionRepo.GetExpired(time.Now())
+			if err != nil {
+				log.Printf("Failed to load expired uploads: %v", err)
+				continue
+			}
+			for _, session := range expired {
+				unlock, err := s.sessionRepo.Lock(session.ID)
+				if err != nil {
+					log.Printf("Failed to lock expired upload %s: %v", session.ID, err)
+					continue
+				}
+				if err := s.discard(session.ID); err != nil {
+					log.Printf("Failed to remove expired upload %s: %v", session.ID, err)
+				}
+				unlock()
+			}
+		}
+	}()
+}
+
+func (s *uploadService) partPath(id uuid.UUID) string {
+	return filepath.Join(s.tempDir, id.String()+".part")
+}
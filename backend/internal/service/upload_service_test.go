@@ -0,0 +1,233 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"mellon-harmony-api/internal/models"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// memorySessionRepository keeps upload sessions in memory.
+type memorySessionRepository struct {
+	sessions map[uuid.UUID]models.UploadSession
+	locked   map[uuid.UUID]bool
+}
+
+func newMemorySessionRepository() *memorySessionRepository {
+	return &memorySessionRepository{sessions: map[uuid.UUID]models.UploadSession{}, locked: map[uuid.UUID]bool{}}
+}
+
+func (r *memorySessionRepository) Create(session *models.UploadSession) error {
+	if session.ID == uuid.Nil {
+		session.ID = uuid.New()
+	}
+	r.sessions[session.ID] = *session
+	return nil
+}
+
+func (r *memorySessionRepository) GetByID(id uuid.UUID) (*models.UploadSession, error) {
+	session, ok := r.sessions[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &session, nil
+}
+
+func (r *memorySessionRepository) Update(session *models.UploadSession) error {
+	r.sessions[session.ID] = *session
+	return nil
+}
+
+func (r *memorySessionRepository) Delete(id uuid.UUID) error {
+	delete(r.sessions, id)
+	return nil
+}
+
+func (r *memorySessionRepository) GetExpired(before time.Time) ([]models.UploadSession, error) {
+	var expired []models.UploadSession
+	for _, session := range r.sessions {
+		if session.ExpiresAt.Before(before) {
+			expired = append(expired, session)
+		}
+	}
+	return expired, nil
+}
+
+func (r *memorySessionRepository) Lock(id uuid.UUID) (func(), error) {
+	if r.locked[id] {
+		return nil, errors.New("upload already locked")
+	}
+	r.locked[id] = true
+	return func() { r.locked[id] = false }, nil
+}
+
+// failingReader returns its data, then an error, like a dropped connection.
+type failingReader struct{ data io.Reader }
+
+func (r failingReader) Read(p []byte) (int, error) {
+	n, err := r.data.Read(p)
+	if err == io.EOF {
+		return n, errors.New("connection reset")
+	}
+	return n, err
+}
+
+func TestUploadServiceAppendChunk(t *testing.T) {
+	owner := uuid.New()
+	type chunk struct {
+		offset  int64
+		data    string
+		fail    bool // the connection drops after data
+		wantErr error
+		// wantOffset is the offset reported back, which the client resumes from
+		wantOffset int64
+	}
+	tests := []struct {
+		name   string
+		length int64
+		chunks []chunk
+		want   string // bytes kept on disk
+	}{
+		{"in order", 10, []chunk{
+			{offset: 0, data: "hello", wantOffset: 5},
+			{offset: 5, data: "wor", wantOffset: 8},
+		}, "hellowor"},
+		{"empty chunk", 10, []chunk{
+			{offset: 0, data: "", wantOffset: 0},
+			{offset: 0, data: "abc", wantOffset: 3},
+		}, "abc"},
+		{"repeated chunk", 10, []chunk{
+			{offset: 0, data: "hello", wantOffset: 5},
+			{offset: 0, data: "hello", wantErr: ErrUploadOffsetMismatch, wantOffset: 5},
+		}, "hello"},
+		{"gap", 10, []chunk{
+			{offset: 0, data: "abc", wantOffset: 3},
+			{offset: 5, data: "fgh", wantErr: ErrUploadOffsetMismatch, wantOffset: 3},
+		}, "abc"},
+		{"past the length", 6, []chunk{
+			{offset: 0, data: "abc", wantOffset: 3},
+			{offset: 3, data: "defg", wantErr: ErrUploadTooLong, wantOffset: 3},
+		}, "abc"},
+		{"interrupted and resumed", 10, []chunk{
+			{offset: 0, data: "abcd", fail: true, wantOffset: 4},
+			{offset: 4, data: "ef", wantOffset: 6},
+		}, "abcdef"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMemorySessionRepository()
+			uploads, err := NewUploadService(repo, nil, t.TempDir(), time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			session := &models.UploadSession{UploadedBy: owner, Filename: "video.mp4", Length: tt.length, ExpiresAt: time.Now().Add(time.Hour)}
+			repo.Create(session)
+
+			for i, c := range tt.chunks {
+				var body io.Reader = strings.NewReader(c.data)
+				if c.fail {
+					body = failingReader{body}
+				}
+				got, err := uploads.AppendChunk(session.ID, owner, c.offset, body)
+				if c.wantErr != nil {
+					if !errors.Is(err, c.wantErr) {
+						t.Fatalf("chunk %d: error = %v, want %v", i, err, c.wantErr)
+					}
+				} else if (err != nil) != c.fail {
+					t.Fatalf("chunk %d: error = %v, want error %v", i, err, c.fail)
+				}
+				if got == nil || got.Offset != c.wantOffset {
+					t.Fatalf("chunk %d: session = %+v, want offset %d", i, got, c.wantOffset)
+				}
+				if repo.locked[session.ID] {
+					t.Fatalf("chunk %d: upload left locked", i)
+				}
+			}
+
+			received, err := os.ReadFile(uploads.(*uploadService).partPath(session.ID))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(received) != tt.want {
+				t.Errorf("received %q, want %q", received, tt.want)
+			}
+		})
+	}
+}
+
+func TestUploadServiceAppendChunkResumesFromDisk(t *testing.T) {
+	// Bytes written before recording the offset failed still count
+	owner := uuid.New()
+	repo := newMemorySessionRepository()
+	uploads, _ := NewUploadService(repo, nil, t.TempDir(), time.Hour)
+	session := &models.UploadSession{UploadedBy: owner, Filename: "video.mp4", Length: 10, ExpiresAt: time.Now().Add(time.Hour)}
+	repo.Create(session)
+	if err := os.WriteFile(uploads.(*uploadService).partPath(session.ID), []byte("abcd"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := uploads.AppendChunk(session.ID, owner, 0, strings.NewReader("abcd"))
+	if !errors.Is(err, ErrUploadOffsetMismatch) || got.Offset != 4 {
+		t.Fatalf("AppendChunk at 0 = %+v, %v; want offset 4 and %v", got, err, ErrUploadOffsetMismatch)
+	}
+	if got, err := uploads.AppendChunk(session.ID, owner, 4, strings.NewReader("ef")); err != nil || got.Offset != 6 {
+		t.Fatalf("AppendChunk at 4 = %+v, %v; want offset 6", got, err)
+	}
+}
+
+func TestUploadServiceAppendChunkAccess(t *testing.T) {
+	owner := uuid.New()
+	fileID := uuid.New()
+	tests := []struct {
+		name    string
+		session models.UploadSession
+		user    uuid.UUID
+		offset  int64
+		wantErr error
+	}{
+		{"other user", models.UploadSession{UploadedBy: owner, Length: 10, ExpiresAt: time.Now().Add(time.Hour)}, uuid.New(), 0, ErrUploadNotFound},
+		{"expired", models.UploadSession{UploadedBy: owner, Length: 10, ExpiresAt: time.Now().Add(-time.Minute)}, owner, 0, ErrUploadNotFound},
+		{"complete, at the end", models.UploadSession{UploadedBy: owner, Length: 10, Offset: 10, FileID: &fileID, ExpiresAt: time.Now().Add(time.Hour)}, owner, 10, nil},
+		{"complete, elsewhere", models.UploadSession{UploadedBy: owner, Length: 10, Offset: 10, FileID: &fileID, ExpiresAt: time.Now().Add(time.Hour)}, owner, 3, ErrUploadOffsetMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMemorySessionRepository()
+			uploads, _ := NewUploadService(repo, nil, t.TempDir(), time.Hour)
+			session := tt.session
+			repo.Create(&session)
+			_, err := uploads.AppendChunk(session.ID, tt.user, tt.offset, strings.NewReader("x"))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("AppendChunk error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUploadServiceDeleteUpload(t *testing.T) {
+	owner := uuid.New()
+	repo := newMemorySessionRepository()
+	uploads, _ := NewUploadService(repo, nil, t.TempDir(), time.Hour)
+	session := &models.UploadSession{UploadedBy: owner, Length: 10, ExpiresAt: time.Now().Add(time.Hour)}
+	repo.Create(session)
+	uploads.AppendChunk(session.ID, owner, 0, strings.NewReader("abc"))
+
+	if err := uploads.DeleteUpload(session.ID, uuid.New()); !errors.Is(err, ErrUploadNotFound) {
+		t.Fatalf("DeleteUpload by another user = %v, want %v", err, ErrUploadNotFound)
+	}
+	if err := uploads.DeleteUpload(session.ID, owner); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(uploads.(*uploadService).partPath(session.ID)); !os.IsNotExist(err) {
+		t.Errorf("received bytes were kept: %v", err)
+	}
+	if _, err := uploads.GetUpload(session.ID, owner); !errors.Is(err, ErrUploadNotFound) {
+		t.Errorf("GetUpload after delete = %v, want %v", err, ErrUploadNotFound)
+	}
+}
@@ -1,6 +1,8 @@
 package service
 
 import (
+	"errors"
+	"log"
 	"mellon-harmony-api/internal/models"
 	"mellon-harmony-api/internal/repository"
 
@@ -8,19 +10,42 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// ErrWrongCurrentPassword is returned by UpdatePassword when the current password does not match.
+var ErrWrongCurrentPassword = errors.New("la contraseña actual no es correcta")
+
 type UserService interface {
 	GetUser(id uuid.UUID) (*models.User, error)
 	GetAllUsers() ([]models.User, error)
-	UpdateUser(id uuid.UUID, name, email *string, role *models.UserRole, avatar *string) (*models.User, error)
-	DeleteUser(id uuid.UUID) error
+	UpdateUser(id uuid.UUID, name, email *string, role *models.UserRole, avatar *string, meta models.AuditMeta) (*models.User, error)
+	DeleteUser(id uuid.UUID, meta models.AuditMeta) error
+	GetUserSessions(id uuid.UUID) ([]models.Session, error)
+	// RevokeAllSessions signs the user out of every device and revokes their personal access tokens.
+	RevokeAllSessions(id uuid.UUID) error
+	UnlockUser(id uuid.UUID, meta models.AuditMeta) error
+	// UpdatePassword changes the user's own password and signs out every other session.
+	UpdatePassword(id uuid.UUID, currentPassword, newPassword string, keepSessionID uuid.UUID) error
 }
 
 type userService struct {
-	userRepo repository.UserRepository
+	userRepo          repository.UserRepository
+	sessionRepo       repository.SessionRepository
+	apiTokenRepo      repository.APITokenRepository
+	emailVerification EmailVerificationService
+	passwordPolicy    *PasswordPolicy
+	fileService       *FileService
+	auditService      AuditService
 }
 
-func NewUserService(userRepo repository.UserRepository) UserService {
-	return &userService{userRepo: userRepo}
+func NewUserService(userRepo repository.UserRepository, sessionRepo repository.SessionRepository, apiTokenRepo repository.APITokenRepository, emailVerification EmailVerificationService, passwordPolicy *PasswordPolicy, fileService *FileService, auditService AuditService) UserService {
+	return &userService{
+		userRepo:          userRepo,
+		sessionRepo:       sessionRepo,
+		apiTokenRepo:      apiTokenRepo,
+		emailVerification: emailVerification,
+		passwordPolicy:    passwordPolicy,
+		fileService:       fileService,
+		auditService:      auditService,
+	}
 }
 
 func (s *userService) GetUser(id uuid.UUID) (*models.User, error) {
@@ -44,20 +69,29 @@ func (s *userService) GetAllUsers() ([]models.User, error) {
 	return users, nil
 }
 
-func (s *userService) UpdateUser(id uuid.UUID, name, email *string, role *models.UserRole, avatar *string) (*models.User, error) {
+func (s *userService) UpdateUser(id uuid.UUID, name, email *string, role *models.UserRole, avatar *string, meta models.AuditMeta) (*models.User, error) {
 	user, err := s.userRepo.GetByID(id)
 	if err != nil {
 		return nil, err
 	}
+	before := auditSnapshot(user)
+	action := models.AuditUpdate
 
 	if name != nil {
 		user.Name = *name
 	}
-	if email != nil {
+	emailChanged := email != nil && *email != user.Email
+	if emailChanged {
 		user.Email = *email
+		// Outstanding reset links were meant for the old address
+		user.PasswordResetToken = nil
+		user.PasswordResetExpiresAt = nil
 	}
-	if role != nil {
+	if role != nil && *role != user.Role {
 		user.Role = *role
+		// Force access tokens to be re-issued so the old role claim stops being accepted
+		user.TokenVersion++
+		action = models.AuditRoleChange
 	}
 	if avatar != nil {
 		user.Avatar = avatar
@@ -66,26 +100,97 @@ func (s *userService) UpdateUser(id uuid.UUID, name, email *string, role *models
 	if err := s.userRepo.Update(user); err != nil {
 		return nil, err
 	}
+	if avatar != nil {
+		s.fileService.LinkFileURL(models.FileOwnerUser, id, user.Avatar)
+	}
+	s.auditService.Record(meta, action, "user", id.String(), before, auditSnapshot(user))
+
+	// A new address must be verified before account emails are sent to it
+	if emailChanged && s.emailVerification != nil {
+		if err := s.emailVerification.StartVerification(user); err != nil {
+			return nil, err
+		}
+	}
 
 	user.Password = ""
 	return user, nil
 }
 
-func (s *userService) DeleteUser(id uuid.UUID) error {
-	return s.userRepo.Delete(id)
+func (s *userService) DeleteUser(id uuid.UUID, meta models.AuditMeta) error {
+	user, err := s.userRepo.GetByID(id)
+	if err != nil {
+		return err
+	}
+	if err := s.userRepo.Delete(id); err != nil {
+		return err
+	}
+	s.auditService.Record(meta, models.AuditDelete, "user", id.String(), auditSnapshot(user), nil)
+	return s.revokeAccess(id)
+}
+
+func (s *userService) GetUserSessions(id uuid.UUID) ([]models.Session, error) {
+	return s.sessionRepo.GetActiveByUserID(id)
 }
 
-func (s *userService) UpdatePassword(id uuid.UUID, newPassword string) error {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+func (s *userService) RevokeAllSessions(id uuid.UUID) error {
+	if _, err := s.userRepo.GetByID(id); err != nil {
+		return err
+	}
+	return s.revokeAccess(id)
+}
+
+// revokeAccess revokes every session and personal access token of the user.
+func (s *userService) revokeAccess(id uuid.UUID) error {
+	if err := s.sessionRepo.RevokeAllForUser(id); err != nil {
+		return err
+	}
+	return s.apiTokenRepo.RevokeAllForUser(id)
+}
+
+// UnlockUser lifts a failed-login lockout and resets the attempt counter.
+func (s *userService) UnlockUser(id uuid.UUID, meta models.AuditMeta) error {
+	user, err := s.userRepo.GetByID(id)
 	if err != nil {
 		return err
 	}
+	if err := s.userRepo.ResetFailedLogins(id); err != nil {
+		return err
+	}
+	before := auditSnapshot(map[string]interface{}{"locked_until": user.LockedUntil, "failed_login_attempts": user.FailedLoginAttempts})
+	after := map[string]interface{}{"locked_until": nil, "failed_login_attempts": float64(0)}
+	s.auditService.Record(meta, models.AuditAccountUnlocked, "user", id.String(), before, after)
+	return nil
+}
 
+func (s *userService) UpdatePassword(id uuid.UUID, currentPassword, newPassword string, keepSessionID uuid.UUID) error {
 	user, err := s.userRepo.GetByID(id)
 	if err != nil {
 		return err
 	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(currentPassword)); err != nil {
+		return ErrWrongCurrentPassword
+	}
+	if s.passwordPolicy != nil {
+		if err := s.passwordPolicy.Validate(newPassword, user.Email, user.Name); err != nil {
+			return err
+		}
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
 
 	user.Password = string(hashedPassword)
-	return s.userRepo.Update(user)
+	if err := s.userRepo.Update(user); err != nil {
+		return err
+	}
+	// Like a reset, other devices and personal access tokens must not outlive the old password
+	if err := s.sessionRepo.RevokeAllForUserExcept(id, keepSessionID); err != nil {
+		log.Printf("Failed to revoke sessions for %s after password change: %v", id, err)
+	}
+	if err := s.apiTokenRepo.RevokeAllForUser(id); err != nil {
+		log.Printf("Failed to revoke API tokens for %s after password change: %v", id, err)
+	}
+	return nil
 }
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"errors"
+	"mellon-harmony-api/internal/models"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestUserServiceUpdatePassword(t *testing.T) {
+	policy, err := NewPasswordPolicy(PasswordPolicyConfig{MinLength: 10, MinClasses: 3, DisallowPersonalInfo: true, CheckBreached: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		current  string
+		password string
+		wantErr  error
+	}{
+		{"valid", "Old-Passw0rd", "Tr1angle-Sky", nil},
+		{"wrong current password", "wrong", "Tr1angle-Sky", ErrWrongCurrentPassword},
+		{"too weak", "Old-Passw0rd", "sky", ErrPasswordPolicy},
+		{"contains the name", "Old-Passw0rd", "Xx-Garcia-2026", ErrPasswordPolicy},
+		{"breached", "Old-Passw0rd", "Password123", ErrPasswordPolicy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hashed, _ := bcrypt.GenerateFromPassword([]byte("Old-Passw0rd"), bcrypt.MinCost)
+			user := &models.User{Name: "Ana Garcia", Email: "ana@example.com", Password: string(hashed)}
+			users := newMemoryUserRepository(user)
+			sessions := newMemoryLoginSessionRepository()
+			current := &models.Session{UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}
+			other := &models.Session{UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}
+			sessions.Create(current)
+			sessions.Create(other)
+			tokens := newMemoryAPITokenRepository()
+			token := &models.APIToken{UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}
+			tokens.Create(token)
+			s := NewUserService(users, sessions, tokens, nil, policy, nil, nil)
+
+			err := s.UpdatePassword(user.ID, tt.current, tt.password, current.ID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UpdatePassword error = %v, want %v", err, tt.wantErr)
+			}
+
+			changed := bcrypt.CompareHashAndPassword([]byte(users.users[user.ID].Password), []byte(tt.password)) == nil
+			if changed != (tt.wantErr == nil) {
+				t.Errorf("password changed = %v, want %v", changed, tt.wantErr == nil)
+			}
+			if sessions.sessions[current.ID].RevokedAt != nil {
+				t.Error("the session that changed the password was signed out")
+			}
+			if revoked := sessions.sessions[other.ID].RevokedAt != nil; revoked != changed {
+				t.Errorf("other session revoked = %v, want %v", revoked, changed)
+			}
+			if revoked := tokens.tokens[token.ID].RevokedAt != nil; revoked != changed {
+				t.Errorf("personal access token revoked = %v, want %v", revoked, changed)
+			}
+		})
+	}
+}
+
+func TestUserServiceUpdatePasswordUnknownUser(t *testing.T) {
+	s := NewUserService(newMemoryUserRepository(), newMemoryLoginSessionRepository(), newMemoryAPITokenRepository(), nil, nil, nil, nil)
+	if err := s.UpdatePassword(uuid.New(), "a", "b", uuid.New()); err == nil {
+		t.Error("UpdatePassword for an unknown user succeeded")
+	}
+}
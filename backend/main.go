@@ -6,9 +6,11 @@ import (
 	"mellon-harmony-api/internal/database"
 	"mellon-harmony-api/internal/handlers"
 	"mellon-harmony-api/internal/middleware"
+	"mellon-harmony-api/internal/models"
 	"mellon-harmony-api/internal/repository"
 	"mellon-harmony-api/internal/service"
 	"strings"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -66,6 +68,15 @@ func main() {
 	clientMemberRepo := repository.NewClientMemberRepository(db)
 	projectRepo := repository.NewProjectRepository(db)
 	notificationRepo := repository.NewNotificationRepository(db)
+	sessionRepo := repository.NewSessionRepository(db)
+	oidcStateRepo := repository.NewOIDCStateRepository(db)
+	invitationRepo := repository.NewInvitationRepository(db)
+	apiTokenRepo := repository.NewAPITokenRepository(db)
+	roleRepo := repository.NewRoleRepository(db)
+	auditRepo := repository.NewAuditRepository(db)
+	fileRepo := repository.NewFileRepository(db)
+	uploadSessionRepo := repository.NewUploadSessionRepository(db)
+	searchRepo := repository.NewSearchRepository(db)
 
 	// Initialize email service for password reset
 	emailService := service.NewEmailService(service.EmailConfig{
@@ -77,26 +88,129 @@ func main() {
 		FromName: cfg.SMTPFromName,
 	})
 
+	emailVerificationService := service.NewEmailVerificationService(userRepo, emailService, cfg.FrontendURL)
+
+	passwordPolicy, err := service.NewPasswordPolicy(service.PasswordPolicyConfig{
+		MinLength:            cfg.PasswordMinLength,
+		MinClasses:           cfg.PasswordMinCharClasses,
+		DisallowPersonalInfo: cfg.PasswordDisallowPersonalInfo,
+		CheckBreached:        cfg.PasswordCheckBreached,
+		BreachListPath:       cfg.PasswordBreachList,
+	})
+	if err != nil {
+		log.Fatalf("Failed to load password policy: %v", err)
+	}
+
+	// Roles that must use two-factor authentication (TWO_FACTOR_REQUIRED_ROLES)
+	var twoFactorRoles []models.UserRole
+	for _, role := range cfg.TwoFactorRequiredRoles {
+		twoFactorRoles = append(twoFactorRoles, models.UserRole(role))
+	}
+
 	// Initialize services
-	authService := service.NewAuthService(userRepo, cfg.JWTSecret, emailService, cfg.FrontendURL)
-	userService := service.NewUserService(userRepo)
+	auditService := service.NewAuditService(auditRepo)
+	authService := service.NewAuthService(userRepo, sessionRepo, apiTokenRepo, emailService, emailVerificationService, service.AuthConfig{
+		JWTSecret:       cfg.JWTSecret,
+		FrontendURL:     cfg.FrontendURL,
+		AccessTokenTTL:  cfg.AccessTokenTTL,
+		RefreshTokenTTL: cfg.RefreshTokenTTL,
+
+		TwoFactorRequiredRoles: twoFactorRoles,
+
+		PasswordLoginDisabledDomains: cfg.PasswordLoginDisabledDomains,
+		DisablePublicRegistration:    !cfg.PublicRegistrationEnabled,
+		Lockout: service.LockoutPolicy{
+			Threshold:    cfg.LockoutThreshold,
+			BaseDuration: cfg.LockoutBaseDuration,
+			MaxDuration:  cfg.LockoutMaxDuration,
+		},
+		PasswordPolicy: passwordPolicy,
+		Audit:          auditService,
+	})
+	oidcService := service.NewOIDCService(service.OIDCConfig{
+		IssuerURL:      cfg.OIDCIssuerURL,
+		ClientID:       cfg.OIDCClientID,
+		ClientSecret:   cfg.OIDCClientSecret,
+		RedirectURL:    cfg.OIDCRedirectURL,
+		Scopes:         cfg.OIDCScopes,
+		AutoProvision:  cfg.OIDCAutoProvision,
+		AllowedDomains: cfg.OIDCAllowedDomains,
+	}, userRepo, oidcStateRepo)
+	storage, err := service.NewStorage(service.StorageConfig{
+		Driver:   cfg.StorageDriver,
+		LocalDir: cfg.UploadDir,
+		S3: service.S3Config{
+			Endpoint:        cfg.S3Endpoint,
+			Region:          cfg.S3Region,
+			Bucket:          cfg.S3Bucket,
+			AccessKeyID:     cfg.S3AccessKeyID,
+			SecretAccessKey: cfg.S3SecretAccessKey,
+			UseSSL:          cfg.S3UseSSL,
+			Prefix:          cfg.S3Prefix,
+		},
+	})
+	if err != nil {
+		log.Fatalf("Failed to initialize file storage: %v", err)
+	}
+	scanner, err := service.NewScanner(service.ScannerConfig{
+		Driver:       cfg.ScannerDriver,
+		ClamdAddress: cfg.ClamdAddress,
+		Timeout:      cfg.ScanTimeout,
+	})
+	if err != nil {
+		log.Fatalf("Failed to initialize virus scanner: %v", err)
+	}
+	fileService := service.NewFileService(storage, fileRepo, scanner, service.UploadLimits{
+		Attachment:  cfg.UploadMaxAttachmentSize,
+		Avatar:      cfg.UploadMaxAvatarSize,
+		ClientLogo:  cfg.UploadMaxClientLogoSize,
+		ClientQuota: cfg.ClientStorageQuota,
+	})
+	// Unreferenced uploads (never attached, removed from an issue, or whose issue was deleted) are deleted after a grace period
+	fileService.StartSweeper(cfg.FileSweepInterval, cfg.FileOrphanGrace)
+	uploadService, err := service.NewUploadService(uploadSessionRepo, fileService, cfg.UploadTempDir, cfg.UploadSessionTTL)
+	if err != nil {
+		log.Fatalf("Failed to initialize resumable uploads: %v", err)
+	}
+	uploadService.StartCleanup(time.Hour)
+	apiTokenService := service.NewAPITokenService(apiTokenRepo, userRepo, auditService)
+	permissionService := service.NewPermissionService(roleRepo, userRepo, auditService)
+	userService := service.NewUserService(userRepo, sessionRepo, apiTokenRepo, emailVerificationService, passwordPolicy, fileService, auditService)
 	notificationService := service.NewNotificationService(notificationRepo)
-	issueService := service.NewIssueService(issueRepo, userRepo)
-	commentService := service.NewCommentService(commentRepo, userRepo, issueRepo, notificationService)
-	clientService := service.NewClientService(clientRepo, userRepo, clientMemberRepo)
-	projectService := service.NewProjectService(projectRepo, userRepo, clientMemberRepo, clientRepo)
-	fileService := service.NewFileService(cfg.UploadDir)
+	issueService := service.NewIssueService(issueRepo, userRepo, clientMemberRepo, projectRepo, permissionService, fileService, auditService)
+	searchService := service.NewSearchService(searchRepo, permissionService)
+	commentService := service.NewCommentService(commentRepo, userRepo, issueRepo, notificationService, permissionService, fileService, auditService)
+	clientService := service.NewClientService(clientRepo, userRepo, clientMemberRepo, fileService, auditService)
+	projectService := service.NewProjectService(projectRepo, userRepo, clientMemberRepo, clientRepo, auditService)
+	fileURLSigner := service.NewFileURLSigner(cfg.FileURLSecret, cfg.FileURLTTL, cfg.PublicImages)
+	invitationService := service.NewInvitationService(invitationRepo, userRepo, clientRepo, clientMemberRepo, permissionService, emailService, service.InvitationConfig{
+		FrontendURL: cfg.FrontendURL,
+		TTL:         cfg.InvitationTTL,
+
+		PasswordPolicy: passwordPolicy,
+	})
 
 	// Initialize handlers
-	authHandler := handlers.NewAuthHandlerWithUserService(authService, userService)
-	userHandler := handlers.NewUserHandler(userService, userRepo)
+	authHandler := handlers.NewAuthHandlerWithUserService(authService, userService, fileURLSigner)
+	oidcHandler := handlers.NewOIDCHandler(authService, oidcService, cfg.FrontendURL, fileURLSigner)
+	invitationHandler := handlers.NewInvitationHandler(invitationService, authService, userRepo, permissionService, fileURLSigner)
+	emailVerificationHandler := handlers.NewEmailVerificationHandler(emailVerificationService)
+	apiTokenHandler := handlers.NewAPITokenHandler(apiTokenService)
+	roleHandler := handlers.NewRoleHandler(permissionService, userRepo)
+	userHandler := handlers.NewUserHandler(userService, userRepo, permissionService, fileURLSigner)
 	notificationHandler := handlers.NewNotificationHandler(notificationService)
-	issueHandler := handlers.NewIssueHandler(issueService, userRepo, notificationService, projectRepo)
-	commentHandler := handlers.NewCommentHandler(commentService)
-	clientHandler := handlers.NewClientHandler(clientService, userRepo, notificationService, clientMemberRepo)
-	projectHandler := handlers.NewProjectHandler(projectService, userRepo, notificationService, projectRepo, clientMemberRepo)
-	fileHandler := handlers.NewFileHandler(fileService)
-	reportHandler := handlers.NewReportHandler(clientRepo, projectRepo, userRepo)
+	issueHandler := handlers.NewIssueHandler(issueService, userRepo, notificationService, projectRepo, permissionService, fileURLSigner)
+	commentHandler := handlers.NewCommentHandler(commentService, issueService, userRepo, fileURLSigner)
+	clientHandler := handlers.NewClientHandler(clientService, userRepo, notificationService, clientMemberRepo, permissionService, fileURLSigner)
+	projectHandler := handlers.NewProjectHandler(projectService, userRepo, notificationService, projectRepo, clientMemberRepo, permissionService, fileURLSigner)
+	fileHandler := handlers.NewFileHandler(fileService, fileURLSigner, userRepo, clientMemberRepo, projectRepo, permissionService)
+	uploadHandler := handlers.NewUploadHandler(uploadService, fileURLSigner, userRepo, clientMemberRepo, projectRepo, permissionService)
+	reportHandler := handlers.NewReportHandler(clientRepo, projectRepo)
+	auditHandler := handlers.NewAuditHandler(auditService, fileURLSigner)
+	archiveHandler := handlers.NewArchiveHandler(issueService, fileService, userRepo, projectRepo, clientRepo)
+	attachmentVersionHandler := handlers.NewAttachmentVersionHandler(issueService, fileURLSigner, userRepo)
+	searchHandler := handlers.NewSearchHandler(searchService, userRepo)
+	storageHandler := handlers.NewStorageHandler(fileService, clientService, userRepo, clientMemberRepo, permissionService)
 
 	// Setup router
 	router := gin.Default()
@@ -121,9 +235,9 @@ func main() {
 	}
 	// Allow all origins in development, or specific origins in production
 	corsConfig := cors.Config{
-		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"},
+		AllowHeaders:     append([]string{"Origin", "Content-Type", "Accept", "Authorization", middleware.RequestIDHeader}, handlers.TusRequestHeaders...),
+		ExposeHeaders:    append(append([]string{"Content-Length", middleware.RequestIDHeader}, handlers.TusResponseHeaders...), handlers.ListResponseHeaders...),
 		AllowCredentials: true,
 		MaxAge:           12 * 3600, // 12 hours
 	}
@@ -137,6 +251,7 @@ func main() {
 	
 	router.Use(cors.New(corsConfig))
 	router.Use(middleware.SecureHeaders())
+	router.Use(middleware.RequestID())
 
 	// Health check
 	router.GET("/health", func(c *gin.Context) {
@@ -154,25 +269,75 @@ func main() {
 			authGroup.POST("/register", authHandler.Register)
 			authGroup.POST("/forgot-password", authHandler.ForgotPassword)
 			authGroup.POST("/reset-password", authHandler.ResetPassword)
+			authGroup.POST("/verify-email", emailVerificationHandler.VerifyEmail)
+			authGroup.POST("/2fa/verify", authHandler.VerifyTwoFactor)
+			authGroup.POST("/2fa/setup-challenge", authHandler.SetupTwoFactorChallenge)
+			authGroup.GET("/oidc/login", oidcHandler.Login)
+			authGroup.GET("/oidc/callback", oidcHandler.Callback)
+			authGroup.POST("/oidc/exchange", oidcHandler.Exchange)
+			authGroup.GET("/invitations/:token", invitationHandler.GetInvitationByToken)
+			authGroup.POST("/invitations/:token/accept", invitationHandler.AcceptInvitation)
 		}
-		// Serve uploaded files (avatars, logos, attachments) without auth so <img> tags can load
+		api.GET("/auth/oidc/config", oidcHandler.Config)
+		// Refresh is outside the auth rate limit: clients call it every few minutes and the
+		// refresh token itself is a 256-bit random secret, so it cannot be brute forced.
+		api.POST("/auth/refresh", authHandler.Refresh)
+		// Serve uploaded files without auth so <img> tags can load; non-public files need a signed URL
 		api.GET("/files/*path", fileHandler.ServeFile)
 	}
 
 	// Protected routes (with audit logging for sensitive actions)
 	protected := api.Group("")
-	protected.Use(middleware.AuthMiddleware(cfg.JWTSecret))
-	protected.Use(middleware.AuditLog())
+	protected.Use(middleware.AuthMiddleware(cfg.JWTSecret, authService, apiTokenService))
+	protected.Use(middleware.AuditLog(auditService))
 	{
 		// Auth routes
 		protected.GET("/auth/me", authHandler.GetMe)
 		protected.POST("/auth/logout", authHandler.Logout)
+		protected.PUT("/auth/password", authHandler.ChangePassword)
+		protected.POST("/auth/verify-email/resend", emailVerificationHandler.ResendVerification)
+		protected.GET("/auth/sessions", authHandler.ListSessions)
+		protected.DELETE("/auth/sessions", authHandler.RevokeOtherSessions)
+		protected.DELETE("/auth/sessions/:id", authHandler.RevokeSession)
+		protected.POST("/auth/2fa/setup", authHandler.SetupTwoFactor)
+		protected.POST("/auth/2fa/enable", authHandler.EnableTwoFactor)
+		protected.POST("/auth/2fa/disable", authHandler.DisableTwoFactor)
+		protected.POST("/auth/2fa/recovery-codes", authHandler.RegenerateRecoveryCodes)
+		protected.GET("/auth/tokens", apiTokenHandler.ListTokens)
+		protected.POST("/auth/tokens", apiTokenHandler.CreateToken)
+		protected.DELETE("/auth/tokens/:id", apiTokenHandler.RevokeToken)
 
 		// User routes
 		protected.GET("/users", userHandler.GetUsers)
 		protected.GET("/users/:id", userHandler.GetUser)
 		protected.PUT("/users/:id", userHandler.UpdateUser)
 		protected.DELETE("/users/:id", userHandler.DeleteUser)
+		protected.GET("/users/:id/sessions", userHandler.GetUserSessions)
+		protected.DELETE("/users/:id/sessions", userHandler.RevokeUserSessions)
+		protected.POST("/users/:id/unlock", userHandler.UnlockUser)
+
+		// Role and permission routes (editing requires role.manage)
+		protected.GET("/permissions", roleHandler.GetPermissions)
+		protected.GET("/roles", roleHandler.GetRoles)
+		protected.POST("/roles", middleware.RequirePermission(permissionService, models.PermRoleManage), roleHandler.CreateRole)
+		protected.PUT("/roles/:name", middleware.RequirePermission(permissionService, models.PermRoleManage), roleHandler.UpdateRole)
+		protected.DELETE("/roles/:name", middleware.RequirePermission(permissionService, models.PermRoleManage), roleHandler.DeleteRole)
+
+		// Audit log routes (require audit.view)
+		protected.GET("/audit", middleware.RequirePermission(permissionService, models.PermAuditView), auditHandler.GetEvents)
+		protected.GET("/audit/export", middleware.RequirePermission(permissionService, models.PermAuditView), auditHandler.ExportEvents)
+
+		// Storage usage of every client (requires storage.manage)
+		protected.GET("/storage", middleware.RequirePermission(permissionService, models.PermStorageManage), storageHandler.GetStorageOverview)
+
+		// Invitation routes (admins and team leads)
+		protected.GET("/invitations", invitationHandler.GetInvitations)
+		protected.POST("/invitations", invitationHandler.CreateInvitation)
+		protected.POST("/invitations/:id/resend", invitationHandler.ResendInvitation)
+		protected.DELETE("/invitations/:id", invitationHandler.RevokeInvitation)
+
+		// Search
+		protected.GET("/search", searchHandler.Search)
 
 		// Issue routes
 		protected.GET("/issues", issueHandler.GetIssues)
@@ -181,6 +346,10 @@ func main() {
 		protected.PUT("/issues/:id", issueHandler.UpdateIssue)
 		protected.PATCH("/issues/:id/status", issueHandler.UpdateIssueStatus)
 		protected.DELETE("/issues/:id", issueHandler.DeleteIssue)
+		protected.GET("/issues/:id/attachments.zip", archiveHandler.DownloadIssueAttachments)
+		protected.GET("/issues/:id/attachments/:fileId/versions", attachmentVersionHandler.ListVersions)
+		protected.POST("/issues/:id/attachments/:fileId/versions", attachmentVersionHandler.UploadVersion)
+		protected.POST("/issues/:id/attachments/:fileId/versions/:versionId/restore", attachmentVersionHandler.RestoreVersion)
 
 		// Comment routes
 		protected.GET("/issues/:id/comments", commentHandler.GetComments)
@@ -193,8 +362,11 @@ func main() {
 		protected.GET("/clients/:id/members", clientHandler.GetClientMembers)
 		protected.POST("/clients/:id/members", clientHandler.AddClientMember)
 		protected.DELETE("/clients/:id/members/:userId", clientHandler.RemoveClientMember)
-		protected.GET("/clients/:id/reports", reportHandler.DownloadClientReportFiltered)
-		protected.GET("/clients/:id/reports/:type", reportHandler.DownloadClientReport)
+		protected.GET("/clients/:id/reports", middleware.RequirePermission(permissionService, models.PermReportDownload), reportHandler.DownloadClientReportFiltered)
+		protected.GET("/clients/:id/reports/:type", middleware.RequirePermission(permissionService, models.PermReportDownload), reportHandler.DownloadClientReport)
+		protected.GET("/clients/:id/attachments.zip", archiveHandler.DownloadClientAttachments)
+		protected.GET("/clients/:id/storage", storageHandler.GetClientStorage)
+		protected.PUT("/clients/:id/storage", middleware.RequirePermission(permissionService, models.PermStorageManage), storageHandler.UpdateClientStorageQuota)
 		protected.GET("/clients/:id", clientHandler.GetClient)
 		protected.POST("/clients", clientHandler.CreateClient)
 		protected.PUT("/clients/:id", clientHandler.UpdateClient)
@@ -204,6 +376,7 @@ func main() {
 		protected.GET("/projects", projectHandler.GetProjects)
 		protected.POST("/projects/bulk-monthly", projectHandler.BulkCreateMonthly)
 		protected.GET("/projects/:id", projectHandler.GetProject)
+		protected.GET("/projects/:id/attachments.zip", archiveHandler.DownloadProjectAttachments)
 		protected.POST("/projects", projectHandler.CreateProject)
 		protected.PUT("/projects/:id", projectHandler.UpdateProject)
 		protected.DELETE("/projects/:id", projectHandler.DeleteProject)
@@ -219,6 +392,12 @@ func main() {
 
 		// File routes (upload requires auth; GET is public above)
 		protected.POST("/files/upload", fileHandler.UploadFile)
+		// Resumable (tus) uploads for large files
+		protected.POST("/uploads", uploadHandler.CreateUpload)
+		protected.HEAD("/uploads/:id", uploadHandler.UploadOffset)
+		protected.PATCH("/uploads/:id", uploadHandler.AppendChunk)
+		protected.GET("/uploads/:id", uploadHandler.GetUpload)
+		protected.DELETE("/uploads/:id", uploadHandler.DeleteUpload)
 	}
 
 	// Start server
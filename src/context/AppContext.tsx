@@ -452,9 +452,7 @@ export function AppProvider({ children }: { children: ReactNode }) {
     try {
       const response = await api.login(email, password);
       if (response.token && response.user) {
-        if (typeof window !== 'undefined') {
-          localStorage.setItem('token', response.token);
-        }
+        api.storeTokens(response.token, response.refresh_token);
         setUser({
           id: response.user.id,
           name: response.user.name,
@@ -473,9 +471,8 @@ export function AppProvider({ children }: { children: ReactNode }) {
   };
 
   const logout = () => {
-    if (typeof window !== 'undefined') {
-      localStorage.removeItem('token');
-    }
+    // Revoke the session server-side; tokens are cleared locally even if the request fails
+    api.logout().catch(() => {});
     setUser(null);
     setUseApi(false);
   };
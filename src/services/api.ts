@@ -55,6 +55,9 @@ const getApiBaseUrl = () => {
 
 const API_BASE_URL = getApiBaseUrl();
 
+// Rows per request when loading a whole list; the API returns at most 200 (50 by default)
+const LIST_PAGE_SIZE = 200;
+
 // Export function to check if API URL is configured correctly
 export const isApiUrlConfigured = (): boolean => {
   if (typeof window === 'undefined') return true; // Server-side, assume configured
@@ -83,6 +86,7 @@ export interface ApiUser {
   email: string;
   role: 'user' | 'admin' | 'team_lead';
   avatar?: string;
+  email_verified_at?: string | null;
   created_at: string;
 }
 
@@ -90,6 +94,38 @@ export interface ApiAttachment {
   type: 'link' | 'image' | 'file';
   url: string;
   name?: string;
+  file_id?: string;
+  // Uploads are only downloadable once the virus scan found them clean
+  scan_status?: 'pending' | 'clean' | 'infected' | 'too_large';
+  // Number of versions of an uploaded file; the attachment is the latest one
+  versions?: number;
+}
+
+export interface ApiAttachmentVersion {
+  id: string;
+  path: string;
+  signed_path: string;
+  name: string;
+  type: 'image' | 'file';
+  size: number;
+  version: number;
+  current: boolean;
+  uploaded_by: string;
+  created_at: string;
+  scan_status?: 'pending' | 'clean' | 'infected' | 'too_large';
+}
+
+export interface ApiSearchResult {
+  type: 'issue' | 'comment' | 'project' | 'client';
+  id: string;
+  // HTML-escaped, with the matched words in <mark>
+  title: string;
+  snippet?: string;
+  rank: number;
+  issue_id?: string;
+  project_id?: string;
+  client_id?: string;
+  updated_at: string;
 }
 
 export interface ApiIssue {
@@ -109,7 +145,9 @@ export interface ApiIssue {
   attachments?: ApiAttachment[];
   created_at: string;
   updated_at: string;
+  // Only in full rows (view=full); summary rows have comment_count instead
   comments?: ApiComment[];
+  comment_count?: number;
 }
 
 export interface ApiComment {
@@ -118,6 +156,8 @@ export interface ApiComment {
   user_id: string;
   text: string;
   created_at: string;
+  deleted_by_moderator?: boolean;
+  moderation_reason?: string;
   user?: {
     id: string;
     name: string;
@@ -139,6 +179,9 @@ export interface CreateIssueRequest {
 }
 
 class ApiService {
+  // Shared so concurrent 401s trigger a single refresh (the refresh token rotates on every use)
+  private refreshPromise: Promise<boolean> | null = null;
+
   private getToken(): string | null {
     if (typeof window === 'undefined') return null;
     const token = localStorage.getItem('token');
@@ -148,9 +191,48 @@ class ApiService {
     return token;
   }
 
+  /** Stores the access/refresh token pair returned by login, register and refresh. */
+  storeTokens(token: string, refreshToken?: string): void {
+    if (typeof window === 'undefined') return;
+    localStorage.setItem('token', token);
+    if (refreshToken) localStorage.setItem('refresh_token', refreshToken);
+  }
+
+  clearTokens(): void {
+    if (typeof window === 'undefined') return;
+    localStorage.removeItem('token');
+    localStorage.removeItem('refresh_token');
+  }
+
+  /** Exchanges the stored refresh token for a new pair. Returns false if the session is gone. */
+  private refreshSession(): Promise<boolean> {
+    if (this.refreshPromise) return this.refreshPromise;
+    this.refreshPromise = (async () => {
+      const refreshToken = typeof window !== 'undefined' ? localStorage.getItem('refresh_token') : null;
+      if (!refreshToken) return false;
+      try {
+        const response = await fetch(`${API_BASE_URL}/auth/refresh`, {
+          method: 'POST',
+          headers: { 'Content-Type': 'application/json' },
+          body: JSON.stringify({ refresh_token: refreshToken }),
+        });
+        if (!response.ok) return false;
+        const data = await response.json();
+        this.storeTokens(data.token, data.refresh_token);
+        return true;
+      } catch {
+        return false;
+      }
+    })().finally(() => {
+      this.refreshPromise = null;
+    });
+    return this.refreshPromise;
+  }
+
   private async request<T>(
     endpoint: string,
-    options: RequestInit = {}
+    options: RequestInit = {},
+    retried = false
   ): Promise<T> {
     const token = this.getToken();
     
@@ -169,7 +251,7 @@ class ApiService {
       headers['Authorization'] = `Bearer ${token}`;
     } else {
       // Log warning if no token for protected endpoints
-      if (endpoint !== '/auth/login' && endpoint !== '/auth/register' && endpoint !== '/auth/forgot-password' && endpoint !== '/auth/reset-password') {
+      if (endpoint !== '/auth/login' && endpoint !== '/auth/register' && endpoint !== '/auth/forgot-password' && endpoint !== '/auth/reset-password' && endpoint !== '/auth/oidc/config' && endpoint !== '/auth/oidc/exchange' && endpoint !== '/auth/verify-email' && !endpoint.startsWith('/auth/invitations/')) {
         console.warn(`No token found for request to ${endpoint}`);
       }
     }
@@ -210,10 +292,12 @@ class ApiService {
     if (!response.ok) {
       // Handle 401 Unauthorized specifically
       if (response.status === 401) {
-        // Clear invalid token
-        if (typeof window !== 'undefined') {
-          localStorage.removeItem('token');
+        // Access tokens are short-lived: try the refresh token once before giving up
+        if (!retried && !endpoint.startsWith('/auth/') && await this.refreshSession()) {
+          return this.request<T>(endpoint, options, true);
         }
+        // Clear invalid token
+        this.clearTokens();
         throw new Error('Unauthorized: Invalid or expired token');
       }
       
@@ -231,20 +315,88 @@ class ApiService {
     return response.json();
   }
 
-  async login(email: string, password: string): Promise<{ token: string; user: ApiUser }> {
-    return this.request<{ token: string; user: ApiUser }>('/auth/login', {
+  /** Loads every row of a paginated list endpoint, one page after another. */
+  private async requestAllPages<T>(endpoint: string, params = new URLSearchParams()): Promise<T[]> {
+    const rows: T[] = [];
+    params.set('limit', String(LIST_PAGE_SIZE));
+    for (let page = 1; ; page++) {
+      params.set('page', String(page));
+      const batch = await this.request<T[]>(`${endpoint}?${params.toString()}`);
+      rows.push(...batch);
+      if (batch.length < LIST_PAGE_SIZE) {
+        return rows;
+      }
+    }
+  }
+
+  async login(email: string, password: string): Promise<{ token: string; refresh_token: string; user: ApiUser }> {
+    return this.request<{ token: string; refresh_token: string; user: ApiUser }>('/auth/login', {
       method: 'POST',
       body: JSON.stringify({ email, password }),
     });
   }
 
-  async register(name: string, email: string, password: string, role?: 'user' | 'admin' | 'team_lead'): Promise<{ token: string; user: ApiUser }> {
-    return this.request<{ token: string; user: ApiUser }>('/auth/register', {
+  async logout(): Promise<void> {
+    try {
+      await this.request<{ message: string }>('/auth/logout', { method: 'POST' });
+    } finally {
+      this.clearTokens();
+    }
+  }
+
+  async register(name: string, email: string, password: string, role?: 'user' | 'admin' | 'team_lead'): Promise<{ token: string; refresh_token: string; user: ApiUser }> {
+    return this.request<{ token: string; refresh_token: string; user: ApiUser }>('/auth/register', {
       method: 'POST',
       body: JSON.stringify({ name, email, password, role: role || 'user' }),
     });
   }
 
+  async getSsoConfig(): Promise<{ enabled: boolean }> {
+    return this.request<{ enabled: boolean }>('/auth/oidc/config');
+  }
+
+  /** URL that starts the single sign-on redirect (a full-page navigation, not a fetch). */
+  ssoLoginUrl(): string {
+    return `${API_BASE_URL}/auth/oidc/login`;
+  }
+
+  /** Exchanges the single-use code from `/sso#code=...` for tokens, or a 2FA challenge. */
+  async exchangeSsoCode(code: string): Promise<
+    | { token: string; refresh_token: string; user: ApiUser }
+    | { two_factor_required: true; two_factor_setup_required: boolean; challenge_token: string }
+  > {
+    return this.request('/auth/oidc/exchange', {
+      method: 'POST',
+      body: JSON.stringify({ code }),
+    });
+  }
+
+  async getInvitation(token: string): Promise<{ email: string; role: string; inviter: string; expires_at: string }> {
+    return this.request<{ email: string; role: string; inviter: string; expires_at: string }>(`/auth/invitations/${encodeURIComponent(token)}`);
+  }
+
+  /** Creates the invited account; answers like login, with a 2FA setup challenge when the role requires it. */
+  async acceptInvitation(token: string, name: string, password: string): Promise<
+    | { token: string; refresh_token: string; user: ApiUser }
+    | { two_factor_required: true; two_factor_setup_required: boolean; challenge_token: string }
+  > {
+    return this.request(`/auth/invitations/${encodeURIComponent(token)}/accept`, {
+      method: 'POST',
+      body: JSON.stringify({ name, password }),
+    });
+  }
+
+  async verifyEmail(token: string): Promise<{ message: string; email: string }> {
+    return this.request<{ message: string; email: string }>('/auth/verify-email', {
+      method: 'POST',
+      body: JSON.stringify({ token }),
+    });
+  }
+
+  async resendEmailVerification(): Promise<void> {
+    await this.request<{ message: string }>('/auth/verify-email/resend', { method: 'POST' });
+  }
+
   async requestPasswordReset(email: string): Promise<void> {
     await this.request<{ message: string }>('/auth/forgot-password', {
       method: 'POST',
@@ -259,6 +411,14 @@ class ApiService {
     });
   }
 
+  /** Changes the signed-in user's password; every other session is signed out. */
+  async changePassword(currentPassword: string, password: string): Promise<void> {
+    await this.request<{ message: string }>('/auth/password', {
+      method: 'PUT',
+      body: JSON.stringify({ current_password: currentPassword, password }),
+    });
+  }
+
   async getMe(): Promise<ApiUser> {
     return this.request<ApiUser>('/auth/me');
   }
@@ -268,15 +428,19 @@ class ApiService {
     priority?: string;
     assigned_to?: string;
     project_id?: string;
+    // Issue query, e.g. "status:review assignee:me due<2026-11-01 logo"
+    q?: string;
   }): Promise<ApiIssue[]> {
     const params = new URLSearchParams();
     if (filters?.status) params.append('status', filters.status);
     if (filters?.priority) params.append('priority', filters.priority);
     if (filters?.assigned_to) params.append('assigned_to', filters.assigned_to);
     if (filters?.project_id) params.append('project_id', filters.project_id);
+    if (filters?.q) params.append('q', filters.q);
+    // The board shows each issue's comments, which the default summary view leaves out
+    params.append('view', 'full');
 
-    const query = params.toString();
-    return this.request<ApiIssue[]>(`/issues${query ? `?${query}` : ''}`);
+    return this.requestAllPages<ApiIssue>('/issues', params);
   }
 
   async getIssue(id: string): Promise<ApiIssue> {
@@ -297,6 +461,23 @@ class ApiService {
     });
   }
 
+  async search(q: string, options?: { type?: ApiSearchResult['type'][]; limit?: number }): Promise<ApiSearchResult[]> {
+    const params = new URLSearchParams({ q });
+    if (options?.type?.length) params.append('type', options.type.join(','));
+    if (options?.limit) params.append('limit', String(options.limit));
+    return this.request<ApiSearchResult[]>(`/search?${params.toString()}`);
+  }
+
+  async getAttachmentVersions(issueId: string, fileId: string): Promise<ApiAttachmentVersion[]> {
+    return this.request<ApiAttachmentVersion[]>(`/issues/${issueId}/attachments/${fileId}/versions`);
+  }
+
+  async restoreAttachmentVersion(issueId: string, fileId: string, versionId: string): Promise<ApiIssue> {
+    return this.request<ApiIssue>(`/issues/${issueId}/attachments/${fileId}/versions/${versionId}/restore`, {
+      method: 'POST',
+    });
+  }
+
   async updateIssueStatus(id: string, status: 'todo' | 'in-progress' | 'review' | 'done'): Promise<ApiIssue> {
     return this.request<ApiIssue>(`/issues/${id}/status`, {
       method: 'PATCH',
@@ -343,7 +524,7 @@ class ApiService {
   }
 
   async getProjects(): Promise<ApiProject[]> {
-    return this.request<ApiProject[]>('/projects');
+    return this.requestAllPages<ApiProject>('/projects');
   }
 
   async getProject(id: string): Promise<ApiProject> {
@@ -391,7 +572,7 @@ class ApiService {
 
   // Notification methods
   async getNotifications(): Promise<ApiNotification[]> {
-    return this.request<ApiNotification[]>('/notifications');
+    return this.requestAllPages<ApiNotification>('/notifications');
   }
 
   async getUnreadNotifications(): Promise<ApiNotification[]> {
@@ -418,7 +599,7 @@ class ApiService {
 
   // Client methods
   async getClients(): Promise<ApiClient[]> {
-    return this.request<ApiClient[]>('/clients');
+    return this.requestAllPages<ApiClient>('/clients');
   }
 
   async getClient(id: string): Promise<ApiClient> {
@@ -547,8 +728,11 @@ class ApiService {
     const data = await response.json();
     return {
       type: data.type as 'image' | 'file',
-      url: `${API_BASE_URL}/files/${data.path}`,
+      // signed_path loads right away; the signature is dropped by the API when the URL is saved
+      url: `${API_BASE_URL}/files/${data.signed_path || data.path}`,
       name: data.name,
+      file_id: data.id,
+      scan_status: data.scan_status,
     };
   }
 